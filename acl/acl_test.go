@@ -0,0 +1,278 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"math/rand"
+	"net"
+	"testing"
+)
+
+func randomPrefix(r *rand.Rand, is6 bool) *net.IPNet {
+	if r.Intn(4) == 0 {
+		return nil
+	}
+	n := net.IPv4len
+	if is6 {
+		n = net.IPv6len
+	}
+	// Few distinct addresses so that prefixes overlap.
+	a := make(net.IP, n)
+	a[0], a[1] = 10, byte(r.Intn(4))
+	a[n-1] = byte(r.Intn(4) << 6)
+	l := 8 + r.Intn(8*n-8+1)
+	return &net.IPNet{IP: a, Mask: net.CIDRMask(l, 8*n)}
+}
+
+func randomPorts(r *rand.Rand) (p PortRange) {
+	if r.Intn(2) == 0 {
+		return
+	}
+	p.Lo = uint16(1 + r.Intn(100))
+	p.Hi = p.Lo + uint16(r.Intn(20))
+	return
+}
+
+func randomRule(r *rand.Rand, is6 bool) (x Rule) {
+	x.Action = Action(r.Intn(3))
+	x.Src = randomPrefix(r, is6)
+	x.Dst = randomPrefix(r, is6)
+	if r.Intn(2) == 0 {
+		x.Protocol, x.HasProtocol = []ip.Protocol{ip.TCP, ip.UDP, ip.ICMP}[r.Intn(3)], true
+	}
+	x.SrcPorts = randomPorts(r)
+	x.DstPorts = randomPorts(r)
+	if r.Intn(4) == 0 {
+		x.Dscp, x.HasDscp = uint8(r.Intn(4)), true
+	}
+	if r.Intn(4) == 0 {
+		x.TcpFlagsMask = TcpFlagSyn | TcpFlagAck
+		x.TcpFlags = uint8(r.Intn(4)) << 1 & x.TcpFlagsMask
+	}
+	return
+}
+
+func randomKey(r *rand.Rand, is6 bool) (k key) {
+	n := net.IPv4len
+	if is6 {
+		n = net.IPv6len
+	}
+	for _, d := range []int{dimSrc, dimDst} {
+		a := make(net.IP, n)
+		a[0], a[1] = 10, byte(r.Intn(4))
+		a[n-1] = byte(r.Intn(256))
+		k.v[d] = addressValue(a)
+	}
+	k.v[dimProtocol].lo = uint64([]ip.Protocol{ip.TCP, ip.UDP, ip.ICMP}[r.Intn(3)])
+	k.v[dimSrcPort].lo = uint64(r.Intn(128))
+	k.v[dimDstPort].lo = uint64(r.Intn(128))
+	k.v[dimDscp].lo = uint64(r.Intn(4))
+	k.tcpFlags = uint8(r.Intn(256))
+	return
+}
+
+// Classifier must find the same matching rules in the same order as a linear scan.
+func TestClassifier(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, is6 := range []bool{false, true} {
+		rules := make([]Rule, 300)
+		for i := range rules {
+			rules[i] = randomRule(r, is6)
+		}
+		c := newClassifier(rules, is6)
+		var m match
+		for iter := 0; iter < 10000; iter++ {
+			k := randomKey(r, is6)
+			c.lookup(&k, &m)
+			i := c.next(&k, &m, 0)
+			for j := range rules {
+				if !rules[j].matches(&k, is6) {
+					continue
+				}
+				if i != j {
+					t.Fatalf("ip6 %v: key %+v: classifier rule %d, linear rule %d", is6, k, i, j)
+				}
+				i = c.next(&k, &m, i+1)
+			}
+			if i != -1 {
+				t.Fatalf("ip6 %v: key %+v: classifier rule %d does not match", is6, k, i)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var x Rule
+	s := "permit src 10.0.0.0/8 proto tcp dport 22-23 dscp 10 tcp-flags syn,!ack"
+	var in parse.Input
+	in.SetString(s)
+	if err := x.Parse(&in); err != nil {
+		t.Fatal(err)
+	}
+	want := "permit src 10.0.0.0/8 proto TCP dport 22-23 dscp 10 tcp-flags syn,!ack"
+	if got := x.String(); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	b := []byte{
+		0x45, 10 << 2, 0, 40, 0, 0, 0x40, 0, 64, byte(ip.TCP), 0, 0,
+		10, 1, 2, 3,
+		192, 168, 0, 1,
+		0x30, 0x39, 0, 22, 0, 0, 0, 0, 0, 0, 0, 0, 0x50, TcpFlagSyn, 0, 0, 0, 0, 0, 0,
+	}
+	var k key
+	if !k.setIp4(b) {
+		t.Fatal("setIp4 failed")
+	}
+	if !x.matches(&k, false) {
+		t.Errorf("%s does not match key %+v", &x, k)
+	}
+	b[33] |= TcpFlagAck
+	k.setIp4(b)
+	if x.matches(&k, false) {
+		t.Errorf("%s matches key with ack set", &x)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, s := range []string{
+		"allow src 10.0.0.0/8",
+		"permit src 10.0.0.0",
+		"deny dst 10.0.0.0/33",
+		"permit tcp-flags syn,foo",
+		"permit dscp 64",
+		"deny track",
+	} {
+		var (
+			x  Rule
+			in parse.Input
+		)
+		in.SetString(s)
+		if err := x.Parse(&in); err == nil {
+			t.Errorf("%s: parsed as %s", s, &x)
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	var (
+		m   sessionMain
+		k   key
+		now cpu.Time = 100
+	)
+	m.defaultLimit = 1
+	for i := range m.timeoutCycles {
+		m.timeoutCycles[i] = 10
+	}
+	k.v[dimSrc], k.v[dimDst] = value{lo: 1}, value{lo: 2}
+	k.v[dimProtocol].lo = uint64(ip.TCP)
+	k.v[dimSrcPort].lo, k.v[dimDstPort].lo = 1000, 22
+	k.tcpFlags = TcpFlagSyn
+	sk := k.sessionKey(false)
+	if !m.create(&sk, &k, 1, 60, now) {
+		t.Fatal("create failed")
+	}
+	if !m.create(&sk, &k, 1, 60, now) || m.nSessions != 1 {
+		t.Fatal("existing session not reused")
+	}
+	k2 := k
+	k2.v[dimSrcPort].lo = 1001
+	sk2 := k2.sessionKey(false)
+	if m.create(&sk2, &k2, 1, 60, now) {
+		t.Fatal("session limit not enforced")
+	}
+	// Reply from responder.
+	rk := sk.reverse()
+	s, dir, ok := m.lookup(&rk)
+	if !ok || dir != 1 {
+		t.Fatalf("reverse lookup: ok %v dir %d", ok, dir)
+	}
+	k.tcpFlags = TcpFlagSyn | TcpFlagAck
+	m.update(s, dir, &k, 60, now)
+	k.tcpFlags = TcpFlagAck
+	m.update(s, 0, &k, 60, now)
+	if s.state != tcpEstablished {
+		t.Fatalf("state %v want %v", s.state, tcpEstablished)
+	}
+	// Session used after aging scan started must not wrap to look idle.
+	m.age(now - 1)
+	m.age(now + 5)
+	if m.nSessions != 1 {
+		t.Fatal("session aged early")
+	}
+	m.age(now + 20)
+	if _, _, ok = m.lookup(&sk); ok || m.perSi[1].count != 0 {
+		t.Fatal("session not aged")
+	}
+}
+
+func ip4Packet(src, dst string) []byte {
+	b := make([]byte, sizeofIp4Header+8)
+	b[0] = 0x45
+	b[9] = byte(ip.UDP)
+	copy(b[12:16], net.ParseIP(src).To4())
+	copy(b[16:20], net.ParseIP(dst).To4())
+	return b
+}
+
+// Packets received on interface with attached list are classified by acl-ip4-input.
+func TestAttachedInput(t *testing.T) {
+	v := &vnet.Vnet{}
+	pg.Init(v)
+	ethernet.Init(v, ip4.Init(v), ip6.Init(v))
+	Init(v)
+	if err := ip4.GetMain(v).Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ip6.GetMain(v).Init(); err != nil {
+		t.Fatal(err)
+	}
+	m := GetMain(v)
+	for f := range m.nodes {
+		for d := range m.nodes[f] {
+			m.nodes[f][d].init(v, m, f == 1, Direction(d))
+		}
+	}
+	var r Rule
+	in := parse.Input{}
+	in.SetString("deny src 10.0.0.0/8")
+	if err := r.Parse(&in); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddRule("in", false, r, -1); err != nil {
+		t.Fatal(err)
+	}
+	const si = vnet.Si(1)
+	if err := m.Attach(si, "in", Input); err != nil {
+		t.Fatal(err)
+	}
+	n := &m.nodes[0][Input]
+	if !ip4.GetMain(v).InputFeatures.IsEnabled(si, n.feature) {
+		t.Fatal("acl-ip4-input not enabled on attached interface")
+	}
+	var mt match
+	b := ip4Packet("10.1.2.3", "20.0.0.1")
+	x, e := n.classifyData(si, b, uint(len(b)), &n.attachments[si], &mt, 0, &m.sessionMain)
+	if x != next_error || e != error_deny {
+		t.Errorf("next %d error %d, want deny", x, e)
+	}
+	if c := m.List("in").counter(0); c.Packets != 1 || c.Bytes != uint64(len(b)) {
+		t.Errorf("deny counter %+v, want 1 packet", c)
+	}
+	if err := m.Detach(si, Input); err != nil {
+		t.Fatal(err)
+	}
+	if ip4.GetMain(v).InputFeatures.IsEnabled(si, n.feature) {
+		t.Error("acl-ip4-input enabled after detach")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"math/bits"
+	"net"
+	"sort"
+)
+
+// Rules are classified by decomposing each header field (dimension) into elementary
+// intervals.  Each interval has a bitmap of rules which match all values in the interval.
+// Lookup does a binary search per dimension and ANDs the resulting bitmaps word by
+// word; the lowest set bit is the first matching rule.  Cost grows with number of rules
+// divided by 64, not number of rules, and lookup stops at first non-zero word.
+
+// Field value: 128 bits for ip6 addresses; other fields use lo only.
+type value struct{ hi, lo uint64 }
+
+func (a value) less(b value) bool {
+	if a.hi != b.hi {
+		return a.hi < b.hi
+	}
+	return a.lo < b.lo
+}
+
+// Value plus one; ok is false on overflow.
+func (a value) next() (b value, ok bool) {
+	b = a
+	b.lo++
+	if b.lo == 0 {
+		b.hi++
+		if b.hi == 0 {
+			return
+		}
+	}
+	ok = true
+	return
+}
+
+const (
+	dimSrc = iota
+	dimDst
+	dimProtocol
+	dimSrcPort
+	dimDstPort
+	dimDscp
+	nDim
+)
+
+// Packet header fields matched by rules.
+type key struct {
+	v        [nDim]value
+	tcpFlags uint8
+	// Identifier of icmp echo request/reply.
+	icmpId uint16
+	// Packet belongs to an existing session.
+	established bool
+}
+
+type interval struct{ lo, hi value }
+
+func addressValue(a net.IP) (v value) {
+	if len(a) == net.IPv4len {
+		v.lo = uint64(a[0])<<24 | uint64(a[1])<<16 | uint64(a[2])<<8 | uint64(a[3])
+		return
+	}
+	for i := 0; i < 8; i++ {
+		v.hi = v.hi<<8 | uint64(a[i])
+		v.lo = v.lo<<8 | uint64(a[8+i])
+	}
+	return
+}
+
+func prefixInterval(p *net.IPNet, is6 bool) (r interval) {
+	if p == nil {
+		r.hi.lo = 1<<32 - 1
+		if is6 {
+			r.hi = value{hi: ^uint64(0), lo: ^uint64(0)}
+		}
+		return
+	}
+	lo := make(net.IP, len(p.IP))
+	hi := make(net.IP, len(p.IP))
+	for i := range p.IP {
+		lo[i] = p.IP[i] & p.Mask[i]
+		hi[i] = lo[i] | ^p.Mask[i]
+	}
+	return interval{addressValue(lo), addressValue(hi)}
+}
+
+func rangeInterval(lo, hi uint64) interval { return interval{value{lo: lo}, value{lo: hi}} }
+
+func (r *Rule) intervals(is6 bool) (x [nDim]interval) {
+	x[dimSrc] = prefixInterval(r.Src, is6)
+	x[dimDst] = prefixInterval(r.Dst, is6)
+	x[dimProtocol] = rangeInterval(0, 0xff)
+	if r.HasProtocol {
+		x[dimProtocol] = rangeInterval(uint64(r.Protocol), uint64(r.Protocol))
+	}
+	x[dimSrcPort] = rangeInterval(0, 0xffff)
+	if !r.SrcPorts.IsAny() {
+		x[dimSrcPort] = rangeInterval(uint64(r.SrcPorts.Lo), uint64(r.SrcPorts.Hi))
+	}
+	x[dimDstPort] = rangeInterval(0, 0xffff)
+	if !r.DstPorts.IsAny() {
+		x[dimDstPort] = rangeInterval(uint64(r.DstPorts.Lo), uint64(r.DstPorts.Hi))
+	}
+	x[dimDscp] = rangeInterval(0, 0x3f)
+	if r.HasDscp {
+		x[dimDscp] = rangeInterval(uint64(r.Dscp), uint64(r.Dscp))
+	}
+	return
+}
+
+// Linear match of rule against key; used for testing classifier.
+func (r *Rule) matches(k *key, is6 bool) bool {
+	x := r.intervals(is6)
+	for d := range x {
+		if k.v[d].less(x[d].lo) || x[d].hi.less(k.v[d]) {
+			return false
+		}
+	}
+	return r.matchFlags(k)
+}
+
+type bitmap []uint64
+
+func (b bitmap) set(i int)   { b[i/64] |= 1 << uint(i%64) }
+func (b bitmap) clear(i int) { b[i/64] &^= 1 << uint(i%64) }
+func (b bitmap) equal(c bitmap) bool {
+	for i := range b {
+		if b[i] != c[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type dimension struct {
+	// Interval i covers values from starts[i] up to starts[i+1]-1.
+	starts []value
+	sets   []bitmap
+}
+
+func (d *dimension) find(v value) bitmap {
+	i := sort.Search(len(d.starts), func(i int) bool { return v.less(d.starts[i]) })
+	return d.sets[i-1]
+}
+
+type classifier struct {
+	rules  []Rule
+	is6    bool
+	nWords int
+	dims   [nDim]dimension
+}
+
+func newClassifier(rules []Rule, is6 bool) (c *classifier) {
+	c = &classifier{rules: rules, is6: is6, nWords: (len(rules) + 63) / 64}
+	x := make([][nDim]interval, len(rules))
+	for i := range rules {
+		x[i] = rules[i].intervals(is6)
+	}
+	for d := range c.dims {
+		c.dims[d].build(x, d, c.nWords)
+	}
+	return
+}
+
+// Sweep interval boundaries in order adding rules as their intervals start and
+// removing them after they end.
+func (d *dimension) build(x [][nDim]interval, dim, nWords int) {
+	type event struct {
+		at    value
+		rule  int
+		isAdd bool
+	}
+	es := []event{{at: value{}, rule: -1}}
+	for i := range x {
+		es = append(es, event{at: x[i][dim].lo, rule: i, isAdd: true})
+		if end, ok := x[i][dim].hi.next(); ok {
+			es = append(es, event{at: end, rule: i})
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool { return es[i].at.less(es[j].at) })
+	cur := make(bitmap, nWords)
+	for i := 0; i < len(es); {
+		at := es[i].at
+		for ; i < len(es) && es[i].at == at; i++ {
+			switch e := &es[i]; {
+			case e.rule < 0:
+			case e.isAdd:
+				cur.set(e.rule)
+			default:
+				cur.clear(e.rule)
+			}
+		}
+		// Merge with previous interval when rule set is unchanged.
+		if n := len(d.sets); n > 0 && d.sets[n-1].equal(cur) {
+			continue
+		}
+		s := make(bitmap, nWords)
+		copy(s, cur)
+		d.starts = append(d.starts, at)
+		d.sets = append(d.sets, s)
+	}
+}
+
+// Matching bitmap for each dimension for given key.
+type match [nDim]bitmap
+
+func (c *classifier) lookup(k *key, m *match) {
+	for d := range c.dims {
+		m[d] = c.dims[d].find(k.v[d])
+	}
+}
+
+// Index of first rule at or after start which matches; -1 if none.
+func (c *classifier) next(k *key, m *match, start int) int {
+	for w := start / 64; w < c.nWords; w++ {
+		x := m[0][w]
+		for d := 1; d < nDim && x != 0; d++ {
+			x &= m[d][w]
+		}
+		if w == start/64 {
+			x &= ^uint64(0) << uint(start%64)
+		}
+		for x != 0 {
+			b := bits.TrailingZeros64(x)
+			i := 64*w + b
+			if c.rules[i].matchFlags(k) {
+				return i
+			}
+			x &^= 1 << uint(b)
+		}
+	}
+	return -1
+}
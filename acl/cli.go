@@ -0,0 +1,376 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+	"sort"
+)
+
+func (d *Direction) Parse(in *parse.Input) {
+	switch text := in.Token(); text {
+	case "input", "in":
+		*d = Input
+	case "output", "out":
+		*d = Output
+	default:
+		in.ParseError()
+	}
+}
+
+// acl add NAME [ip6] [position N] RULE
+func (m *Main) aclAdd(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		name     string
+		is6      bool
+		position int = -1
+		r        Rule
+	)
+	if !in.Parse("%s", &name) {
+		err = cli.ParseError
+		return
+	}
+	for {
+		switch {
+		case in.Parse("ip6"):
+			is6 = true
+		case in.Parse("ip4"):
+			is6 = false
+		case in.Parse("pos%*ition %d", &position):
+		default:
+			if err = r.Parse(&in.Input); err != nil {
+				return
+			}
+			return m.AddRule(name, is6, r, position)
+		}
+	}
+}
+
+// acl delete NAME [rule N]
+func (m *Main) aclDel(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		name  string
+		index int = -1
+	)
+	for !in.End() {
+		switch {
+		case len(name) > 0 && in.Parse("rule %d", &index):
+		case len(name) == 0 && in.Parse("%s", &name):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if len(name) == 0 {
+		err = fmt.Errorf("acl delete: no list given")
+		return
+	}
+	if index >= 0 {
+		return m.DelRule(name, index)
+	}
+	return m.DelList(name)
+}
+
+// acl attach NAME INTERFACE input|output
+func (m *Main) aclAttach(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		name string
+		si   vnet.Si
+		dir  Direction
+	)
+	if !in.Parse("%s %v %v", &name, &si, m.Vnet, &dir) {
+		err = cli.ParseError
+		return
+	}
+	return m.Attach(si, name, dir)
+}
+
+// acl detach INTERFACE input|output
+func (m *Main) aclDetach(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si  vnet.Si
+		dir Direction
+	)
+	if !in.Parse("%v %v", &si, m.Vnet, &dir) {
+		err = cli.ParseError
+		return
+	}
+	return m.Detach(si, dir)
+}
+
+type showRule struct {
+	Index   string `format:"%6s" align:"right"`
+	Rule    string `align:"left"`
+	Packets uint64 `format:"%16d"`
+	Bytes   uint64 `format:"%16d"`
+}
+
+// Counter values summed over all threads.
+func (l *List) counter(i uint) (c vnet.CombinedCounter) {
+	for t := range l.counters {
+		v := l.counters[t].Value(i)
+		c.Packets += v.Packets
+		c.Bytes += v.Bytes
+	}
+	return
+}
+
+func (m *Main) attachedString(l *List) (s string) {
+	v := m.Vnet
+	for d := range m.nodes[family(l.Is6)] {
+		as := m.nodes[family(l.Is6)][d].attachments
+		for si := range as {
+			if as[si].list == l {
+				if len(s) > 0 {
+					s += ", "
+				}
+				s += fmt.Sprintf("%s %s", vnet.SiName{V: v, Si: vnet.Si(si)}, Direction(d))
+			}
+		}
+	}
+	return
+}
+
+func (m *Main) showAcl(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var name string
+	for !in.End() {
+		switch {
+		case in.Parse("%s", &name):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	var ls []*List
+	for _, l := range m.lists {
+		if len(name) == 0 || l.Name == name {
+			ls = append(ls, l)
+		}
+	}
+	if len(name) > 0 && len(ls) == 0 {
+		err = fmt.Errorf("acl %s: no such list", name)
+		return
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Name < ls[j].Name })
+	for _, l := range ls {
+		family := "ip4"
+		if l.Is6 {
+			family = "ip6"
+		}
+		fmt.Fprintf(w, "%s %s", l.Name, family)
+		if s := m.attachedString(l); len(s) > 0 {
+			fmt.Fprintf(w, ", attached to %s", s)
+		}
+		fmt.Fprintln(w)
+		rs := make([]showRule, len(l.Rules)+1)
+		for i := range rs {
+			x := l.counter(uint(i))
+			rs[i] = showRule{
+				Index:   fmt.Sprintf("%d", i),
+				Packets: x.Packets,
+				Bytes:   x.Bytes,
+			}
+			if i < len(l.Rules) {
+				rs[i].Rule = l.Rules[i].String()
+			} else {
+				rs[i].Index, rs[i].Rule = "", "no match (deny)"
+			}
+		}
+		elib.Tabulate(rs).Write(w)
+	}
+	return
+}
+
+func (m *Main) clearAcl(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var name string
+	for !in.End() {
+		switch {
+		case in.Parse("counters"):
+		case in.Parse("%s", &name):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	for _, l := range m.lists {
+		if len(name) == 0 || l.Name == name {
+			l.counters.ClearAll()
+		}
+	}
+	return
+}
+
+// acl session limit INTERFACE|default N
+// acl session timeout tcp-established|tcp-transitory|tcp-closing|udp|icmp|other SECONDS
+func (m *Main) aclSession(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si      vnet.Si
+		limit   uint
+		t       sessionTimeout
+		seconds float64
+	)
+	switch {
+	case in.Parse("limit default %d", &limit):
+		m.SetSessionLimit(vnet.SiNil, limit)
+	case in.Parse("limit %v %d", &si, m.Vnet, &limit):
+		m.SetSessionLimit(si, limit)
+	case in.Parse("timeout %v %f", &t, &seconds):
+		err = m.setSessionTimeout(t, seconds)
+	default:
+		err = cli.ParseError
+	}
+	return
+}
+
+type showSession struct {
+	Protocol    string `format:"%-8s" align:"left"`
+	Source      string `format:"%-24s" align:"left"`
+	Destination string `format:"%-24s" align:"left"`
+	State       string `format:"%-12s" align:"left"`
+	Interface   string `format:"%-16s" align:"left"`
+	Idle        string `format:"%8s"`
+	Forward     string `format:"%16s"`
+	Reverse     string `format:"%16s"`
+}
+
+type showSessionLimit struct {
+	Interface string `format:"%-16s" align:"left"`
+	Sessions  uint   `format:"%10d"`
+	Limit     string `format:"%10s"`
+}
+
+func limitString(l uint) string {
+	if l == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d", l)
+}
+
+func (m *Main) showSessions(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var summary bool
+	for !in.End() {
+		switch {
+		case in.Parse("sum%*mary"):
+			summary = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	sm := &m.sessionMain
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	now := cpu.TimeNow()
+	fmt.Fprintf(w, "%d sessions, %d created, %d aged, %d limit exceeded, default limit %s\n",
+		sm.nSessions, sm.counters.Created, sm.counters.Aged, sm.counters.LimitExceeded, limitString(sm.defaultLimit))
+	var ls []showSessionLimit
+	for i := range sm.perSi {
+		if x := &sm.perSi[i]; x.count > 0 || x.limit > 0 {
+			l := x.limit
+			if l == 0 {
+				l = sm.defaultLimit
+			}
+			ls = append(ls, showSessionLimit{
+				Interface: vnet.SiName{V: v, Si: vnet.Si(i)}.String(),
+				Sessions:  x.count,
+				Limit:     limitString(l),
+			})
+		}
+	}
+	if len(ls) > 0 {
+		elib.Tabulate(ls).Write(w)
+	}
+	if summary || sm.nSessions == 0 {
+		return
+	}
+	var ss []showSession
+	sm.foreach(func(s *session) {
+		src, dst := s.key.endpoints()
+		fwd, rev := s.getCounter(0), s.getCounter(1)
+		ss = append(ss, showSession{
+			Protocol:    s.key.protocol.String(),
+			Source:      src,
+			Destination: dst,
+			State:       s.getState().String(),
+			Interface:   vnet.SiName{V: v, Si: s.si}.String(),
+			Idle:        fmt.Sprintf("%.0fs", (now - s.getLastUsed()).Seconds()),
+			Forward:     fmt.Sprintf("%d/%d", fwd.Packets, fwd.Bytes),
+			Reverse:     fmt.Sprintf("%d/%d", rev.Packets, rev.Bytes),
+		})
+	})
+	elib.Tabulate(ss).Write(w)
+	return
+}
+
+func (m *Main) clearSessions(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	si := vnet.SiNil
+	if !in.End() && !in.Parse("%v", &si, m.Vnet) {
+		err = cli.ParseError
+		return
+	}
+	m.sessionMain.clear(si)
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := []cli.Command{
+		cli.Command{
+			Name:      "acl add",
+			ShortHelp: "add rule to access control list: acl add NAME [ip6] [position N] permit|deny|count [src P] [dst P] [proto P] [sport R] [dport R] [dscp N] [tcp-flags F] [established] [track]",
+			Action:    m.aclAdd,
+		},
+		cli.Command{
+			Name:      "acl delete",
+			ShortHelp: "delete access control list or rule: acl delete NAME [rule N]",
+			Action:    m.aclDel,
+		},
+		cli.Command{
+			Name:      "acl attach",
+			ShortHelp: "attach access control list to interface: acl attach NAME INTERFACE input|output",
+			Action:    m.aclAttach,
+		},
+		cli.Command{
+			Name:      "acl detach",
+			ShortHelp: "detach access control lists from interface: acl detach INTERFACE input|output",
+			Action:    m.aclDetach,
+		},
+		cli.Command{
+			Name:      "acl session",
+			ShortHelp: "set session limits and timeouts: acl session limit INTERFACE|default N, acl session timeout KIND SECONDS",
+			Action:    m.aclSession,
+		},
+		cli.Command{
+			Name:      "show sessions",
+			ShortHelp: "show connection tracking sessions (packets/bytes from initiator and responder)",
+			Action:    m.showSessions,
+		},
+		cli.Command{
+			Name:      "clear sessions",
+			ShortHelp: "delete all sessions or sessions created on given interface",
+			Action:    m.clearSessions,
+		},
+		cli.Command{
+			Name:      "show acl",
+			ShortHelp: "show access control lists with rule counters",
+			Action:    m.showAcl,
+		},
+		cli.Command{
+			Name:      "clear acl",
+			ShortHelp: "clear access control list counters",
+			Action:    m.clearAcl,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
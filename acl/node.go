@@ -0,0 +1,211 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+)
+
+type Direction uint8
+
+const (
+	Input Direction = iota
+	Output
+	nDirection
+)
+
+var directionStrings = [...]string{
+	Input:  "input",
+	Output: "output",
+}
+
+func (d Direction) String() string { return directionStrings[d] }
+
+const (
+	next_error uint = iota
+)
+
+const (
+	error_deny uint = iota
+	error_no_match
+	error_bad_header
+	error_not_attached
+	error_session_limit
+)
+
+// Classify node for given family and direction.  Input nodes are ip4 or ip6 input
+// features; packets start with ip header.  Output nodes are output features; packets start
+// with ethernet header and packets of the other family pass unchanged.  Permitted packets
+// continue to the next enabled feature.
+type node struct {
+	vnet.InOutNode
+	m   *Main
+	is6 bool
+	dir Direction
+	// Feature arc and index of node's feature.
+	arc     *vnet.FeatureArc
+	feature uint
+	// Attached lists indexed by software interface.
+	attachments []attachment
+}
+
+type attachment struct {
+	list *List
+}
+
+func (n *node) init(v *vnet.Vnet, m *Main, is6 bool, dir Direction) {
+	n.m, n.is6, n.dir = m, is6, dir
+	family := "ip4"
+	if is6 {
+		family = "ip6"
+	}
+	n.Next = []string{
+		next_error: "error",
+	}
+	n.Errors = []string{
+		error_deny:          "denied by acl rule",
+		error_no_match:      "no acl rule matches",
+		error_bad_header:    "bad ip header",
+		error_not_attached:  "no acl attached to output interface",
+		error_session_limit: "interface session limit exceeded",
+	}
+	v.RegisterInOutNode(n, "acl-%s-%s", family, dir)
+	switch {
+	case dir == Output:
+		n.arc = v.OutputFeatures()
+	case is6:
+		n.arc = &ip6.GetMain(v).InputFeatures
+	default:
+		n.arc = &ip4.GetMain(v).InputFeatures
+	}
+	n.feature = n.arc.Register(n)
+}
+
+// Ip header of packet data or nil if packet is output packet of other family.
+func (n *node) ipHeader(b []byte) []byte {
+	if n.dir == Input {
+		return b
+	}
+	t := ethernet.TYPE_IP4
+	if n.is6 {
+		t = ethernet.TYPE_IP6
+	}
+	if len(b) < ethernet.SizeofHeader || (*ethernet.Header)(vnet.Pointer(b)).GetType() != t {
+		return nil
+	}
+	return b[ethernet.SizeofHeader:]
+}
+
+func (n *node) classify(r0 *vnet.Ref, a *attachment, m *match, t uint, sm *sessionMain) (next0 uint) {
+	next0, error0 := n.classifyData(r0.Si, r0.DataSlice(), r0.DataLen(), a, m, t, sm)
+	if next0 == next_error {
+		n.SetError(r0, error0)
+	}
+	return
+}
+
+// Classify packet data of given length received or sent on given interface; error is
+// set when packet is dropped.
+func (n *node) classifyData(si vnet.Si, b []byte, l0 uint, a *attachment, m *match, t uint, sm *sessionMain) (next0, error0 uint) {
+	l := a.list
+	if l == nil {
+		// Input from interfaces without acl is permitted.
+		if n.dir == Input {
+			return n.arc.Next(si, n.feature), 0
+		}
+		return next_error, error_not_attached
+	}
+	if b = n.ipHeader(b); b == nil {
+		return n.arc.Next(si, n.feature), 0
+	}
+	var (
+		k  key
+		ok bool
+	)
+	if n.is6 {
+		ok = k.setIp6(b)
+	} else {
+		ok = k.setIp4(b)
+	}
+	if !ok {
+		return next_error, error_bad_header
+	}
+	var (
+		sk    sessionKey
+		s     *session
+		dir   int
+		found bool
+	)
+	if l.stateful {
+		sk = k.sessionKey(n.is6)
+		s, dir, found = sm.lookup(&sk)
+		k.established = found
+	}
+	c, cs := l.c, l.threadCounters(t)
+	c.lookup(&k, m)
+	for i := c.next(&k, m, 0); i >= 0; i = c.next(&k, m, i+1) {
+		cs.Add(uint(i), 1, l0)
+		switch r := &c.rules[i]; r.Action {
+		case Permit:
+			switch {
+			case found:
+				sm.update(s, dir, &k, l0, cpu.TimeNow())
+			case r.Track && !sm.create(&sk, &k, si, l0, cpu.TimeNow()):
+				return next_error, error_session_limit
+			}
+			return n.arc.Next(si, n.feature), 0
+		case Deny:
+			return next_error, error_deny
+		}
+	}
+	// Packets matching no rule are denied and counted after last rule.
+	cs.Add(uint(len(c.rules)), 1, l0)
+	return next_error, error_no_match
+}
+
+func (n *node) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	q := n.GetEnqueue(in)
+	t := in.ThreadId()
+	as := n.attachments
+	var m match
+	i, n_left := in.Range()
+	for n_left >= 1 {
+		r0 := in.Get1(i)
+		var a0 attachment
+		if uint(r0.Si) < uint(len(as)) {
+			a0 = as[r0.Si]
+		}
+		x0 := n.classify(r0, &a0, &m, t, &n.m.sessionMain)
+		q.Put1(r0, x0)
+		n_left -= 1
+		i += 1
+	}
+}
+
+// Permits returns true if the first permit or deny rule matching the given ip packet
+// is a permit rule.  Used by other packages to classify packets with access lists;
+// count rules are skipped without counting and established rules never match.
+func (l *List) Permits(b []byte) bool {
+	var k key
+	if ok := l.Is6 && k.setIp6(b) || !l.Is6 && k.setIp4(b); !ok || l.c == nil {
+		return false
+	}
+	var m match
+	c := l.c
+	c.lookup(&k, &m)
+	for i := c.next(&k, &m, 0); i >= 0; i = c.next(&k, &m, i+1) {
+		switch c.rules[i].Action {
+		case Permit:
+			return true
+		case Deny:
+			return false
+		}
+	}
+	return false
+}
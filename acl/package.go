@@ -0,0 +1,246 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package acl provides access control lists: ordered lists of rules matching
+// source/destination prefix, protocol, port ranges, DSCP and TCP flags.
+// Lists are attached to the input or output of software interfaces; attached
+// lists are evaluated by acl-ip4-input, acl-ip4-output, acl-ip6-input and
+// acl-ip6-output nodes.  Input nodes are ip4 and ip6 input features; output
+// nodes are output features of packets sent out interfaces.  First matching
+// permit or deny rule decides; count rules count and continue; packets
+// matching no rule are denied.
+//
+// Permit rules with track set create sessions; rules with established set
+// only match packets of existing sessions, permitting return traffic of
+// flows initiated from the inside.
+package acl
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+
+	lists map[string]*List
+
+	// Classify nodes indexed by family (0 ip4, 1 ip6) and direction.
+	nodes [2][nDirection]node
+
+	sessionMain
+}
+
+type List struct {
+	Name  string
+	Is6   bool
+	Rules []Rule
+
+	c *classifier
+
+	// Per rule packet and byte counters indexed by thread.
+	// Counter after last rule counts packets matching no rule.
+	counters vnet.CombinedCountersVec
+
+	// Number of interfaces list is attached to.
+	refs uint
+
+	// List has rules with established or track set.
+	stateful bool
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("acl", m)
+	m.DependsOn("ip4", "ip6")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. acl { session-limit 10000 session-timeout udp 60 }
+func (m *Main) Configure(in *parse.Input) {
+	var (
+		t       sessionTimeout
+		seconds float64
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("session-limit %d", &m.defaultLimit):
+		case in.Parse("session-timeout %v %f", &t, &seconds) && seconds > 0:
+			m.timeouts[t] = seconds
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func family(is6 bool) int {
+	if is6 {
+		return 1
+	}
+	return 0
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	for f := range m.nodes {
+		for d := range m.nodes[f] {
+			m.nodes[f][d].init(v, m, f == 1, Direction(d))
+		}
+	}
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.sessionMain.init(v)
+	m.cliInit()
+	return
+}
+
+// List returns list with given name or nil if none exists.
+func (m *Main) List(name string) *List { return m.lists[name] }
+
+// Rebuild classifier after rules change; counters restart from zero.
+func (l *List) update() {
+	rules := make([]Rule, len(l.Rules))
+	copy(rules, l.Rules)
+	l.c = newClassifier(rules, l.Is6)
+	l.counters = nil
+	l.stateful = false
+	for i := range rules {
+		l.stateful = l.stateful || rules[i].Established || rules[i].Track
+	}
+}
+
+// Counters for given thread.  Counters of all threads are validated when vector grows so
+// that show need not modify them.
+func (l *List) threadCounters(t uint) *vnet.CombinedCounters {
+	if t >= uint(len(l.counters)) {
+		l.counters.Validate(t)
+		for i := range l.counters {
+			l.counters[i].Validate(uint(len(l.c.rules)))
+		}
+	}
+	return &l.counters[t]
+}
+
+// AddRule inserts rule into named list before given position (appending if position
+// is negative or past end of list).  List is created if it does not exist.
+func (m *Main) AddRule(name string, is6 bool, r Rule, position int) (err error) {
+	if is4, isIp6 := r.families(); is6 && is4 || !is6 && isIp6 {
+		return fmt.Errorf("acl %s: rule %s: address family mismatch", name, &r)
+	}
+	if r.Track && r.Action != Permit {
+		return fmt.Errorf("acl %s: rule %s: track requires permit", name, &r)
+	}
+	l := m.lists[name]
+	if l == nil {
+		l = &List{Name: name, Is6: is6}
+		if m.lists == nil {
+			m.lists = make(map[string]*List)
+		}
+		m.lists[name] = l
+	} else if l.Is6 != is6 {
+		return fmt.Errorf("acl %s: address family mismatch", name)
+	}
+	if position < 0 || position > len(l.Rules) {
+		position = len(l.Rules)
+	}
+	l.Rules = append(l.Rules, Rule{})
+	copy(l.Rules[position+1:], l.Rules[position:])
+	l.Rules[position] = r
+	l.update()
+	return
+}
+
+// DelRule deletes rule with given index from named list.
+func (m *Main) DelRule(name string, index int) (err error) {
+	l := m.lists[name]
+	if l == nil {
+		return fmt.Errorf("acl %s: no such list", name)
+	}
+	if index < 0 || index >= len(l.Rules) {
+		return fmt.Errorf("acl %s: no rule with index %d", name, index)
+	}
+	l.Rules = append(l.Rules[:index:index], l.Rules[index+1:]...)
+	l.update()
+	return
+}
+
+// DelList deletes named list; list must not be attached to any interface.
+func (m *Main) DelList(name string) (err error) {
+	l := m.lists[name]
+	switch {
+	case l == nil:
+		err = fmt.Errorf("acl %s: no such list", name)
+	case l.refs > 0:
+		err = fmt.Errorf("acl %s: list is attached to %d interfaces", name, l.refs)
+	default:
+		delete(m.lists, name)
+	}
+	return
+}
+
+// Attach attaches named list to given direction of software interface replacing
+// any list of the same address family already attached.
+func (m *Main) Attach(si vnet.Si, name string, dir Direction) (err error) {
+	l := m.lists[name]
+	if l == nil {
+		return fmt.Errorf("acl %s: no such list", name)
+	}
+	n := &m.nodes[family(l.Is6)][dir]
+	m.detach(n, si)
+	if i := uint(si); i >= uint(len(n.attachments)) {
+		n.attachments = append(n.attachments, make([]attachment, 1+i-uint(len(n.attachments)))...)
+	}
+	n.attachments[si] = attachment{list: l}
+	n.arc.Enable(si, n.feature, true)
+	l.refs++
+	return
+}
+
+func (m *Main) detach(n *node, si vnet.Si) (ok bool) {
+	if uint(si) >= uint(len(n.attachments)) {
+		return
+	}
+	a := &n.attachments[si]
+	if ok = a.list != nil; ok {
+		n.arc.Enable(si, n.feature, false)
+		a.list.refs--
+		*a = attachment{}
+	}
+	return
+}
+
+// Detach detaches lists of both address families from given direction of software interface.
+func (m *Main) Detach(si vnet.Si, dir Direction) (err error) {
+	ok4 := m.detach(&m.nodes[0][dir], si)
+	ok6 := m.detach(&m.nodes[1][dir], si)
+	if !ok4 && !ok6 {
+		err = fmt.Errorf("acl: no list attached to %s %s", vnet.SiName{V: m.Vnet, Si: si}, dir)
+	}
+	return
+}
+
+// Attached returns list attached to given direction of software interface or nil if none.
+func (m *Main) Attached(si vnet.Si, is6 bool, dir Direction) *List {
+	n := &m.nodes[family(is6)][dir]
+	if uint(si) < uint(len(n.attachments)) {
+		return n.attachments[si].list
+	}
+	return nil
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		for f := range m.nodes {
+			for d := range m.nodes[f] {
+				m.detach(&m.nodes[f][d], si)
+			}
+		}
+		m.sessionMain.clear(si)
+	}
+	return
+}
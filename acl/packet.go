@@ -0,0 +1,90 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/vnet/ip"
+)
+
+const (
+	sizeofIp4Header = 20
+	sizeofIp6Header = 40
+)
+
+// Layer 4 protocols with source and destination ports as first 4 bytes of header.
+func hasPorts(p ip.Protocol) bool { return p == ip.TCP || p == ip.UDP || p == ip.SCTP }
+
+// Icmp echo request and reply types.
+const (
+	icmp4EchoReply   = 0
+	icmp4EchoRequest = 8
+	icmp6EchoRequest = 128
+	icmp6EchoReply   = 129
+)
+
+func isIcmpEcho(p ip.Protocol, t uint8) bool {
+	return p == ip.ICMP && (t == icmp4EchoRequest || t == icmp4EchoReply) ||
+		p == ip.ICMP6 && (t == icmp6EchoRequest || t == icmp6EchoReply)
+}
+
+func (k *key) setL4(p ip.Protocol, b []byte) {
+	k.v[dimProtocol].lo = uint64(p)
+	if isIcmpEcho(p, b0(b)) && len(b) >= 6 {
+		k.icmpId = uint16(b[4])<<8 | uint16(b[5])
+		return
+	}
+	if !hasPorts(p) || len(b) < 4 {
+		return
+	}
+	k.v[dimSrcPort].lo = uint64(b[0])<<8 | uint64(b[1])
+	k.v[dimDstPort].lo = uint64(b[2])<<8 | uint64(b[3])
+	if p == ip.TCP && len(b) > 13 {
+		k.tcpFlags = b[13]
+	}
+}
+
+func b0(b []byte) (x uint8) {
+	if len(b) > 0 {
+		x = b[0]
+	}
+	return
+}
+
+// Set key from ip4 packet; returns false if packet is too short or not ip4.
+func (k *key) setIp4(b []byte) bool {
+	*k = key{}
+	if len(b) < sizeofIp4Header || b[0]>>4 != 4 {
+		return false
+	}
+	k.v[dimDscp].lo = uint64(b[1] >> 2)
+	k.v[dimSrc] = addressValue(b[12:16])
+	k.v[dimDst] = addressValue(b[16:20])
+	l := uint(b[0]&0xf) * 4
+	if l < sizeofIp4Header || uint(len(b)) < l {
+		return false
+	}
+	// Non-first fragments have no layer 4 header.
+	if isFirst := b[6]&0x1f == 0 && b[7] == 0; isFirst {
+		k.setL4(ip.Protocol(b[9]), b[l:])
+	} else {
+		k.v[dimProtocol].lo = uint64(b[9])
+	}
+	return true
+}
+
+// Set key from ip6 packet.  Extension headers are not followed: protocol is next header
+// field of fixed header.
+func (k *key) setIp6(b []byte) bool {
+	*k = key{}
+	if len(b) < sizeofIp6Header || b[0]>>4 != 6 {
+		return false
+	}
+	tc := b[0]<<4 | b[1]>>4
+	k.v[dimDscp].lo = uint64(tc >> 2)
+	k.v[dimSrc] = addressValue(b[8:24])
+	k.v[dimDst] = addressValue(b[24:40])
+	k.setL4(ip.Protocol(b[6]), b[sizeofIp6Header:])
+	return true
+}
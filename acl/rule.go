@@ -0,0 +1,254 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+	"net"
+	"strings"
+)
+
+type Action uint8
+
+const (
+	Deny Action = iota
+	Permit
+	// Count packet and continue with next matching rule.
+	Count
+)
+
+var actionStrings = [...]string{
+	Deny:   "deny",
+	Permit: "permit",
+	Count:  "count",
+}
+
+func (a Action) String() string { return elib.Stringer(actionStrings[:], int(a)) }
+
+func (a *Action) Parse(in *parse.Input) {
+	switch text := in.Token(); text {
+	case "deny":
+		*a = Deny
+	case "permit":
+		*a = Permit
+	case "count":
+		*a = Count
+	default:
+		in.ParseError()
+	}
+}
+
+// Inclusive range of ports; zero value matches any port.
+type PortRange struct{ Lo, Hi uint16 }
+
+func (r PortRange) IsAny() bool { return r.Lo == 0 && r.Hi == 0 }
+
+func (r PortRange) String() string {
+	if r.Lo == r.Hi {
+		return fmt.Sprintf("%d", r.Lo)
+	}
+	return fmt.Sprintf("%d-%d", r.Lo, r.Hi)
+}
+
+func (r *PortRange) Parse(in *parse.Input) {
+	switch {
+	case in.Parse("%d-%d", &r.Lo, &r.Hi) && r.Lo <= r.Hi:
+	case in.Parse("%d", &r.Lo):
+		r.Hi = r.Lo
+	default:
+		in.ParseError()
+	}
+}
+
+type Rule struct {
+	Action Action
+	// Nil prefix matches any address.
+	Src, Dst *net.IPNet
+	// Protocol is only matched if HasProtocol is set.
+	Protocol    ip.Protocol
+	HasProtocol bool
+	// Layer 4 ports for tcp, udp and sctp; other packets have zero ports.
+	SrcPorts, DstPorts PortRange
+	// Differentiated services code point (6 most significant bits of tos/traffic class).
+	Dscp    uint8
+	HasDscp bool
+	// Matches tcp packets with (flags & TcpFlagsMask) == TcpFlags.
+	// Non-zero mask never matches packets other than tcp.
+	TcpFlags, TcpFlagsMask uint8
+	// Only matches packets of existing sessions (in either direction).
+	Established bool
+	// Permitted packets create sessions; only valid for permit rules.
+	Track bool
+}
+
+const (
+	TcpFlagFin = 1 << iota
+	TcpFlagSyn
+	TcpFlagRst
+	TcpFlagPsh
+	TcpFlagAck
+	TcpFlagUrg
+	TcpFlagEce
+	TcpFlagCwr
+)
+
+var tcpFlagStrings = [...]string{"fin", "syn", "rst", "psh", "ack", "urg", "ece", "cwr"}
+
+func tcpFlagsString(f uint8) string {
+	var s []string
+	for i := range tcpFlagStrings {
+		if f&(1<<uint(i)) != 0 {
+			s = append(s, tcpFlagStrings[i])
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// Match fields not handled by classifier dimensions.
+func (r *Rule) matchFlags(k *key) bool {
+	if r.Established && !k.established {
+		return false
+	}
+	return r.TcpFlagsMask == 0 || k.v[dimProtocol].lo == uint64(ip.TCP) && k.tcpFlags&r.TcpFlagsMask == r.TcpFlags
+}
+
+// Parse tcp flags e.g. syn,!ack matches packets with syn set and ack clear.
+func (r *Rule) parseTcpFlags(s string) (err error) {
+	for _, f := range strings.Split(s, ",") {
+		not := strings.HasPrefix(f, "!")
+		f = strings.TrimPrefix(f, "!")
+		i := 0
+		for i < len(tcpFlagStrings) && tcpFlagStrings[i] != f {
+			i++
+		}
+		if i == len(tcpFlagStrings) {
+			return fmt.Errorf("unknown tcp flag `%s'", f)
+		}
+		r.TcpFlagsMask |= 1 << uint(i)
+		if !not {
+			r.TcpFlags |= 1 << uint(i)
+		}
+	}
+	return
+}
+
+func (r *Rule) String() string {
+	s := []string{r.Action.String()}
+	if r.Src != nil {
+		s = append(s, "src "+r.Src.String())
+	}
+	if r.Dst != nil {
+		s = append(s, "dst "+r.Dst.String())
+	}
+	if r.HasProtocol {
+		s = append(s, "proto "+r.Protocol.String())
+	}
+	if !r.SrcPorts.IsAny() {
+		s = append(s, "sport "+r.SrcPorts.String())
+	}
+	if !r.DstPorts.IsAny() {
+		s = append(s, "dport "+r.DstPorts.String())
+	}
+	if r.HasDscp {
+		s = append(s, fmt.Sprintf("dscp %d", r.Dscp))
+	}
+	if r.TcpFlagsMask != 0 {
+		f := tcpFlagsString(r.TcpFlags)
+		if clear := r.TcpFlagsMask &^ r.TcpFlags; clear != 0 {
+			if len(f) > 0 {
+				f += ","
+			}
+			f += "!" + strings.Replace(tcpFlagsString(clear), ",", ",!", -1)
+		}
+		s = append(s, "tcp-flags "+f)
+	}
+	if r.Established {
+		s = append(s, "established")
+	}
+	if r.Track {
+		s = append(s, "track")
+	}
+	return strings.Join(s, " ")
+}
+
+// Parse rule e.g. permit src 10.0.0.0/8 proto tcp dport 22 tcp-flags syn,!ack track
+func (r *Rule) Parse(in *parse.Input) (err error) {
+	var (
+		prefix string
+		flags  string
+		proto  uint8
+	)
+	if !in.Parse("%v", &r.Action) {
+		return fmt.Errorf("expected permit, deny or count: `%s'", in)
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("src %s", &prefix):
+			if r.Src, err = parsePrefix(prefix); err != nil {
+				return
+			}
+		case in.Parse("dst %s", &prefix):
+			if r.Dst, err = parsePrefix(prefix); err != nil {
+				return
+			}
+		case in.Parse("proto%*col %d", &proto):
+			r.Protocol, r.HasProtocol = ip.Protocol(proto), true
+		case in.Parse("proto%*col tcp"):
+			r.Protocol, r.HasProtocol = ip.TCP, true
+		case in.Parse("proto%*col udp"):
+			r.Protocol, r.HasProtocol = ip.UDP, true
+		case in.Parse("proto%*col icmp6"):
+			r.Protocol, r.HasProtocol = ip.ICMP6, true
+		case in.Parse("proto%*col icmp"):
+			r.Protocol, r.HasProtocol = ip.ICMP, true
+		case in.Parse("proto%*col %v", &r.Protocol):
+			r.HasProtocol = true
+		case in.Parse("sport %v", &r.SrcPorts):
+		case in.Parse("dport %v", &r.DstPorts):
+		case in.Parse("dscp %d", &r.Dscp) && r.Dscp < 64:
+			r.HasDscp = true
+		case in.Parse("tcp-flags %s", &flags):
+			if err = r.parseTcpFlags(flags); err != nil {
+				return
+			}
+		case in.Parse("established"):
+			r.Established = true
+		case in.Parse("track") && r.Action == Permit:
+			r.Track = true
+		default:
+			return fmt.Errorf("unexpected input: `%s'", in)
+		}
+	}
+	return
+}
+
+func parsePrefix(s string) (p *net.IPNet, err error) {
+	if _, p, err = net.ParseCIDR(s); err != nil {
+		return
+	}
+	if a := p.IP.To4(); a != nil {
+		p.IP = a
+	}
+	return
+}
+
+// Address families of rule prefixes; neither is set if rule matches any address.
+func (r *Rule) families() (is4, is6 bool) {
+	for _, p := range []*net.IPNet{r.Src, r.Dst} {
+		if p == nil {
+			continue
+		}
+		if len(p.IP) == net.IPv4len {
+			is4 = true
+		} else {
+			is6 = true
+		}
+	}
+	return
+}
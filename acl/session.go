@@ -0,0 +1,414 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acl
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// Sessions track tcp connections and udp/icmp pseudo-connections created by packets
+// permitted by rules with track set.  Rules with established set match packets of
+// existing sessions in either direction so that return traffic may be permitted.
+
+type sessionKey struct {
+	is6          bool
+	protocol     ip.Protocol
+	src, dst     value
+	sport, dport uint16
+}
+
+func (k *key) sessionKey(is6 bool) (s sessionKey) {
+	s.is6 = is6
+	s.protocol = ip.Protocol(k.v[dimProtocol].lo)
+	s.src, s.dst = k.v[dimSrc], k.v[dimDst]
+	if k.icmpId != 0 {
+		s.sport, s.dport = k.icmpId, k.icmpId
+	} else {
+		s.sport, s.dport = uint16(k.v[dimSrcPort].lo), uint16(k.v[dimDstPort].lo)
+	}
+	return
+}
+
+func (s sessionKey) reverse() sessionKey {
+	s.src, s.dst = s.dst, s.src
+	s.sport, s.dport = s.dport, s.sport
+	return s
+}
+
+// Stored as uint32 so that packet processing threads may read state without locking.
+type sessionState uint32
+
+const (
+	// Udp, icmp and other protocols.
+	sessionActive sessionState = iota
+	tcpSynSent
+	tcpSynReceived
+	tcpEstablished
+	// Fin seen in one direction.
+	tcpFinWait
+	// Fin seen in both directions.
+	tcpClosing
+	// Reset seen.
+	tcpClosed
+)
+
+var sessionStateStrings = [...]string{
+	sessionActive:  "active",
+	tcpSynSent:     "syn-sent",
+	tcpSynReceived: "syn-received",
+	tcpEstablished: "established",
+	tcpFinWait:     "fin-wait",
+	tcpClosing:     "closing",
+	tcpClosed:      "closed",
+}
+
+func (s sessionState) String() string { return elib.Stringer(sessionStateStrings[:], int(s)) }
+
+type sessionTimeout uint8
+
+const (
+	timeoutTcpTransitory sessionTimeout = iota
+	timeoutTcpEstablished
+	timeoutTcpClosing
+	timeoutUdp
+	timeoutIcmp
+	timeoutOther
+	nSessionTimeout
+)
+
+var sessionTimeoutStrings = [...]string{
+	timeoutTcpTransitory:  "tcp-transitory",
+	timeoutTcpEstablished: "tcp-established",
+	timeoutTcpClosing:     "tcp-closing",
+	timeoutUdp:            "udp",
+	timeoutIcmp:           "icmp",
+	timeoutOther:          "other",
+}
+
+func (t sessionTimeout) String() string { return elib.Stringer(sessionTimeoutStrings[:], int(t)) }
+
+func (t *sessionTimeout) Parse(in *parse.Input) {
+	text := in.Token()
+	for i := range sessionTimeoutStrings {
+		if sessionTimeoutStrings[i] == text {
+			*t = sessionTimeout(i)
+			return
+		}
+	}
+	in.ParseError()
+}
+
+// Default timeouts in seconds.
+var defaultSessionTimeouts = [nSessionTimeout]float64{
+	timeoutTcpTransitory:  120,
+	timeoutTcpEstablished: 7440,
+	timeoutTcpClosing:     10,
+	timeoutUdp:            300,
+	timeoutIcmp:           30,
+	timeoutOther:          60,
+}
+
+type session struct {
+	// Key in direction of packet which created session.
+	key sessionKey
+	// Interface where session was created; session limits apply per interface.
+	si    vnet.Si
+	state sessionState
+	// Fin seen from initiator (0) and responder (1).
+	finSeen           [2]bool
+	created, lastUsed cpu.Time
+	// Packets and bytes from initiator (0) and responder (1).
+	counters [2]vnet.CombinedCounter
+}
+
+func (s *session) timeout() sessionTimeout {
+	switch s.key.protocol {
+	case ip.TCP:
+		switch s.state {
+		case tcpEstablished:
+			return timeoutTcpEstablished
+		case tcpClosing, tcpClosed:
+			return timeoutTcpClosing
+		default:
+			return timeoutTcpTransitory
+		}
+	case ip.UDP:
+		return timeoutUdp
+	case ip.ICMP, ip.ICMP6:
+		return timeoutIcmp
+	default:
+		return timeoutOther
+	}
+}
+
+// Update tcp state for packet from initiator (dir 0) or responder (dir 1).
+// Must be called with lock held; state is stored atomically for lock-free readers.
+func (s *session) updateTcp(dir int, flags uint8) {
+	state := s.state
+	switch {
+	case flags&TcpFlagRst != 0:
+		state = tcpClosed
+	case flags&TcpFlagFin != 0:
+		s.finSeen[dir] = true
+		state = tcpFinWait
+		if s.finSeen[0] && s.finSeen[1] {
+			state = tcpClosing
+		}
+	case state == tcpSynSent && dir == 1 && flags&(TcpFlagSyn|TcpFlagAck) == TcpFlagSyn|TcpFlagAck:
+		state = tcpSynReceived
+	case state == tcpSynReceived && dir == 0 && flags&TcpFlagAck != 0:
+		state = tcpEstablished
+	}
+	atomic.StoreUint32((*uint32)(&s.state), uint32(state))
+}
+
+type siSessions struct {
+	// Number of sessions created on interface.
+	count uint
+	// Limit on number of sessions; zero means use default limit.
+	limit uint
+}
+
+type sessionCounters struct {
+	Created       uint64
+	Aged          uint64
+	LimitExceeded uint64
+}
+
+type sessionMain struct {
+	// Sessions are looked up and updated by packet processing threads without locking.
+	// Creation, tcp state changes, aging and configuration are serialized by mu.
+	mu sync.Mutex
+	// Sessions indexed by key in both directions; values are *session.
+	byKey     sync.Map
+	nSessions uint
+
+	// Default per interface session limit; zero means unlimited.
+	defaultLimit uint
+	perSi        []siSessions
+
+	timeouts      [nSessionTimeout]float64
+	timeoutCycles [nSessionTimeout]cpu.Time
+
+	counters sessionCounters
+
+	ageEvent sessionAgeEvent
+}
+
+// Interval in seconds between session aging scans.
+const sessionAgeInterval = 1
+
+func (m *sessionMain) init(v *vnet.Vnet) {
+	for t := range m.timeouts {
+		if m.timeouts[t] == 0 {
+			m.timeouts[t] = defaultSessionTimeouts[t]
+		}
+		m.timeoutCycles[t].Cycles(m.timeouts[t])
+	}
+	m.ageEvent.m = m
+	v.SignalEventAfter(&m.ageEvent, sessionAgeInterval)
+}
+
+func (m *sessionMain) siSessions(si vnet.Si) *siSessions {
+	if i := uint(si); i >= uint(len(m.perSi)) {
+		m.perSi = append(m.perSi, make([]siSessions, 1+i-uint(len(m.perSi)))...)
+	}
+	return &m.perSi[si]
+}
+
+// Lookup session for packet; dir is 0 for packets from initiator and 1 for packets from responder.
+func (m *sessionMain) lookup(k *sessionKey) (s *session, dir int, ok bool) {
+	var x interface{}
+	if x, ok = m.byKey.Load(*k); ok {
+		if s = x.(*session); s.key != *k {
+			dir = 1
+		}
+	}
+	return
+}
+
+func (s *session) getState() sessionState {
+	return sessionState(atomic.LoadUint32((*uint32)(&s.state)))
+}
+
+func (s *session) getLastUsed() cpu.Time {
+	return cpu.Time(atomic.LoadUint64((*uint64)(&s.lastUsed)))
+}
+
+func (s *session) getCounter(dir int) (c vnet.CombinedCounter) {
+	c.Packets = atomic.LoadUint64(&s.counters[dir].Packets)
+	c.Bytes = atomic.LoadUint64(&s.counters[dir].Bytes)
+	return
+}
+
+// Update session for permitted packet.  Only tcp packets which may change state take the lock.
+func (m *sessionMain) update(s *session, dir int, k *key, nBytes uint, now cpu.Time) {
+	atomic.StoreUint64((*uint64)(&s.lastUsed), uint64(now))
+	atomic.AddUint64(&s.counters[dir].Packets, 1)
+	atomic.AddUint64(&s.counters[dir].Bytes, uint64(nBytes))
+	if s.key.protocol != ip.TCP {
+		return
+	}
+	if s.getState() == tcpEstablished && k.tcpFlags&(TcpFlagSyn|TcpFlagFin|TcpFlagRst) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.updateTcp(dir, k.tcpFlags)
+}
+
+// Create session for permitted packet unless another thread created it first; returns false
+// when interface session limit is reached.
+func (m *sessionMain) create(sk *sessionKey, k *key, si vnet.Si, nBytes uint, now cpu.Time) (ok bool) {
+	m.mu.Lock()
+	if s, dir, found := m.lookup(sk); found {
+		m.mu.Unlock()
+		m.update(s, dir, k, nBytes, now)
+		return true
+	}
+	defer m.mu.Unlock()
+	ss := m.siSessions(si)
+	limit := ss.limit
+	if limit == 0 {
+		limit = m.defaultLimit
+	}
+	if limit != 0 && ss.count >= limit {
+		m.counters.LimitExceeded++
+		return
+	}
+	ss.count++
+	s := &session{key: *sk, si: si, created: now, lastUsed: now}
+	s.counters[0] = vnet.CombinedCounter{Packets: 1, Bytes: uint64(nBytes)}
+	if sk.protocol == ip.TCP {
+		switch f := k.tcpFlags; {
+		case f&TcpFlagRst != 0:
+			s.state = tcpClosed
+		case f&(TcpFlagSyn|TcpFlagAck) == TcpFlagSyn:
+			s.state = tcpSynSent
+		default:
+			// Connection picked up mid-stream.
+			s.state = tcpEstablished
+		}
+	}
+	m.byKey.Store(*sk, s)
+	m.byKey.Store(sk.reverse(), s)
+	m.nSessions++
+	m.counters.Created++
+	return true
+}
+
+// Must be called with lock held.
+func (m *sessionMain) del(s *session) {
+	m.byKey.Delete(s.key)
+	m.byKey.Delete(s.key.reverse())
+	m.perSi[s.si].count--
+	m.nSessions--
+}
+
+// Calls fn for each session.  Must be called with lock held.
+func (m *sessionMain) foreach(fn func(s *session)) {
+	m.byKey.Range(func(k, x interface{}) bool {
+		// Sessions appear twice; skip reverse key.
+		if s := x.(*session); s.key == k.(sessionKey) {
+			fn(s)
+		}
+		return true
+	})
+}
+
+func (m *sessionMain) age(now cpu.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.foreach(func(s *session) {
+		// Packets on other threads may have been seen after now was sampled.
+		if last := s.getLastUsed(); now > last && now-last > m.timeoutCycles[s.timeout()] {
+			m.del(s)
+			m.counters.Aged++
+		}
+	})
+}
+
+// Delete all sessions or, if si is not SiNil, sessions created on given interface.
+func (m *sessionMain) clear(si vnet.Si) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.foreach(func(s *session) {
+		if si == vnet.SiNil || s.si == si {
+			m.del(s)
+		}
+	})
+}
+
+type sessionAgeEvent struct {
+	vnet.Event
+	m *sessionMain
+}
+
+func (e *sessionAgeEvent) String() string { return "acl session aging" }
+func (e *sessionAgeEvent) EventAction() {
+	e.m.age(cpu.TimeNow())
+	e.SignalEventAfter(e, sessionAgeInterval)
+}
+
+// SetSessionLimit sets maximum number of sessions created on given interface; zero means
+// use default limit.  With si SiNil default limit is set (zero meaning unlimited).
+func (m *Main) SetSessionLimit(si vnet.Si, limit uint) {
+	sm := &m.sessionMain
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if si == vnet.SiNil {
+		sm.defaultLimit = limit
+	} else {
+		sm.siSessions(si).limit = limit
+	}
+}
+
+// Set idle timeout in seconds for given kind of session.
+func (m *Main) setSessionTimeout(t sessionTimeout, seconds float64) (err error) {
+	if seconds <= 0 {
+		return fmt.Errorf("session timeout must be positive: %v", seconds)
+	}
+	sm := &m.sessionMain
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.timeouts[t] = seconds
+	sm.timeoutCycles[t].Cycles(seconds)
+	return
+}
+
+// ClearSessions deletes all sessions.
+func (m *Main) ClearSessions() { m.sessionMain.clear(vnet.SiNil) }
+
+func (v value) ip(is6 bool) net.IP {
+	if !is6 {
+		return net.IPv4(byte(v.lo>>24), byte(v.lo>>16), byte(v.lo>>8), byte(v.lo)).To4()
+	}
+	a := make(net.IP, net.IPv6len)
+	for i := 0; i < 8; i++ {
+		a[7-i] = byte(v.hi >> uint(8*i))
+		a[15-i] = byte(v.lo >> uint(8*i))
+	}
+	return a
+}
+
+func (s *sessionKey) endpoints() (src, dst string) {
+	src, dst = s.src.ip(s.is6).String(), s.dst.ip(s.is6).String()
+	if hasPorts(s.protocol) {
+		src = net.JoinHostPort(src, fmt.Sprintf("%d", s.sport))
+		dst = net.JoinHostPort(dst, fmt.Sprintf("%d", s.dport))
+	} else if s.sport != 0 {
+		dst += fmt.Sprintf(" id %d", s.sport)
+	}
+	return
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bfd
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"net"
+	"testing"
+	"time"
+)
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+func TestControl(t *testing.T) {
+	c := control{
+		diag:     DiagNeighborDown,
+		state:    StateInit,
+		flags:    flagPoll,
+		mult:     3,
+		myDisc:   0x12345678,
+		yourDisc: 7,
+		minTx:    100000,
+		minRx:    300000,
+	}
+	var b [sizeofPacket]byte
+	c.packet(b[:], []byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, minSourcePort+1)
+	src, ttl, payload, ok := parsePacket(b[:])
+	if !ok || !net.IP(src).Equal(net.IPv4(10, 0, 0, 1)) || ttl != 255 || len(payload) != sizeofControl {
+		t.Fatalf("parse % x", b)
+	}
+	var d control
+	if err := d.decode(payload); err != nil || d != c {
+		t.Errorf("got %+v want %+v: %v", d, c, err)
+	}
+
+	bad := []func(x []byte){
+		func(x []byte) { x[0] = 2<<5 | x[0]&0x1f },
+		func(x []byte) { x[2] = 0 },
+		func(x []byte) { x[1] |= flagAuth },
+		func(x []byte) { put32(x[4:], 0) },
+		// Zero your discriminator only in down states.
+		func(x []byte) { put32(x[8:], 0) },
+		func(x []byte) { x[3] = sizeofControl + 1 },
+	}
+	for i, f := range bad {
+		x := append([]byte(nil), payload...)
+		f(x)
+		if err := d.decode(x); err == nil {
+			t.Errorf("bad packet %d decoded", i)
+		}
+	}
+	if _, _, _, ok := parsePacket(b[:sizeofPacket-sizeofControl-1]); ok {
+		t.Errorf("truncated packet parsed")
+	}
+}
+
+// Pass queued control packets from one side to the other.
+func deliver(from, to *Main, now cpu.Time) (n int) {
+	for _, f := range from.frames {
+		src, t, b, ok := parsePacket(f.b[:])
+		if !ok {
+			panic("parse")
+		}
+		if e := to.input(1, src, t, b, now); e != rx_error_control {
+			panic(e)
+		}
+		n++
+	}
+	from.frames = nil
+	return
+}
+
+func newSession(m *Main, local, peer net.IP) *session {
+	c := SessionConfig{
+		Si:         1,
+		Peer:       peer,
+		MinTx:      100 * time.Millisecond,
+		MinRx:      100 * time.Millisecond,
+		Multiplier: 3,
+	}
+	s := m.addSession(&c, 0)
+	copy(s.local[:], local)
+	s.resolved = true
+	return s
+}
+
+func TestSession(t *testing.T) {
+	a, b := &Main{}, &Main{}
+	aIP, bIP := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	sa, sb := newSession(a, aIP, bIP), newSession(b, bIP, aIP)
+
+	// Three way handshake: down, init, up.
+	now := seconds(10)
+	for i := 0; i < 30; i++ {
+		now += seconds(.1)
+		a.timer(now)
+		deliver(a, b, now)
+		b.timer(now)
+		deliver(b, a, now)
+	}
+	if sa.State != StateUp || sb.State != StateUp || sa.RemoteDisc != sb.LocalDisc {
+		t.Fatalf("states %s %s", sa.State, sb.State)
+	}
+	if len(a.changes) != 1 || len(b.changes) != 1 {
+		t.Errorf("changes %d %d", len(a.changes), len(b.changes))
+	}
+	// Poll sequence for faster transmission started when coming up ends when final is received.
+	if sa.poll || sb.poll {
+		t.Errorf("poll sequence not terminated")
+	}
+	if x, y := sa.txInterval(), sa.detectTime(); x != 100000 || y != 300000 {
+		t.Errorf("tx interval %d detect time %d", x, y)
+	}
+
+	// Packets from a stop; b detects down after detection time.
+	b.changes = nil
+	b.timer(now + seconds(.25))
+	if sb.State != StateUp {
+		t.Errorf("down before detection time")
+	}
+	b.timer(now + seconds(.31))
+	if sb.State != StateDown || sb.Diag != DiagDetectTimeExpired || sb.RemoteDisc != 0 || sb.Flaps != 1 {
+		t.Errorf("state %s diag %s", sb.State, sb.Diag)
+	}
+	if len(b.changes) != 1 || b.changes[0] != sb {
+		t.Errorf("changes %v", b.changes)
+	}
+
+	// a hears b is down and goes down as well.
+	deliver(b, a, now+seconds(.31))
+	if sa.State != StateDown || sa.Diag != DiagNeighborDown {
+		t.Errorf("state %s diag %s", sa.State, sa.Diag)
+	}
+
+	// Packets with wrong ttl or for unknown sessions are rejected.
+	var x [sizeofPacket]byte
+	c := sa.control()
+	c.packet(x[:], aIP, bIP, sa.srcPort)
+	src, _, p, _ := parsePacket(x[:])
+	if e := b.input(1, src, 254, p, now); e != rx_error_ttl {
+		t.Errorf("ttl error %d", e)
+	}
+	if e := b.input(2, src, 255, p, now); e != rx_error_no_session {
+		t.Errorf("session error %d", e)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bfd
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"time"
+)
+
+// bfd session add INTERFACE ADDRESS [local ADDRESS] [min-tx MS] [min-rx MS] [multiplier N]
+// bfd session del INTERFACE ADDRESS
+func (m *Main) sessionConfig(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		cf          SessionConfig
+		peer, local ip4.Address
+		isDel       bool
+		msec, mult  uint
+	)
+	switch {
+	case in.Parse("add %v %v", &cf.Si, m.Vnet, &peer):
+	case in.Parse("del %v %v", &cf.Si, m.Vnet, &peer):
+		isDel = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	cf.Peer = peer.ToNetIP()
+	for !in.End() {
+		switch {
+		case in.Parse("local %v", &local):
+			cf.Local = local.ToNetIP()
+		case in.Parse("min-tx %d", &msec) && msec > 0:
+			cf.MinTx = time.Duration(msec) * time.Millisecond
+		case in.Parse("min-rx %d", &msec) && msec > 0:
+			cf.MinRx = time.Duration(msec) * time.Millisecond
+		case in.Parse("multiplier %d", &mult) && mult > 0 && mult <= 255:
+			cf.Multiplier = uint8(mult)
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	return m.AddDelSession(&cf, isDel)
+}
+
+type showSession struct {
+	Interface string `format:"%-30s" align:"left"`
+	Peer      string `format:"%-16s" align:"left"`
+	State     string `format:"%-10s" align:"left"`
+	Remote    string `format:"%-10s" align:"left"`
+	Tx        string `format:"%8s"`
+	Detect    string `format:"%8s"`
+	Flaps     uint64 `format:"%8d"`
+	Diag      string `format:"%-30s" align:"left"`
+}
+
+func ms(d time.Duration) string { return fmt.Sprintf("%dms", d/time.Millisecond) }
+
+// show bfd sessions [detail]
+func (m *Main) showSessions(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var detail bool
+	for !in.End() {
+		switch {
+		case in.Parse("d%*etail"):
+			detail = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	ss := m.Sessions()
+	if len(ss) == 0 {
+		fmt.Fprintln(w, "No bfd sessions")
+		return
+	}
+	if detail {
+		for i := range ss {
+			s := &ss[i]
+			local := "interface address"
+			if s.Local != nil {
+				local = s.Local.String()
+			}
+			fmt.Fprintf(w, "%s peer %s local %s: %s, remote %s, diag %s\n",
+				vnet.SiName{V: v, Si: s.Si}, s.Peer, local, s.State, s.RemoteState, s.Diag)
+			fmt.Fprintf(w, "  discriminators local %d remote %d\n", s.LocalDisc, s.RemoteDisc)
+			fmt.Fprintf(w, "  min-tx %s min-rx %s multiplier %d, tx interval %s, detect time %s\n",
+				ms(s.MinTx), ms(s.MinRx), s.Multiplier, ms(s.TxInterval), ms(s.DetectTime))
+			fmt.Fprintf(w, "  tx %d rx %d flaps %d\n", s.Tx, s.Rx, s.Flaps)
+		}
+		return
+	}
+	var xs []showSession
+	for i := range ss {
+		s := &ss[i]
+		xs = append(xs, showSession{
+			Interface: vnet.SiName{V: v, Si: s.Si}.String(),
+			Peer:      s.Peer.String(),
+			State:     s.State.String(),
+			Remote:    s.RemoteState.String(),
+			Tx:        ms(s.TxInterval),
+			Detect:    ms(s.DetectTime),
+			Flaps:     s.Flaps,
+			Diag:      s.Diag.String(),
+		})
+	}
+	elib.Tabulate(xs).Write(w)
+	return
+}
+
+// clear bfd
+func (m *Main) clearBfd(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.ClearCounters()
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "bfd session",
+			ShortHelp: "add/delete bfd session: bfd session add|del INTERFACE ADDRESS [local ADDRESS] [min-tx MS] [min-rx MS] [multiplier N]",
+			Action:    m.sessionConfig,
+		},
+		cli.Command{
+			Name:      "show bfd sessions",
+			ShortHelp: "show bfd sessions [detail]",
+			Action:    m.showSessions,
+		},
+		cli.Command{
+			Name:      "clear bfd",
+			ShortHelp: "zero bfd session counters",
+			Action:    m.clearBfd,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bfd
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+)
+
+const (
+	rx_next_error uint = iota
+	rx_next_punt
+)
+
+const (
+	rx_error_control uint = iota
+	rx_error_malformed
+	rx_error_ttl
+	rx_error_no_session
+)
+
+// Node receiving control packets.  Packets must start with ip4 header.
+type rxNode struct {
+	vnet.InOutNode
+	m *Main
+}
+
+func (n *rxNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{
+		rx_next_error: "error",
+		rx_next_punt:  "punt",
+	}
+	n.Errors = []string{
+		rx_error_control:    "bfd control packets",
+		rx_error_malformed:  "malformed bfd control packet",
+		rx_error_ttl:        "bfd ttl not 255",
+		rx_error_no_session: "no bfd session",
+	}
+	v.RegisterInOutNode(n, "bfd-input")
+}
+
+func (n *rxNode) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		x0 := rx_next_punt
+		if src, t, b, ok := parsePacket(r0.DataSlice()); ok && !r0.NextIsValid() {
+			n.SetError(r0, m.input(r0.Si, src, t, b, now))
+			x0 = rx_next_error
+		}
+		q.Put1(r0, x0)
+		i++
+	}
+	m.notify()
+}
+
+// Maximum number of control packets waiting for transmission.
+const maxFrames = vnet.MaxVectorLen
+
+// Node running session timers and transmitting control packets.  Nexts to interface output
+// nodes are added with session rewrites.
+type txNode struct {
+	vnet.InputNode
+	m    *Main
+	pool vnet.BufferPool
+	tmp  vnet.RefVec
+}
+
+func (n *txNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "bfd-tx")
+	p := &n.pool
+	p.BufferTemplate = vnet.DefaultBufferPool.BufferTemplate
+	p.Name = "bfd-tx"
+	v.AddBufferPool(p)
+}
+
+func (n *txNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+	now := cpu.TimeNow()
+	next := m.timer(now)
+
+	m.mu.Lock()
+	done := 0
+	for ; done < len(m.frames); done++ {
+		f := &m.frames[done]
+		out := &o.Outs[f.s.rw.NextIndex]
+		if out.GetLen(v) >= out.Cap() {
+			break
+		}
+		n.tmp.Validate(0)
+		n.pool.AllocRefs(n.tmp[:1])
+		r := n.tmp[0]
+		r.SetDataLen(sizeofPacket)
+		copy(r.DataSlice(), f.b[:])
+		vnet.PerformRewrite(&r, &f.s.rw)
+		r.Si = f.s.rw.Si
+		out.BufferPool = &n.pool
+		out.Refs[out.AddLen(v)] = r
+	}
+	l := copy(m.frames, m.frames[done:])
+	m.frames = m.frames[:l]
+	m.mu.Unlock()
+	m.notify()
+
+	// Remain active for waits too small to schedule.
+	dt := float64(0)
+	if next > now {
+		dt = (next - now).Seconds()
+	}
+	switch {
+	case l > 0 || (next != 0 && dt <= 10e-6):
+		n.Activate(true)
+	case next == 0:
+		n.Activate(false)
+	default:
+		n.ActivateAfter(dt)
+	}
+}
@@ -0,0 +1,576 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bfd provides single hop bidirectional forwarding detection (RFC 5880, RFC 5881)
+// in asynchronous mode.
+//
+// Sessions are configured per interface and ip4 peer address.  Ip4 input sends
+// packets for the bfd control port on local addresses to the bfd-input node;
+// control packets are consumed and run the session state machine while other
+// packets are punted.  The bfd-tx node runs transmit and detection timers in
+// the vnet loop and sends control packets via the peer's neighbor rewrite.
+// When a session which has been up goes down, its peer is withdrawn as next
+// hop from the multipath adjacencies of all routes via it; it is restored when
+// the session comes back up.
+package bfd
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip4"
+
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+var packageIndex uint
+
+type SessionConfig struct {
+	Si   vnet.Si
+	Peer net.IP
+	// Source address; first ip4 address of interface when nil.
+	Local net.IP
+	// Desired minimum transmit and required minimum receive intervals.
+	MinTx, MinRx time.Duration
+	// Detection time multiplier.
+	Multiplier uint8
+}
+
+// Session status.
+type Session struct {
+	SessionConfig
+	State, RemoteState State
+	// Reason of last state change.
+	Diag                  Diag
+	LocalDisc, RemoteDisc uint32
+	// Negotiated transmit interval and detection time.
+	TxInterval, DetectTime time.Duration
+	// Packets sent and received; number of times session went down from up.
+	Tx, Rx, Flaps uint64
+}
+
+// StateHook is called when a session comes up or goes down from up.
+type StateHook func(c *SessionConfig, s State)
+
+type peerKey struct {
+	si vnet.Si
+	a  ip4.Address
+}
+
+type session struct {
+	Session
+
+	peer, local ip4.Address
+	srcPort     uint
+
+	// Remote intervals in microseconds.
+	remoteMinTx, remoteMinRx uint32
+	remoteMult               uint8
+
+	// Set while poll sequence is in progress; set final to answer poll in next packet.
+	poll, final bool
+
+	nextTx, detect cpu.Time
+
+	// Rewrite to peer; valid when resolved is set.
+	rw       vnet.Rewrite
+	resolved bool
+}
+
+// Control packet waiting for transmission.
+type frame struct {
+	s *session
+	b [sizeofPacket]byte
+}
+
+type Main struct {
+	vnet.Package
+
+	ip4Main *ip4.Main
+
+	// Defaults for sessions added without intervals or multiplier.
+	MinTx, MinRx time.Duration
+	Multiplier   uint8
+
+	mu       sync.Mutex
+	sessions map[uint32]*session
+	peers    map[peerKey]*session
+	frames   []frame
+
+	hooks   []StateHook
+	changes []*session
+
+	rxNode rxNode
+	txNode txNode
+
+	resolveEvent resolveEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{
+		MinTx:      300 * time.Millisecond,
+		MinRx:      300 * time.Millisecond,
+		Multiplier: 3,
+	}
+	packageIndex = v.AddPackage("bfd", m)
+	m.DependsOn("ip4")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. bfd { min-tx 100 min-rx 100 multiplier 3 } with intervals in milliseconds.
+func (m *Main) Configure(in *parse.Input) {
+	var ms, mult uint
+	for !in.End() {
+		switch {
+		case in.Parse("min-tx %d", &ms) && ms > 0:
+			m.MinTx = time.Duration(ms) * time.Millisecond
+		case in.Parse("min-rx %d", &ms):
+			m.MinRx = time.Duration(ms) * time.Millisecond
+		case in.Parse("multiplier %d", &mult) && mult > 0 && mult <= 255:
+			m.Multiplier = uint8(mult)
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between resolving session addresses and rewrites.
+const resolveInterval = 1
+
+type resolveEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *resolveEvent) String() string { return "bfd resolve" }
+func (e *resolveEvent) EventAction() {
+	e.m.resolveAll()
+	e.SignalEventAfter(e, resolveInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.ip4Main = ip4.GetMain(v)
+	m.rxNode.init(v, m)
+	m.txNode.init(v, m)
+	m.ip4Main.RegisterUdpLocalPort(controlPort, "bfd-input")
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.resolveEvent.m = m
+	v.SignalEventAfter(&m.resolveEvent, resolveInterval)
+	m.cliInit()
+	return
+}
+
+// RegisterStateHook registers function called when sessions come up or go down.
+func (m *Main) RegisterStateHook(h StateHook) {
+	m.mu.Lock()
+	m.hooks = append(m.hooks, h)
+	m.mu.Unlock()
+}
+
+// AddDelSession adds or deletes session with given interface and peer.  Adding an existing
+// session changes its intervals and multiplier.  Deleting a session restores its peer as next hop.
+func (m *Main) AddDelSession(c *SessionConfig, isDel bool) (err error) {
+	v := m.Vnet
+	peer := c.Peer.To4()
+	if peer == nil {
+		return fmt.Errorf("%s: peer is not an ip4 address", c.Peer)
+	}
+	if c.Local != nil && c.Local.To4() == nil {
+		return fmt.Errorf("%s: local is not an ip4 address", c.Local)
+	}
+	k := peerKey{si: c.Si, a: ip4.NetIPToV4Address(peer)}
+	if isDel {
+		m.mu.Lock()
+		s, ok := m.peers[k]
+		if ok {
+			m.delSession(s)
+		}
+		m.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("%s %s: no bfd session", vnet.SiName{V: v, Si: c.Si}, peer)
+		}
+		return m.ip4Main.SetNextHopDown(c.Si, peer, false)
+	}
+	if v.SupHwIf(v.SwIf(c.Si)) == nil {
+		return fmt.Errorf("%s: no hardware interface", vnet.SiName{V: v, Si: c.Si})
+	}
+	cf := *c
+	cf.Peer = peer
+	if cf.MinTx == 0 {
+		cf.MinTx = m.MinTx
+	}
+	if cf.MinRx == 0 {
+		cf.MinRx = m.MinRx
+	}
+	if cf.Multiplier == 0 {
+		cf.Multiplier = m.Multiplier
+	}
+	now := cpu.TimeNow()
+	m.mu.Lock()
+	m.addSession(&cf, now)
+	m.mu.Unlock()
+	m.resolveAll()
+	m.txNode.Activate(true)
+	return
+}
+
+// Add session or update configuration of existing session.  Called with lock held.
+func (m *Main) addSession(c *SessionConfig, now cpu.Time) (s *session) {
+	k := peerKey{si: c.Si, a: ip4.NetIPToV4Address(c.Peer)}
+	if s, ok := m.peers[k]; ok {
+		s.SessionConfig = *c
+		// Changed parameters are announced with poll sequence.
+		if s.State == StateUp {
+			s.poll = true
+		}
+		s.nextTx = now
+		return s
+	}
+	s = &session{}
+	s.SessionConfig = *c
+	s.peer = k.a
+	s.State, s.RemoteState = StateDown, StateDown
+	s.remoteMinRx = 1
+	for s.LocalDisc == 0 || m.sessions[s.LocalDisc] != nil {
+		s.LocalDisc = rand.Uint32()
+	}
+	s.srcPort = minSourcePort + uint(s.LocalDisc%(1<<14))
+	s.nextTx = now
+	if m.sessions == nil {
+		m.sessions = make(map[uint32]*session)
+		m.peers = make(map[peerKey]*session)
+	}
+	m.sessions[s.LocalDisc] = s
+	m.peers[k] = s
+	return
+}
+
+// Called with lock held.
+func (m *Main) delSession(s *session) {
+	delete(m.sessions, s.LocalDisc)
+	delete(m.peers, peerKey{si: s.Si, a: s.peer})
+}
+
+// Sessions returns status of all sessions sorted by interface and peer.
+func (m *Main) Sessions() (ss []Session) {
+	m.mu.Lock()
+	for _, s := range m.peers {
+		x := s.Session
+		x.Peer = append(net.IP(nil), s.Peer...)
+		x.TxInterval = time.Duration(s.txInterval()) * time.Microsecond
+		x.DetectTime = time.Duration(s.detectTime()) * time.Microsecond
+		ss = append(ss, x)
+	}
+	m.mu.Unlock()
+	sort.Slice(ss, func(i, j int) bool {
+		a, b := &ss[i], &ss[j]
+		if a.Si != b.Si {
+			return a.Si < b.Si
+		}
+		return bytes.Compare(a.Peer, b.Peer) < 0
+	})
+	return
+}
+
+// ClearCounters zeros packet and flap counters of all sessions.
+func (m *Main) ClearCounters() {
+	m.mu.Lock()
+	for _, s := range m.sessions {
+		s.Tx, s.Rx, s.Flaps = 0, 0, 0
+	}
+	m.mu.Unlock()
+}
+
+func micros(d time.Duration) uint64 { return uint64(d / time.Microsecond) }
+
+func after(now cpu.Time, us uint64) cpu.Time {
+	var dt cpu.Time
+	dt.Cycles(float64(us) * 1e-6)
+	return now + dt
+}
+
+// Sessions which are not up transmit at most once per second (RFC 5880 section 6.8.3).
+const slowTxInterval = 1e6
+
+func (s *session) desiredMinTx() (x uint64) {
+	x = micros(s.MinTx)
+	if s.State != StateUp && x < slowTxInterval {
+		x = slowTxInterval
+	}
+	return
+}
+
+// Transmit interval in microseconds.
+func (s *session) txInterval() (x uint64) {
+	x = s.desiredMinTx()
+	if r := uint64(s.remoteMinRx); r > x {
+		x = r
+	}
+	return
+}
+
+// Detection time in microseconds.
+func (s *session) detectTime() (x uint64) {
+	x = micros(s.MinRx)
+	if r := uint64(s.remoteMinTx); r > x {
+		x = r
+	}
+	return uint64(s.remoteMult) * x
+}
+
+// Transmit interval with 0-25% jitter or 10-25% with multiplier 1 (RFC 5880 section 6.8.7).
+func (s *session) jitteredTxInterval() uint64 {
+	f := 0.75 + 0.25*rand.Float64()
+	if s.Multiplier == 1 {
+		f = 0.75 + 0.15*rand.Float64()
+	}
+	return uint64(f * float64(s.txInterval()))
+}
+
+// Called with lock held.
+func (m *Main) setState(s *session, state State, diag Diag, now cpu.Time) {
+	old := s.State
+	s.State, s.Diag = state, diag
+	// Slower transmit interval changes when session comes up.
+	if state == StateUp {
+		s.poll = true
+	}
+	if old == StateUp {
+		s.Flaps++
+	}
+	if old == StateUp || state == StateUp {
+		m.changes = append(m.changes, s)
+	}
+	// Announce new state at once.
+	s.nextTx = now
+}
+
+// Run state machine for received control packet (RFC 5880 section 6.8.6).  Called with lock held.
+func (m *Main) receive(s *session, c *control, now cpu.Time) {
+	s.Rx++
+	s.RemoteDisc = c.myDisc
+	s.RemoteState = c.state
+	s.remoteMinTx, s.remoteMinRx, s.remoteMult = c.minTx, c.minRx, c.mult
+	if c.flags&flagFinal != 0 {
+		s.poll = false
+	}
+	s.detect = after(now, s.detectTime())
+
+	if s.State == StateAdminDown {
+		return
+	}
+	if c.state == StateAdminDown {
+		if s.State != StateDown {
+			m.setState(s, StateDown, DiagNeighborDown, now)
+		}
+	} else {
+		switch s.State {
+		case StateDown:
+			switch c.state {
+			case StateDown:
+				m.setState(s, StateInit, DiagNone, now)
+			case StateInit:
+				m.setState(s, StateUp, DiagNone, now)
+			}
+		case StateInit:
+			if c.state == StateInit || c.state == StateUp {
+				m.setState(s, StateUp, DiagNone, now)
+			}
+		case StateUp:
+			if c.state == StateDown {
+				m.setState(s, StateDown, DiagNeighborDown, now)
+			}
+		}
+	}
+	if c.flags&flagPoll != 0 {
+		s.final = true
+		s.nextTx = now
+	}
+	// Remote may ask for faster transmission.
+	if t := after(now, s.jitteredTxInterval()); t < s.nextTx {
+		s.nextTx = t
+	}
+}
+
+// Handle received ip4 control packet from given source.  Returns rx node error.
+func (m *Main) input(si vnet.Si, src []byte, t uint8, b []byte, now cpu.Time) uint {
+	var c control
+	if err := c.decode(b); err != nil {
+		return rx_error_malformed
+	}
+	if t != ttl {
+		return rx_error_ttl
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var (
+		s  *session
+		ok bool
+	)
+	if c.yourDisc != 0 {
+		s, ok = m.sessions[c.yourDisc]
+		ok = ok && s.Si == si
+	} else {
+		var k peerKey
+		k.si = si
+		copy(k.a[:], src)
+		s, ok = m.peers[k]
+	}
+	if !ok {
+		return rx_error_no_session
+	}
+	m.receive(s, &c, now)
+	return rx_error_control
+}
+
+// Control packet for session.  Called with lock held.
+func (s *session) control() (c control) {
+	c.diag, c.state = s.Diag, s.State
+	c.mult = s.Multiplier
+	c.myDisc, c.yourDisc = s.LocalDisc, s.RemoteDisc
+	c.minTx = uint32(s.desiredMinTx())
+	c.minRx = uint32(micros(s.MinRx))
+	// Poll and final must not both be set.
+	if s.final {
+		c.flags |= flagFinal
+		s.final = false
+	} else if s.poll {
+		c.flags |= flagPoll
+	}
+	return
+}
+
+// Run detection and transmit timers.  Queues due control packets and returns time of
+// next timer expiry or zero when there are no sessions.
+func (m *Main) timer(now cpu.Time) (next cpu.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.detect != 0 && now >= s.detect {
+			s.detect = 0
+			s.RemoteDisc = 0
+			if s.State == StateInit || s.State == StateUp {
+				m.setState(s, StateDown, DiagDetectTimeExpired, now)
+			}
+		}
+		if now >= s.nextTx {
+			// No periodic transmission when remote does not want packets.
+			if s.resolved && (s.remoteMinRx != 0 || s.final) && len(m.frames) < maxFrames {
+				m.frames = append(m.frames, frame{s: s})
+				f := &m.frames[len(m.frames)-1]
+				c := s.control()
+				c.packet(f.b[:], s.local[:], s.peer[:], s.srcPort)
+				s.Tx++
+			}
+			s.nextTx = after(now, s.jitteredTxInterval())
+		}
+		if next == 0 || s.nextTx < next {
+			next = s.nextTx
+		}
+		if s.detect != 0 && s.detect < next {
+			next = s.detect
+		}
+	}
+	return
+}
+
+type stateEvent struct {
+	vnet.Event
+	m  *Main
+	ss []*session
+}
+
+func (e *stateEvent) String() string { return "bfd state change" }
+func (e *stateEvent) EventAction()   { e.m.changed(e.ss) }
+
+// Signal event to act on queued state changes.
+func (m *Main) notify() {
+	m.mu.Lock()
+	ss := m.changes
+	m.changes = nil
+	m.mu.Unlock()
+	if len(ss) > 0 {
+		m.Vnet.SignalEvent(&stateEvent{m: m, ss: ss})
+	}
+}
+
+// Withdraw or restore next hops and call hooks for changed sessions.  Sessions deleted since
+// their change was queued are ignored.  Called in event context.
+func (m *Main) changed(ss []*session) {
+	for _, s := range ss {
+		m.mu.Lock()
+		cur, ok := m.peers[peerKey{si: s.Si, a: s.peer}]
+		state, c, hs := s.State, s.SessionConfig, m.hooks
+		m.mu.Unlock()
+		if !ok || cur != s {
+			continue
+		}
+		m.ip4Main.SetNextHopDown(c.Si, c.Peer, state != StateUp)
+		for _, h := range hs {
+			h(&c, state)
+		}
+	}
+}
+
+// Resolve local address and rewrite to peer of each session.
+func (m *Main) resolveAll() {
+	v := m.Vnet
+	m.mu.Lock()
+	ss := make([]*session, 0, len(m.peers))
+	for _, s := range m.peers {
+		ss = append(ss, s)
+	}
+	m.mu.Unlock()
+	for _, s := range ss {
+		var (
+			local    ip4.Address
+			rw       vnet.Rewrite
+			resolved bool
+		)
+		if s.Local != nil {
+			local = ip4.NetIPToV4Address(s.Local)
+		} else if a := m.ip4Main.IfFirstAddress(s.Si); a != nil {
+			local = ip4.NetIPToV4Address(a.Prefix.IP)
+		}
+		fi := m.ip4Main.FibIndexForSi(s.Si)
+		// Peer must be a resolved neighbor on session interface.
+		if as, ok := m.ip4Main.LookupAdjacency(fi, s.Peer); ok && len(as) == 1 && as[0].IsRewrite() && as[0].Si == s.Si {
+			if h := v.SupHwIf(v.SwIf(s.Si)); h != nil && !local.IsZero() {
+				rw = as[0].Rewrite
+				v.SetRewriteNodeHwIf(&rw, h, &m.txNode)
+				resolved = true
+			}
+		}
+		m.mu.Lock()
+		s.local, s.rw, s.resolved = local, rw, resolved
+		m.mu.Unlock()
+	}
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if !isDel {
+		return
+	}
+	var peers []net.IP
+	m.mu.Lock()
+	for _, s := range m.peers {
+		if s.Si == si {
+			m.delSession(s)
+			peers = append(peers, s.Peer)
+		}
+	}
+	m.mu.Unlock()
+	for _, a := range peers {
+		m.ip4Main.SetNextHopDown(si, a, false)
+	}
+	return
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bfd
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+)
+
+const (
+	// Udp destination port of single hop control packets (RFC 5881).
+	controlPort = 3784
+	// Source ports are taken from this range.
+	minSourcePort = 49152
+
+	version = 1
+
+	sizeofIp4Header = 20
+	sizeofUdpHeader = 8
+	sizeofControl   = 24
+	sizeofPacket    = sizeofIp4Header + sizeofUdpHeader + sizeofControl
+
+	// Single hop packets are sent with and must be received with maximum ttl.
+	ttl = 255
+)
+
+// Session state.
+type State uint8
+
+const (
+	StateAdminDown State = iota
+	StateDown
+	StateInit
+	StateUp
+)
+
+var stateStrings = [...]string{
+	StateAdminDown: "admin-down",
+	StateDown:      "down",
+	StateInit:      "init",
+	StateUp:        "up",
+}
+
+func (x State) String() string { return elib.Stringer(stateStrings[:], int(x)) }
+
+// Diagnostic code giving reason of last state change.
+type Diag uint8
+
+const (
+	DiagNone Diag = iota
+	DiagDetectTimeExpired
+	DiagEchoFailed
+	DiagNeighborDown
+	DiagForwardingReset
+	DiagPathDown
+	DiagConcatenatedPathDown
+	DiagAdminDown
+	DiagReverseConcatenatedPathDown
+)
+
+var diagStrings = [...]string{
+	DiagNone:                        "none",
+	DiagDetectTimeExpired:           "control detection time expired",
+	DiagEchoFailed:                  "echo function failed",
+	DiagNeighborDown:                "neighbor signaled session down",
+	DiagForwardingReset:             "forwarding plane reset",
+	DiagPathDown:                    "path down",
+	DiagConcatenatedPathDown:        "concatenated path down",
+	DiagAdminDown:                   "administratively down",
+	DiagReverseConcatenatedPathDown: "reverse concatenated path down",
+}
+
+func (x Diag) String() string { return elib.Stringer(diagStrings[:], int(x)) }
+
+// Flags in second byte of control packet.
+const (
+	flagPoll          = 1 << 5
+	flagFinal         = 1 << 4
+	flagCpIndependent = 1 << 3
+	flagAuth          = 1 << 2
+	flagDemand        = 1 << 1
+	flagMultipoint    = 1 << 0
+)
+
+// Control packet (RFC 5880 section 4.1).  Intervals are in microseconds.
+type control struct {
+	diag      Diag
+	state     State
+	flags     uint8
+	mult      uint8
+	myDisc    uint32
+	yourDisc  uint32
+	minTx     uint32
+	minRx     uint32
+	minEchoRx uint32
+}
+
+func get32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+func put32(b []byte, x uint32) {
+	b[0], b[1], b[2], b[3] = byte(x>>24), byte(x>>16), byte(x>>8), byte(x)
+}
+func get16(b []byte) uint { return uint(b[0])<<8 | uint(b[1]) }
+func put16(b []byte, x uint) {
+	b[0], b[1] = byte(x>>8), byte(x)
+}
+
+func (c *control) encode(b []byte) {
+	b[0] = version<<5 | uint8(c.diag)&0x1f
+	b[1] = uint8(c.state)<<6 | c.flags&0x3f
+	b[2] = c.mult
+	b[3] = sizeofControl
+	put32(b[4:], c.myDisc)
+	put32(b[8:], c.yourDisc)
+	put32(b[12:], c.minTx)
+	put32(b[16:], c.minRx)
+	put32(b[20:], c.minEchoRx)
+}
+
+// Decode and validate control packet (RFC 5880 section 6.8.6).  Authentication is not supported.
+func (c *control) decode(b []byte) (err error) {
+	if len(b) < sizeofControl {
+		return fmt.Errorf("short packet")
+	}
+	if v := b[0] >> 5; v != version {
+		return fmt.Errorf("version %d", v)
+	}
+	if l := int(b[3]); l < sizeofControl || l > len(b) {
+		return fmt.Errorf("length %d", l)
+	}
+	*c = control{
+		diag:      Diag(b[0] & 0x1f),
+		state:     State(b[1] >> 6),
+		flags:     b[1] & 0x3f,
+		mult:      b[2],
+		myDisc:    get32(b[4:]),
+		yourDisc:  get32(b[8:]),
+		minTx:     get32(b[12:]),
+		minRx:     get32(b[16:]),
+		minEchoRx: get32(b[20:]),
+	}
+	switch {
+	case c.mult == 0:
+		err = fmt.Errorf("zero detect multiplier")
+	case c.flags&flagMultipoint != 0:
+		err = fmt.Errorf("multipoint")
+	case c.flags&flagAuth != 0:
+		err = fmt.Errorf("authentication not supported")
+	case c.myDisc == 0:
+		err = fmt.Errorf("zero my discriminator")
+	case c.yourDisc == 0 && c.state != StateDown && c.state != StateAdminDown:
+		err = fmt.Errorf("zero your discriminator in state %s", c.state)
+	}
+	return
+}
+
+// Write ip4/udp control packet with given addresses and source port.
+func (c *control) packet(b []byte, src, dst []byte, srcPort uint) {
+	b = b[:sizeofPacket]
+	for i := range b[:sizeofIp4Header+sizeofUdpHeader] {
+		b[i] = 0
+	}
+	b[0] = 0x45
+	// Precedence internetwork control.
+	b[1] = 0xc0
+	put16(b[2:], sizeofPacket)
+	b[8] = ttl
+	b[9] = uint8(ip.UDP)
+	copy(b[12:16], src)
+	copy(b[16:20], dst)
+	sum := ^ip.Checksum(0).AddBytes(b[:sizeofIp4Header]).Fold()
+	*(*vnet.Uint16)(vnet.Pointer(b[10:])) = sum
+
+	// Udp checksum is optional for ip4 and left zero.
+	u := b[sizeofIp4Header:]
+	put16(u[0:], srcPort)
+	put16(u[2:], controlPort)
+	put16(u[4:], sizeofUdpHeader+sizeofControl)
+	c.encode(u[sizeofUdpHeader:])
+}
+
+// Parse ip4 packet; returns false unless packet is an unfragmented udp packet to single hop
+// control port.  Returns source address, ttl and udp payload.
+func parsePacket(b []byte) (src []byte, t uint8, payload []byte, ok bool) {
+	if len(b) < sizeofIp4Header || b[0]>>4 != 4 {
+		return
+	}
+	ihl := int(b[0]&0xf) * 4
+	l := int(get16(b[2:]))
+	if ihl < sizeofIp4Header || l > len(b) || l < ihl+sizeofUdpHeader {
+		return
+	}
+	if ip.Protocol(b[9]) != ip.UDP || get16(b[6:])&0x3fff != 0 {
+		return
+	}
+	u := b[ihl:l]
+	ul := int(get16(u[4:]))
+	if get16(u[2:]) != controlPort || ul < sizeofUdpHeader || ul > len(u) {
+		return
+	}
+	return b[12:16], b[8], u[sizeofUdpHeader:ul], true
+}
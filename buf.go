@@ -135,6 +135,14 @@ type RefOut struct {
 	Outs []RefIn
 }
 
+// Total number of packets in all next vectors.
+func (o *RefOut) outLen(v *Vnet) (n uint) {
+	for i := range o.Outs {
+		n += o.Outs[i].GetLen(v)
+	}
+	return
+}
+
 type BufferPool hw.BufferPool
 
 var DefaultBufferPool = &BufferPool{
@@ -272,10 +280,10 @@ func (r *RefHeader) slice(n uint) (l []Ref) {
 }
 
 type showPool struct {
-	Pool string `format:"%-30s" align:"left"`
-	Size string `format:"%-12s" align:"right"`
-	Free string `format:"%-12s" align:"right"`
-	Used string `format:"%-12s" align:"right"`
+	Pool string          `format:"%-30s" align:"left" json:"pool" yaml:"pool"`
+	Size uint            `format:"%12d" align:"right" json:"size" yaml:"size"`
+	Free elib.MemorySize `format:"%12s" align:"right" json:"free_bytes" yaml:"free_bytes"`
+	Used elib.MemorySize `format:"%12s" align:"right" json:"used_bytes" yaml:"used_bytes"`
 }
 type showPools []showPool
 
@@ -284,19 +292,31 @@ func (x showPools) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
 func (x showPools) Len() int           { return len(x) }
 
 func (v *Vnet) showBufferUsage(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
-	m := &v.BufferMain
+	var format ShowFormat
+	for !in.End() {
+		switch {
+		case in.Parse("f%*ormat %v", &format):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
 
+	m := &v.BufferMain
 	sps := []showPool{}
-	fmt.Fprintf(w, "DMA heap: %s\n", hw.DmaHeapUsage())
 	for _, p := range m.PoolByName {
 		sps = append(sps, showPool{
 			Pool: p.Name,
-			Size: fmt.Sprintf("%12d", p.Size),
-			Free: fmt.Sprintf("%12s", elib.MemorySize(p.SizeIncludingOverhead()*p.FreeLen())),
-			Used: fmt.Sprintf("%12s", elib.MemorySize(p.DmaMemAllocBytes)),
+			Size: p.Size,
+			Free: elib.MemorySize(p.SizeIncludingOverhead() * p.FreeLen()),
+			Used: elib.MemorySize(p.DmaMemAllocBytes),
 		})
 	}
 	sort.Sort(showPools(sps))
+	if !format.IsText() {
+		return format.Write(w, sps)
+	}
+	fmt.Fprintf(w, "DMA heap: %s\n", hw.DmaHeapUsage())
 	elib.Tabulate(sps).Write(w)
 	return
 }
@@ -0,0 +1,348 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// Parse string s with given parse format (e.g. "%v").
+func parseString(s string, format string, args ...interface{}) bool {
+	var in parse.Input
+	in.SetString(s)
+	return in.Parse(format, args...) && in.End()
+}
+
+func (m *Main) hwIfByName(name string) (h *vnet.HwIf, err error) {
+	hi, ok := m.Vnet.HwIfByName(name)
+	if !ok {
+		err = fmt.Errorf("unknown interface `%s'", name)
+		return
+	}
+	h = m.Vnet.HwIf(hi)
+	return
+}
+
+func (m *Main) siByName(name string) (si vnet.Si, err error) {
+	if !parseString(name, "%v", &si, m.Vnet) {
+		err = fmt.Errorf("unknown interface `%s'", name)
+	}
+	return
+}
+
+func normalizeAdmin(s *string) (err error) {
+	switch *s {
+	case "", "up", "down":
+	default:
+		err = fmt.Errorf("admin must be up or down; got `%s'", *s)
+	}
+	return
+}
+
+// Ip4 interface address: address is kept, not masked, and prefix length is required.
+func normalizeAddress(s *string) (err error) {
+	a, p, err := net.ParseCIDR(*s)
+	if err != nil || a.To4() == nil {
+		err = fmt.Errorf("bad ip4 address `%s'", *s)
+		return
+	}
+	*s = (&net.IPNet{IP: a.To4(), Mask: p.Mask}).String()
+	return
+}
+
+// Normalize validates configuration and rewrites values in the same form as Running
+// so that configurations can be compared.
+func (m *Main) normalize(c *Config) (err error) {
+	v := m.Vnet
+	names := make(map[string]bool)
+	for i := range c.Interfaces {
+		x := &c.Interfaces[i]
+		if _, err = m.hwIfByName(x.Name); err != nil {
+			return
+		}
+		names[x.Name] = true
+		if err = normalizeAdmin(&x.Admin); err != nil {
+			return fmt.Errorf("%s: %v", x.Name, err)
+		}
+		if len(x.Speed) > 0 {
+			var bw vnet.Bandwidth
+			if !parseString(x.Speed, "%v", &bw) {
+				return fmt.Errorf("%s: bad speed `%s'", x.Name, x.Speed)
+			}
+			x.Speed = bw.String()
+		}
+		if len(x.Fec) > 0 {
+			var t ethernet.ErrorCorrectionType
+			if !parseString(x.Fec, "%v", &t) {
+				return fmt.Errorf("%s: bad fec `%s'", x.Name, x.Fec)
+			}
+			x.Fec = t.String()
+		}
+		if len(x.Loopback) > 0 {
+			var t vnet.IfLoopbackType
+			if !parseString(x.Loopback, "%v", &t) {
+				return fmt.Errorf("%s: bad loopback `%s'", x.Name, x.Loopback)
+			}
+			x.Loopback = t.String()
+		}
+		for j := range x.Addresses {
+			if err = normalizeAddress(&x.Addresses[j]); err != nil {
+				return fmt.Errorf("%s: %v", x.Name, err)
+			}
+		}
+	}
+	for i := range c.SubInterfaces {
+		x := &c.SubInterfaces[i]
+		if _, err = m.hwIfByName(x.Interface); err != nil {
+			return
+		}
+		if x.Vlan == 0 || x.Vlan >= 4095 {
+			return fmt.Errorf("%s: vlan must be in range 1 to 4094", x.Name())
+		}
+		if names[x.Name()] {
+			return fmt.Errorf("%s: duplicate sub-interface", x.Name())
+		}
+		names[x.Name()] = true
+		if err = normalizeAdmin(&x.Admin); err != nil {
+			return fmt.Errorf("%s: %v", x.Name(), err)
+		}
+		for j := range x.Addresses {
+			if err = normalizeAddress(&x.Addresses[j]); err != nil {
+				return fmt.Errorf("%s: %v", x.Name(), err)
+			}
+		}
+	}
+
+	// Interface must either exist or be a sub-interface given by configuration.
+	checkInterface := func(name string) (err error) {
+		if !names[name] {
+			_, err = m.siByName(name)
+		}
+		return
+	}
+
+	m4 := ip4.GetMain(v)
+	for i := range c.Routes {
+		x := &c.Routes[i]
+		_, p, e := net.ParseCIDR(x.Prefix)
+		if e != nil || p.IP.To4() == nil {
+			return fmt.Errorf("bad ip4 prefix `%s'", x.Prefix)
+		}
+		x.Prefix = p.String()
+		if len(x.NextHops) == 0 {
+			return fmt.Errorf("route %s: no next hops given", x.Prefix)
+		}
+		for j := range x.NextHops {
+			nh := &x.NextHops[j]
+			a := net.ParseIP(nh.Address).To4()
+			if a == nil {
+				return fmt.Errorf("route %s: bad next hop address `%s'", x.Prefix, nh.Address)
+			}
+			nh.Address = a.String()
+			if err = checkInterface(nh.Interface); err != nil {
+				return fmt.Errorf("route %s: %v", x.Prefix, err)
+			}
+			if nh.Weight == 0 {
+				nh.Weight = 1
+			}
+		}
+		if len(x.Table) > 0 {
+			if _, ok := m4.FibIndexForName(x.Table); !ok {
+				return fmt.Errorf("route %s: unknown table `%s'", x.Prefix, x.Table)
+			}
+		} else {
+			// Interfaces not yet created will be in default table.
+			fi := ip.FibIndex(0)
+			if si, err := m.siByName(x.NextHops[0].Interface); err == nil {
+				fi = m4.FibIndexForSi(si)
+			}
+			x.Table = m4.FibNameForIndex(fi)
+		}
+	}
+
+	for i := range c.Neighbors {
+		x := &c.Neighbors[i]
+		a := net.ParseIP(x.Address)
+		if a == nil {
+			return fmt.Errorf("neighbor: bad address `%s'", x.Address)
+		}
+		x.Address = a.String()
+		var ea ethernet.Address
+		if !parseString(x.LinkAddress, "%v", &ea) {
+			return fmt.Errorf("neighbor %s: bad ethernet address `%s'", x.Address, x.LinkAddress)
+		}
+		x.LinkAddress = ea.String()
+		if err = checkInterface(x.Interface); err != nil {
+			return fmt.Errorf("neighbor %s: %v", x.Address, err)
+		}
+	}
+
+	streams := make(map[string]bool)
+	for i := range c.Streams {
+		x := &c.Streams[i]
+		if len(x.Name) == 0 {
+			return fmt.Errorf("stream: no name given")
+		}
+		if streams[x.Name] {
+			return fmt.Errorf("stream %s: duplicate stream", x.Name)
+		}
+		streams[x.Name] = true
+	}
+
+	c.sort()
+	return
+}
+
+func (m *Main) setMtu(name string, mtu uint) (err error) {
+	h, err := m.hwIfByName(name)
+	if err != nil {
+		return
+	}
+	return h.SetMaxPacketSize(mtu)
+}
+
+func (m *Main) setSpeed(name, value string) (err error) {
+	h, err := m.hwIfByName(name)
+	if err != nil {
+		return
+	}
+	var bw vnet.Bandwidth
+	parseString(value, "%v", &bw)
+	return h.SetSpeed(bw)
+}
+
+func (m *Main) setFec(name, value string) (err error) {
+	h, err := m.hwIfByName(name)
+	if err != nil {
+		return
+	}
+	var t ethernet.ErrorCorrectionType
+	parseString(value, "%v", &t)
+	return ethernet.SetInterfaceErrorCorrection(m.Vnet, h.Hi(), t)
+}
+
+func (m *Main) setLoopback(name, value string) (err error) {
+	h, err := m.hwIfByName(name)
+	if err != nil {
+		return
+	}
+	var t vnet.IfLoopbackType
+	parseString(value, "%v", &t)
+	return m.Vnet.HwIfer(h.Hi()).SetLoopback(t)
+}
+
+func (m *Main) setAdmin(name, value string) (err error) {
+	si, err := m.siByName(name)
+	if err != nil {
+		return
+	}
+	return si.SetAdminUp(m.Vnet, value == "up")
+}
+
+func (m *Main) addDelSubInterface(x *SubInterface, isDel bool) (err error) {
+	v := m.Vnet
+	if isDel {
+		var si vnet.Si
+		if si, err = m.siByName(x.Name()); err != nil {
+			return
+		}
+		v.CleanAndDownSwInterface(si)
+		v.DelSwIf(si)
+		return
+	}
+	h, err := m.hwIfByName(x.Interface)
+	if err != nil {
+		return
+	}
+	var id ethernet.IfId
+	id.Set(vnet.Uint16(x.Vlan))
+	v.NewSwSubInterface(h.Si(), vnet.IfId(id), x.Name())
+	return
+}
+
+func (m *Main) addDelAddress(name, addr string, isDel bool) (err error) {
+	si, err := m.siByName(name)
+	if err != nil {
+		return
+	}
+	a, p, err := net.ParseCIDR(addr)
+	if err != nil {
+		return
+	}
+	p.IP = a.To4()
+	return ip4.GetMain(m.Vnet).AddDelInterfaceAddress(si, p, isDel)
+}
+
+func (m *Main) addDelNeighbor(x *Neighbor, isDel bool) (err error) {
+	v := m.Vnet
+	n := ethernet.IpNeighbor{Ip: net.ParseIP(x.Address)}
+	if n.Si, err = m.siByName(x.Interface); err != nil {
+		return
+	}
+	parseString(x.LinkAddress, "%v", &n.Ethernet)
+	var im *ip.Main
+	if a4 := n.Ip.To4(); a4 != nil {
+		n.Ip = a4
+		im = &ip4.GetMain(v).Main
+	} else {
+		im = &ip6.GetMain(v).Main
+	}
+	_, err = ethernet.GetMain(v).AddDelIpNeighbor(im, &n, isDel)
+	return
+}
+
+func (m *Main) addDelRoute(x *Route, isDel, isReplace bool) (err error) {
+	m4 := ip4.GetMain(m.Vnet)
+	fi, ok := m4.FibIndexForName(x.Table)
+	if !ok {
+		return fmt.Errorf("unknown table `%s'", x.Table)
+	}
+	_, p, err := net.ParseCIDR(x.Prefix)
+	if err != nil {
+		return
+	}
+	var nhs ip.NextHopVec
+	for i := range x.NextHops {
+		y := &x.NextHops[i]
+		nh := ip.NextHop{Address: net.ParseIP(y.Address).To4()}
+		if nh.Si, err = m.siByName(y.Interface); err != nil {
+			return
+		}
+		nh.Weight = ip.NextHopWeight(y.Weight)
+		if nh.Weight == 0 {
+			nh.Weight = 1
+		}
+		nhs = append(nhs, nh)
+	}
+	return m4.AddDelRouteNextHops(fi, p, nhs, isDel, isReplace)
+}
+
+func (m *Main) addStream(x *Stream, isReplace bool) (err error) {
+	if isReplace {
+		pg.DelStream(m.Vnet, x.Name)
+	}
+	var b bytes.Buffer
+	if err = pg.EditStreams(m.Vnet, &b, "name "+x.Name+" "+x.Args); err != nil {
+		err = fmt.Errorf("%v %s", err, b.String())
+	}
+	return
+}
+
+func (m *Main) delStream(name string) (err error) {
+	if !pg.DelStream(m.Vnet, name) {
+		err = fmt.Errorf("unknown stream `%s'", name)
+	}
+	return
+}
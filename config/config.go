@@ -0,0 +1,136 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"gopkg.in/yaml.v2"
+
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Config is declarative vnet configuration as read from or written to YAML.
+// Empty fields are not managed: they are left unchanged by apply.
+type Config struct {
+	Interfaces    []Interface    `yaml:"interfaces,omitempty"`
+	SubInterfaces []SubInterface `yaml:"sub_interfaces,omitempty"`
+	Routes        []Route        `yaml:"routes,omitempty"`
+	Neighbors     []Neighbor     `yaml:"neighbors,omitempty"`
+	Streams       []Stream       `yaml:"streams,omitempty"`
+}
+
+// Hardware interface (e.g. eth-0-0) and its software interface.
+type Interface struct {
+	Name string `yaml:"name"`
+	// up or down.
+	Admin string `yaml:"admin,omitempty"`
+	Mtu   uint   `yaml:"mtu,omitempty"`
+	// As accepted by set hardware-interface speed (e.g. 100g or autoneg).
+	Speed string `yaml:"speed,omitempty"`
+	// none, cl74 or cl91.
+	Fec string `yaml:"fec,omitempty"`
+	// none, mac or phy.
+	Loopback string `yaml:"loopback,omitempty"`
+	// Ip4 interface addresses with prefix length (e.g. 10.0.0.1/24).
+	Addresses []string `yaml:"addresses,omitempty"`
+}
+
+// Vlan sub-interface named INTERFACE.VLAN.
+type SubInterface struct {
+	Interface string   `yaml:"interface"`
+	Vlan      uint     `yaml:"vlan"`
+	Admin     string   `yaml:"admin,omitempty"`
+	Addresses []string `yaml:"addresses,omitempty"`
+}
+
+func (s *SubInterface) Name() string { return fmt.Sprintf("%s.%d", s.Interface, s.Vlan) }
+
+// Ip4 static route.
+type Route struct {
+	// Fib table name; defaults to table of first next hop's interface.
+	Table    string    `yaml:"table,omitempty"`
+	Prefix   string    `yaml:"prefix"`
+	NextHops []NextHop `yaml:"next_hops"`
+}
+
+type NextHop struct {
+	Address   string `yaml:"address"`
+	Interface string `yaml:"interface"`
+	// Defaults to 1.
+	Weight uint `yaml:"weight,omitempty"`
+}
+
+func (r *Route) key() string { return r.Table + " " + r.Prefix }
+
+// Static ip4 or ip6 neighbor.
+type Neighbor struct {
+	Interface string `yaml:"interface"`
+	Address   string `yaml:"address"`
+	// Ethernet address.
+	LinkAddress string `yaml:"lladdr"`
+}
+
+func (n *Neighbor) key() string { return n.Interface + " " + n.Address }
+
+// Packet generator stream.
+type Stream struct {
+	Name string `yaml:"name"`
+	// Arguments as given to packet-generator command following stream name
+	// (e.g. "count 10 rate 1e3 size 64 eth {...}").
+	Args string `yaml:"args,omitempty"`
+}
+
+// Parse YAML configuration; errors give line numbers.
+func Parse(b []byte) (c *Config, err error) {
+	c = &Config{}
+	if err = yaml.UnmarshalStrict(b, c); err != nil {
+		c = nil
+	}
+	return
+}
+
+func Load(path string) (c *Config, err error) {
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	if c, err = Parse(b); err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+	return
+}
+
+func (c *Config) Marshal() ([]byte, error) { return yaml.Marshal(c) }
+
+// Sort items so that dumped configurations can be compared.
+func (c *Config) sort() {
+	sort.Slice(c.Interfaces, func(i, j int) bool { return c.Interfaces[i].Name < c.Interfaces[j].Name })
+	sort.Slice(c.SubInterfaces, func(i, j int) bool {
+		a, b := &c.SubInterfaces[i], &c.SubInterfaces[j]
+		if a.Interface != b.Interface {
+			return a.Interface < b.Interface
+		}
+		return a.Vlan < b.Vlan
+	})
+	sort.Slice(c.Routes, func(i, j int) bool { return c.Routes[i].key() < c.Routes[j].key() })
+	sort.Slice(c.Neighbors, func(i, j int) bool { return c.Neighbors[i].key() < c.Neighbors[j].key() })
+	sort.Slice(c.Streams, func(i, j int) bool { return c.Streams[i].Name < c.Streams[j].Name })
+}
+
+// Canonical string for next hops; order of next hops is not significant.
+func nextHopsString(nhs []NextHop) string {
+	s := make([]string, len(nhs))
+	for i := range nhs {
+		w := nhs[i].Weight
+		if w == 0 {
+			w = 1
+		}
+		s[i] = fmt.Sprintf("%s %s %d", nhs[i].Address, nhs[i].Interface, w)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
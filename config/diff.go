@@ -0,0 +1,241 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+)
+
+// Single change to running state.
+type change struct {
+	desc  string
+	apply func(m *Main) error
+}
+
+func (c *change) String() string { return c.desc }
+
+type changes []change
+
+// Changes are applied in phases so that deletes happen before adds
+// and objects exist before they are referenced.
+type phase int
+
+const (
+	phaseDel phase = iota
+	phaseInterface
+	phaseSubInterface
+	phaseAdmin
+	phaseAddress
+	phaseNeighbor
+	phaseRoute
+	phaseStream
+	nPhase
+)
+
+type differ struct {
+	phases [nPhase]changes
+}
+
+func (d *differ) add(p phase, f func(m *Main) error, format string, args ...interface{}) {
+	d.phases[p] = append(d.phases[p], change{desc: fmt.Sprintf(format, args...), apply: f})
+}
+
+// Diff returns changes needed to make running state match desired configuration.
+// Items which were applied by a previous configuration (applied) but are no longer
+// desired are deleted; items created by other means (e.g. netlink) are left alone.
+func diff(running, desired, applied *Config) (cs changes) {
+	var d differ
+	// Deletes are made in reverse order of dependency: routes before neighbors
+	// before addresses before sub-interfaces.
+	d.routes(running, desired, applied)
+	d.streams(running, desired, applied)
+	d.neighbors(running, desired, applied)
+	d.addresses(running, desired, applied)
+	d.subInterfaces(running, desired, applied)
+	d.interfaces(running, desired)
+	for i := range d.phases {
+		cs = append(cs, d.phases[i]...)
+	}
+	return
+}
+
+func (d *differ) interfaces(running, desired *Config) {
+	r := make(map[string]*Interface)
+	for i := range running.Interfaces {
+		r[running.Interfaces[i].Name] = &running.Interfaces[i]
+	}
+	for i := range desired.Interfaces {
+		x := &desired.Interfaces[i]
+		y := r[x.Name]
+		if y == nil {
+			y = &Interface{Name: x.Name}
+		}
+		name := x.Name
+		if x.Mtu != 0 && x.Mtu != y.Mtu {
+			mtu := x.Mtu
+			d.add(phaseInterface, func(m *Main) error { return m.setMtu(name, mtu) }, "set %s mtu %d", name, mtu)
+		}
+		for _, s := range []struct {
+			field, want, have string
+			f                 func(m *Main, name, value string) error
+		}{
+			{"speed", x.Speed, y.Speed, (*Main).setSpeed},
+			{"fec", x.Fec, y.Fec, (*Main).setFec},
+			{"loopback", x.Loopback, y.Loopback, (*Main).setLoopback},
+		} {
+			if len(s.want) > 0 && s.want != s.have {
+				f, value := s.f, s.want
+				d.add(phaseInterface, func(m *Main) error { return f(m, name, value) }, "set %s %s %s", name, s.field, value)
+			}
+		}
+		d.admin(name, x.Admin, y.Admin)
+	}
+}
+
+func (d *differ) admin(name, want, have string) {
+	if len(want) > 0 && want != have {
+		d.add(phaseAdmin, func(m *Main) error { return m.setAdmin(name, want) }, "set %s admin %s", name, want)
+	}
+}
+
+func (d *differ) subInterfaces(running, desired, applied *Config) {
+	r := make(map[string]*SubInterface)
+	for i := range running.SubInterfaces {
+		x := &running.SubInterfaces[i]
+		r[x.Name()] = x
+	}
+	want := make(map[string]bool)
+	for i := range desired.SubInterfaces {
+		x := desired.SubInterfaces[i]
+		name := x.Name()
+		want[name] = true
+		y := r[name]
+		if y == nil {
+			d.add(phaseSubInterface, func(m *Main) error { return m.addDelSubInterface(&x, false) }, "add sub-interface %s", name)
+			y = &SubInterface{Admin: "down"}
+		}
+		d.admin(name, x.Admin, y.Admin)
+	}
+	for i := range applied.SubInterfaces {
+		x := applied.SubInterfaces[i]
+		name := x.Name()
+		if !want[name] && r[name] != nil {
+			d.add(phaseDel, func(m *Main) error { return m.addDelSubInterface(&x, true) }, "del sub-interface %s", name)
+		}
+	}
+}
+
+type address struct{ intf, addr string }
+
+func addresses(c *Config) (as []address) {
+	for i := range c.Interfaces {
+		for _, a := range c.Interfaces[i].Addresses {
+			as = append(as, address{c.Interfaces[i].Name, a})
+		}
+	}
+	for i := range c.SubInterfaces {
+		for _, a := range c.SubInterfaces[i].Addresses {
+			as = append(as, address{c.SubInterfaces[i].Name(), a})
+		}
+	}
+	return
+}
+
+func addressSet(as []address) (s map[address]bool) {
+	s = make(map[address]bool)
+	for _, a := range as {
+		s[a] = true
+	}
+	return
+}
+
+func (d *differ) addresses(running, desired, applied *Config) {
+	r := addressSet(addresses(running))
+	ds := addresses(desired)
+	want := addressSet(ds)
+	for _, a := range addresses(applied) {
+		if x := a; !want[x] && r[x] {
+			d.add(phaseDel, func(m *Main) error { return m.addDelAddress(x.intf, x.addr, true) }, "del address %s %s", x.intf, x.addr)
+		}
+	}
+	for _, a := range ds {
+		if x := a; !r[x] {
+			d.add(phaseAddress, func(m *Main) error { return m.addDelAddress(x.intf, x.addr, false) }, "add address %s %s", x.intf, x.addr)
+		}
+	}
+}
+
+func (d *differ) neighbors(running, desired, applied *Config) {
+	r := make(map[string]*Neighbor)
+	for i := range running.Neighbors {
+		r[running.Neighbors[i].key()] = &running.Neighbors[i]
+	}
+	want := make(map[string]bool)
+	for i := range desired.Neighbors {
+		x := desired.Neighbors[i]
+		want[x.key()] = true
+		if y := r[x.key()]; y == nil || y.LinkAddress != x.LinkAddress {
+			d.add(phaseNeighbor, func(m *Main) error { return m.addDelNeighbor(&x, false) }, "add neighbor %s %s %s", x.Interface, x.Address, x.LinkAddress)
+		}
+	}
+	for i := range applied.Neighbors {
+		x := applied.Neighbors[i]
+		if !want[x.key()] && r[x.key()] != nil {
+			d.add(phaseDel, func(m *Main) error { return m.addDelNeighbor(&x, true) }, "del neighbor %s %s", x.Interface, x.Address)
+		}
+	}
+}
+
+func (d *differ) routes(running, desired, applied *Config) {
+	r := make(map[string]*Route)
+	for i := range running.Routes {
+		r[running.Routes[i].key()] = &running.Routes[i]
+	}
+	want := make(map[string]bool)
+	for i := range desired.Routes {
+		x := desired.Routes[i]
+		want[x.key()] = true
+		nhs := nextHopsString(x.NextHops)
+		y := r[x.key()]
+		switch {
+		case y == nil:
+			d.add(phaseRoute, func(m *Main) error { return m.addDelRoute(&x, false, false) }, "add route %s %s via %s", x.Table, x.Prefix, nhs)
+		case nextHopsString(y.NextHops) != nhs:
+			d.add(phaseRoute, func(m *Main) error { return m.addDelRoute(&x, false, true) }, "replace route %s %s via %s", x.Table, x.Prefix, nhs)
+		}
+	}
+	for i := range applied.Routes {
+		x := applied.Routes[i]
+		// Delete next hops as currently installed.
+		if y := r[x.key()]; !want[x.key()] && y != nil {
+			d.add(phaseDel, func(m *Main) error { return m.addDelRoute(y, true, false) }, "del route %s %s", x.Table, x.Prefix)
+		}
+	}
+}
+
+func (d *differ) streams(running, desired, applied *Config) {
+	r := make(map[string]*Stream)
+	for i := range running.Streams {
+		r[running.Streams[i].Name] = &running.Streams[i]
+	}
+	want := make(map[string]bool)
+	for i := range desired.Streams {
+		x := desired.Streams[i]
+		want[x.Name] = true
+		y := r[x.Name]
+		switch {
+		case y == nil:
+			d.add(phaseStream, func(m *Main) error { return m.addStream(&x, false) }, "add stream %s %s", x.Name, x.Args)
+		case len(x.Args) > 0 && x.Args != y.Args:
+			d.add(phaseStream, func(m *Main) error { return m.addStream(&x, true) }, "replace stream %s %s", x.Name, x.Args)
+		}
+	}
+	for i := range applied.Streams {
+		name := applied.Streams[i].Name
+		if !want[name] && r[name] != nil {
+			d.add(phaseDel, func(m *Main) error { return m.delStream(name) }, "del stream %s", name)
+		}
+	}
+}
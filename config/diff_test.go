@@ -0,0 +1,108 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) *Config {
+	c, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sort()
+	return c
+}
+
+func TestDiff(t *testing.T) {
+	running := mustParse(t, `
+interfaces:
+- {name: eth-0-0, admin: down, mtu: 1514, speed: 100g, fec: none, addresses: [10.0.0.1/24, 10.9.0.1/24]}
+- {name: eth-1-0, admin: up, mtu: 9216, speed: 100g, fec: cl91}
+sub_interfaces:
+- {interface: eth-1-0, vlan: 20, admin: up}
+routes:
+- table: default
+  prefix: 10.2.0.0/16
+  next_hops: [{address: 10.0.0.2, interface: eth-0-0, weight: 1}]
+- table: default
+  prefix: 10.3.0.0/16
+  next_hops: [{address: 10.0.0.2, interface: eth-0-0, weight: 1}]
+- table: default
+  prefix: 10.4.0.0/16
+  next_hops: [{address: 10.0.0.3, interface: eth-0-0, weight: 1}]
+neighbors:
+- {interface: eth-0-0, address: 10.0.0.2, lladdr: "00:00:00:00:00:02"}
+streams:
+- {name: s0, args: count 10}
+- {name: s1}
+`)
+	// Previously applied configuration owns route 10.3.0.0/16, sub-interface eth-1-0.20 and stream s1.
+	applied := mustParse(t, `
+sub_interfaces:
+- {interface: eth-1-0, vlan: 20}
+routes:
+- table: default
+  prefix: 10.3.0.0/16
+  next_hops: [{address: 10.0.0.2, interface: eth-0-0}]
+streams:
+- {name: s0, args: count 10}
+- {name: s1}
+`)
+	desired := mustParse(t, `
+interfaces:
+- {name: eth-0-0, admin: up, mtu: 9216, fec: cl91, addresses: [10.0.0.1/24]}
+- {name: eth-1-0, admin: up, mtu: 9216}
+sub_interfaces:
+- {interface: eth-0-0, vlan: 10, admin: up, addresses: [10.1.0.1/24]}
+routes:
+- table: default
+  prefix: 10.2.0.0/16
+  next_hops: [{address: 10.0.0.2, interface: eth-0-0}]
+- table: default
+  prefix: 10.4.0.0/16
+  next_hops: [{address: 10.0.0.2, interface: eth-0-0}, {address: 10.0.0.3, interface: eth-0-0, weight: 2}]
+neighbors:
+- {interface: eth-0-0, address: 10.0.0.2, lladdr: "00:00:00:00:00:02"}
+- {interface: eth-0-0.10, address: 10.1.0.2, lladdr: "00:00:00:00:00:03"}
+streams:
+- {name: s0, args: count 20}
+`)
+	var got []string
+	for _, c := range diff(running, desired, applied) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"del route default 10.3.0.0/16",
+		"del stream s1",
+		"del sub-interface eth-1-0.20",
+		"set eth-0-0 mtu 9216",
+		"set eth-0-0 fec cl91",
+		"add sub-interface eth-0-0.10",
+		"set eth-0-0.10 admin up",
+		"set eth-0-0 admin up",
+		"add address eth-0-0.10 10.1.0.1/24",
+		"add neighbor eth-0-0.10 10.1.0.2 00:00:00:00:00:03",
+		"replace route default 10.4.0.0/16 via 10.0.0.2 eth-0-0 1, 10.0.0.3 eth-0-0 2",
+		"replace stream s0 count 20",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("got\n%s\nwant\n%s", g, w)
+	}
+
+	// Applying desired configuration to itself makes no changes.
+	if cs := diff(desired, desired, desired); len(cs) != 0 {
+		t.Errorf("expected no changes; got %v", cs)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Parse([]byte("interfaces:\n- name: eth-0-0\n  mtux: 9216\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected error at line 3; got %v", err)
+	}
+}
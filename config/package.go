@@ -0,0 +1,160 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package config provides declarative YAML configuration of interfaces,
+// sub-interfaces, addresses, static routes, neighbors and packet generator streams.
+//
+// "config apply FILE" computes the difference between the file and running
+// state and applies only the changes; "config dump" writes running state in
+// the same format.  A startup configuration may be given with config { file PATH }.
+package config
+
+import (
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+
+	// Startup configuration file applied once vnet is running.
+	file string
+
+	// Configuration as last applied; used to decide which items are owned by
+	// configuration and should be deleted when no longer present.
+	applied Config
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("config", m)
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. config { file /etc/vnet/vnet.yaml }
+func (m *Main) Configure(in *parse.Input) {
+	for !in.End() {
+		switch {
+		case in.Parse("file %s", &m.file):
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+type startupEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *startupEvent) String() string { return "config apply " + e.m.file }
+func (e *startupEvent) EventAction() {
+	if err := e.m.ApplyFile(e.m.file, nil, false); err != nil {
+		e.m.Vnet.Logf("config: %v\n", err)
+	}
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	v.CliAdd(&cli.Command{
+		Name:      "config apply",
+		ShortHelp: "apply configuration from YAML file",
+		Action:    m.configApply,
+	})
+	v.CliAdd(&cli.Command{
+		Name:      "config dump",
+		ShortHelp: "write running configuration as YAML",
+		Action:    m.configDump,
+	})
+	if len(m.file) > 0 {
+		v.SignalEvent(&startupEvent{m: m})
+	}
+	return
+}
+
+// ApplyFile applies configuration from given file writing changes made to w (if non-nil).
+// With dryRun changes are only reported.  Must be called from vnet event context.
+func (m *Main) ApplyFile(path string, w io.Writer, dryRun bool) (err error) {
+	c, err := Load(path)
+	if err != nil {
+		return
+	}
+	return m.Apply(c, w, dryRun)
+}
+
+// Apply makes running state match given configuration.
+func (m *Main) Apply(c *Config, w io.Writer, dryRun bool) (err error) {
+	if err = m.normalize(c); err != nil {
+		return
+	}
+	cs := diff(m.Running(), c, &m.applied)
+	for i := range cs {
+		x := &cs[i]
+		if w != nil {
+			fmt.Fprintln(w, x)
+		}
+		if dryRun {
+			continue
+		}
+		if err = x.apply(m); err != nil {
+			err = fmt.Errorf("%s: %v", x, err)
+			return
+		}
+	}
+	if !dryRun {
+		m.applied = *c
+	}
+	return
+}
+
+func (m *Main) configApply(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		path   string
+		dryRun bool
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("dry%*-run"):
+			dryRun = true
+		case in.Parse("%s", &path):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if len(path) == 0 {
+		err = fmt.Errorf("config apply: no file given")
+		return
+	}
+	return m.ApplyFile(path, w, dryRun)
+}
+
+func (m *Main) configDump(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var path string
+	for !in.End() {
+		switch {
+		case in.Parse("%s", &path):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	b, err := m.Running().Marshal()
+	if err != nil {
+		return
+	}
+	if len(path) > 0 {
+		return ioutil.WriteFile(path, b, 0644)
+	}
+	_, err = w.Write(b)
+	return
+}
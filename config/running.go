@@ -0,0 +1,114 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/pg"
+
+	"net"
+)
+
+func adminString(isUp bool) string {
+	if isUp {
+		return "up"
+	}
+	return "down"
+}
+
+// Running returns configuration describing current vnet state.
+// Must be called from vnet event context.
+func (m *Main) Running() (c *Config) {
+	v := m.Vnet
+	m4 := ip4.GetMain(v)
+	c = &Config{}
+
+	// Loopback cannot be read back from hardware so report value as last applied.
+	loopback := make(map[string]string)
+	for i := range m.applied.Interfaces {
+		x := &m.applied.Interfaces[i]
+		loopback[x.Name] = x.Loopback
+	}
+
+	v.ForeachSwIf(func(si vnet.Si) {
+		sw := v.SwIf(si)
+		h := v.SupHwIf(sw)
+		if h == nil || !h.IsProvisioned() {
+			return
+		}
+		var as []string
+		m4.ForeachIfAddress(si, func(ia ip.IfAddr, ifa *ip.IfAddress) (err error) {
+			as = append(as, ifa.Prefix.String())
+			return
+		})
+		admin := adminString(sw.IsAdminUp())
+		if si.IsSwSubInterface(v) {
+			vlan, ok := ethernet.IfId(sw.Id(v)).OuterVlan()
+			if !ok {
+				return
+			}
+			c.SubInterfaces = append(c.SubInterfaces, SubInterface{
+				Interface: h.Name(),
+				Vlan:      uint(vlan),
+				Admin:     admin,
+				Addresses: as,
+			})
+			return
+		}
+		if si != h.Si() {
+			return
+		}
+		x := Interface{
+			Name:      h.Name(),
+			Admin:     admin,
+			Mtu:       h.MaxPacketSize(),
+			Speed:     h.Speed().String(),
+			Loopback:  loopback[h.Name()],
+			Addresses: as,
+		}
+		if e, ok := v.HwIfer(h.Hi()).(ethernet.HwInterfacer); ok {
+			x.Fec = e.GetInterface().ErrorCorrectionType.String()
+		}
+		c.Interfaces = append(c.Interfaces, x)
+	})
+
+	m4.ForeachRoute(func(fi ip.FibIndex, p net.IPNet, r *ip4.FibResult) {
+		x := Route{Table: m4.FibNameForIndex(fi), Prefix: p.String()}
+		for i := range r.Nhs {
+			nh := &r.Nhs[i]
+			x.NextHops = append(x.NextHops, NextHop{
+				Address:   nh.Address.String(),
+				Interface: vnet.SiName{V: v, Si: nh.Si}.String(),
+				Weight:    uint(nh.Weight),
+			})
+		}
+		if len(x.NextHops) > 0 {
+			c.Routes = append(c.Routes, x)
+		}
+	})
+
+	ethernet.GetMain(v).ForeachIpNeighbor(func(im *ip.Main, n *ethernet.IpNeighbor) {
+		c.Neighbors = append(c.Neighbors, Neighbor{
+			Interface:   vnet.SiName{V: v, Si: n.Si}.String(),
+			Address:     n.Ip.String(),
+			LinkAddress: n.Ethernet.String(),
+		})
+	})
+
+	// Stream arguments are only known for streams added by configuration.
+	args := make(map[string]string)
+	for i := range m.applied.Streams {
+		args[m.applied.Streams[i].Name] = m.applied.Streams[i].Args
+	}
+	for _, s := range pg.Streams(v) {
+		c.Streams = append(c.Streams, Stream{Name: s.Name, Args: args[s.Name]})
+	}
+
+	c.sort()
+	return
+}
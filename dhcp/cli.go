@@ -0,0 +1,137 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"net"
+	"strings"
+)
+
+// dhcp relay INTERFACE [table NAME] server ADDRESS [server ADDRESS]...
+// dhcp relay INTERFACE disable
+func (m *Main) relayConfig(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si    vnet.Si
+		a     ip4.Address
+		table string
+		cf    RelayConfig
+		dis   bool
+	)
+	if !in.Parse("%v", &si, m.Vnet) {
+		err = cli.ParseError
+		return
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("disable"):
+			dis = true
+		case in.Parse("t%*able %s", &table):
+			var ok bool
+			if cf.ServerFib, ok = m.ip4Main.FibIndexForName(table); !ok {
+				err = fmt.Errorf("%s: unknown table", table)
+				return
+			}
+		case in.Parse("s%*erver %v", &a):
+			cf.Servers = append(cf.Servers, net.IP(append([]byte(nil), a[:]...)))
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if dis {
+		return m.SetRelay(si, nil)
+	}
+	return m.SetRelay(si, &cf)
+}
+
+type showRelay struct {
+	Interface string `format:"%-30s" align:"left"`
+	Address   string `format:"%-16s" align:"left"`
+	Table     string `format:"%-12s" align:"left"`
+	Servers   string `format:"%-40s" align:"left"`
+	Requests  uint64 `format:"%12d"`
+	Replies   uint64 `format:"%12d"`
+	NoOption  uint64 `format:"%12d"`
+	Dropped   uint64 `format:"%12d"`
+}
+
+// show dhcp relay
+func (m *Main) showRelay(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.relays) == 0 {
+		fmt.Fprintln(w, "DHCP relay not enabled on any interface")
+		return
+	}
+	var rs []showRelay
+	for _, r := range m.sortedRelays() {
+		resolved := make(map[ip4.Address]bool)
+		for i := range r.servers {
+			resolved[r.servers[i].addr] = true
+		}
+		var ss []string
+		for _, a := range r.Servers {
+			s := a.String()
+			var x ip4.Address
+			copy(x[:], a)
+			if !resolved[x] {
+				s += " (unreachable)"
+			}
+			ss = append(ss, s)
+		}
+		addr := "none"
+		if !r.giaddr.IsZero() {
+			addr = net.IP(r.giaddr[:]).String()
+		}
+		rs = append(rs, showRelay{
+			Interface: vnet.SiName{V: m.Vnet, Si: r.si}.String(),
+			Address:   addr,
+			Table:     m.ip4Main.FibNameForIndex(r.ServerFib),
+			Servers:   strings.Join(ss, ", "),
+			Requests:  r.counters[counterRequest],
+			Replies:   r.counters[counterReply],
+			NoOption:  r.counters[counterNoOption],
+			Dropped:   r.counters[counterDrop],
+		})
+	}
+	elib.Tabulate(rs).Write(w)
+	return
+}
+
+// clear dhcp relay
+func (m *Main) clearRelay(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.ClearCounters()
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "dhcp relay",
+			ShortHelp: "enable/disable dhcp relay: dhcp relay INTERFACE [table NAME] server ADDRESS... | disable",
+			Action:    m.relayConfig,
+		},
+		cli.Command{
+			Name:      "show dhcp relay",
+			ShortHelp: "show dhcp relay interfaces, servers and counters",
+			Action:    m.showRelay,
+		},
+		cli.Command{
+			Name:      "clear dhcp relay",
+			ShortHelp: "clear dhcp relay counters",
+			Action:    m.clearRelay,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
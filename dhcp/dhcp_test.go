@@ -0,0 +1,127 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Ip4/udp packet with bootp message of given op and options, padded to minimum bootp size.
+func dhcpPacket(op byte, options ...byte) []byte {
+	d := make([]byte, offOptions, 300)
+	d[0], d[1], d[2] = op, 1, 6
+	copy(d[offChaddr:], []byte{0, 1, 2, 3, 4, 5})
+	copy(d[offMagic:], magicCookie[:])
+	d = append(d, options...)
+	d = append(d, optEnd)
+	d = d[:300]
+
+	b := make([]byte, sizeofIp4Header+sizeofUdpHeader+len(d))
+	b[0], b[8], b[9] = 0x45, 64, 17
+	put16(b[2:], uint(len(b)))
+	copy(b[16:], []byte{255, 255, 255, 255})
+	u := b[sizeofIp4Header:]
+	put16(u[0:], clientPort)
+	put16(u[2:], serverPort)
+	put16(u[4:], uint(len(u)))
+	copy(u[sizeofUdpHeader:], d)
+	return b
+}
+
+func TestParse(t *testing.T) {
+	var p packet
+	b := dhcpPacket(bootRequest, 53, 1, 1)
+	if !p.parse(b) || p.op() != bootRequest || len(p.bootp()) != 300 {
+		t.Fatalf("request not parsed")
+	}
+	// Trailing bytes after udp payload are trimmed.
+	if !p.parse(append(b, 0, 0, 0, 0)) || len(p.b) != len(b) {
+		t.Errorf("padded packet length %d", len(p.b))
+	}
+	x := append([]byte(nil), b...)
+	put16(x[sizeofIp4Header+2:], 53)
+	if p.parse(x) {
+		t.Errorf("dns packet parsed")
+	}
+	x = append([]byte(nil), b...)
+	x[6] = 0x20
+	if p.parse(x) {
+		t.Errorf("fragment parsed")
+	}
+	x = append([]byte(nil), b...)
+	x[sizeofIp4Header+sizeofUdpHeader+offMagic] = 0
+	if p.parse(x) {
+		t.Errorf("bootp without magic cookie parsed")
+	}
+}
+
+func TestRelayAgentInfo(t *testing.T) {
+	o := relayAgentInfo([]byte("eth-1-0"), []byte{2, 0, 0, 0, 0, 1})
+	want := []byte{82, 17, 1, 7, 'e', 't', 'h', '-', '1', '-', '0', 2, 6, 2, 0, 0, 0, 0, 1}
+	if !bytes.Equal(o, want) {
+		t.Fatalf("option % x", o)
+	}
+
+	// Option fits in padding after end option.
+	b := dhcpPacket(bootRequest, 53, 1, 1)
+	var p packet
+	p.parse(b)
+	d := p.bootp()
+	l, ok := addOption(d, len(d), o)
+	if !ok || l != 300 {
+		t.Fatalf("add option: %d %v", l, ok)
+	}
+	if i, end := findOptions(d); i != offOptions+3 || end != i+len(o) {
+		t.Errorf("options at %d end %d", i, end)
+	}
+
+	circuit, ok := stripRelayAgentInfo(d)
+	if !ok || circuit != "eth-1-0" {
+		t.Errorf("strip: %q %v", circuit, ok)
+	}
+	if i, end := findOptions(d); i >= 0 || end != offOptions+3 {
+		t.Errorf("after strip option at %d end %d", i, end)
+	}
+
+	// Message grows when padding is too short: hostname option followed by pad and end.
+	msg := func() []byte {
+		d := make([]byte, 400)
+		copy(d, p.bootp()[:offOptions])
+		d[offOptions], d[offOptions+1] = 12, 36
+		d[offOptions+38], d[offOptions+39] = optPad, optEnd
+		return d
+	}
+	n := offOptions + 40
+	if l, ok = addOption(msg(), n, o); !ok || l != n+len(o) {
+		t.Errorf("grow: %d %v", l, ok)
+	}
+	if l, ok = addOption(msg()[:n+2], n, o); ok {
+		t.Errorf("option added beyond maximum size")
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	var p packet
+	p.parse(dhcpPacket(bootReply))
+	p.setHeader([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 2}, serverPort, clientPort)
+	p.setChecksums()
+	if c := fold(checksum(p.b[:p.ihl], 0)); c != 0 {
+		t.Errorf("ip4 checksum %x", c)
+	}
+	u := p.udp()
+	if c := fold(checksum(u, checksum(p.b[12:20], 17+uint32(len(u))))); c != 0 {
+		t.Errorf("udp checksum %x", c)
+	}
+	if get16(u[2:]) != clientPort || p.b[8] != relayTtl {
+		t.Errorf("header % x", p.b[:28])
+	}
+
+	// Length is updated in ip and udp headers.
+	p.setLen(280)
+	if len(p.b) != 308 || get16(p.b[2:]) != 308 || get16(u[4:]) != 288 {
+		t.Errorf("length %d", len(p.b))
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dhcp provides a DHCPv4 relay agent.
+//
+// Relaying is enabled per software interface with a list of servers and the
+// fib used to reach them.  Ip4 input sends dhcp packets for local and broadcast
+// addresses to the dhcp-relay node; client requests received on relay
+// interfaces get the interface address as gateway address and a relay agent
+// information option (RFC 3046) with the interface name as circuit id and its
+// station address as remote id.  Requests are then sent to each reachable
+// server by dhcp-relay-server.  Server replies to a relay gateway address have
+// the option stripped and are sent out the client interface given by circuit
+// id.  Packets which are not relayed are punted.
+package dhcp
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+
+	ip4Main *ip4.Main
+
+	mu     sync.Mutex
+	relays map[vnet.Si]*relay
+	// Relays by circuit id for replies.
+	circuits map[string]*relay
+
+	// Requests which have passed this many relays are dropped.
+	MaxHops uint8
+
+	node       node
+	serverNode serverNode
+	pending    []pending
+
+	resolveEvent resolveEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{MaxHops: 16}
+	packageIndex = v.AddPackage("dhcp", m)
+	m.DependsOn("ip4")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. dhcp { max-hops 4 }
+func (m *Main) Configure(in *parse.Input) {
+	var hops uint
+	for !in.End() {
+		switch {
+		case in.Parse("max-hops %d", &hops) && hops > 0 && hops <= 255:
+			m.MaxHops = uint8(hops)
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between resolving relay addresses and servers.
+const resolveInterval = 1
+
+type resolveEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *resolveEvent) String() string { return "dhcp relay resolve" }
+func (e *resolveEvent) EventAction() {
+	e.m.resolveAll()
+	e.SignalEventAfter(e, resolveInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.ip4Main = ip4.GetMain(v)
+	m.node.init(v, m)
+	m.serverNode.init(v, m)
+	m.ip4Main.RegisterUdpLocalPort(serverPort, "dhcp-relay")
+	m.ip4Main.RegisterUdpLocalPort(clientPort, "dhcp-relay")
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.resolveEvent.m = m
+	v.SignalEventAfter(&m.resolveEvent, resolveInterval)
+	m.cliInit()
+	return
+}
+
+type RelayConfig struct {
+	// Servers requests are relayed to.
+	Servers []net.IP
+	// Fib used to reach servers.
+	ServerFib ip.FibIndex
+}
+
+// SetRelay enables relaying of requests received on given interface or, with nil
+// config, disables it.
+func (m *Main) SetRelay(si vnet.Si, c *RelayConfig) (err error) {
+	v := m.Vnet
+	if c == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		r, ok := m.relays[si]
+		if !ok {
+			return fmt.Errorf("%s: dhcp relay not enabled", vnet.SiName{V: v, Si: si})
+		}
+		m.delRelay(r)
+		return
+	}
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("%s: no dhcp servers", vnet.SiName{V: v, Si: si})
+	}
+	r := &relay{si: si}
+	r.ServerFib = c.ServerFib
+	for _, a := range c.Servers {
+		if a.To4() == nil {
+			return fmt.Errorf("%s: server %s is not an ip4 address", vnet.SiName{V: v, Si: si}, a)
+		}
+		r.Servers = append(r.Servers, a.To4())
+	}
+	h := v.SupHwIf(v.SwIf(si))
+	if h == nil {
+		return fmt.Errorf("%s: no hardware interface", vnet.SiName{V: v, Si: si})
+	}
+	r.circuit = vnet.SiName{V: v, Si: si}.String()
+	r.option = relayAgentInfo([]byte(r.circuit), h.Hi().GetAddress(v))
+	// Replies are broadcast; destination of unicast replies is set per packet.
+	v.SetRewrite(&r.rw, si, &m.node, vnet.IP4, nil)
+	giaddr, servers := m.resolve(r)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.relays[si]; ok {
+		r.counters = old.counters
+		m.delRelay(old)
+	}
+	r.giaddr, r.servers = giaddr, servers
+	if m.relays == nil {
+		m.relays = make(map[vnet.Si]*relay)
+		m.circuits = make(map[string]*relay)
+	}
+	m.relays[si] = r
+	m.circuits[r.circuit] = r
+	return
+}
+
+// Relay returns relay configuration of interface.
+func (m *Main) Relay(si vnet.Si) (c RelayConfig, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var r *relay
+	if r, ok = m.relays[si]; ok {
+		c = r.RelayConfig
+		c.Servers = append([]net.IP(nil), c.Servers...)
+	}
+	return
+}
+
+// Called with lock held.
+func (m *Main) delRelay(r *relay) {
+	delete(m.relays, r.si)
+	if m.circuits[r.circuit] == r {
+		delete(m.circuits, r.circuit)
+	}
+}
+
+// Resolve gateway address and reachable servers of relay.
+func (m *Main) resolve(r *relay) (giaddr ip4.Address, servers []server) {
+	v := m.Vnet
+	if a := m.ip4Main.IfFirstAddress(r.si); a != nil {
+		copy(giaddr[:], a.Prefix.IP.To4())
+	}
+	for _, a := range r.Servers {
+		as, ok := m.ip4Main.LookupAdjacency(r.ServerFib, a)
+		if !ok || !as[0].IsRewrite() {
+			continue
+		}
+		s := server{rw: as[0].Rewrite}
+		copy(s.addr[:], a)
+		h := v.SupHwIf(v.SwIf(s.rw.Si))
+		if h == nil {
+			continue
+		}
+		v.SetRewriteNodeHwIf(&s.rw, h, &m.serverNode)
+		servers = append(servers, s)
+	}
+	return
+}
+
+// Resolve all relays: interface addresses and server adjacencies change with routes.
+func (m *Main) resolveAll() {
+	m.mu.Lock()
+	rs := make([]*relay, 0, len(m.relays))
+	for _, r := range m.relays {
+		rs = append(rs, r)
+	}
+	m.mu.Unlock()
+	for _, r := range rs {
+		giaddr, servers := m.resolve(r)
+		m.mu.Lock()
+		r.giaddr, r.servers = giaddr, servers
+		m.mu.Unlock()
+	}
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if !isDel {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.relays[si]; ok {
+		m.delRelay(r)
+	}
+	return
+}
+
+// ClearCounters zeros counters of all relays.
+func (m *Main) ClearCounters() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.relays {
+		r.counters = [nCounter]uint64{}
+	}
+}
+
+func (m *Main) sortedRelays() (rs []*relay) {
+	for _, r := range m.relays {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].si < rs[j].si })
+	return
+}
@@ -0,0 +1,229 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp
+
+import (
+	"github.com/platinasystems/vnet/ip"
+)
+
+const (
+	serverPort = 67
+	clientPort = 68
+
+	bootRequest = 1
+	bootReply   = 2
+
+	sizeofIp4Header = 20
+	sizeofUdpHeader = 8
+
+	// Offsets of fixed fields in bootp header.
+	offHops    = 3
+	offFlags   = 10
+	offCiaddr  = 12
+	offYiaddr  = 16
+	offGiaddr  = 24
+	offChaddr  = 28
+	offMagic   = 236
+	offOptions = 240
+
+	// Broadcast bit in first byte of flags.
+	flagBroadcast = 0x80
+
+	optPad            = 0
+	optRelayAgentInfo = 82
+	optEnd            = 255
+
+	// Relay agent information sub-options (RFC 3046).
+	subCircuitId = 1
+	subRemoteId  = 2
+
+	// Relayed messages are kept within the size all agents must accept (RFC 2131).
+	maxMessageSize = 576
+
+	// Ttl of packets sent by relay.
+	relayTtl = 64
+)
+
+var magicCookie = [4]byte{99, 130, 83, 99}
+
+func get16(b []byte) uint { return uint(b[0])<<8 | uint(b[1]) }
+func put16(b []byte, x uint) {
+	b[0], b[1] = byte(x>>8), byte(x)
+}
+
+// Dhcp message in ip4/udp packet.  Packet is trimmed to udp length.
+type packet struct {
+	b []byte
+	// Length of ip4 header.
+	ihl int
+}
+
+// Parse ip4 packet; returns false unless packet is an unfragmented udp message to dhcp server port.
+func (p *packet) parse(b []byte) bool {
+	if len(b) < sizeofIp4Header || b[0]>>4 != 4 {
+		return false
+	}
+	ihl := int(b[0]&0xf) * 4
+	l := int(get16(b[2:]))
+	if ihl < sizeofIp4Header || l > len(b) || l < ihl+sizeofUdpHeader+offOptions {
+		return false
+	}
+	// Fragments have more fragments flag or non-zero offset.
+	if ip.Protocol(b[9]) != ip.UDP || get16(b[6:])&0x3fff != 0 {
+		return false
+	}
+	u := b[ihl:]
+	ul := int(get16(u[4:]))
+	if get16(u[2:]) != serverPort || ul < sizeofUdpHeader+offOptions || ihl+ul > l {
+		return false
+	}
+	p.b, p.ihl = b[:ihl+ul], ihl
+	d := p.bootp()
+	if d[0] != bootRequest && d[0] != bootReply {
+		return false
+	}
+	return d[offMagic] == magicCookie[0] && d[offMagic+1] == magicCookie[1] &&
+		d[offMagic+2] == magicCookie[2] && d[offMagic+3] == magicCookie[3]
+}
+
+func (p *packet) udp() []byte   { return p.b[p.ihl:] }
+func (p *packet) bootp() []byte { return p.b[p.ihl+sizeofUdpHeader:] }
+func (p *packet) op() uint8     { return p.b[p.ihl+sizeofUdpHeader] }
+
+// Set length of bootp message, growing or shrinking packet within capacity of packet slice.
+func (p *packet) setLen(n int) {
+	l := p.ihl + sizeofUdpHeader + n
+	p.b = p.b[:l]
+	put16(p.b[2:], uint(l))
+	put16(p.udp()[4:], uint(sizeofUdpHeader+n))
+}
+
+// Set addresses and ports of packet sent by relay.
+func (p *packet) setHeader(src, dst []byte, srcPort, dstPort uint) {
+	b := p.b
+	b[8] = relayTtl
+	copy(b[12:16], src)
+	copy(b[16:20], dst)
+	u := p.udp()
+	put16(u[0:], srcPort)
+	put16(u[2:], dstPort)
+}
+
+func checksum(b []byte, sum uint32) uint32 {
+	for len(b) >= 2 {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) > 0 {
+		sum += uint32(b[0]) << 8
+	}
+	return sum
+}
+
+func fold(sum uint32) uint {
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return uint(^sum & 0xffff)
+}
+
+// Compute ip4 header and udp checksums.
+func (p *packet) setChecksums() {
+	b, u := p.b, p.udp()
+	put16(b[10:], 0)
+	put16(b[10:], fold(checksum(b[:p.ihl], 0)))
+
+	put16(u[6:], 0)
+	// Pseudo header: addresses, protocol and udp length.
+	sum := checksum(b[12:20], uint32(ip.UDP)+uint32(len(u)))
+	c := fold(checksum(u, sum))
+	if c == 0 {
+		c = 0xffff
+	}
+	put16(u[6:], c)
+}
+
+// Find relay agent information and end options in options of bootp message.
+// Offsets are negative when option is not present or options are malformed.
+func findOptions(d []byte) (info, end int) {
+	info, end = -1, -1
+	for i := offOptions; i < len(d); {
+		switch d[i] {
+		case optPad:
+			i++
+			continue
+		case optEnd:
+			end = i
+			return
+		}
+		if i+1 >= len(d) || i+2+int(d[i+1]) > len(d) {
+			info = -1
+			return
+		}
+		if d[i] == optRelayAgentInfo {
+			info = i
+		}
+		i += 2 + int(d[i+1])
+	}
+	return
+}
+
+// Relay agent information option with given circuit and remote id.
+func relayAgentInfo(circuit, remote []byte) []byte {
+	// Option length must fit in a byte.
+	if max := 255 - 4 - len(remote); len(circuit) > max {
+		circuit = circuit[:max]
+	}
+	o := []byte{optRelayAgentInfo, byte(4 + len(circuit) + len(remote))}
+	o = append(o, subCircuitId, byte(len(circuit)))
+	o = append(o, circuit...)
+	o = append(o, subRemoteId, byte(len(remote)))
+	o = append(o, remote...)
+	return o
+}
+
+// Add option before end option of bootp message of length n.  Padding after end option is
+// re-used; message grows up to len(d).  Returns new message length.
+func addOption(d []byte, n int, o []byte) (l int, ok bool) {
+	_, end := findOptions(d[:n])
+	if end < 0 {
+		return
+	}
+	l = end + len(o) + 1
+	if l > len(d) {
+		return
+	}
+	copy(d[end:], o)
+	d[l-1] = optEnd
+	if l < n {
+		l = n
+	}
+	ok = true
+	return
+}
+
+// Remove relay agent information option from bootp message returning its circuit id.
+// Message length is kept; freed space is padded after end option.
+func stripRelayAgentInfo(d []byte) (circuit string, ok bool) {
+	i, _ := findOptions(d)
+	if i < 0 {
+		return
+	}
+	l := 2 + int(d[i+1])
+	o := d[i+2 : i+l]
+	for len(o) >= 2 && 2+int(o[1]) <= len(o) {
+		if o[0] == subCircuitId {
+			circuit = string(o[2 : 2+int(o[1])])
+			break
+		}
+		o = o[2+int(o[1]):]
+	}
+	copy(d[i:], d[i+l:])
+	for j := len(d) - l; j < len(d); j++ {
+		d[j] = optPad
+	}
+	ok = true
+	return
+}
@@ -0,0 +1,336 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhcp
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip4"
+)
+
+// Reachable server with rewrite from its adjacency.
+type server struct {
+	addr ip4.Address
+	rw   vnet.Rewrite
+}
+
+const (
+	// Requests relayed to servers.
+	counterRequest = iota
+	// Replies relayed to clients.
+	counterReply
+	// Requests relayed without relay agent information since message would be too big.
+	counterNoOption
+	// Requests dropped: no address, no reachable server, hop limit or untrusted option.
+	counterDrop
+	nCounter
+)
+
+type relay struct {
+	RelayConfig
+	si vnet.Si
+
+	// Interface address used as gateway address; zero when interface has no ip4 address.
+	giaddr ip4.Address
+	// Relay agent information option added to requests.
+	option  []byte
+	circuit string
+	// Broadcast rewrite for replies to clients.
+	rw vnet.Rewrite
+	// Reachable servers; replaced as a whole when resolved.
+	servers []server
+
+	counters [nCounter]uint64
+}
+
+const (
+	next_error uint = iota
+	next_punt
+)
+
+const (
+	error_no_address uint = iota
+	error_no_server
+	error_max_hops
+	error_untrusted
+	error_queue_full
+)
+
+// Relay node.  Packets must start with ip4 header.
+type node struct {
+	vnet.InOutNode
+	m *Main
+	p packet
+}
+
+func (n *node) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	// Nexts to interface output nodes are added with client rewrites.
+	n.Next = []string{
+		next_error: "error",
+		next_punt:  "punt",
+	}
+	n.Errors = []string{
+		error_no_address: "relay interface has no ip4 address",
+		error_no_server:  "no reachable dhcp server",
+		error_max_hops:   "dhcp hop limit exceeded",
+		error_untrusted:  "relay agent information from client",
+		error_queue_full: "dhcp relay queue full",
+	}
+	v.RegisterInOutNode(n, "dhcp-relay")
+}
+
+func (n *node) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		x0 := next_punt
+		queued := false
+		if len(m.relays) > 0 && !r0.NextIsValid() && n.p.parse(r0.DataSlice()) {
+			if n.p.op() == bootRequest {
+				x0, queued = n.request(r0, in.BufferPool)
+			} else {
+				x0 = n.reply(r0)
+			}
+		}
+		if !queued {
+			q.Put1(r0, x0)
+		}
+		i++
+	}
+}
+
+// Add gateway address and relay agent information to client request and queue it for
+// sending to servers.
+func (n *node) request(r0 *vnet.Ref, pool *vnet.BufferPool) (x0 uint, queued bool) {
+	m := n.m
+	x0 = next_punt
+	r, ok := m.relays[r0.Si]
+	if !ok {
+		return
+	}
+	p := &n.p
+	d := p.bootp()
+	info, _ := findOptions(d)
+	giaddr := d[offGiaddr : offGiaddr+4]
+	switch {
+	case r.giaddr.IsZero():
+		return n.drop(r0, r, error_no_address), false
+	case len(r.servers) == 0:
+		return n.drop(r0, r, error_no_server), false
+	case d[offHops] >= m.MaxHops:
+		return n.drop(r0, r, error_max_hops), false
+	// Clients must not send relay agent information (RFC 3046 section 2.1).
+	case info >= 0 && isZero(giaddr):
+		return n.drop(r0, r, error_untrusted), false
+	case len(m.pending) >= maxPending:
+		return n.drop(r0, r, error_queue_full), false
+	}
+
+	d[offHops]++
+	// Requests from downstream relays keep their gateway address and options.
+	if isZero(giaddr) {
+		copy(giaddr, r.giaddr[:])
+		n.addOption(r0, r)
+	}
+	p.setHeader(r.giaddr[:], r.giaddr[:], serverPort, serverPort)
+	r.counters[counterRequest]++
+
+	m.pending = append(m.pending, pending{r: *r0, pool: pool, servers: r.servers})
+	queued = true
+	if len(m.pending) == 1 {
+		m.serverNode.Activate(true)
+	}
+	return
+}
+
+func (n *node) drop(r0 *vnet.Ref, r *relay, e uint) uint {
+	r.counters[counterDrop]++
+	n.SetError(r0, e)
+	return next_error
+}
+
+func (n *node) addOption(r0 *vnet.Ref, r *relay) {
+	p := &n.p
+	hl := p.ihl + sizeofUdpHeader
+	l := len(p.bootp())
+	// Message may grow up to maximum size; larger messages are not grown.
+	max := maxMessageSize - hl
+	if max < l {
+		max = l
+	}
+	r0.SetDataLen(uint(hl + max))
+	p.b = r0.DataSlice()
+	if x, ok := addOption(p.b[hl:], l, r.option); ok {
+		l = x
+	} else {
+		r.counters[counterNoOption]++
+	}
+	p.setLen(l)
+	r0.SetDataLen(uint(len(p.b)))
+}
+
+// Strip relay agent information from server reply and send it to client.
+func (n *node) reply(r0 *vnet.Ref) (x0 uint) {
+	m := n.m
+	x0 = next_punt
+	p := &n.p
+	d := p.bootp()
+	giaddr := d[offGiaddr : offGiaddr+4]
+	// Replies to other gateway addresses are not for us.
+	r, ok := m.relayForGiaddr(giaddr)
+	if !ok {
+		return
+	}
+	circuit, _ := stripRelayAgentInfo(d)
+	if c, ok := m.circuits[circuit]; ok && c.giaddr.IsEqual(&r.giaddr) {
+		r = c
+	}
+
+	// Reply is broadcast when client asks for it or has no address yet (RFC 2131 section 4.1).
+	var dst []byte
+	unicast := false
+	switch {
+	case !isZero(d[offCiaddr : offCiaddr+4]):
+		dst, unicast = d[offCiaddr:offCiaddr+4], true
+	case d[offFlags]&flagBroadcast != 0 || isZero(d[offYiaddr:offYiaddr+4]):
+		dst = []byte{0xff, 0xff, 0xff, 0xff}
+	default:
+		dst, unicast = d[offYiaddr:offYiaddr+4], true
+	}
+	// Only ethernet client hardware addresses are known.
+	if unicast && (d[1] != 1 || d[2] != 6) {
+		dst, unicast = []byte{0xff, 0xff, 0xff, 0xff}, false
+	}
+	var chaddr [6]byte
+	copy(chaddr[:], d[offChaddr:])
+	p.setHeader(r.giaddr[:], dst, serverPort, clientPort)
+	p.setChecksums()
+	r0.SetDataLen(uint(len(p.b)))
+	r.counters[counterReply]++
+
+	vnet.PerformRewrite(r0, &r.rw)
+	if unicast {
+		copy(r0.DataSlice(), chaddr[:])
+	}
+	r0.Si = r.rw.Si
+	return uint(r.rw.NextIndex)
+}
+
+// Called with lock held.
+func (m *Main) relayForGiaddr(a []byte) (r *relay, ok bool) {
+	for _, r = range m.relays {
+		if r.giaddr.IsEqual(ip4AddressOf(a)) {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func ip4AddressOf(b []byte) (a *ip4.Address) {
+	a = &ip4.Address{}
+	copy(a[:], b)
+	return
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Request waiting to be sent to servers.
+type pending struct {
+	r       vnet.Ref
+	pool    *vnet.BufferPool
+	servers []server
+	// Index of next server to send copy to.
+	i uint
+	// Set when original buffer has been sent.
+	sent bool
+}
+
+// Maximum number of requests waiting to be sent.
+const maxPending = vnet.MaxVectorLen
+
+// Node which sends a copy of relayed requests to each server.
+type serverNode struct {
+	vnet.InputNode
+	m   *Main
+	tmp vnet.RefVec
+	p   packet
+}
+
+func (n *serverNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	// Nexts to interface output nodes are added with server rewrites.
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "dhcp-relay-server")
+}
+
+// Copy single buffer packet into newly allocated buffer.
+func (n *serverNode) copy(p *vnet.BufferPool, r *vnet.Ref) (c vnet.Ref) {
+	n.tmp.Validate(0)
+	p.AllocRefs(n.tmp[:1])
+	c = n.tmp[0]
+	c.SetDataLen(r.DataLen())
+	copy(c.DataSlice(), r.DataSlice())
+	c.RefOpaque = r.RefOpaque
+	return
+}
+
+func (n *serverNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	full := false
+	done := 0
+	for ; done < len(m.pending); done++ {
+		p := &m.pending[done]
+		for ; p.i < uint(len(p.servers)); p.i++ {
+			s := &p.servers[p.i]
+			out := &o.Outs[s.rw.NextIndex]
+			if out.GetLen(v) >= out.Cap() {
+				full = true
+				break
+			}
+			var r vnet.Ref
+			// Last server gets original buffer.
+			if p.i+1 == uint(len(p.servers)) {
+				r = p.r
+				p.sent = true
+			} else {
+				r = n.copy(p.pool, &p.r)
+			}
+			if n.p.parse(r.DataSlice()) {
+				copy(n.p.b[16:20], s.addr[:])
+				n.p.setChecksums()
+			}
+			vnet.PerformRewrite(&r, &s.rw)
+			r.Si = s.rw.Si
+			out.BufferPool = p.pool
+			out.Refs[out.AddLen(v)] = r
+		}
+		if full {
+			break
+		}
+		if !p.sent {
+			p.pool.FreeRefs(&p.r, 1, true)
+		}
+	}
+
+	l := copy(m.pending, m.pending[done:])
+	m.pending = m.pending[:l]
+	n.Activate(l > 0)
+}
@@ -0,0 +1,722 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Optional per hardware interface egress queueing.  Packets sent to an interface output node
+// are classified into queues which are served by strict priority and deficit round robin among
+// queues of equal priority.  Each queue and the port as a whole may be shaped by a token bucket.
+// Packets which cannot be sent immediately stay queued and are transmitted by the egress node
+// once shapers allow.
+
+type EgressDropPolicy uint8
+
+const (
+	// Drop arriving packets when queue is full.
+	TailDrop EgressDropPolicy = iota
+	// Weighted random early detection: drop arriving packets with probability increasing
+	// linearly from 0 to MaxProbability as average queue depth goes from MinThreshold to MaxThreshold.
+	// Packets are always dropped above MaxThreshold.
+	Wred
+)
+
+var egressDropPolicyStrings = [...]string{
+	TailDrop: "tail-drop",
+	Wred:     "wred",
+}
+
+func (p EgressDropPolicy) String() string { return elib.Stringer(egressDropPolicyStrings[:], int(p)) }
+
+// Token bucket shaper; zero rate disables shaping.
+type EgressShaper struct {
+	// Rate in bits per second.
+	Rate Bandwidth
+	// Bucket size in bytes.
+	Burst uint
+}
+
+func (s EgressShaper) String() string {
+	if s.Rate == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%sbps burst %d", s.Rate, s.Burst)
+}
+
+// Default burst is 10 milliseconds at given rate but at least a few jumbo frames.
+func defaultEgressBurst(rate Bandwidth) (b uint) {
+	b = uint(float64(rate) / 8 * 10e-3)
+	if b < 32<<10 {
+		b = 32 << 10
+	}
+	return
+}
+
+// Parse shaper e.g. 1g burst 16384 or none.
+func (s *EgressShaper) Parse(in *parse.Input) {
+	*s = EgressShaper{}
+	if in.Parse("none") {
+		return
+	}
+	if !in.Parse("%v", &s.Rate) || s.Rate <= 0 {
+		in.ParseError()
+	}
+	if !in.Parse("burst %d", &s.Burst) {
+		s.Burst = defaultEgressBurst(s.Rate)
+	}
+}
+
+type EgressQueueConfig struct {
+	// Non-empty queues with higher priority are always served first.
+	Priority uint
+	// Queues with equal priority share bandwidth in proportion to weight (deficit round robin).
+	Weight uint
+	// Maximum number of packets in queue.
+	Limit uint
+	Drop  EgressDropPolicy
+	// Wred average queue depth thresholds in packets and drop probability at MaxThreshold.
+	MinThreshold, MaxThreshold uint
+	MaxProbability             float64
+	Shaper                     EgressShaper
+}
+
+var DefaultEgressQueueConfig = EgressQueueConfig{Weight: 1, Limit: 1024}
+
+func (c *EgressQueueConfig) String() (s string) {
+	s = fmt.Sprintf("priority %d weight %d limit %d", c.Priority, c.Weight, c.Limit)
+	if c.Drop == Wred {
+		s += fmt.Sprintf(" wred %d %d %g", c.MinThreshold, c.MaxThreshold, c.MaxProbability)
+	}
+	if c.Shaper.Rate != 0 {
+		s += " shape " + c.Shaper.String()
+	}
+	return
+}
+
+// Parse queue parameters e.g. priority 1 weight 4 limit 512 wred 64 256 .1 shape 100m
+// Parameters not given keep their current values.
+func (c *EgressQueueConfig) Parse(in *parse.Input) {
+	for !in.End() {
+		switch {
+		case in.Parse("priority %d", &c.Priority):
+		case in.Parse("weight %d", &c.Weight) && c.Weight > 0:
+		case in.Parse("limit %d", &c.Limit) && c.Limit > 0:
+		case in.Parse("tail-drop"):
+			c.Drop = TailDrop
+		case in.Parse("wred %d %d %f", &c.MinThreshold, &c.MaxThreshold, &c.MaxProbability):
+			c.Drop = Wred
+		case in.Parse("shape %v", &c.Shaper):
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func (c *EgressQueueConfig) validate() (err error) {
+	switch {
+	case c.Weight == 0:
+		err = fmt.Errorf("weight must be positive")
+	case c.Limit == 0:
+		err = fmt.Errorf("limit must be positive")
+	case c.Drop == Wred && c.MinThreshold >= c.MaxThreshold:
+		err = fmt.Errorf("wred minimum threshold %d must be less than maximum %d", c.MinThreshold, c.MaxThreshold)
+	case c.Drop == Wred && c.MaxThreshold > c.Limit:
+		err = fmt.Errorf("wred maximum threshold %d exceeds queue limit %d", c.MaxThreshold, c.Limit)
+	case c.Drop == Wred && (c.MaxProbability <= 0 || c.MaxProbability > 1):
+		err = fmt.Errorf("wred drop probability %g must be in (0,1]", c.MaxProbability)
+	}
+	return
+}
+
+type EgressConfig struct {
+	Queues []EgressQueueConfig
+	// Port shaper applied to all queues.
+	Shaper EgressShaper
+	// Packets are assumed to be ethernet frames.  Ip packets are assigned to queues by dscp,
+	// other vlan tagged frames by priority code point and all other frames go to queue 0.
+	DscpQueue [64]uint8
+	PcpQueue  [8]uint8
+}
+
+func (c *EgressConfig) validate() (err error) {
+	nq := uint(len(c.Queues))
+	if nq == 0 {
+		return fmt.Errorf("no queues configured")
+	}
+	for i := range c.Queues {
+		if err = c.Queues[i].validate(); err != nil {
+			return fmt.Errorf("queue %d: %v", i, err)
+		}
+	}
+	for d, q := range c.DscpQueue {
+		if uint(q) >= nq {
+			return fmt.Errorf("dscp %d maps to unknown queue %d", d, q)
+		}
+	}
+	for p, q := range c.PcpQueue {
+		if uint(q) >= nq {
+			return fmt.Errorf("pcp %d maps to unknown queue %d", p, q)
+		}
+	}
+	return
+}
+
+// Queue index for given ethernet frame.
+func (c *EgressConfig) queue(b []byte) uint {
+	o, pcp := 12, -1
+	for len(b) >= o+2 {
+		switch uint16(b[o])<<8 | uint16(b[o+1]) {
+		case 0x8100, 0x88a8: // vlan, q-in-q
+			if len(b) < o+4 {
+				break
+			}
+			if pcp < 0 {
+				pcp = int(b[o+2] >> 5)
+			}
+			o += 4
+			continue
+		case 0x0800: // ip4: tos byte
+			if len(b) > o+3 {
+				return uint(c.DscpQueue[b[o+3]>>2])
+			}
+		case 0x86dd: // ip6: traffic class spans first 2 bytes
+			if len(b) > o+4 {
+				tc := b[o+2]<<4 | b[o+3]>>4
+				return uint(c.DscpQueue[tc>>2])
+			}
+		}
+		break
+	}
+	if pcp >= 0 {
+		return uint(c.PcpQueue[pcp])
+	}
+	return 0
+}
+
+type tokenBucket struct {
+	// Rate in bytes per second; zero when shaping is disabled.
+	rate   float64
+	size   float64
+	tokens float64
+	last   cpu.Time
+}
+
+func (b *tokenBucket) init(s EgressShaper, now cpu.Time) {
+	b.rate = float64(s.Rate) / 8
+	b.size = float64(s.Burst)
+	b.tokens = b.size
+	b.last = now
+}
+
+func (b *tokenBucket) refill(now cpu.Time) {
+	if b.rate == 0 || now <= b.last {
+		return
+	}
+	b.tokens += (now - b.last).Seconds() * b.rate
+	if b.tokens > b.size {
+		b.tokens = b.size
+	}
+	b.last = now
+}
+
+// Packets larger than bucket are sent when bucket is full.
+func (b *tokenBucket) need(size uint) (x float64) {
+	x = float64(size)
+	if x > b.size {
+		x = b.size
+	}
+	return
+}
+
+func (b *tokenBucket) conform(size uint) bool { return b.rate == 0 || b.tokens >= b.need(size) }
+
+func (b *tokenBucket) take(size uint) {
+	if b.rate != 0 {
+		b.tokens -= float64(size)
+	}
+}
+
+// Seconds until packet of given size conforms.
+func (b *tokenBucket) wait(size uint) float64 {
+	if b.conform(size) {
+		return 0
+	}
+	return (b.need(size) - b.tokens) / b.rate
+}
+
+const (
+	egressTransmit = iota
+	egressTailDrop
+	egressWredDrop
+	nEgressCounter
+)
+
+type egressQueue struct {
+	EgressQueueConfig
+
+	// Circular buffer of queued packets and their lengths in bytes.
+	refs  []Ref
+	sizes []uint32
+	head  uint
+	len   uint
+	bytes uint
+
+	// Wred average queue depth.
+	avg float64
+
+	// Deficit round robin byte credit and whether quantum has been added for current turn.
+	deficit uint
+	turn    bool
+
+	shaper tokenBucket
+
+	counters [nEgressCounter]CombinedCounter
+}
+
+// Byte credit added per round for weight 1.
+const egressQuantum = 1536
+
+// Weight of current queue depth in wred average.
+const wredAvgWeight = 1. / 512
+
+func (q *egressQueue) headSize() uint { return uint(q.sizes[q.head]) }
+
+func (q *egressQueue) eligible() bool { return q.len > 0 && q.shaper.conform(q.headSize()) }
+
+func (q *egressQueue) wredProbability() float64 {
+	switch {
+	case q.avg < float64(q.MinThreshold):
+		return 0
+	case q.avg >= float64(q.MaxThreshold):
+		return 1
+	default:
+		return q.MaxProbability * (q.avg - float64(q.MinThreshold)) / float64(q.MaxThreshold-q.MinThreshold)
+	}
+}
+
+// Queues with equal priority.
+type egressLevel struct {
+	queues []uint
+	// Queue currently being served by deficit round robin.
+	cursor uint
+}
+
+type egressScheduler struct {
+	mu     sync.Mutex
+	config EgressConfig
+	queues []egressQueue
+	// Highest priority first.
+	levels []egressLevel
+	shaper tokenBucket
+	// Total number of queued packets.
+	backlog uint
+	rand    *rand.Rand
+	// Buffer pool of queued packets.
+	pool *BufferPool
+	// Set under lock when scheduler has been replaced; queued packets have moved to its replacement.
+	retired bool
+	// Scratch vectors for dequeued and dropped packets.
+	refs, drops [MaxVectorLen]Ref
+}
+
+func newEgressScheduler(c *EgressConfig, now cpu.Time) (s *egressScheduler) {
+	s = &egressScheduler{config: *c}
+	s.config.Queues = append([]EgressQueueConfig(nil), c.Queues...)
+	s.rand = rand.New(rand.NewSource(int64(now)))
+	s.shaper.init(c.Shaper, now)
+	s.queues = make([]egressQueue, len(c.Queues))
+	byPriority := make(map[uint]int)
+	for i := range s.queues {
+		q := &s.queues[i]
+		q.EgressQueueConfig = c.Queues[i]
+		q.refs = make([]Ref, q.Limit)
+		q.sizes = make([]uint32, q.Limit)
+		q.shaper.init(q.Shaper, now)
+		l, ok := byPriority[q.Priority]
+		if !ok {
+			l = len(s.levels)
+			byPriority[q.Priority] = l
+			s.levels = append(s.levels, egressLevel{})
+		}
+		s.levels[l].queues = append(s.levels[l].queues, uint(i))
+	}
+	// Insertion sort levels by decreasing priority; there are only a few.
+	for i := 1; i < len(s.levels); i++ {
+		for j := i; j > 0 && s.queues[s.levels[j].queues[0]].Priority > s.queues[s.levels[j-1].queues[0]].Priority; j-- {
+			s.levels[j], s.levels[j-1] = s.levels[j-1], s.levels[j]
+		}
+	}
+	return
+}
+
+// Enqueue packet of given size on given queue; returns false if packet is dropped.
+func (s *egressScheduler) enqueue(r *Ref, size, qi uint) (ok bool) {
+	q := &s.queues[qi]
+	if q.Drop == Wred {
+		q.avg += (float64(q.len) - q.avg) * wredAvgWeight
+		if p := q.wredProbability(); p >= 1 || (p > 0 && s.rand.Float64() < p) {
+			q.counters[egressWredDrop].add(size)
+			return
+		}
+	}
+	if q.len >= uint(len(q.refs)) {
+		q.counters[egressTailDrop].add(size)
+		return
+	}
+	i := (q.head + q.len) % uint(len(q.refs))
+	q.refs[i], q.sizes[i] = *r, uint32(size)
+	q.len++
+	q.bytes += size
+	s.backlog++
+	return true
+}
+
+func (c *CombinedCounter) add(size uint) {
+	c.Packets++
+	c.Bytes += uint64(size)
+}
+
+// Select queue to serve next: highest priority level with a queue whose shaper allows
+// transmission then deficit round robin within level.  Returns -1 if no queue may transmit.
+func (s *egressScheduler) selectQueue() int {
+	for li := range s.levels {
+		l := &s.levels[li]
+		ok := false
+		for _, qi := range l.queues {
+			if ok = s.queues[qi].eligible(); ok {
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		// Terminates since eligible queue gains a quantum of credit on each turn.
+		for {
+			q := &s.queues[l.queues[l.cursor]]
+			if q.eligible() {
+				if !q.turn {
+					q.deficit += q.Weight * egressQuantum
+					q.turn = true
+				}
+				if q.headSize() <= q.deficit {
+					return int(l.queues[l.cursor])
+				}
+			} else if q.len == 0 {
+				// Idle queues do not accumulate credit.
+				q.deficit = 0
+			}
+			q.turn = false
+			if l.cursor++; l.cursor >= uint(len(l.queues)) {
+				l.cursor = 0
+			}
+		}
+	}
+	return -1
+}
+
+// Dequeue packets allowed by scheduler and shapers into given vector; returns number of packets dequeued.
+func (s *egressScheduler) dequeue(rs []Ref, now cpu.Time) (n uint) {
+	s.shaper.refill(now)
+	for i := range s.queues {
+		s.queues[i].shaper.refill(now)
+	}
+	for n < uint(len(rs)) && s.backlog > 0 {
+		qi := s.selectQueue()
+		if qi < 0 {
+			break
+		}
+		q := &s.queues[qi]
+		size := q.headSize()
+		if !s.shaper.conform(size) {
+			break
+		}
+		rs[n] = q.refs[q.head]
+		n++
+		if q.head++; q.head >= uint(len(q.refs)) {
+			q.head = 0
+		}
+		q.len--
+		q.bytes -= size
+		q.deficit -= size
+		s.backlog--
+		q.shaper.take(size)
+		s.shaper.take(size)
+		q.counters[egressTransmit].add(size)
+	}
+	return
+}
+
+// Seconds until next packet may be sent; negative if nothing is queued.
+func (s *egressScheduler) wait() (dt float64) {
+	dt = -1
+	for i := range s.queues {
+		q := &s.queues[i]
+		if q.len == 0 {
+			continue
+		}
+		size := q.headSize()
+		w := q.shaper.wait(size)
+		if x := s.shaper.wait(size); x > w {
+			w = x
+		}
+		if dt < 0 || w < dt {
+			dt = w
+		}
+	}
+	return
+}
+
+// Remove all queued packets appending them to given vector.
+func (s *egressScheduler) flush(rs []Ref) []Ref {
+	for i := range s.queues {
+		q := &s.queues[i]
+		for ; q.len > 0; q.len-- {
+			rs = append(rs, q.refs[q.head])
+			if q.head++; q.head >= uint(len(q.refs)) {
+				q.head = 0
+			}
+		}
+		q.bytes = 0
+	}
+	s.backlog = 0
+	return rs
+}
+
+// Node which transmits queued packets when shapers allow.
+type egressNode struct {
+	InputNode
+	refs [MaxVectorLen]Ref
+	// Vector state for transmit vectors sent to interface output threads.
+	tx RefIn
+}
+
+type egressMain struct {
+	egressNode egressNode
+	mu         sync.Mutex
+	// Set when packets are queued while egress node is running.
+	egressKick bool
+	// Interfaces with egress queueing enabled.
+	egressHwIfs []*HwIf
+}
+
+func (v *Vnet) egressInit() {
+	n := &v.egressNode
+	// Transmit vectors are sent directly to interface output threads; node has no packets
+	// of its own to hand to next nodes.
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "egress")
+}
+
+func init() {
+	AddInit(func(v *Vnet) { v.egressInit() })
+}
+
+// Make sure egress node runs to transmit queued packets.
+func (m *egressMain) egressActivate() {
+	m.mu.Lock()
+	m.egressKick = true
+	m.egressNode.Activate(true)
+	m.mu.Unlock()
+}
+
+func (n *egressNode) NodeInput(o *RefOut) {
+	v := n.Vnet
+	m := &v.egressMain
+	// Transmit on behalf of this node's poller.
+	ri := &n.tx
+	ri.In = o.Outs[0].In
+	now := cpu.TimeNow()
+	dt := float64(-1)
+
+	m.mu.Lock()
+	m.egressKick = false
+	hs := m.egressHwIfs
+	m.mu.Unlock()
+
+	for _, h := range hs {
+		s := h.getEgress()
+		if s == nil || len(h.n) == 0 {
+			continue
+		}
+		in := h.n[0].GetInterfaceNode()
+		s.mu.Lock()
+		if s.retired {
+			// Replaced by SetEgress; replacement is served on next pass.
+			s.mu.Unlock()
+			continue
+		}
+		ri.BufferPool = s.pool
+		if in.tx_chan == nil {
+			rs := s.flush(n.refs[:0])
+			s.mu.Unlock()
+			in.egressFree(ri.BufferPool, rs)
+			continue
+		}
+		k := s.dequeue(n.refs[:], now)
+		w := s.wait()
+		s.mu.Unlock()
+		if k > 0 {
+			in.txRefs(ri, n.refs[:k], k)
+		}
+		if w >= 0 && (dt < 0 || w < dt) {
+			dt = w
+		}
+	}
+
+	m.mu.Lock()
+	switch {
+	case m.egressKick || dt == 0:
+		n.Activate(true)
+	case dt < 0:
+		n.Activate(false)
+	case dt > 10e-6:
+		n.ActivateAfter(dt)
+	}
+	m.mu.Unlock()
+}
+
+func (n *interfaceNode) egressFree(p *BufferPool, rs []Ref) {
+	if l := uint(len(rs)); l > 0 {
+		p.FreeRefs(&rs[0], l, true)
+		n.CountError(n.txDownDropError, l)
+	}
+}
+
+// Queue input packets and transmit those allowed by scheduler.
+// Returns false when egress queueing has been disabled so packets are to be sent directly.
+func (n *interfaceNode) egressOutput(ri *RefIn, s *egressScheduler) (ok bool) {
+	now := cpu.TimeNow()
+	n_drop := uint(0)
+	s.mu.Lock()
+	// Scheduler may have been replaced since it was loaded.
+	for s.retired {
+		s.mu.Unlock()
+		if s = n.Vnet.HwIf(n.hi).getEgress(); s == nil {
+			return
+		}
+		s.mu.Lock()
+	}
+	s.pool = ri.BufferPool
+	for i := uint(0); i < ri.InLen(); i++ {
+		r := &ri.Refs[i]
+		size := uint(0)
+		for x := r; x != nil; x = x.NextRef() {
+			size += x.DataLen()
+		}
+		if !s.enqueue(r, size, s.config.queue(r.DataSlice())) {
+			s.drops[n_drop] = *r
+			n_drop++
+		}
+	}
+	k := s.dequeue(s.refs[:], now)
+	backlog := s.backlog > 0
+	s.mu.Unlock()
+
+	if n_drop > 0 {
+		ri.BufferPool.FreeRefs(&s.drops[0], n_drop, true)
+		n.CountError(n.egressDropError, n_drop)
+	}
+	if k > 0 {
+		n.txRefs(ri, s.refs[:k], k)
+	}
+	if backlog {
+		n.Vnet.egressMain.egressActivate()
+	}
+	return true
+}
+
+func (h *HwIf) getEgress() (s *egressScheduler) {
+	s, _ = h.egress.Load().(*egressScheduler)
+	return
+}
+
+// SetEgress enables egress queueing on hardware interface with given configuration.
+// Nil configuration disables queueing.  Queued packets are kept in queues which still exist
+// after reconfiguration as long as they fit; others are dropped.
+func (h *HwIf) SetEgress(c *EgressConfig) (err error) {
+	v := h.vnet
+	if c != nil {
+		if err = c.validate(); err != nil {
+			return
+		}
+	}
+	var s *egressScheduler
+	if c != nil {
+		s = newEgressScheduler(c, cpu.TimeNow())
+	}
+
+	m := &v.egressMain
+	// Serializes concurrent reconfiguration; data path only takes scheduler locks.
+	m.mu.Lock()
+	hs := m.egressHwIfs[:0:0]
+	for _, x := range m.egressHwIfs {
+		if x != h {
+			hs = append(hs, x)
+		}
+	}
+	if s != nil {
+		hs = append(hs, h)
+	}
+	m.egressHwIfs = hs
+
+	var drops []Ref
+	old := h.getEgress()
+	if old != nil {
+		old.mu.Lock()
+		if s != nil {
+			s.pool = old.pool
+			for qi := range old.queues {
+				q := &old.queues[qi]
+				for ; q.len > 0; q.len-- {
+					r := &q.refs[q.head]
+					if qi >= len(s.queues) || !s.enqueue(r, q.headSize(), uint(qi)) {
+						drops = append(drops, *r)
+					}
+					if q.head++; q.head >= uint(len(q.refs)) {
+						q.head = 0
+					}
+				}
+			}
+			old.backlog = 0
+		} else {
+			drops = old.flush(drops)
+		}
+		// Readers waiting on old lock will find it retired and load new scheduler.
+		old.retired = true
+	}
+	h.egress.Store(s)
+	activate := s != nil && s.backlog > 0
+	if old != nil {
+		old.mu.Unlock()
+	}
+	m.mu.Unlock()
+
+	// No reader can reach old queues once retired, so drops may be freed.
+	if len(drops) > 0 {
+		old.pool.FreeRefs(&drops[0], uint(len(drops)), true)
+	}
+	if activate {
+		m.egressActivate()
+	}
+	return
+}
+
+// Egress returns copy of egress configuration or nil when egress queueing is disabled.
+func (h *HwIf) Egress() (c *EgressConfig) {
+	if s := h.getEgress(); s != nil {
+		x := s.config
+		x.Queues = append([]EgressQueueConfig(nil), x.Queues...)
+		c = &x
+	}
+	return
+}
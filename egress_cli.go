@@ -0,0 +1,196 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/parse"
+
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parse comma separated list of values less than max into bitmap.
+func parseEgressList(s string, max uint) (x uint64) {
+	for _, f := range strings.Split(s, ",") {
+		i, err := strconv.ParseUint(f, 10, 8)
+		if err != nil || uint(i) >= max {
+			panic(fmt.Errorf("invalid value `%s'", f))
+		}
+		x |= 1 << uint(i)
+	}
+	return
+}
+
+// set hardware-interface INTF egress queue Q [priority P] [weight W] [limit L] [tail-drop | wred MIN MAX PROB] [shape RATE [burst BYTES] | none]
+// set hardware-interface INTF egress shape RATE [burst BYTES] | none
+// set hardware-interface INTF egress map dscp|pcp N,... queue Q
+// set hardware-interface INTF egress disable
+func (h *HwIf) setEgress(in *parse.Input) (err error) {
+	var (
+		c    EgressConfig
+		qi   uint
+		list string
+	)
+	if x := h.Egress(); x != nil {
+		c = *x
+	}
+	switch {
+	case in.Parse("disable"):
+		return h.SetEgress(nil)
+	case in.Parse("queue %d", &qi):
+		for uint(len(c.Queues)) <= qi {
+			c.Queues = append(c.Queues, DefaultEgressQueueConfig)
+		}
+		if !in.Parse("%v", &c.Queues[qi]) {
+			return cli.ParseError
+		}
+	case in.Parse("shape %v", &c.Shaper):
+	case in.Parse("map dscp %s queue %d", &list, &qi):
+		x := parseEgressList(list, uint(len(c.DscpQueue)))
+		for i := range c.DscpQueue {
+			if x&(1<<uint(i)) != 0 {
+				c.DscpQueue[i] = uint8(qi)
+			}
+		}
+	case in.Parse("map pcp %s queue %d", &list, &qi):
+		x := parseEgressList(list, uint(len(c.PcpQueue)))
+		for i := range c.PcpQueue {
+			if x&(1<<uint(i)) != 0 {
+				c.PcpQueue[i] = uint8(qi)
+			}
+		}
+	default:
+		return cli.ParseError
+	}
+	if len(c.Queues) == 0 {
+		c.Queues = append(c.Queues, DefaultEgressQueueConfig)
+	}
+	return h.SetEgress(&c)
+}
+
+type showEgressQueue struct {
+	Interface string `format:"%-20s" align:"left"`
+	Queue     uint   `format:"%5d"`
+	Priority  uint   `format:"%8d"`
+	Weight    uint   `format:"%6d"`
+	Depth     string `format:"%12s"`
+	Shaper    string `format:"%-24s" align:"left"`
+	Transmit  uint64 `format:"%16d"`
+	TailDrops uint64 `format:"%12d"`
+	WredDrops uint64 `format:"%12d"`
+}
+
+func (v *Vnet) showEgress(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var hi Hi
+	hiValid := false
+	for !in.End() {
+		switch {
+		case in.Parse("%v", &hi, v):
+			hiValid = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v.egressMain.mu.Lock()
+	hs := append([]*HwIf(nil), v.egressHwIfs...)
+	v.egressMain.mu.Unlock()
+	sort.Slice(hs, func(i, j int) bool { return hs[i].name < hs[j].name })
+
+	var qs []showEgressQueue
+	for _, h := range hs {
+		s := h.getEgress()
+		if s == nil || (hiValid && h.hi != hi) {
+			continue
+		}
+		s.mu.Lock()
+		fmt.Fprintf(w, "%s: shape %s", h.name, s.config.Shaper)
+		if s.shaper.rate != 0 {
+			fmt.Fprintf(w, ", tokens %.0f", s.shaper.tokens)
+		}
+		fmt.Fprintf(w, ", %d packets queued\n", s.backlog)
+		for i := range s.queues {
+			q := &s.queues[i]
+			x := showEgressQueue{
+				Interface: h.name,
+				Queue:     uint(i),
+				Priority:  q.Priority,
+				Weight:    q.Weight,
+				Depth:     fmt.Sprintf("%d/%d", q.len, q.Limit),
+				Shaper:    q.Shaper.String(),
+				Transmit:  q.counters[egressTransmit].Packets,
+				TailDrops: q.counters[egressTailDrop].Packets,
+				WredDrops: q.counters[egressWredDrop].Packets,
+			}
+			if q.Drop == Wred {
+				x.Shaper += fmt.Sprintf(", wred avg %.1f", q.avg)
+			}
+			qs = append(qs, x)
+		}
+		s.mu.Unlock()
+	}
+	if hiValid && len(qs) == 0 {
+		err = fmt.Errorf("%s: egress queueing not enabled", v.HwIf(hi).name)
+		return
+	}
+	if len(qs) > 0 {
+		elib.Tabulate(qs).Write(w)
+	}
+	return
+}
+
+func (v *Vnet) clearEgress(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var hi Hi
+	hiValid := false
+	for !in.End() {
+		switch {
+		case in.Parse("counters"):
+		case in.Parse("%v", &hi, v):
+			hiValid = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v.egressMain.mu.Lock()
+	hs := v.egressHwIfs
+	v.egressMain.mu.Unlock()
+	for _, h := range hs {
+		s := h.getEgress()
+		if s == nil || (hiValid && h.hi != hi) {
+			continue
+		}
+		s.mu.Lock()
+		for i := range s.queues {
+			s.queues[i].counters = [nEgressCounter]CombinedCounter{}
+		}
+		s.mu.Unlock()
+	}
+	return
+}
+
+func init() {
+	AddInit(func(v *Vnet) {
+		cmds := [...]cli.Command{
+			cli.Command{
+				Name:      "show egress",
+				ShortHelp: "show egress queue depth, transmit and drop counters [INTERFACE]",
+				Action:    v.showEgress,
+			},
+			cli.Command{
+				Name:      "clear egress",
+				ShortHelp: "clear egress queue counters [INTERFACE]",
+				Action:    v.clearEgress,
+			},
+		}
+		for i := range cmds {
+			v.CliAdd(&cmds[i])
+		}
+	})
+}
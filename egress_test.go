@@ -0,0 +1,157 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"testing"
+)
+
+func egressSeconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+// Fill queues with packets of given size and return number of packets sent from each queue.
+func egressRun(s *egressScheduler, size uint, nPerQueue int, now cpu.Time, nDequeue uint) (sent []uint) {
+	var r Ref
+	for qi := range s.queues {
+		for i := 0; i < nPerQueue; i++ {
+			r.Aux = uint32(qi)
+			s.enqueue(&r, size, uint(qi))
+		}
+	}
+	rs := make([]Ref, nDequeue)
+	n := s.dequeue(rs, now)
+	sent = make([]uint, len(s.queues))
+	for i := uint(0); i < n; i++ {
+		sent[rs[i].Aux]++
+	}
+	return
+}
+
+func TestEgressDrr(t *testing.T) {
+	q := DefaultEgressQueueConfig
+	c := &EgressConfig{Queues: []EgressQueueConfig{q, q}}
+	c.Queues[1].Weight = 3
+	s := newEgressScheduler(c, 0)
+	sent := egressRun(s, egressQuantum, 400, 0, 400)
+	// Bandwidth is shared 1:3.
+	if sent[0] != 100 || sent[1] != 300 {
+		t.Errorf("sent %v", sent)
+	}
+}
+
+func TestEgressPriority(t *testing.T) {
+	q := DefaultEgressQueueConfig
+	c := &EgressConfig{Queues: []EgressQueueConfig{q, q}}
+	c.Queues[1].Priority = 1
+	c.Queues[1].Shaper = EgressShaper{Rate: 8 * 10000, Burst: 10000}
+	s := newEgressScheduler(c, 0)
+	// Shaped high priority queue sends its burst first then low priority queue gets the rest.
+	sent := egressRun(s, 1000, 50, 0, 30)
+	if sent[0] != 20 || sent[1] != 10 {
+		t.Errorf("sent %v", sent)
+	}
+	if w := s.wait(); w != 0 {
+		t.Errorf("wait %g", w)
+	}
+}
+
+func TestEgressShaper(t *testing.T) {
+	c := &EgressConfig{
+		Queues: []EgressQueueConfig{DefaultEgressQueueConfig},
+		// 1 megabyte per second with 5000 byte burst.
+		Shaper: EgressShaper{Rate: 8e6, Burst: 5000},
+	}
+	s := newEgressScheduler(c, 0)
+	if sent := egressRun(s, 1000, 20, 0, 20); sent[0] != 5 {
+		t.Fatalf("burst sent %v", sent)
+	}
+	if w := s.wait(); w < 999e-6 || w > 1001e-6 {
+		t.Errorf("wait %g", w)
+	}
+	rs := make([]Ref, 20)
+	if n := s.dequeue(rs, egressSeconds(3e-3)); n != 3 {
+		t.Errorf("sent %d after 3ms", n)
+	}
+	if s.backlog != 12 {
+		t.Errorf("backlog %d", s.backlog)
+	}
+}
+
+func TestEgressDrops(t *testing.T) {
+	c := &EgressConfig{Queues: []EgressQueueConfig{DefaultEgressQueueConfig}}
+	q := &c.Queues[0]
+	q.Limit = 10
+	s := newEgressScheduler(c, 0)
+	var r Ref
+	for i := 0; i < 15; i++ {
+		s.enqueue(&r, 100, 0)
+	}
+	if x := s.queues[0].counters[egressTailDrop]; x.Packets != 5 || x.Bytes != 500 {
+		t.Errorf("tail drops %+v", x)
+	}
+
+	q.Drop, q.MinThreshold, q.MaxThreshold, q.MaxProbability = Wred, 2, 6, .5
+	s = newEgressScheduler(c, 0)
+	x := &s.queues[0]
+	for _, v := range []struct{ avg, p float64 }{{1, 0}, {4, .25}, {6, 1}} {
+		x.avg = v.avg
+		if p := x.wredProbability(); p != v.p {
+			t.Errorf("avg %g: probability %g want %g", v.avg, p, v.p)
+		}
+	}
+	x.avg = 7
+	if s.enqueue(&r, 100, 0) || x.counters[egressWredDrop].Packets != 1 {
+		t.Errorf("expected wred drop")
+	}
+}
+
+func TestEgressClassify(t *testing.T) {
+	c := &EgressConfig{}
+	c.DscpQueue[46] = 2
+	c.PcpQueue[5] = 1
+	b := make([]byte, 18+20)
+	b[12], b[13] = 0x81, 0x00
+	b[14] = 5 << 5
+	b[16], b[17] = 0x08, 0x00
+	b[18], b[19] = 0x45, 46<<2
+	if q := c.queue(b); q != 2 {
+		t.Errorf("ip4 queue %d", q)
+	}
+	b[16], b[17] = 0x08, 0x06
+	if q := c.queue(b); q != 1 {
+		t.Errorf("vlan queue %d", q)
+	}
+	if q := c.queue(b[4:]); q != 0 {
+		t.Errorf("untagged queue %d", q)
+	}
+}
+
+func TestEgressReplace(t *testing.T) {
+	v := &Vnet{}
+	h := &HwIf{vnet: v}
+	q := DefaultEgressQueueConfig
+	if err := h.SetEgress(&EgressConfig{Queues: []EgressQueueConfig{q}}); err != nil {
+		t.Fatal(err)
+	}
+	s := h.getEgress()
+	if err := h.SetEgress(&EgressConfig{Queues: []EgressQueueConfig{q, q}}); err != nil {
+		t.Fatal(err)
+	}
+	// Readers holding old scheduler must see it retired and find its replacement.
+	x := h.getEgress()
+	if !s.retired || x == s || x.retired || len(x.queues) != 2 {
+		t.Errorf("scheduler not replaced")
+	}
+	if err := h.SetEgress(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !x.retired || h.getEgress() != nil || h.Egress() != nil || len(v.egressHwIfs) != 0 {
+		t.Errorf("egress not disabled")
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/elog"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Event in Chrome trace event format as understood by chrome://tracing and Perfetto.
+type ChromeTraceEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	// Phase: "i" for instant events; "M" for metadata (process and thread names).
+	Ph string `json:"ph"`
+	// Time stamp in micro-seconds.
+	Ts  float64 `json:"ts"`
+	Pid uint    `json:"pid"`
+	Tid uint    `json:"tid"`
+	// Scope of instant events: "t" for thread.
+	S    string                 `json:"s,omitempty"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type ChromeTrace struct {
+	TraceEvents     []ChromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+
+	pids   map[string]uint
+	tracks map[chromeTraceTrack]uint
+}
+
+// Each thread is a trace process with one track (trace thread) for each event type.
+type chromeTraceTrack struct {
+	thread   string
+	typeName string
+}
+
+// Elog does not record thread of events; events are attributed to thread of node they name.
+// Events naming no node are attributed to main loop thread.
+const chromeTraceMainThread = "main"
+
+// Elog event as extracted from view.
+type chromeTraceElogEvent struct {
+	// Seconds since start of view.
+	time float64
+	// Type name of event data (e.g. irq_elog).
+	typeName string
+	lines    []string
+}
+
+func (t *ChromeTrace) getPid(thread string) (pid uint) {
+	if t.pids == nil {
+		t.pids = make(map[string]uint)
+		t.tracks = make(map[chromeTraceTrack]uint)
+	}
+	var ok bool
+	if pid, ok = t.pids[thread]; ok {
+		return
+	}
+	pid = uint(len(t.pids)) + 1
+	t.pids[thread] = pid
+	t.TraceEvents = append(t.TraceEvents, ChromeTraceEvent{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  pid,
+		Args: map[string]interface{}{"name": thread},
+	})
+	return
+}
+
+func (t *ChromeTrace) getTrack(thread, typeName string) (pid, tid uint) {
+	pid = t.getPid(thread)
+	k := chromeTraceTrack{thread: thread, typeName: typeName}
+	var ok bool
+	if tid, ok = t.tracks[k]; ok {
+		return
+	}
+	tid = uint(len(t.tracks)) + 1
+	t.tracks[k] = tid
+	t.TraceEvents = append(t.TraceEvents, ChromeTraceEvent{
+		Name: "thread_name",
+		Ph:   "M",
+		Pid:  pid,
+		Tid:  tid,
+		Args: map[string]interface{}{"name": typeName},
+	})
+	return
+}
+
+// Node named in event is first word of first line matching a node name.
+func chromeTraceNodeName(lines []string, isNode func(name string) bool) string {
+	if len(lines) == 0 || isNode == nil {
+		return ""
+	}
+	for _, f := range strings.Fields(lines[0]) {
+		if isNode(f) {
+			return f
+		}
+	}
+	return ""
+}
+
+// Thread for event: node named in event; interface transmit events run in interface's output thread.
+func (e *chromeTraceElogEvent) thread(isNode func(name string) bool) string {
+	n := chromeTraceNodeName(e.lines, isNode)
+	if len(n) == 0 {
+		return chromeTraceMainThread
+	}
+	if e.typeName == "txElogEvent" && strings.HasPrefix(e.lines[0], tx_elog_kind(tx_elog_tx).String()+" ") {
+		return n + " tx"
+	}
+	return n
+}
+
+func (t *ChromeTrace) add(e *chromeTraceElogEvent, isNode func(name string) bool) {
+	x := ChromeTraceEvent{
+		Cat: e.typeName,
+		Ph:  "i",
+		S:   "t",
+		Ts:  1e6 * e.time,
+	}
+	if len(e.lines) > 0 {
+		x.Name = e.lines[0]
+	}
+	typeName := e.typeName
+	if len(typeName) == 0 {
+		typeName = "unknown"
+	}
+	x.Pid, x.Tid = t.getTrack(e.thread(isNode), typeName)
+	x.Args = map[string]interface{}{"type": e.typeName}
+	if len(e.lines) > 1 {
+		x.Args["lines"] = e.lines[1:]
+	}
+	t.TraceEvents = append(t.TraceEvents, x)
+}
+
+// NewChromeTrace converts given events (or all events if eis is nil) in elog view into Chrome trace events.
+// Each thread is a trace process with a track for each event type.  Events whose first line names
+// a node (as determined by isNode) are attributed to that node's thread; others to main loop thread.
+func NewChromeTrace(ev *elog.View, eis []uint, isNode func(name string) bool) (t *ChromeTrace) {
+	t = &ChromeTrace{DisplayTimeUnit: "ns"}
+	f := func(i uint) {
+		e := chromeTraceElogEvent{
+			time:  ev.Event(i).ElapsedTime(ev),
+			lines: ev.EventLines(i),
+		}
+		if c := ev.EventCaller(i); c != nil {
+			e.typeName = c.TypeName
+		}
+		t.add(&e, isNode)
+	}
+	if eis != nil {
+		for _, i := range eis {
+			f(i)
+		}
+	} else {
+		for i := uint(0); i < ev.NumEvents(); i++ {
+			f(i)
+		}
+	}
+	return
+}
+
+func (t *ChromeTrace) Write(w io.Writer) error { return json.NewEncoder(w).Encode(t) }
+
+// ChromeTrace converts events in elog view into Chrome trace events with one process per vnet node thread.
+func (v *Vnet) ChromeTrace(ev *elog.View, eis []uint) *ChromeTrace {
+	nodes := make(map[string]bool)
+	for _, n := range v.runtimeNodes {
+		nodes[n.Name()] = true
+	}
+	return NewChromeTrace(ev, eis, func(name string) bool { return nodes[name] })
+}
+
+// WriteEventLogChromeTrace writes current contents of event log in Chrome trace event JSON format.
+func (v *Vnet) WriteEventLogChromeTrace(w io.Writer) error {
+	return v.ChromeTrace(elog.NewView(), nil).Write(w)
+}
+
+func (v *Vnet) exportEventLog(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var file, matching string
+	for !in.End() {
+		switch {
+		case in.Parse("m%*atching %s", &matching):
+		case in.Parse("%s", &file):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if len(file) == 0 {
+		err = fmt.Errorf("missing file name")
+		return
+	}
+
+	ev := elog.NewView()
+	var eis []uint
+	if len(matching) > 0 {
+		if eis, err = ev.EventsMatching(matching, eis); err != nil {
+			return
+		}
+		if eis == nil {
+			eis = []uint{}
+		}
+	}
+	t := v.ChromeTrace(ev, eis)
+
+	var f *os.File
+	if f, err = os.Create(file); err != nil {
+		return
+	}
+	if err = t.Write(f); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	n := ev.NumEvents()
+	if eis != nil {
+		n = uint(len(eis))
+	}
+	fmt.Fprintf(w, "%d events written to %s\n", n, file)
+	return
+}
+
+func init() {
+	AddInit(func(v *Vnet) {
+		v.CliAdd(&cli.Command{
+			Name:      "export event-log",
+			ShortHelp: "export event log as Chrome trace event JSON: export event-log FILE [matching REGEXP]",
+			Action:    v.exportEventLog,
+		})
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestChromeTrace(t *testing.T) {
+	nodes := map[string]bool{"ixge-0-0": true, "ip4-input": true}
+	isNode := func(name string) bool { return nodes[name] }
+
+	tr := &ChromeTrace{DisplayTimeUnit: "ns"}
+	for _, e := range []chromeTraceElogEvent{
+		{time: 1e-6, typeName: "irq_elog", lines: []string{"ixge-0-0 interrupt status 0x1", "ixge-0-0 irq rx"}},
+		{time: 2e-6, typeName: "call_elog", lines: []string{"loop call ixge-0-0 4"}},
+		{time: 3e-6, typeName: "call_elog", lines: []string{"loop call ip4-input 4"}},
+		{time: 4e-6, typeName: "netlinkElogEvent", lines: []string{"netlink add route"}},
+		{time: 5e-6, typeName: "txElogEvent", lines: []string{"send-tx ixge-0-0 4 buffers"}},
+		{time: 6e-6, typeName: "txElogEvent", lines: []string{"tx ixge-0-0 4 buffers"}},
+		{time: 7e-6, typeName: "call_elog", lines: []string{"loop call ixge-0-0 2"}},
+	} {
+		tr.add(&e, isNode)
+	}
+
+	var b bytes.Buffer
+	if err := tr.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	var x struct {
+		TraceEvents []struct {
+			Name, Ph string
+			Ts       float64
+			Pid, Tid uint
+			Args     map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &x); err != nil {
+		t.Fatal(err)
+	}
+
+	threadNames := make(map[uint]string)
+	trackNames := make(map[uint]string)
+	type track struct{ pid, tid uint }
+	tracks := make(map[string]track)
+	nInstant := 0
+	for _, e := range x.TraceEvents {
+		switch e.Ph {
+		case "M":
+			switch e.Name {
+			case "process_name":
+				threadNames[e.Pid] = e.Args["name"].(string)
+			case "thread_name":
+				trackNames[e.Tid] = e.Args["name"].(string)
+			}
+		case "i":
+			nInstant++
+			tracks[e.Name] = track{e.Pid, e.Tid}
+		}
+	}
+	if nInstant != 7 {
+		t.Fatalf("got %d events want 7:\n%s", nInstant, b.String())
+	}
+	for name, want := range map[string][2]string{
+		"ixge-0-0 interrupt status 0x1": {"ixge-0-0", "irq_elog"},
+		"loop call ixge-0-0 4":          {"ixge-0-0", "call_elog"},
+		"loop call ip4-input 4":         {"ip4-input", "call_elog"},
+		"netlink add route":             {"main", "netlinkElogEvent"},
+		"send-tx ixge-0-0 4 buffers":    {"ixge-0-0", "txElogEvent"},
+		"tx ixge-0-0 4 buffers":         {"ixge-0-0 tx", "txElogEvent"},
+	} {
+		tr := tracks[name]
+		if got := [2]string{threadNames[tr.pid], trackNames[tr.tid]}; got != want {
+			t.Errorf("%s: got thread/track %q want %q", name, got, want)
+		}
+	}
+	// Same event type on different threads gets different tracks; same thread and type share a track.
+	if tracks["loop call ixge-0-0 4"].tid == tracks["loop call ip4-input 4"].tid {
+		t.Errorf("same event type on different threads share track")
+	}
+	if tracks["loop call ixge-0-0 4"] != tracks["loop call ixge-0-0 2"] {
+		t.Errorf("same event type on same thread in different tracks")
+	}
+}
@@ -175,28 +175,38 @@ func (ns errNodes) Less(i, j int) bool {
 func (ns errNodes) Swap(i, j int) { ns[i], ns[j] = ns[j], ns[i] }
 func (ns errNodes) Len() int      { return len(ns) }
 
-func (v *Vnet) showErrors(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+// ForeachError calls f with count since last clear for each node error.
+// Zero counts are skipped unless zero is true.
+func (v *Vnet) ForeachError(zero bool, f func(nodeName, errorName string, count uint64)) {
 	en := ErrorNode
-	ns := []errNode{}
 	for i := range en.errs {
 		e := &en.errs[i]
 		c := uint64(0)
 		for _, t := range en.threads {
 			if t != nil {
-				c += t.counts[i]
+				if i < len(t.counts) {
+					c += t.counts[i]
+				}
 				if i < len(t.countsLastClear) {
 					c -= t.countsLastClear[i]
 				}
 			}
 		}
-		if c > 0 {
-			ns = append(ns, errNode{
-				Node:  e.nodeName,
-				Error: e.str,
-				Count: c,
-			})
+		if c > 0 || zero {
+			f(e.nodeName, e.str, c)
 		}
 	}
+}
+
+func (v *Vnet) showErrors(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	ns := []errNode{}
+	v.ForeachError(false, func(nodeName, errorName string, count uint64) {
+		ns = append(ns, errNode{
+			Node:  nodeName,
+			Error: errorName,
+			Count: count,
+		})
+	})
 	if len(ns) > 1 {
 		sort.Sort(errNodes(ns))
 	}
@@ -18,6 +18,20 @@ type showNeighborConfig struct {
 	ip6       bool
 	detail    bool
 	showTable string
+	format    vnet.ShowFormat
+}
+
+type showNeighbor struct {
+	Table       string `json:"table" yaml:"table"`
+	Address     string `json:"address" yaml:"address"`
+	Interface   string `json:"interface" yaml:"interface"`
+	LinkAddress string `json:"lladdr" yaml:"lladdr"`
+	// Interface used for rewrite; differs from Interface for bridge neighbors.
+	RewriteInterface string `json:"rewrite_interface" yaml:"rewrite_interface"`
+	// Adjacency when neighbor is reachable.
+	Found     bool     `json:"found" yaml:"found"`
+	Adj       ip.Adj   `json:"adj" yaml:"adj"`
+	Adjacency []string `json:"adjacency,omitempty" yaml:"adjacency,omitempty"`
 }
 
 func (m *Main) showIpNeighbor(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
@@ -32,6 +46,7 @@ func (m *Main) showIpNeighbor(c cli.Commander, w cli.Writer, in *cli.Input) (err
 		case in.Parse("d%*etail"):
 			cf.detail = true
 		case in.Parse("t%*able %s", &cf.showTable):
+		case in.Parse("f%*ormat %v", &cf.format):
 		default:
 			err = cli.ParseError
 			return
@@ -45,6 +60,7 @@ func (m *Main) showIpNeighbor(c cli.Commander, w cli.Writer, in *cli.Input) (err
 
 	em := GetMain(v)
 
+	ns := []showNeighbor{}
 	for ipFamily, nf := range em.ipNeighborFamilies {
 		im := nf.m
 		if ip.Family(ipFamily) == ip.Ip4 && !cf.ip4 {
@@ -56,17 +72,16 @@ func (m *Main) showIpNeighbor(c cli.Commander, w cli.Writer, in *cli.Input) (err
 		for _, i := range nf.indexByAddress {
 			n := &nf.pool.neighbors[i]
 			fi := im.FibIndexForSi(n.Si)
-			ns := im.FibNameForIndex(fi)
+			table := im.FibNameForIndex(fi)
 
-			if cf.showTable != "" && ns != cf.showTable {
+			if cf.showTable != "" && table != cf.showTable {
 				continue
 			}
 
 			var (
-				ok        bool
-				as        []ip.Adjacency
-				adj_lines []string
-				prefix    net.IPNet
+				ok     bool
+				as     []ip.Adjacency
+				prefix net.IPNet
 			)
 
 			prefix.IP = n.Ip
@@ -75,38 +90,44 @@ func (m *Main) showIpNeighbor(c cli.Commander, w cli.Writer, in *cli.Input) (err
 				prefix.Mask = net.CIDRMask(128, 128)
 			}
 
-			ipAddr := n.Ip.String()
-			//mac := n.Ethernet.String()
-			intf := fmt.Sprint(vnet.SiName{V: v, Si: n.Si})
-			lladdr := n.Ethernet.String()
-
-			ai := ip.AdjNil
-			ln := 0
+			x := showNeighbor{
+				Table:       table,
+				Address:     n.Ip.String(),
+				Interface:   fmt.Sprint(vnet.SiName{V: v, Si: n.Si}),
+				LinkAddress: n.Ethernet.String(),
+				Adj:         ip.AdjNil,
+			}
 			rwSi := n.Si
 			if n.Si.Kind(v) == vnet.SwBridgeInterface {
 				br := GetBridgeBySi(n.Si)
 				rwSi, _ = br.LookupSiCtag(n.Ethernet, v)
 			}
-			if ai, as, ok = im.GetReachable(&prefix, rwSi); ok {
+			x.RewriteInterface = fmt.Sprint(vnet.SiName{V: v, Si: rwSi})
+			if x.Adj, as, ok = im.GetReachable(&prefix, rwSi); ok {
+				x.Found = true
 				for i := range as {
-					adj_lines = as[i].AdjLines(im)
-				}
-				if ln == 0 {
-					fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      adjacency %v:%v\n", ns, ipAddr, intf, lladdr, ai, adj_lines)
-				} else {
-					fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      adjacency %v:%v\n", "", "unexpected extras", "", "", ai, adj_lines)
+					x.Adjacency = as[i].AdjLines(im)
 				}
-				ln++
-			} else {
-				//fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      adjacency %v:%v\n", ns, ipAddr, intf, lladdr, ai, "not found")
-				fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      %v not found\n", ns, ipAddr, intf, lladdr, vnet.SiName{V: v, Si: rwSi})
 			}
+			ns = append(ns, x)
 
 			if cf.detail {
 				//no additional details for now
 			}
 		}
 	}
+
+	if !cf.format.IsText() {
+		return cf.format.Write(w, ns)
+	}
+	for i := range ns {
+		x := &ns[i]
+		if x.Found {
+			fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      adjacency %v:%v\n", x.Table, x.Address, x.Interface, x.LinkAddress, x.Adj, x.Adjacency)
+		} else {
+			fmt.Fprintf(w, "%10v%20v dev %10v lladdr %v      %v not found\n", x.Table, x.Address, x.Interface, x.LinkAddress, x.RewriteInterface)
+		}
+	}
 	return
 }
 
@@ -32,3 +32,22 @@ func TestAddressBlock(t *testing.T) {
 	}
 	b.Free(&as[0])
 }
+
+func TestInputTypeNext(t *testing.T) {
+	n := &inputNode{m: &nodeMain{typeNexts: map[Type]uint{0x88cc: 2}}}
+	frame := func(t ...byte) []byte { return append(make([]byte, 12), t...) }
+	tests := []struct {
+		b    []byte
+		next uint
+	}{
+		{b: frame(0x88, 0xcc), next: 2},
+		{b: frame(0x08, 0x00), next: input_next_punt},
+		{b: frame(0x81, 0x00, 0x00, 0x01, 0x88, 0xcc), next: input_next_punt},
+		{b: frame(0x88), next: input_next_punt},
+	}
+	for _, x := range tests {
+		if got := n.next(x.b); got != x.next {
+			t.Errorf("%x: next %d, want %d", x.b, got, x.next)
+		}
+	}
+}
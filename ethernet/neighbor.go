@@ -35,6 +35,16 @@ func (m *ipNeighborMain) init(v *vnet.Vnet, im4, im6 *ip.Main) {
 	v.RegisterSwIfAdminUpDownHook(m.swIfAdminUpDown)
 }
 
+// ForeachIpNeighbor calls f for each ip4 and ip6 neighbor.
+func (m *ipNeighborMain) ForeachIpNeighbor(f func(im *ip.Main, n *IpNeighbor)) {
+	for i := range m.ipNeighborFamilies {
+		nf := &m.ipNeighborFamilies[i]
+		for _, ni := range nf.indexByAddress {
+			f(nf.m, &nf.pool.neighbors[ni].IpNeighbor)
+		}
+	}
+}
+
 type ipNeighborKey struct {
 	Ip string // stringer of net.IP
 	Si vnet.Si
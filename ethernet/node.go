@@ -6,14 +6,25 @@ package ethernet
 
 import (
 	"github.com/platinasystems/vnet"
+
+	"fmt"
 )
 
 type nodeMain struct {
 	inputNode inputNode
+	// Continues ethernet input for frames which have passed input features.
+	postFeaturesNode inputNode
+	// Next indexed by type of untagged frames; frames of other types are punted.
+	typeNexts map[Type]uint
+	// Features applied to frames received on software interfaces before ethernet input.
+	InputFeatures vnet.FeatureArc
 }
 
 type inputNode struct {
 	vnet.InOutNode
+	m *nodeMain
+	// Input features have been applied.
+	postFeatures bool
 }
 
 const (
@@ -23,13 +34,65 @@ const (
 
 func (m *Main) nodeInit(v *vnet.Vnet) {
 	n := &m.inputNode
+	n.m = &m.nodeMain
 	n.Next = []string{
 		input_next_drop: "error",
 		input_next_punt: "punt",
 	}
 	v.RegisterInOutNode(n, "ethernet-input")
+	p := &m.postFeaturesNode
+	p.m, p.postFeatures = &m.nodeMain, true
+	p.Next = n.Next
+	v.RegisterInOutNode(p, "ethernet-input-post-features")
+	m.InputFeatures.Init(v, "ethernet-input", "ethernet-input-post-features")
+	m.InputFeatures.AddStart(n)
+	// Not a start node but added so that both input nodes share next indices.
+	m.InputFeatures.AddStart(p)
+}
+
+// RegisterInputType sends untagged frames of given type received by ethernet-input to named
+// node instead of punting them.  Must be called at init time.
+func RegisterInputType(v *vnet.Vnet, t Type, nodeName string) {
+	m := &GetMain(v).nodeMain
+	if _, ok := m.typeNexts[t]; ok {
+		panic(fmt.Errorf("ethernet input type %v already registered", t))
+	}
+	x := v.AddNamedNext(&m.inputNode, nodeName)
+	// Both input nodes share nexts.
+	if y := v.AddNamedNext(&m.postFeaturesNode, nodeName); y != x {
+		panic(fmt.Errorf("ethernet input type %v: next %d != %d", t, x, y))
+	}
+	if m.typeNexts == nil {
+		m.typeNexts = make(map[Type]uint)
+	}
+	m.typeNexts[t] = x
+}
+
+func (node *inputNode) next(b []byte) uint {
+	if len(b) >= SizeofHeader {
+		h := (*Header)(vnet.Pointer(b))
+		if x, ok := node.m.typeNexts[h.GetType()]; ok {
+			return x
+		}
+	}
+	return input_next_punt
 }
 
 func (node *inputNode) NodeInput(in *vnet.RefIn, out *vnet.RefOut) {
-	node.Redirect(in, out, input_next_punt)
+	features := !node.postFeatures && node.m.InputFeatures.Active()
+	if len(node.m.typeNexts) == 0 && !features {
+		node.Redirect(in, out, input_next_punt)
+		return
+	}
+	q := node.GetEnqueue(in)
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		x0, ok := node.m.InputFeatures.First(r0.Si)
+		if !features || !ok {
+			x0 = node.next(r0.DataSlice())
+		}
+		q.Put1(r0, x0)
+		i++
+	}
 }
@@ -15,6 +15,8 @@ import (
 type pgStream struct {
 	pg.Stream
 	ai_src, ai_dst addressIncrement
+	// Vlan id increments indexed by position in tag stack.
+	vlanIncs []pg.Increment
 }
 
 type pgMain struct {
@@ -29,7 +31,64 @@ func (m *pgMain) initTypes() {
 		return
 	}
 	m.typeMap = make(map[Type]pg.StreamType)
-	m.typeMap[TYPE_IP4.FromHost()] = pg.GetStreamType(m.v, "ip4")
+	for t, name := range map[Type]string{
+		TYPE_IP4:            "ip4",
+		TYPE_IP6:            "ip6",
+		TYPE_MPLS_UNICAST:   "mpls",
+		TYPE_MPLS_MULTICAST: "mpls",
+	} {
+		if st := pg.GetStreamType(m.v, name); st != nil {
+			m.typeMap[t.FromHost()] = st
+		}
+	}
+}
+
+// Vlan header with optional incrementing or random vlan id.
+type pgVlanHeader struct {
+	VlanHeader
+	inc pg.Increment
+}
+
+// Parse parses vlan ID|MIN-MAX|random MIN-MAX [cfi] [priority PRI] [tpid TYPE].
+// Use braces for multiple fields: vlan {100-199 tpid 0x88a8}
+func (h *pgVlanHeader) Parse(sup_in *parse.Input) {
+	var (
+		in  parse.Input
+		id  vnet.Uint16
+		pri vnet.Uint16
+		tag vnet.Uint16
+		tp  Type
+	)
+	if !sup_in.Parse("vlan %v", &in) {
+		sup_in.ParseError()
+	}
+	tp = TYPE_VLAN.FromHost()
+	for !in.End() {
+		switch {
+		case in.Parse("%v", &h.inc):
+			if h.inc.Max > 0xfff {
+				in.ParseError()
+			}
+			tag = (tag &^ 0xfff) | vnet.Uint16(h.inc.Min)
+		case in.Parse("%v", &id):
+			if id > 0xfff {
+				in.ParseError()
+			}
+			tag = (tag &^ 0xfff) | id
+		case in.Parse("cfi"):
+			tag |= 1 << 12
+		case in.Parse("pri%*ority %d", &pri):
+			if pri > 7 {
+				in.ParseError()
+			}
+			tag = (tag &^ (7 << 13)) | pri<<13
+		case in.Parse("tpid %v", &tp):
+		default:
+			in.ParseError()
+		}
+	}
+	h.Type = tp
+	h.Tag = VlanTag(tag).FromHost()
 }
 
 func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
@@ -38,14 +97,14 @@ func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
 	var s pgStream
 	for !in.End() {
 		var h struct {
-			v []VlanHeader
+			v []pgVlanHeader
 			h Header
 		}
 		var min, max uint64
 		switch {
 		case in.Parse("%v", &h.h):
 			for {
-				var v VlanHeader
+				var v pgVlanHeader
 				if in.Parse("%v", &v) {
 					h.v = append(h.v, v)
 				} else {
@@ -75,14 +134,14 @@ func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
 				}
 			}
 
+			// Each tag's type is tpid for that tag: chain types as HeaderParser does.
 			inner_type := h.h.Type
 			if len(h.v) > 0 {
-				vt := TYPE_VLAN.FromHost()
-				h.h.Type = vt
+				h.h.Type = h.v[0].Type
 				for i := range h.v {
 					t := inner_type
 					if i+1 < len(h.v) {
-						t = vt
+						t = h.v[i+1].Type
 					}
 					h.v[i].Type = t
 				}
@@ -90,7 +149,8 @@ func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
 
 			s.AddHeader(&h.h)
 			for i := range h.v {
-				s.AddHeader(&h.v[i])
+				s.AddHeader(&h.v[i].VlanHeader)
+				s.vlanIncs = append(s.vlanIncs, h.v[i].inc)
 			}
 			if t, ok := m.typeMap[inner_type]; ok {
 				var sub_r pg.Streamer
@@ -153,6 +213,19 @@ func (s *pgStream) Finalize(r []vnet.Ref, do uint) (changed bool) {
 		s.ai_dst.do(r, do, false)
 		changed = true
 	}
+	for vi := range s.vlanIncs {
+		inc := &s.vlanIncs[vi]
+		if !inc.Valid() {
+			continue
+		}
+		o := do + SizeofHeader + uint(vi)*SizeofVlanHeader
+		for i := range r {
+			h := (*VlanHeader)(r[i].DataOffset(o))
+			t := h.Tag.ToHost()
+			h.Tag = ((t &^ 0xfff) | VlanTag(inc.Next())).FromHost()
+		}
+		changed = true
+	}
 	return
 }
 
@@ -15,6 +15,7 @@ import (
 	ipcli "github.com/platinasystems/vnet/ip/cli"
 	"github.com/platinasystems/vnet/ip4"
 	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/mpls"
 	"github.com/platinasystems/vnet/pg"
 	"github.com/platinasystems/vnet/unix"
 
@@ -214,6 +215,7 @@ func Example() {
 	m6 := ip6.Init(v)
 	ethernet.Init(v, m4, m6)
 	gre.Init(v)
+	mpls.Init(v)
 	ixge.Init(v)
 	pg.Init(v)
 	ipcli.Init(v)
@@ -0,0 +1,207 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// FeatureArc sends packets of software interfaces with enabled features through feature
+// nodes in order of registration before they continue to the arc's end node.
+// Start nodes call First for each packet; feature nodes call Next to pass a packet on.
+type FeatureArc struct {
+	v    *Vnet
+	name string
+	// Name of node packets continue to after last enabled feature.
+	end string
+	// Start nodes (index 0) and feature nodes (index 1+f).
+	nodes []featureArcNode
+	// Enabled features (*featureEnables) read by data path without locking.
+	// Enable publishes a new copy for each change.
+	enabled atomic.Value
+	// Serializes Enable.
+	mu sync.Mutex
+}
+
+type featureEnables struct {
+	// Bitmap of enabled features indexed by software interface.
+	bySi []uint32
+	// Number of software interfaces with any feature enabled.
+	n uint
+}
+
+var noFeatureEnables featureEnables
+
+func (a *FeatureArc) enables() (e *featureEnables) {
+	if e, _ = a.enabled.Load().(*featureEnables); e == nil {
+		e = &noFeatureEnables
+	}
+	return
+}
+
+type featureArcNode struct {
+	noders []Noder
+	// Nexts to features indexed by feature.
+	featureNexts []uint
+	endNext      uint
+}
+
+// Maximum number of features per arc.
+const maxFeatures = 32
+
+// Init initializes arc with given name; end node may be set later with SetEnd.
+func (a *FeatureArc) Init(v *Vnet, name, end string) {
+	a.v, a.name, a.end = v, name, end
+	a.nodes = make([]featureArcNode, 1)
+}
+
+func (a *FeatureArc) Name() string { return a.name }
+
+// Add named next to all nodes of given index; all must have same next index.
+func (a *FeatureArc) addNext(i int, name string) (x uint) {
+	ns := a.nodes[i].noders
+	for j := range ns {
+		y := a.v.AddNamedNext(ns[j], name)
+		if j == 0 {
+			x = y
+		} else if y != x {
+			panic(fmt.Errorf("%s feature arc: %s next %d != %d", a.name, name, y, x))
+		}
+	}
+	return
+}
+
+func (x *featureArcNode) name() string { return x.noders[0].GetVnetNode().Name() }
+
+// Set nexts of given node index to following features and end.
+func (a *FeatureArc) setNexts(i int) {
+	x := &a.nodes[i]
+	if len(x.noders) == 0 {
+		return
+	}
+	x.featureNexts = make([]uint, len(a.nodes)-1)
+	for f := i; f < len(a.nodes)-1; f++ {
+		x.featureNexts[f] = a.addNext(i, a.nodes[f+1].name())
+	}
+	if len(a.end) > 0 {
+		x.endNext = a.addNext(i, a.end)
+	}
+}
+
+// AddStart adds node which sends packets to first enabled feature.  Start nodes of an arc
+// must have the same next indices.  Must be called at init time after node is registered.
+func (a *FeatureArc) AddStart(n Noder) {
+	a.nodes[0].noders = append(a.nodes[0].noders, n)
+	a.setNexts(0)
+}
+
+// SetEnd sets name of node packets continue to after last enabled feature.
+func (a *FeatureArc) SetEnd(name string) {
+	a.end = name
+	for i := range a.nodes {
+		a.setNexts(i)
+	}
+}
+
+// Register adds feature node to arc returning feature index.  Must be called at init time
+// after node is registered.
+func (a *FeatureArc) Register(n Noder) (f uint) {
+	f = uint(len(a.nodes) - 1)
+	if f >= maxFeatures {
+		panic(fmt.Errorf("%s feature arc: too many features", a.name))
+	}
+	a.nodes = append(a.nodes, featureArcNode{noders: []Noder{n}})
+	for i := range a.nodes {
+		a.setNexts(i)
+	}
+	return
+}
+
+// Enable enables or disables feature for given software interface.
+func (a *FeatureArc) Enable(si Si, f uint, enable bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e := *a.enables()
+	l := uint(len(e.bySi))
+	if i := uint(si); i >= l {
+		if !enable {
+			return
+		}
+		l = i + 1
+	}
+	// Copy so that data path never sees bitmap being resized or modified.
+	bySi := make([]uint32, l)
+	copy(bySi, e.bySi)
+	e.bySi = bySi
+	was := bySi[si] != 0
+	if enable {
+		bySi[si] |= 1 << f
+	} else {
+		bySi[si] &^= 1 << f
+	}
+	switch is := bySi[si] != 0; {
+	case is && !was:
+		e.n++
+	case was && !is:
+		e.n--
+	}
+	a.enabled.Store(&e)
+}
+
+// IsEnabled returns whether feature is enabled for given software interface.
+func (a *FeatureArc) IsEnabled(si Si, f uint) bool {
+	e := a.enables()
+	return uint(si) < uint(len(e.bySi)) && e.bySi[si]&(1<<f) != 0
+}
+
+// Active returns whether any feature is enabled for any software interface.
+func (a *FeatureArc) Active() bool { return a.enables().n > 0 }
+
+// Next from given node index for packet of software interface with enabled features
+// greater or equal to f.
+func (a *FeatureArc) next(i int, si Si, f uint) (x uint, ok bool) {
+	bySi := a.enables().bySi
+	if uint(si) >= uint(len(bySi)) {
+		return
+	}
+	if e := bySi[si] >> f; e != 0 {
+		for e&1 == 0 {
+			e >>= 1
+			f++
+		}
+		x, ok = a.nodes[i].featureNexts[f], true
+	}
+	return
+}
+
+// First returns next of start node for first enabled feature of given software interface;
+// ok is false when no feature is enabled.
+func (a *FeatureArc) First(si Si) (x uint, ok bool) { return a.next(0, si, 0) }
+
+// Next returns next of feature node f for packet of given software interface: next enabled
+// feature or end of arc.
+func (a *FeatureArc) Next(si Si, f uint) (x uint) {
+	var ok bool
+	if x, ok = a.next(int(f+1), si, f+1); !ok {
+		x = a.nodes[f+1].endNext
+	}
+	return
+}
+
+type featureMain struct {
+	outputFeatures FeatureArc
+}
+
+// OutputFeatures returns arc of features applied to packets sent out software interfaces.
+// Packets start with ethernet header.
+func (v *Vnet) OutputFeatures() *FeatureArc {
+	a := &v.outputFeatures
+	if a.v == nil {
+		a.Init(v, "output", "")
+	}
+	return a
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"testing"
+)
+
+// Data path reads enables while interfaces are added and features enabled.
+func TestFeatureArcEnableConcurrent(t *testing.T) {
+	var a FeatureArc
+	a.Init(&Vnet{}, "test", "")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for si := Si(0); si < 1000; si++ {
+			a.Enable(si, 1, true)
+			if si%2 == 0 {
+				a.Enable(si, 1, false)
+			}
+		}
+	}()
+	for stop := false; !stop; {
+		select {
+		case <-done:
+			stop = true
+		default:
+		}
+		if a.IsEnabled(1000, 1) {
+			t.Fatal("feature enabled on interface beyond range")
+		}
+		a.Active()
+	}
+	if n := a.enables().n; n != 500 || !a.IsEnabled(999, 1) || a.IsEnabled(998, 1) {
+		t.Errorf("%d interfaces with features enabled", n)
+	}
+}
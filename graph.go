@@ -0,0 +1,324 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib/cli"
+
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Next node names are recorded as nexts are added so that node graph can be exported.
+func (n *Node) setNextName(i uint, name string) {
+	if l := uint(len(n.nextNames)); i >= l {
+		n.nextNames = append(n.nextNames, make([]string, i+1-l)...)
+	}
+	n.nextNames[i] = name
+}
+
+// As loop does, names already present keep their index.
+func (n *Node) addNextName(name string) {
+	for i := range n.nextNames {
+		if n.nextNames[i] == name {
+			return
+		}
+	}
+	n.nextNames = append(n.nextNames, name)
+}
+
+type GraphNodeKind int
+
+const (
+	GraphNodeOther GraphNodeKind = iota
+	GraphNodeInput
+	GraphNodeOutput
+	GraphNodeInOut
+	GraphNodeInterface
+	GraphNodeOutputInterface
+)
+
+var graphNodeKindStrings = [...]string{
+	GraphNodeOther:           "other",
+	GraphNodeInput:           "input",
+	GraphNodeOutput:          "output",
+	GraphNodeInOut:           "in-out",
+	GraphNodeInterface:       "interface",
+	GraphNodeOutputInterface: "output-interface",
+}
+
+func (k GraphNodeKind) String() string { return graphNodeKindStrings[k] }
+func (k GraphNodeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Arc from node to its next node.
+type GraphArc struct {
+	// Next index as used by node to enqueue packets.
+	Index uint   `json:"index"`
+	Next  string `json:"next"`
+}
+
+// Hardware and software interface of interface nodes.
+type GraphInterface struct {
+	Hi       Hi     `json:"hi"`
+	Si       Si     `json:"si"`
+	HwIfName string `json:"hw_name"`
+	SwIfName string `json:"sw_name"`
+}
+
+type GraphNode struct {
+	Name      string          `json:"name"`
+	Index     uint            `json:"index"`
+	Kind      GraphNodeKind   `json:"kind"`
+	Next      []GraphArc      `json:"next,omitempty"`
+	Interface *GraphInterface `json:"interface,omitempty"`
+}
+
+// Graph is a snapshot of vnet node graph.
+type Graph struct {
+	Nodes  []GraphNode `json:"nodes"`
+	byName map[string]uint
+}
+
+// Graph returns snapshot of current node graph with nodes in registration order.
+func (v *Vnet) Graph() (g *Graph) {
+	g = &Graph{}
+	for _, n := range v.runtimeNodes {
+		x := GraphNode{
+			Name:  n.Name(),
+			Index: n.Index(),
+		}
+		switch r := n.GetNoder().(type) {
+		case inputOutputInterfaceNoder:
+			x.Kind = GraphNodeInterface
+			x.setInterface(v, r.GetInterfaceNode().hi)
+		case outputInterfaceNoder:
+			x.Kind = GraphNodeOutputInterface
+			x.setInterface(v, r.GetInterfaceNode().hi)
+		case InOutNoder:
+			x.Kind = GraphNodeInOut
+		case OutputNoder:
+			x.Kind = GraphNodeOutput
+		case InputNoder:
+			x.Kind = GraphNodeInput
+		}
+		for i, name := range n.nextNames {
+			if len(name) > 0 {
+				x.Next = append(x.Next, GraphArc{Index: uint(i), Next: name})
+			}
+		}
+		g.add(x)
+	}
+	return
+}
+
+func (x *GraphNode) setInterface(v *Vnet, hi Hi) {
+	si := hi.Si(v)
+	x.Interface = &GraphInterface{
+		Hi:       hi,
+		Si:       si,
+		HwIfName: hi.Name(v),
+		SwIfName: SiName{V: v, Si: si}.String(),
+	}
+}
+
+func (g *Graph) add(x GraphNode) {
+	if g.byName == nil {
+		g.byName = make(map[string]uint)
+	}
+	g.byName[x.Name] = uint(len(g.Nodes))
+	g.Nodes = append(g.Nodes, x)
+}
+
+func (g *Graph) sortByName() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Name < g.Nodes[j].Name })
+	for i := range g.Nodes {
+		g.byName[g.Nodes[i].Name] = uint(i)
+	}
+}
+
+// Node returns node with given name or nil if not found.
+func (g *Graph) Node(name string) *GraphNode {
+	if i, ok := g.byName[name]; ok {
+		return &g.Nodes[i]
+	}
+	return nil
+}
+
+// HasArc returns true if node from has next node named to.
+func (g *Graph) HasArc(from, to string) bool {
+	if n := g.Node(from); n != nil {
+		for i := range n.Next {
+			if n.Next[i].Next == to {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reachable returns sub-graph of nodes reachable via next arcs from named node (including that node).
+func (g *Graph) Reachable(from string) (r *Graph) {
+	r = &Graph{}
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if n := g.Node(name); n != nil {
+			for i := range n.Next {
+				visit(n.Next[i].Next)
+			}
+		}
+	}
+	visit(from)
+	for i := range g.Nodes {
+		if seen[g.Nodes[i].Name] {
+			r.add(g.Nodes[i])
+		}
+	}
+	return
+}
+
+// Matching returns sub-graph of nodes whose name matches given regular expression.
+func (g *Graph) Matching(re *regexp.Regexp) (r *Graph) {
+	r = &Graph{}
+	for i := range g.Nodes {
+		if re.MatchString(g.Nodes[i].Name) {
+			r.add(g.Nodes[i])
+		}
+	}
+	return
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(g)
+}
+
+// WriteDot writes graph in Graphviz DOT format.
+// Arcs to nodes not in graph are omitted.
+func (g *Graph) WriteDot(w io.Writer) (err error) {
+	fmt.Fprintln(w, "digraph vnet {")
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		name := strconv.Quote(n.Name)
+		label := name
+		shape := "box"
+		switch n.Kind {
+		case GraphNodeInterface, GraphNodeOutputInterface:
+			// Second label line gives interface indices; \n is DOT line break.
+			label = fmt.Sprintf(`%s\nhi %d si %d"`, name[:len(name)-1], n.Interface.Hi, n.Interface.Si)
+			shape = "ellipse"
+		case GraphNodeInput:
+			shape = "invhouse"
+		case GraphNodeOutput:
+			shape = "house"
+		}
+		fmt.Fprintf(w, "  %s [label=%s shape=%s];\n", name, label, shape)
+	}
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		for j := range n.Next {
+			a := &n.Next[j]
+			if g.Node(a.Next) == nil {
+				continue
+			}
+			fmt.Fprintf(w, "  %s -> %s [label=\"%d\"];\n", strconv.Quote(n.Name), strconv.Quote(a.Next), a.Index)
+		}
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return
+}
+
+func (g *Graph) write(w io.Writer) {
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		fmt.Fprintf(w, "%s: %s", n.Name, n.Kind)
+		if i := n.Interface; i != nil {
+			fmt.Fprintf(w, ", hw %s (hi %d), sw %s (si %d)", i.HwIfName, i.Hi, i.SwIfName, i.Si)
+		}
+		fmt.Fprintln(w)
+		for j := range n.Next {
+			fmt.Fprintf(w, "  %3d: %s\n", n.Next[j].Index, n.Next[j].Next)
+		}
+	}
+}
+
+func (v *Vnet) showGraph(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		matching, from, file string
+		isDot, isJson        bool
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("m%*atching %s", &matching):
+		case in.Parse("f%*rom %s", &from):
+		case in.Parse("d%*ot"):
+			isDot = true
+		case in.Parse("j%*son"):
+			isJson = true
+		case in.Parse("o%*utput %s", &file):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+
+	g := v.Graph()
+	if len(from) > 0 {
+		if g.Node(from) == nil {
+			err = fmt.Errorf("unknown node `%s'", from)
+			return
+		}
+		g = g.Reachable(from)
+	}
+	if len(matching) > 0 {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(matching); err != nil {
+			return
+		}
+		g = g.Matching(re)
+	}
+	g.sortByName()
+
+	out := io.Writer(w)
+	if len(file) > 0 {
+		var f *os.File
+		if f, err = os.Create(file); err != nil {
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	switch {
+	case isDot:
+		err = g.WriteDot(out)
+	case isJson:
+		err = g.WriteJSON(out)
+	default:
+		g.write(out)
+	}
+	return
+}
+
+func init() {
+	AddInit(func(v *Vnet) {
+		v.CliAdd(&cli.Command{
+			Name:      "show graph",
+			ShortHelp: "show node graph [matching REGEXP] [from NODE] [dot|json] [output FILE]",
+			Action:    v.showGraph,
+		})
+	})
+}
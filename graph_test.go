@@ -0,0 +1,107 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func testGraph() (g *Graph) {
+	g = &Graph{}
+	g.add(GraphNode{Name: "eth-0-0", Kind: GraphNodeInterface,
+		Next:      []GraphArc{{0, "ethernet-input"}},
+		Interface: &GraphInterface{Hi: 1, Si: 2, HwIfName: "eth-0-0", SwIfName: "eth-0-0"}})
+	g.add(GraphNode{Name: "ethernet-input", Kind: GraphNodeInOut,
+		Next: []GraphArc{{0, "error"}, {1, "ip4-input"}}})
+	g.add(GraphNode{Name: "ip4-input", Kind: GraphNodeInOut,
+		Next: []GraphArc{{0, "error"}, {2, "ip4-lookup"}}})
+	g.add(GraphNode{Name: "ip4-lookup", Kind: GraphNodeInOut})
+	g.add(GraphNode{Name: "error", Kind: GraphNodeOutput})
+	g.add(GraphNode{Name: "pg", Kind: GraphNodeInput, Next: []GraphArc{{0, "error"}}})
+	return
+}
+
+func graphNames(g *Graph) (s []string) {
+	for i := range g.Nodes {
+		s = append(s, g.Nodes[i].Name)
+	}
+	return
+}
+
+func TestGraphReachable(t *testing.T) {
+	g := testGraph()
+	r := g.Reachable("ethernet-input")
+	want := []string{"ethernet-input", "ip4-input", "ip4-lookup", "error"}
+	if got := graphNames(r); len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for _, name := range want {
+		if r.Node(name) == nil {
+			t.Errorf("%s not reachable", name)
+		}
+	}
+	if r.Node("pg") != nil || r.Node("eth-0-0") != nil {
+		t.Errorf("unexpected nodes reachable: %v", graphNames(r))
+	}
+	if !r.HasArc("ip4-input", "ip4-lookup") || r.HasArc("ip4-lookup", "ip4-input") {
+		t.Errorf("bad arcs")
+	}
+}
+
+func TestGraphMatching(t *testing.T) {
+	g := testGraph().Matching(regexp.MustCompile("^ip4-"))
+	if got := graphNames(g); len(got) != 2 || got[0] != "ip4-input" || got[1] != "ip4-lookup" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestGraphExport(t *testing.T) {
+	g := testGraph().Reachable("eth-0-0")
+
+	var b bytes.Buffer
+	if err := g.WriteDot(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"digraph vnet {\n",
+		`"eth-0-0" [label="eth-0-0\nhi 1 si 2" shape=ellipse];`,
+		`"ip4-input" -> "ip4-lookup" [label="2"];`,
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("dot output missing %q:\n%s", s, b.String())
+		}
+	}
+	if bytes.Contains(b.Bytes(), []byte(`"pg"`)) {
+		t.Errorf("dot output contains unreachable node:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := g.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var x struct {
+		Nodes []struct {
+			Name      string
+			Kind      string
+			Next      []struct{ Index uint }
+			Interface *struct{ Hi, Si uint }
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &x); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Nodes) != 5 {
+		t.Fatalf("got %d nodes want 5", len(x.Nodes))
+	}
+	if n := x.Nodes[0]; n.Name != "eth-0-0" || n.Kind != "interface" || n.Interface == nil || n.Interface.Hi != 1 || n.Interface.Si != 2 {
+		t.Errorf("bad interface node %+v", n)
+	}
+	if n := x.Nodes[2]; n.Name != "ip4-input" || len(n.Next) != 2 || n.Next[1].Index != 2 {
+		t.Errorf("bad node %+v", n)
+	}
+}
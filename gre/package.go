@@ -16,12 +16,14 @@ var packageIndex uint
 func Init(v *vnet.Vnet) {
 	m := &Main{}
 	packageIndex = v.AddPackage("gre", m)
+	m.DependsOn("pg")
 }
 
 func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
 
 type Main struct {
 	vnet.Package
+	pgMain
 }
 
 func (m *Main) FormatLayer(b []byte) (lines []string) {
@@ -39,5 +41,6 @@ func (m *Main) ParseLayer(b []byte, in *parse.Input) (n uint) {
 func (m *Main) Init() (err error) {
 	v := m.Vnet
 	ip4.RegisterLayer(v, ip.GRE, m)
+	m.pgInit(v)
 	return
 }
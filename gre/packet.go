@@ -9,6 +9,7 @@ import (
 	"github.com/platinasystems/vnet"
 	"github.com/platinasystems/vnet/ethernet"
 
+	"fmt"
 	"unsafe"
 )
 
@@ -46,3 +47,21 @@ func (h *Header) Parse(in *parse.Input) {
 		in.ParseError()
 	}
 }
+
+// Optional key follows header when KeyPresent flag is set.
+type KeyHeader struct {
+	Key vnet.Uint32
+}
+
+const SizeofKeyHeader = 4
+
+func (h *KeyHeader) String() string { return fmt.Sprintf("GRE key: 0x%x", h.Key.ToHost()) }
+
+// vnet.PacketHeader interface.
+func (h *KeyHeader) Len() uint                       { return SizeofKeyHeader }
+func (h *KeyHeader) Read(b []byte) vnet.PacketHeader { return (*KeyHeader)(vnet.Pointer(b)) }
+func (h *KeyHeader) Write(b []byte) {
+	type t struct{ data [SizeofKeyHeader]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
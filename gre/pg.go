@@ -0,0 +1,106 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gre
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/pg"
+
+	"fmt"
+)
+
+type pgStream struct {
+	pg.Stream
+	key_inc pg.Increment
+}
+
+type pgMain struct {
+	v       *vnet.Vnet
+	typeMap map[ethernet.Type]pg.StreamType
+}
+
+func (m *pgMain) Name() string { return "gre" }
+
+func (m *pgMain) initTypes() {
+	if m.typeMap != nil {
+		return
+	}
+	m.typeMap = make(map[ethernet.Type]pg.StreamType)
+	for t, name := range map[ethernet.Type]string{
+		ethernet.TYPE_IP4:                  "ip4",
+		ethernet.TYPE_IP6:                  "ip6",
+		ethernet.TYPE_MPLS_UNICAST:         "mpls",
+		ethernet.TYPE_TRANSPARENT_BRIDGING: "ethernet",
+	} {
+		if st := pg.GetStreamType(m.v, name); st != nil {
+			m.typeMap[t.FromHost()] = st
+		}
+	}
+}
+
+// Stream syntax: TYPE [key KEY|MIN-MAX|random MIN-MAX] INNER-STREAM
+func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
+	m.initTypes()
+	var s pgStream
+	for !in.End() {
+		var (
+			h Header
+			k KeyHeader
+		)
+		switch {
+		case in.Parse("%v", &h):
+			var key uint32
+			has_key := false
+			switch {
+			case in.Parse("key %v", &s.key_inc):
+				has_key = true
+				key = uint32(s.key_inc.Min)
+			case in.Parse("key %d", &key):
+				has_key = true
+			}
+			if has_key {
+				h.VersionAndFlags = VersionAndFlags(vnet.Uint16(KeyPresent).FromHost())
+				k.Key.Set(uint(key))
+			}
+			s.AddHeader(&h)
+			if has_key {
+				s.AddHeader(&k)
+			}
+			if t, ok := m.typeMap[h.Type]; ok {
+				var sub_r pg.Streamer
+				sub_r, err = t.ParseStream(in)
+				if err != nil {
+					err = fmt.Errorf("gre %s: %s `%s'", t.Name(), err, in)
+					return
+				}
+				s.AddStreamer(sub_r)
+			}
+		default:
+			in.ParseError()
+		}
+	}
+	if err == nil {
+		r = &s
+	}
+	return
+}
+
+func (s *pgStream) Finalize(r []vnet.Ref, data_offset uint) (changed bool) {
+	if s.key_inc.Valid() {
+		for i := range r {
+			k := (*KeyHeader)(r[i].DataOffset(data_offset + SizeofHeader))
+			k.Key.Set(uint(s.key_inc.Next()))
+		}
+		changed = true
+	}
+	return
+}
+
+func (m *pgMain) pgInit(v *vnet.Vnet) {
+	m.v = v
+	pg.AddStreamType(v, "gre", m)
+}
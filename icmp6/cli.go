@@ -0,0 +1,51 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/cli"
+
+	"fmt"
+)
+
+// show icmp6
+func (m *Main) showIcmp6(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	if !in.End() {
+		err = cli.ParseError
+		return
+	}
+	x := m.Counters()
+	fmt.Fprintf(w, "%-20s%d\n", "echo replies", x.EchoReplies)
+	fmt.Fprintf(w, "%-20s%d\n", "errors", x.Errors)
+	fmt.Fprintf(w, "%-20s%d\n", "rate limited", x.RateLimited)
+	fmt.Fprintf(w, "%-20s%d\n", "no route", x.NoRoute)
+	fmt.Fprintf(w, "error rate %g/s burst %g\n", m.ErrorRate, m.ErrorBurst)
+	return
+}
+
+// clear icmp6
+func (m *Main) clearIcmp6(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.ClearCounters()
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "show icmp6",
+			ShortHelp: "show icmp6 message counters",
+			Action:    m.showIcmp6,
+		},
+		cli.Command{
+			Name:      "clear icmp6",
+			ShortHelp: "zero icmp6 message counters",
+			Action:    m.clearIcmp6,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/parse"
+)
+
+// Parses e.g. echo-request or destination-unreachable code 4.
+func (h *Header) Parse(in *parse.Input) {
+	if !in.ParseLoose("%v", &h.Type) {
+		in.ParseError()
+	}
+	var code uint
+	if in.Parse("code %d", &code) {
+		h.Code = uint8(code)
+	}
+	return
+}
+
+func (h *EchoRequest) Parse(in *parse.Input) {
+	var id, seq uint
+	for {
+		switch {
+		case in.Parse("id %d", &id):
+			h.Id.Set(id)
+		case in.Parse("seq%*uence %d", &seq):
+			h.Sequence.Set(seq)
+		default:
+			return
+		}
+	}
+}
+
+func (h *ErrorHeader) Parse(in *parse.Input) {
+	var x uint
+	switch {
+	case in.Parse("mtu %d", &x):
+	case in.Parse("pointer %d", &x):
+	}
+	h.Data.Set(x)
+}
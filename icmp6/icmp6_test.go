@@ -0,0 +1,161 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip6"
+
+	"net"
+	"testing"
+)
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+func addr(s string) (a ip6.Address) {
+	copy(a[:], net.ParseIP(s).To16())
+	return
+}
+
+func newMain() *Main {
+	m := &Main{ErrorRate: 10, ErrorBurst: 2}
+	m.ifAddrAddDel(1, &net.IPNet{IP: net.ParseIP("2001:db8::1"), Mask: net.CIDRMask(64, 128)}, false)
+	m.ifAddrAddDel(1, &net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)}, false)
+	return m
+}
+
+func echoRequest(src, dst ip6.Address, l int) (b []byte) {
+	b = newPacket(&src, &dst, SizeofHeader+EchoRequestBytes+l)
+	i := b[ip6.SizeofHeader:]
+	i[0] = Echo_request
+	e := (*EchoRequest)(vnet.Pointer(i[SizeofHeader:]))
+	e.Id.Set(7)
+	e.Sequence.Set(9)
+	for j := SizeofHeader + EchoRequestBytes; j < len(i); j++ {
+		i[j] = byte(j)
+	}
+	SetChecksum(b)
+	return
+}
+
+func TestEcho(t *testing.T) {
+	m := newMain()
+	local, remote := addr("2001:db8::1"), addr("2001:db8::2")
+	b := echoRequest(remote, local, 100)
+	reply, ok := m.echo(b)
+	if !ok {
+		t.Fatal("no echo reply")
+	}
+	h, i := icmp(reply)
+	if h == nil || h.Src != local || h.Dst != remote || i[0] != Echo_reply {
+		t.Fatalf("bad reply %x", reply)
+	}
+	if c := Checksum(&h.Src, &h.Dst, i); c != 0 && c != 0xffff {
+		t.Errorf("reply checksum %x", c)
+	}
+	if string(i[SizeofHeader:]) != string(b[ip6.SizeofHeader+SizeofHeader:]) {
+		t.Errorf("reply data differs")
+	}
+
+	// Bad checksum, other destinations and replies are not answered.
+	c := append([]byte(nil), b...)
+	c[len(c)-1]++
+	if _, ok := m.echo(c); ok {
+		t.Errorf("bad checksum answered")
+	}
+	if _, ok := m.echo(echoRequest(remote, addr("2001:db8::3"), 0)); ok {
+		t.Errorf("non local destination answered")
+	}
+	if _, ok := m.echo(reply); ok {
+		t.Errorf("echo reply answered")
+	}
+
+	// Deleting address stops replies.
+	m.ifAddrAddDel(1, &net.IPNet{IP: local.ToNetIP(), Mask: net.CIDRMask(64, 128)}, true)
+	if _, ok := m.echo(b); ok {
+		t.Errorf("deleted address answered")
+	}
+	if x := m.Counters(); x.EchoReplies != 1 {
+		t.Errorf("echo replies %d", x.EchoReplies)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	m := newMain()
+	now := seconds(1)
+	local, remote := addr("2001:db8::1"), addr("2001:db8::2")
+	b := echoRequest(remote, addr("2001:db8:1::1"), 2000)
+	msg, e := m.errorMessage(1, b, Time_exceeded, Hop_limit_exceeded, 0, now)
+	if e != error_sent {
+		t.Fatalf("error %d", e)
+	}
+	if len(msg) != minMtu {
+		t.Errorf("length %d not truncated", len(msg))
+	}
+	h, i := icmp(msg)
+	if h == nil || h.Src != local || h.Dst != remote || Type(i[0]) != Time_exceeded || i[1] != Hop_limit_exceeded {
+		t.Fatalf("bad message %x", msg[:ip6.SizeofHeader+SizeofHeader])
+	}
+	if c := Checksum(&h.Src, &h.Dst, i); c != 0 && c != 0xffff {
+		t.Errorf("checksum %x", c)
+	}
+	if string(i[SizeofHeader+SizeofErrorHeader:]) != string(b[:len(i)-SizeofHeader-SizeofErrorHeader]) {
+		t.Errorf("invoking packet not included")
+	}
+
+	// Link local destinations get link local source.
+	msg, _ = m.errorMessage(1, echoRequest(addr("fe80::2"), local, 0), Destination_unreachable, Port_unreachable, 0, now)
+	if h, _ := icmp(msg); h == nil || h.Src != addr("fe80::1") {
+		t.Errorf("link local source")
+	}
+
+	// No errors for errors, multicast sources or destinations or without interface address.
+	m.tokens = m.ErrorBurst
+	if _, e := m.errorMessage(1, msg, Time_exceeded, 0, 0, now); e != error_not_sent {
+		t.Errorf("error for error message")
+	}
+	if _, e := m.errorMessage(1, echoRequest(addr("ff02::1"), local, 0), Time_exceeded, 0, 0, now); e != error_not_sent {
+		t.Errorf("error for multicast source")
+	}
+	if _, e := m.errorMessage(1, echoRequest(remote, addr("ff02::1"), 0), Time_exceeded, 0, 0, now); e != error_not_sent {
+		t.Errorf("error for multicast destination")
+	}
+	if _, e := m.errorMessage(1, echoRequest(remote, addr("ff02::1"), 0), Packet_too_big, 0, 1500, now); e != error_sent {
+		t.Errorf("no packet too big for multicast destination")
+	}
+	if _, e := m.errorMessage(2, b, Time_exceeded, 0, 0, now); e != error_no_source {
+		t.Errorf("error without interface address")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	m := newMain()
+	b := echoRequest(addr("2001:db8::2"), addr("2001:db8:1::1"), 0)
+	now := seconds(1)
+	for i := 0; i < 2; i++ {
+		if _, e := m.errorMessage(1, b, Time_exceeded, 0, 0, now); e != error_sent {
+			t.Fatalf("burst message %d not sent", i)
+		}
+	}
+	if _, e := m.errorMessage(1, b, Time_exceeded, 0, 0, now); e != error_rate_limited {
+		t.Errorf("message beyond burst sent")
+	}
+	// Rate of 10 per second refills one token in 100ms.
+	now += seconds(.11)
+	if _, e := m.errorMessage(1, b, Time_exceeded, 0, 0, now); e != error_sent {
+		t.Errorf("message after refill not sent")
+	}
+	if x := m.Counters(); x.Errors != 3 || x.RateLimited != 1 {
+		t.Errorf("counters %+v", x)
+	}
+	m.ClearCounters()
+	if x := m.Counters(); x != (Counters{}) {
+		t.Errorf("counters not cleared %+v", x)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+)
+
+const (
+	input_next_error uint = iota
+	input_next_punt
+)
+
+const (
+	input_error_echo_request uint = iota
+)
+
+// Node answering echo requests to interface addresses.  Packets must start with ip6 header.
+type inputNode struct {
+	vnet.InOutNode
+	m *Main
+}
+
+func (n *inputNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{
+		input_next_error: "error",
+		input_next_punt:  "punt",
+	}
+	n.Errors = []string{
+		input_error_echo_request: "echo requests answered",
+	}
+	v.RegisterInOutNode(n, "icmp6-input")
+}
+
+func (n *inputNode) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	i, n_left := in.Range()
+	m.mu.Lock()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		x0 := input_next_punt
+		if reply, ok := m.echo(r0.DataSlice()); ok {
+			m.pending = append(m.pending, message{si: r0.Si, b: reply})
+			n.SetError(r0, input_error_echo_request)
+			x0 = input_next_error
+		}
+		q.Put1(r0, x0)
+		i++
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+const (
+	error_next_error uint = iota
+)
+
+// Node sending error message of given type and code for each ip6 packet; packets are dropped.
+type errorNode struct {
+	vnet.InOutNode
+	m    *Main
+	t    Type
+	code uint8
+}
+
+func (n *errorNode) init(v *vnet.Vnet, m *Main, name string, t Type, code uint8) {
+	n.m = m
+	n.t, n.code = t, code
+	n.Next = []string{
+		error_next_error: "error",
+	}
+	n.Errors = []string{
+		error_sent:         t.String() + " sent",
+		error_rate_limited: t.String() + " rate limited",
+		error_not_sent:     "no error message for packet",
+		error_no_source:    "no interface address for error message",
+	}
+	v.RegisterInOutNode(n, "%s", name)
+}
+
+func (n *errorNode) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	i, n_left := in.Range()
+	m.mu.Lock()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		msg, e := m.errorMessage(r0.Si, r0.DataSlice(), n.t, n.code, 0, now)
+		if msg != nil {
+			m.pending = append(m.pending, message{si: r0.Si, b: msg})
+		}
+		n.SetError(r0, e)
+		q.Put1(r0, error_next_error)
+		i++
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+// Maximum number of messages waiting for transmission.
+const maxFrames = vnet.MaxVectorLen
+
+// Node transmitting queued messages.  Nexts to interface output nodes are added with rewrites.
+type txNode struct {
+	vnet.InputNode
+	m    *Main
+	pool vnet.BufferPool
+	tmp  vnet.RefVec
+}
+
+func (n *txNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "icmp6-tx")
+	p := &n.pool
+	p.BufferTemplate = vnet.DefaultBufferPool.BufferTemplate
+	p.Name = "icmp6-tx"
+	v.AddBufferPool(p)
+}
+
+func (n *txNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	done := 0
+	for ; done < len(m.frames); done++ {
+		f := &m.frames[done]
+		out := &o.Outs[f.rw.NextIndex]
+		if out.GetLen(v) >= out.Cap() {
+			break
+		}
+		n.tmp.Validate(0)
+		n.pool.AllocRefs(n.tmp[:1])
+		r := n.tmp[0]
+		r.SetDataLen(uint(len(f.b)))
+		copy(r.DataSlice(), f.b)
+		vnet.PerformRewrite(&r, &f.rw)
+		r.Si = f.rw.Si
+		out.BufferPool = &n.pool
+		out.Refs[out.AddLen(v)] = r
+	}
+	l := copy(m.frames, m.frames[done:])
+	m.frames = m.frames[:l]
+	n.Activate(l > 0)
+}
@@ -0,0 +1,457 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package icmp6 provides icmp6 (RFC 4443) headers with packet formatting, parsing and
+// generator streams, an echo responder for local ip6 addresses and error messages.
+//
+// Ip6 input sends echo requests for local addresses to the icmp6-input node
+// which answers those to interface addresses; other packets are punted.  Packets
+// ip6 input or rewrite would forward with hop limit exceeded or via drop routes
+// are sent to the icmp6-time-exceeded and icmp6-unreachable nodes which send
+// error messages for them; SendError sends error messages for other packets.
+// Error messages are rate limited (RFC 4443 section 2.4).  Replies and error
+// messages are sent via the neighbor adjacency of their destination in the ip6
+// fib; messages to unresolved destinations are dropped.
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip6"
+
+	"net"
+	"sync"
+)
+
+var packageIndex uint
+
+// Counters of messages sent and dropped.
+type Counters struct {
+	EchoReplies uint64
+	Errors      uint64
+	// Error messages not sent because of rate limit.
+	RateLimited uint64
+	// Messages dropped because destination is not a resolved neighbor or via one.
+	NoRoute uint64
+}
+
+// Generated message; b starts with ip6 header.
+type message struct {
+	// Interface invoking packet was received on.
+	si vnet.Si
+	b  []byte
+}
+
+// Message waiting for transmission.
+type frame struct {
+	rw vnet.Rewrite
+	b  []byte
+}
+
+type Main struct {
+	vnet.Package
+	pgMain
+
+	m6 *ip6.Main
+
+	// Error messages per second and maximum burst.
+	ErrorRate, ErrorBurst float64
+
+	mu sync.Mutex
+	// Interface addresses by interface; echo requests to these are answered.
+	ifAddrs map[vnet.Si][]ip6.Address
+	local   map[ip6.Address]uint
+	// Rate limit token bucket.
+	tokens     float64
+	lastRefill cpu.Time
+	pending    []message
+	frames     []frame
+	counters   Counters
+
+	inputNode        inputNode
+	timeExceededNode errorNode
+	unreachableNode  errorNode
+	txNode           txNode
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{
+		ErrorRate:  100,
+		ErrorBurst: 10,
+	}
+	packageIndex = v.AddPackage("icmp6", m)
+	m.DependsOn("ip6", "pg")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. icmp6 { error-rate 100 error-burst 10 } with rate in messages per second.
+func (m *Main) Configure(in *parse.Input) {
+	var x float64
+	for !in.End() {
+		switch {
+		case in.Parse("error-rate %f", &x) && x > 0:
+			m.ErrorRate = x
+		case in.Parse("error-burst %f", &x) && x >= 1:
+			m.ErrorBurst = x
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func (m *Main) FormatLayer(b []byte) (lines []string) {
+	h := (*Header)(vnet.Pointer(b))
+	lines = append(lines, h.String())
+	n := uint(SizeofHeader)
+	if n >= uint(len(b)) {
+		return
+	}
+	switch {
+	case h.Type == Echo_request || h.Type == Echo_reply:
+		if len(b) >= SizeofHeader+EchoRequestBytes {
+			e := (*EchoRequest)(vnet.Pointer(b[n:]))
+			lines = append(lines, e.String())
+		}
+	case h.Type.IsError():
+		if len(b) >= SizeofHeader+SizeofErrorHeader {
+			e := (*ErrorHeader)(vnet.Pointer(b[n:]))
+			lines = append(lines, e.String())
+		}
+	}
+	return
+}
+
+func (m *Main) ParseLayer(b []byte, in *parse.Input) (n uint) {
+	h := (*Header)(vnet.Pointer(b))
+	h.Parse(in)
+	n = SizeofHeader
+	switch {
+	case h.Type == Echo_request || h.Type == Echo_reply:
+		e := (*EchoRequest)(vnet.Pointer(b[n:]))
+		e.Parse(in)
+		n += EchoRequestBytes
+	case h.Type.IsError():
+		e := (*ErrorHeader)(vnet.Pointer(b[n:]))
+		e.Parse(in)
+		n += SizeofErrorHeader
+	}
+	return
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.m6 = ip6.GetMain(v)
+	ip6.RegisterLayer(v, ip.ICMP6, m)
+	m.pgInit(v)
+	m.inputNode.init(v, m)
+	m.timeExceededNode.init(v, m, "icmp6-time-exceeded", Time_exceeded, Hop_limit_exceeded)
+	m.unreachableNode.init(v, m, "icmp6-unreachable", Destination_unreachable, No_route_to_destination)
+	m.txNode.init(v, m)
+	m.m6.RegisterIcmp6LocalType(Echo_request, "icmp6-input")
+	m.m6.RegisterTimeExceededNode("icmp6-time-exceeded")
+	m.m6.RegisterUnreachableNode("icmp6-unreachable")
+	m.m6.RegisterIfAddrAddDelHook(m.ifAddrAddDel)
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.cliInit()
+	return
+}
+
+func (m *Main) ifAddrAddDel(si vnet.Si, p *net.IPNet, isDel bool) {
+	if p.IP.To4() != nil {
+		return
+	}
+	var a ip6.Address
+	copy(a[:], p.IP.To16())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	as := m.ifAddrs[si]
+	for i := range as {
+		if as[i] == a {
+			if isDel {
+				m.delAddress(si, i)
+			}
+			return
+		}
+	}
+	if isDel {
+		return
+	}
+	if m.ifAddrs == nil {
+		m.ifAddrs = make(map[vnet.Si][]ip6.Address)
+		m.local = make(map[ip6.Address]uint)
+	}
+	m.ifAddrs[si] = append(as, a)
+	m.local[a]++
+}
+
+// Delete i'th address of interface.  Called with lock held.
+func (m *Main) delAddress(si vnet.Si, i int) {
+	as := m.ifAddrs[si]
+	a := as[i]
+	if m.local[a]--; m.local[a] == 0 {
+		delete(m.local, a)
+	}
+	copy(as[i:], as[i+1:])
+	if as = as[:len(as)-1]; len(as) == 0 {
+		delete(m.ifAddrs, si)
+	} else {
+		m.ifAddrs[si] = as
+	}
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		m.mu.Lock()
+		for len(m.ifAddrs[si]) > 0 {
+			m.delAddress(si, 0)
+		}
+		m.mu.Unlock()
+	}
+	return
+}
+
+// Counters returns message counters.
+func (m *Main) Counters() (c Counters) {
+	m.mu.Lock()
+	c = m.counters
+	m.mu.Unlock()
+	return
+}
+
+// ClearCounters zeros message counters.
+func (m *Main) ClearCounters() {
+	m.mu.Lock()
+	m.counters = Counters{}
+	m.mu.Unlock()
+}
+
+const (
+	// Hop limit of generated messages.
+	hopLimit = 64
+	// Error messages must not exceed minimum ip6 mtu (RFC 4443 section 2.4 (c)).
+	minMtu = 1280
+)
+
+func isMulticast(a *ip6.Address) bool { return a[0] == 0xff }
+func isLinkLocal(a *ip6.Address) bool { return a[0] == 0xfe && a[1]&0xc0 == 0x80 }
+
+// Ip6 packet with icmp6 message; returns nil unless packet is a complete unfragmented
+// icmp6 message without extension headers.
+func icmp(b []byte) (h *ip6.Header, i []byte) {
+	if len(b) < ip6.SizeofHeader+SizeofHeader || b[0]>>4 != 6 {
+		return
+	}
+	h = (*ip6.Header)(vnet.Pointer(b))
+	l := int(h.Payload_length.ToHost())
+	if h.Protocol != ip.ICMP6 || l < SizeofHeader || ip6.SizeofHeader+l > len(b) {
+		return nil, nil
+	}
+	return h, b[ip6.SizeofHeader : ip6.SizeofHeader+l]
+}
+
+// New ip6 packet with given addresses and icmp6 payload length.
+func newPacket(src, dst *ip6.Address, l int) (b []byte) {
+	b = make([]byte, ip6.SizeofHeader+l)
+	h := ip6.Header{Protocol: ip.ICMP6, Ttl: hopLimit, Src: *src, Dst: *dst}
+	h.Ip_version_traffic_class_and_flow_label.Set(ip6.DefaultVersionTrafficClassAndFlowLabel)
+	h.Payload_length.Set(uint(l))
+	h.Write(b)
+	return
+}
+
+// Reply for echo request to local address.  Called with lock held.
+func (m *Main) echo(b []byte) (reply []byte, ok bool) {
+	h, i := icmp(b)
+	if h == nil || i[0] != Echo_request || i[1] != 0 || len(i) < SizeofHeader+EchoRequestBytes {
+		return
+	}
+	if m.local[h.Dst] == 0 || isMulticast(&h.Src) || h.Src.IsZero() {
+		return
+	}
+	if c := Checksum(&h.Src, &h.Dst, i); c != 0 && c != 0xffff {
+		return
+	}
+	reply = newPacket(&h.Dst, &h.Src, len(i))
+	r := reply[ip6.SizeofHeader:]
+	copy(r, i)
+	r[0] = Echo_reply
+	SetChecksum(reply)
+	m.counters.EchoReplies++
+	return reply, true
+}
+
+// Take token from rate limit bucket.  Called with lock held.
+func (m *Main) allow(now cpu.Time) (ok bool) {
+	if m.lastRefill == 0 {
+		m.tokens = m.ErrorBurst
+	} else if now > m.lastRefill {
+		m.tokens += (now - m.lastRefill).Seconds() * m.ErrorRate
+		if m.tokens > m.ErrorBurst {
+			m.tokens = m.ErrorBurst
+		}
+	}
+	m.lastRefill = now
+	if ok = m.tokens >= 1; ok {
+		m.tokens--
+	}
+	return
+}
+
+// Source of error message: address of receiving interface with scope of destination.
+// Called with lock held.
+func (m *Main) source(si vnet.Si, dst *ip6.Address) (src ip6.Address, ok bool) {
+	for _, a := range m.ifAddrs[si] {
+		if isLinkLocal(&a) == isLinkLocal(dst) {
+			return a, true
+		}
+		if !ok {
+			src, ok = a, true
+		}
+	}
+	return
+}
+
+// Errors making error messages.
+const (
+	error_sent uint = iota
+	error_rate_limited
+	error_not_sent
+	error_no_source
+)
+
+// Error message for invoking packet received on given interface (RFC 4443 section 2.4).
+// Called with lock held.
+func (m *Main) errorMessage(si vnet.Si, b []byte, t Type, code uint8, data uint32, now cpu.Time) (msg []byte, e uint) {
+	e = error_not_sent
+	if len(b) < ip6.SizeofHeader || b[0]>>4 != 6 {
+		return
+	}
+	h := (*ip6.Header)(vnet.Pointer(b))
+	// Not sent for error messages and redirects.
+	if _, i := icmp(b); i != nil && (Type(i[0]).IsError() || i[0] == Redirect) {
+		return
+	}
+	// Nor to multicast destinations unless packet too big or unrecognized option.
+	if isMulticast(&h.Dst) && t != Packet_too_big && !(t == Parameter_problem && code == Unrecognized_option) {
+		return
+	}
+	// Nor to multicast or unspecified sources.
+	if isMulticast(&h.Src) || h.Src.IsZero() {
+		return
+	}
+	src, ok := m.source(si, &h.Src)
+	if !ok {
+		return nil, error_no_source
+	}
+	if !m.allow(now) {
+		m.counters.RateLimited++
+		return nil, error_rate_limited
+	}
+	l := len(b)
+	if max := minMtu - ip6.SizeofHeader - SizeofHeader - SizeofErrorHeader; l > max {
+		l = max
+	}
+	msg = newPacket(&src, &h.Src, SizeofHeader+SizeofErrorHeader+l)
+	i := msg[ip6.SizeofHeader:]
+	i[0], i[1] = uint8(t), code
+	x := (*ErrorHeader)(vnet.Pointer(i[SizeofHeader:]))
+	x.Data.Set(uint(data))
+	copy(i[SizeofHeader+SizeofErrorHeader:], b[:l])
+	SetChecksum(msg)
+	m.counters.Errors++
+	return msg, error_sent
+}
+
+// SendError sends error message of given type, code and data for invoking ip6 packet b
+// received on given interface.  Returns false when message is not sent because of the
+// rules of RFC 4443 section 2.4 or the rate limit.
+func (m *Main) SendError(si vnet.Si, b []byte, t Type, code uint8, data uint32) (ok bool) {
+	m.mu.Lock()
+	msg, e := m.errorMessage(si, b, t, code, data, cpu.TimeNow())
+	if ok = e == error_sent; ok {
+		m.pending = append(m.pending, message{si: si, b: msg})
+	}
+	m.mu.Unlock()
+	m.notify()
+	return
+}
+
+// SendTimeExceeded sends hop limit exceeded error for packet.
+func (m *Main) SendTimeExceeded(si vnet.Si, b []byte) bool {
+	return m.SendError(si, b, Time_exceeded, Hop_limit_exceeded, 0)
+}
+
+// SendUnreachable sends destination unreachable error with given code for packet.
+func (m *Main) SendUnreachable(si vnet.Si, b []byte, code uint8) bool {
+	return m.SendError(si, b, Destination_unreachable, code, 0)
+}
+
+// SendPacketTooBig sends packet too big error with mtu of next hop, e.g. of a tunnel, for
+// path mtu discovery.
+func (m *Main) SendPacketTooBig(si vnet.Si, b []byte, mtu uint) bool {
+	return m.SendError(si, b, Packet_too_big, 0, uint32(mtu))
+}
+
+type sendEvent struct {
+	vnet.Event
+	m  *Main
+	ms []message
+}
+
+func (e *sendEvent) String() string { return "icmp6 send" }
+func (e *sendEvent) EventAction()   { e.m.resolve(e.ms) }
+
+// Signal event to resolve rewrites for pending messages.
+func (m *Main) notify() {
+	m.mu.Lock()
+	ms := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+	if len(ms) > 0 {
+		m.Vnet.SignalEvent(&sendEvent{m: m, ms: ms})
+	}
+}
+
+// Queue messages for transmission via neighbor adjacency of their destination.  Called in
+// event context.
+func (m *Main) resolve(ms []message) {
+	v := m.Vnet
+	var fs []frame
+	noRoute := uint64(0)
+	for _, x := range ms {
+		h := (*ip6.Header)(vnet.Pointer(x.b))
+		fi := m.m6.FibIndexForSi(x.si)
+		as, ok := m.m6.LookupAdjacency(fi, h.Dst.ToNetIP())
+		if !ok || !as[0].IsRewrite() {
+			noRoute++
+			continue
+		}
+		f := frame{rw: as[0].Rewrite, b: x.b}
+		hw := v.SupHwIf(v.SwIf(f.rw.Si))
+		if hw == nil {
+			noRoute++
+			continue
+		}
+		v.SetRewriteNodeHwIf(&f.rw, hw, &m.txNode)
+		fs = append(fs, f)
+	}
+	m.mu.Lock()
+	m.counters.NoRoute += noRoute
+	for i := range fs {
+		// Dropped when transmit queue is full.
+		if len(m.frames) >= maxFrames {
+			m.counters.NoRoute++
+			continue
+		}
+		m.frames = append(m.frames, fs[i])
+	}
+	n := len(m.frames)
+	m.mu.Unlock()
+	if n > 0 {
+		m.txNode.Activate(true)
+	}
+}
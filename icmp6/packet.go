@@ -0,0 +1,223 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip6"
+
+	"fmt"
+	"unsafe"
+)
+
+type Header struct {
+	Type     Type
+	Code     uint8
+	Checksum vnet.Uint16
+}
+
+const SizeofHeader = 4
+
+type Type uint8
+
+const (
+	Destination_unreachable          = 1
+	Packet_too_big                   = 2
+	Time_exceeded                    = 3
+	Parameter_problem                = 4
+	Echo_request                     = 128
+	Echo_reply                       = 129
+	Multicast_listener_query         = 130
+	Multicast_listener_report        = 131
+	Multicast_listener_done          = 132
+	Router_solicitation              = 133
+	Router_advertisement             = 134
+	Neighbor_solicitation            = 135
+	Neighbor_advertisement           = 136
+	Redirect                         = 137
+	Router_renumbering               = 138
+	Node_information_request         = 139
+	Node_information_response        = 140
+	Inverse_neighbor_solicitation    = 141
+	Inverse_neighbor_advertisement   = 142
+	Multicast_listener_report_v2     = 143
+	Home_agent_address_request       = 144
+	Home_agent_address_reply         = 145
+	Mobile_prefix_solicitation       = 146
+	Mobile_prefix_advertisement      = 147
+	Certification_path_solicitation  = 148
+	Certification_path_advertisement = 149
+	Multicast_router_advertisement   = 151
+	Multicast_router_solicitation    = 152
+	Multicast_router_termination     = 153
+	Fmipv6                           = 154
+	Rpl_control                      = 155
+	Duplicate_address_request        = 157
+	Duplicate_address_confirmation   = 158
+	Mpl_control                      = 159
+	Extended_echo_request            = 160
+	Extended_echo_reply              = 161
+)
+
+var typeStrings = [...]string{
+	Destination_unreachable:          "destination-unreachable",
+	Packet_too_big:                   "packet-too-big",
+	Time_exceeded:                    "time-exceeded",
+	Parameter_problem:                "parameter-problem",
+	Echo_request:                     "echo-request",
+	Echo_reply:                       "echo-reply",
+	Multicast_listener_query:         "multicast-listener-query",
+	Multicast_listener_report:        "multicast-listener-report",
+	Multicast_listener_done:          "multicast-listener-done",
+	Router_solicitation:              "router-solicitation",
+	Router_advertisement:             "router-advertisement",
+	Neighbor_solicitation:            "neighbor-solicitation",
+	Neighbor_advertisement:           "neighbor-advertisement",
+	Redirect:                         "redirect",
+	Router_renumbering:               "router-renumbering",
+	Node_information_request:         "node-information-request",
+	Node_information_response:        "node-information-response",
+	Inverse_neighbor_solicitation:    "inverse-neighbor-solicitation",
+	Inverse_neighbor_advertisement:   "inverse-neighbor-advertisement",
+	Multicast_listener_report_v2:     "multicast-listener-report-v2",
+	Home_agent_address_request:       "home-agent-address-request",
+	Home_agent_address_reply:         "home-agent-address-reply",
+	Mobile_prefix_solicitation:       "mobile-prefix-solicitation",
+	Mobile_prefix_advertisement:      "mobile-prefix-advertisement",
+	Certification_path_solicitation:  "certification-path-solicitation",
+	Certification_path_advertisement: "certification-path-advertisement",
+	Multicast_router_advertisement:   "multicast-router-advertisement",
+	Multicast_router_solicitation:    "multicast-router-solicitation",
+	Multicast_router_termination:     "multicast-router-termination",
+	Fmipv6:                           "fmipv6",
+	Rpl_control:                      "rpl-control",
+	Duplicate_address_request:        "duplicate-address-request",
+	Duplicate_address_confirmation:   "duplicate-address-confirmation",
+	Mpl_control:                      "mpl-control",
+	Extended_echo_request:            "extended-echo-request",
+	Extended_echo_reply:              "extended-echo-reply",
+}
+
+func (t Type) String() string {
+	return elib.StringerHex(typeStrings[:], int(t))
+}
+
+var typeMap = parse.NewStringMap(typeStrings[:])
+
+func (t *Type) Parse(in *parse.Input) {
+	var v uint8
+	if !in.Parse("%v", typeMap, &v) {
+		in.ParseError()
+	}
+	*t = Type(v)
+}
+
+// Error messages have types below 128 (RFC 4443 section 2.1).
+func (t Type) IsError() bool { return t < Echo_request }
+
+// Destination unreachable codes.
+const (
+	No_route_to_destination     = 0
+	Administratively_prohibited = 1
+	Beyond_scope_of_source      = 2
+	Address_unreachable         = 3
+	Port_unreachable            = 4
+	Source_address_failed       = 5
+	Reject_route                = 6
+)
+
+// Time exceeded codes.
+const (
+	Hop_limit_exceeded                = 0
+	Fragment_reassembly_time_exceeded = 1
+)
+
+// Parameter problem codes.
+const (
+	Erroneous_header_field   = 0
+	Unrecognized_next_header = 1
+	Unrecognized_option      = 2
+	Incomplete_header_chain  = 3
+)
+
+func (h *Header) String() (s string) {
+	s = "ICMP6 " + h.Type.String()
+	if h.Code != 0 {
+		s += fmt.Sprintf(" code %d", h.Code)
+	}
+	return
+}
+
+func (h *Header) Len() uint                       { return SizeofHeader }
+func (h *Header) Read(b []byte) vnet.PacketHeader { return (*Header)(vnet.Pointer(b)) }
+
+// Checksum covers ip6 pseudo header and is set with SetChecksum once message is complete.
+func (h *Header) Write(b []byte) {
+	type t struct{ data [SizeofHeader]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
+
+// Sum of ip6 pseudo header for icmp6 message of given length.
+func pseudoHeader(src, dst *ip6.Address, l uint) ip.Checksum {
+	var tail [8]byte
+	tail[0], tail[1], tail[2], tail[3] = byte(l>>24), byte(l>>16), byte(l>>8), byte(l)
+	tail[7] = uint8(ip.ICMP6)
+	c := ip.Checksum(0).AddBytes(src[:])
+	c = c.AddBytes(dst[:])
+	return c.AddBytes(tail[:])
+}
+
+// Checksum of icmp6 message with ip6 pseudo header of given addresses.
+func Checksum(src, dst *ip6.Address, icmp []byte) vnet.Uint16 {
+	return ^pseudoHeader(src, dst, uint(len(icmp))).AddBytes(icmp).Fold()
+}
+
+// SetChecksum sets checksum of icmp6 message following ip6 header in b.
+func SetChecksum(b []byte) {
+	ih := (*ip6.Header)(vnet.Pointer(b))
+	i := b[ip6.SizeofHeader:]
+	h := (*Header)(vnet.Pointer(i))
+	h.Checksum = 0
+	h.Checksum = Checksum(&ih.Src, &ih.Dst, i)
+}
+
+type EchoRequest struct {
+	Id       vnet.Uint16
+	Sequence vnet.Uint16
+}
+
+const EchoRequestBytes = 4
+
+func (h *EchoRequest) String() string {
+	return fmt.Sprintf("id %d seq %d", h.Id.ToHost(), h.Sequence.ToHost())
+}
+func (h *EchoRequest) Len() uint                       { return EchoRequestBytes }
+func (h *EchoRequest) Read(b []byte) vnet.PacketHeader { return (*EchoRequest)(vnet.Pointer(b)) }
+func (h *EchoRequest) Write(b []byte) {
+	type t struct{ data [EchoRequestBytes]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
+
+// Error messages follow header with 4 bytes: mtu for packet too big, pointer to erroneous
+// octet for parameter problem and unused otherwise.  Invoking packet follows.
+type ErrorHeader struct {
+	Data vnet.Uint32
+}
+
+const SizeofErrorHeader = 4
+
+func (h *ErrorHeader) String() string                  { return fmt.Sprintf("data %d", h.Data.ToHost()) }
+func (h *ErrorHeader) Len() uint                       { return SizeofErrorHeader }
+func (h *ErrorHeader) Read(b []byte) vnet.PacketHeader { return (*ErrorHeader)(vnet.Pointer(b)) }
+func (h *ErrorHeader) Write(b []byte) {
+	type t struct{ data [SizeofErrorHeader]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp6
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+)
+
+type pgStream struct {
+	pg.Stream
+}
+
+type pgMain struct {
+}
+
+func (m *pgMain) Name() string { return "icmp6" }
+
+// Stream syntax: TYPE [code CODE] [id ID] [seq SEQ] for echo or [mtu MTU] [pointer P] for errors.
+func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
+	var s pgStream
+	h := Header{}
+	for !in.End() {
+		switch {
+		case in.Parse("%v", &h):
+			s.AddHeader(&h)
+			switch {
+			case h.Type == Echo_request || h.Type == Echo_reply:
+				e := &EchoRequest{}
+				e.Parse(in)
+				s.AddHeader(e)
+			case h.Type.IsError():
+				e := &ErrorHeader{}
+				e.Parse(in)
+				s.AddHeader(e)
+			}
+		default:
+			in.ParseError()
+		}
+	}
+	if err == nil {
+		r = &s
+	}
+	return
+}
+
+// Checksum covers pseudo header of ip6 header which must directly precede icmp6 header.
+// Sub streams are finalized first so ip6 address increments are not covered.
+func (s *pgStream) Finalize(dst []vnet.Ref, do uint) (changed bool) {
+	for i := range dst {
+		r := &dst[i]
+		ih := (*ip6.Header)(r.DataOffset(do - ip6.SizeofHeader))
+		h := (*Header)(r.DataOffset(do))
+		h.Checksum = 0
+		sum := pseudoHeader(&ih.Src, &ih.Dst, r.ChainLen()-do).AddRef(r, do)
+		h.Checksum = ^sum.Fold()
+	}
+	return true
+}
+
+func (m *pgMain) pgInit(v *vnet.Vnet) {
+	pg.AddStreamType(v, "icmp6", m)
+}
@@ -5,6 +5,7 @@
 package vnet
 
 import (
+	"github.com/platinasystems/elib"
 	"github.com/platinasystems/elib/cli"
 	"github.com/platinasystems/elib/elog"
 	"github.com/platinasystems/elib/loop"
@@ -14,6 +15,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -48,6 +50,10 @@ type HwIf struct {
 	// Max size of packet in bytes (MTU)
 	maxPacketSize uint
 
+	// Egress queues and scheduler (*egressScheduler); nil when packets are sent directly to output thread.
+	// Read by data path without locking; replaced by SetEgress.
+	egress atomic.Value
+
 	defaultId IfId
 	subSiById map[IfId]Si
 
@@ -706,6 +712,15 @@ const (
 	IfLoopbackPhy
 )
 
+func (x IfLoopbackType) String() string {
+	t := [...]string{
+		IfLoopbackNone: "none",
+		IfLoopbackMac:  "mac",
+		IfLoopbackPhy:  "phy",
+	}
+	return elib.Stringer(t[:], int(x))
+}
+
 func (x *IfLoopbackType) Parse(in *parse.Input) {
 	switch text := in.Token(); text {
 	case "none":
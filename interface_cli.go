@@ -153,6 +153,7 @@ type showIfConfig struct {
 	colMap  map[string]bool
 	siMap   map[Si]bool
 	hiMap   map[Hi]bool
+	format  ShowFormat
 }
 
 func (c *showIfConfig) parse(v *Vnet, in *cli.Input, isHw bool) {
@@ -172,6 +173,7 @@ func (c *showIfConfig) parse(v *Vnet, in *cli.Input, isHw bool) {
 			hi Hi
 		)
 		switch {
+		case in.Parse("f%*ormat %v", &c.format):
 		case !isHw && in.Parse("%v", &si, v):
 			c.siMap[si] = true
 		case isHw && in.Parse("%v", &hi, v):
@@ -207,13 +209,35 @@ func (h *swIfIndices) Swap(i, j int)      { h.ifs[i], h.ifs[j] = h.ifs[j], h.ifs
 func (h *swIfIndices) Len() int           { return len(h.ifs) }
 
 type showSwIf struct {
+	Name    string  `json:"name" yaml:"name"`
+	State   string  `json:"state" yaml:"state"`
+	Counter string  `json:"counter,omitempty" yaml:"counter,omitempty"`
+	Count   uint64  `json:"count" yaml:"count"`
+	Rate    float64 `json:"rate" yaml:"rate"`
+}
+type showSwIfs []showSwIf
+
+// Text table row: count and rate are blank for rows without counter.
+type showSwIfText struct {
 	Name    string `format:"%-30s" align:"left"`
 	State   string `format:"%-12s" align:"left"`
 	Counter string `format:"%-30s" align:"left"`
 	Count   string `format:"%16s" align:"right"`
 	Rate    string `format:"%16s" align:"right"`
 }
-type showSwIfs []showSwIf
+
+func (x showSwIfs) text() (t []showSwIfText) {
+	t = make([]showSwIfText, len(x))
+	for i := range x {
+		s := &x[i]
+		t[i] = showSwIfText{Name: s.Name, State: s.State, Counter: s.Counter}
+		if s.Counter != "" {
+			t[i].Count = fmt.Sprintf("%d", s.Count)
+			t[i].Rate = fmt.Sprintf("%.2e", s.Rate)
+		}
+	}
+	return
+}
 
 func (v *Vnet) showSwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
 
@@ -242,6 +266,9 @@ func (v *Vnet) showSwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 	}
 
 	if cf.re.Valid() && len(swIfs.ifs) == 0 {
+		if !cf.format.IsText() {
+			return cf.format.Write(w, showSwIfs{})
+		}
 		fmt.Fprintf(w, "No interfaces match expression: `%s'\n", cf.re)
 		return
 	}
@@ -268,10 +295,11 @@ func (v *Vnet) showSwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 		v.foreachSwIfCounter(cf.detail, si, func(counter string, count uint64) {
 			s := showSwIf{
 				Counter: counter,
-				Count:   fmt.Sprintf("%d", count),
-				Rate:    fmt.Sprintf("%.2e", float64(count)/dt),
+				Count:   count,
+				Rate:    float64(count) / dt,
 			}
-			if first {
+			// Structured output repeats interface name and state on each counter.
+			if first || !cf.format.IsText() {
 				first = false
 				s.Name = firstIf.Name
 				s.State = firstIf.State
@@ -283,8 +311,14 @@ func (v *Vnet) showSwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 			sifs = append(sifs, firstIf)
 		}
 	}
+	if !cf.format.IsText() {
+		sifs = append(sifs,
+			showSwIf{Name: "sideband", Counter: "to-kernel sent packets", Count: xeth.Count.Tx.Sent},
+			showSwIf{Name: "sideband", Counter: "to-kernel dropped packets", Count: xeth.Count.Tx.Dropped})
+		return cf.format.Write(w, sifs)
+	}
 	if len(sifs) > 0 {
-		elib.Tabulate(sifs).WriteCols(w, cf.colMap)
+		elib.Tabulate(sifs.text()).WriteCols(w, cf.colMap)
 	} else {
 		fmt.Fprintln(w, "All counters are zero")
 	}
@@ -312,6 +346,18 @@ func (h *hwIfIndices) Swap(i, j int)      { h.ifs[i], h.ifs[j] = h.ifs[j], h.ifs
 func (h *hwIfIndices) Len() int           { return len(h.ifs) }
 
 type showHwIf struct {
+	Name    string  `json:"name" yaml:"name"`
+	Driver  string  `json:"driver" yaml:"driver"`
+	Address string  `json:"address" yaml:"address"`
+	Link    string  `json:"link" yaml:"link"`
+	Counter string  `json:"counter,omitempty" yaml:"counter,omitempty"`
+	Count   uint64  `json:"count" yaml:"count"`
+	Rate    float64 `json:"rate" yaml:"rate"`
+}
+type showHwIfs []showHwIf
+
+// Text table row: count and rate are blank for rows without counter.
+type showHwIfText struct {
 	Name    string `format:"%-30s"`
 	Driver  string `width:"20" format:"%-12s" align:"center"`
 	Address string `format:"%-12s" align:"center"`
@@ -320,7 +366,19 @@ type showHwIf struct {
 	Count   string `format:"%16s" align:"right"`
 	Rate    string `format:"%16s" align:"right"`
 }
-type showHwIfs []showHwIf
+
+func (x showHwIfs) text() (t []showHwIfText) {
+	t = make([]showHwIfText, len(x))
+	for i := range x {
+		s := &x[i]
+		t[i] = showHwIfText{Name: s.Name, Driver: s.Driver, Address: s.Address, Link: s.Link, Counter: s.Counter}
+		if s.Counter != "" {
+			t[i].Count = fmt.Sprintf("%d", s.Count)
+			t[i].Rate = fmt.Sprintf("%.2e", s.Rate)
+		}
+	}
+	return
+}
 
 func (ns showHwIfs) Less(i, j int) bool { return ns[i].Name < ns[j].Name }
 func (ns showHwIfs) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
@@ -350,6 +408,9 @@ func (v *Vnet) showHwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 	}
 
 	if cf.re.Valid() && len(hwIfs.ifs) == 0 {
+		if !cf.format.IsText() {
+			return cf.format.Write(w, showHwIfs{})
+		}
 		fmt.Fprintf(w, "No interfaces match expression: `%s'\n", cf.re)
 		return
 	}
@@ -376,10 +437,10 @@ func (v *Vnet) showHwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 		v.foreachHwIfCounter(cf.detail, h.hi, func(counter string, count uint64) {
 			s := showHwIf{
 				Counter: counter,
-				Count:   fmt.Sprintf("%d", count),
-				Rate:    fmt.Sprintf("%.2e", float64(count)/dt),
+				Count:   count,
+				Rate:    float64(count) / dt,
 			}
-			if first {
+			if first || !cf.format.IsText() {
 				first = false
 				s.Name = firstIf.Name
 				s.Driver = firstIf.Driver
@@ -393,8 +454,11 @@ func (v *Vnet) showHwIfs(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 			ifs = append(ifs, firstIf)
 		}
 	}
+	if !cf.format.IsText() {
+		return cf.format.Write(w, ifs)
+	}
 	if len(ifs) > 0 {
-		elib.Tabulate(ifs).WriteCols(w, cf.colMap)
+		elib.Tabulate(ifs.text()).WriteCols(w, cf.colMap)
 	} else {
 		fmt.Fprintln(w, "All counters are zero")
 	}
@@ -459,6 +523,8 @@ func (v *Vnet) setHwIf(c cli.Commander, w cli.Writer, in *cli.Input) (err error)
 		err = hwif.SetProvisioned(bool(enable))
 	case in.Parse("s%*peed %v", &bw):
 		err = hwif.SetSpeed(bw)
+	case in.Parse("egress"):
+		err = hwif.setEgress(&in.Input)
 	default:
 		var ok bool
 		if ok, err = h.ConfigureHwIf(in); !ok {
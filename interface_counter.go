@@ -289,6 +289,10 @@ func (v *Vnet) ForeachHighFreqHwIfCounter(zero bool, unixOnly bool, f func(hi Hi
 		})
 	}
 }
+
+// SyncSwIfCounters calls counter sync hooks so that software interface counters are current.
+func (v *Vnet) SyncSwIfCounters() { v.syncSwIfCounters() }
+
 func (v *Vnet) syncSwIfCounters() {
 	for i := range v.swIfCounterSyncHooks.hooks {
 		v.swIfCounterSyncHooks.Get(i)(v)
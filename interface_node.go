@@ -35,6 +35,7 @@ type interfaceNode struct {
 	tx_chan chan *TxRefVecIn
 
 	txDownDropError uint
+	egressDropError uint
 
 	freeChan chan *TxRefVecIn
 	tx       outputInterfaceNoder
@@ -44,25 +45,44 @@ type interfaceNode struct {
 type OutputInterfaceNode struct{ interfaceNode }
 type InterfaceNode struct{ interfaceNode }
 
-func (n *interfaceNode) MakeLoopIn() loop.LooperIn                { return &RefIn{} }
-func (n *interfaceNode) MakeLoopOut() loop.LooperOut              { return &RefOut{} }
-func (n *interfaceNode) LoopOutput(l *loop.Loop, i loop.LooperIn) { n.ifOutput(i.(*RefIn)) }
-func (n *interfaceNode) GetInterfaceNode() *interfaceNode         { return n }
+func (n *interfaceNode) MakeLoopIn() loop.LooperIn   { return &RefIn{} }
+func (n *interfaceNode) MakeLoopOut() loop.LooperOut { return &RefOut{} }
+func (n *interfaceNode) LoopOutput(l *loop.Loop, i loop.LooperIn) {
+	t0 := n.runtimeStart()
+	in := i.(*RefIn)
+	nVec := in.InLen()
+	n.ifOutput(in)
+	n.runtimeUpdate(in.ThreadId(), nVec, t0)
+}
+func (n *interfaceNode) GetInterfaceNode() *interfaceNode { return n }
 
 func (n *InterfaceNode) LoopInput(l *loop.Loop, o loop.LooperOut) {
-	n.rx.InterfaceInput(o.(*RefOut))
+	t0 := n.runtimeStart()
+	out := o.(*RefOut)
+	n.rx.InterfaceInput(out)
+	n.runtimeUpdate(n.ThreadId(), out.outLen(n.Vnet), t0)
 }
 
 func (v *Vnet) registerInterfaceNodeHelper(n outputInterfaceNoder, hi Hi) {
 	x := n.GetInterfaceNode()
 	x.txDownDropError = uint(len(x.Errors))
 	x.Errors = append(x.Errors, "tx down drops")
+	x.egressDropError = uint(len(x.Errors))
+	x.Errors = append(x.Errors, "egress queue drops")
 	x.hi = hi
 	x.setupTx(n)
 	h := v.HwIf(hi)
 	h.n = append(h.n, n)
 }
 
+// OutputNodeName returns name of node which transmits packets on hardware interface.
+func (h *HwIf) OutputNodeName() (name string) {
+	if len(h.n) > 0 {
+		name = h.n[0].GetVnetNode().Name()
+	}
+	return
+}
+
 func (v *Vnet) RegisterOutputInterfaceNode(n outputInterfaceNoder, hi Hi, name string, args ...interface{}) {
 	v.registerInterfaceNodeHelper(n, hi)
 	v.RegisterNode(n, name, args...)
@@ -222,9 +242,15 @@ func (n *interfaceNode) ifOutput(ri *RefIn) {
 		ri.FreeRefs(l)
 		return
 	}
+	if s := n.Vnet.HwIf(n.hi).getEgress(); s != nil && n.egressOutput(ri, s) {
+		return
+	}
+	n.txRefs(ri, ri.Refs[:], ri.InLen())
+}
 
+// Send given packets to output thread.
+func (n *interfaceNode) txRefs(ri *RefIn, rs []Ref, n_packets_in uint) {
 	rvi := n.allocTxRefVecIn(ri)
-	n_packets_in := ri.InLen()
 
 	rvi.Refs.Validate(n_packets_in - 1)
 	rvi.Refs = rvi.Refs[:n_packets_in]
@@ -232,7 +258,6 @@ func (n *interfaceNode) ifOutput(ri *RefIn) {
 	// Number of packets left to process.
 	n_ref_left := n_packets_in
 
-	rs := ri.Refs[:]
 	rv := rvi.Refs
 	is, iv := uint(0), uint(0)
 	n_bytes_in, n_packets_rvi := uint(0), uint(0)
@@ -1127,6 +1127,15 @@ func (m *Main) ClearAdjCounters() {
 	})
 }
 
+// ForeachAdj calls f for each allocated adjacency.
+func (m *Main) ForeachAdj(f func(a Adj, adj *Adjacency)) {
+	m.adjacencyHeap.Foreach(func(o, l uint) {
+		for i := uint(0); i < l; i++ {
+			f(Adj(o+i), &m.adjacencyHeap.elts[o+i])
+		}
+	})
+}
+
 func (m *Main) ForeachAdjCounter(a Adj, f AdjGetCounterHandler) {
 	var v vnet.CombinedCounter
 	for _, t := range m.threads {
@@ -41,6 +41,9 @@ type fibMain struct {
 func (f *fibMain) fibIndexForSi(si vnet.Si, validate bool) FibIndex {
 	if validate {
 		f.fibIndexBySi.Validate(uint(si))
+	} else if uint(si) >= uint(len(f.fibIndexBySi)) {
+		// Interfaces without fib index set use default fib.
+		return 0
 	}
 	return f.fibIndexBySi[si]
 }
@@ -64,6 +67,7 @@ func (f *fibMain) SetFibIndexForId(id FibId, i FibIndex) {
 	}
 	f.fibIndexById[id] = i
 }
+func (f *fibMain) DelFibIndexForId(id FibId) { delete(f.fibIndexById, id) }
 
 func (f *fibMain) SetFibNameForIndex(name string, i FibIndex) {
 	f.nameByIndex.Validate(uint(i))
@@ -78,6 +82,15 @@ func (f *fibMain) FibNameForIndex(i FibIndex) string {
 	}
 }
 
+func (f *fibMain) FibIndexForName(name string) (i FibIndex, ok bool) {
+	for j := range f.nameByIndex {
+		if f.nameByIndex[j] == name {
+			return FibIndex(j), true
+		}
+	}
+	return
+}
+
 func (n FibName) String() string {
 	f := &n.M.fibMain
 	if f == nil {
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"net"
 	"sort"
+	"strings"
 )
 
 type fibShowUsageHook func(w cli.Writer)
@@ -24,6 +25,59 @@ type showFibConfig struct {
 	summary     bool
 	unreachable bool
 	showTable   string
+	format      vnet.ShowFormat
+}
+
+type route struct {
+	prefixFibIndex ip.FibIndex
+	prefixFibName  string
+	prefix         net.IPNet
+	r              FibResult
+}
+
+type showRouteNextHop struct {
+	Address   string `json:"address" yaml:"address"`
+	Interface string `json:"interface" yaml:"interface"`
+	Weight    uint   `json:"weight" yaml:"weight"`
+	Resolved  bool   `json:"resolved" yaml:"resolved"`
+}
+
+// Route for structured show ip fib output.
+type showRoute struct {
+	Table     string             `json:"table" yaml:"table"`
+	Prefix    string             `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Type      string             `json:"type,omitempty" yaml:"type,omitempty"`
+	Installed bool               `json:"installed" yaml:"installed"`
+	Adj       ip.Adj             `json:"adj" yaml:"adj"`
+	NextHops  []showRouteNextHop `json:"next_hops,omitempty" yaml:"next_hops,omitempty"`
+	Adjacency []string           `json:"adjacency,omitempty" yaml:"adjacency,omitempty"`
+}
+
+func (m *Main) showRoute(r *route, lines []string) (x showRoute) {
+	x = showRoute{
+		Table:     r.prefixFibName,
+		Installed: r.r.Installed,
+		Adj:       r.r.Adj,
+	}
+	for _, l := range lines {
+		x.Adjacency = append(x.Adjacency, strings.TrimSpace(l))
+	}
+	// Routes of tables not shown have no prefix.
+	if r.prefix.IP != nil {
+		x.Prefix = r.prefix.String()
+		x.Type = r.r.Type.String()
+	}
+	if r.r.Type == VIA {
+		for _, nh := range r.r.Nhs {
+			x.NextHops = append(x.NextHops, showRouteNextHop{
+				Address:   nh.Address.String(),
+				Interface: vnet.SiName{V: m.v, Si: nh.Si}.String(),
+				Weight:    uint(nh.Weight),
+				Resolved:  !(nh.Adj == ip.AdjNil || nh.Adj == ip.AdjMiss || nh.Adj == ip.AdjPunt),
+			})
+		}
+	}
+	return
 }
 
 func (m *Main) showIpFib(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
@@ -35,6 +89,7 @@ func (m *Main) showIpFib(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 		case in.Parse("s%*ummary"):
 			cf.summary = true
 		case in.Parse("t%*able %s", &cf.showTable):
+		case in.Parse("f%*ormat %v", &cf.format):
 		default:
 			err = cli.ParseError
 			return
@@ -49,12 +104,6 @@ func (m *Main) showIpFib(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 	// Sync adjacency stats with hardware.
 	m.CallAdjSyncCounterHooks()
 
-	type route struct {
-		prefixFibIndex ip.FibIndex
-		prefixFibName  string
-		prefix         net.IPNet
-		r              FibResult
-	}
 	rs := []route{}
 	for fi := range m.fibs {
 		fib := m.fibs[fi]
@@ -101,6 +150,18 @@ func (m *Main) showIpFib(c cli.Commander, w cli.Writer, in *cli.Input) (err erro
 		}
 		return bytes.Compare(rs[i].prefix.Mask, rs[j].prefix.Mask) < 0
 	})
+	if !cf.format.IsText() {
+		srs := []showRoute{}
+		for ri := range rs {
+			r := &rs[ri]
+			var lines []string
+			if r.r.Adj != ip.AdjNil && r.r.Adj != ip.AdjMiss {
+				lines = m.adjLines(r.r.Adj, cf.detail, r.r.Installed)
+			}
+			srs = append(srs, m.showRoute(r, lines))
+		}
+		return cf.format.Write(w, srs)
+	}
 	fmt.Fprintf(w, "%6s%30s%40s\n", "Table", "Destination", "Adjacency")
 	for ri := range rs {
 		r := &rs[ri]
@@ -210,9 +210,14 @@ func (r *FibResult) String() (s string) {
 }
 
 func (rs *FibResultVec) ForeachMatchingNhAddress(nha net.IP, fn func(r *FibResult, nh *ip.NextHop)) {
+	rs.foreachMatchingNh(vnet.SiNil, nha, fn)
+}
+
+// Calls fn for next hops with given address and, unless si is SiNil, given interface.
+func (rs *FibResultVec) foreachMatchingNh(si vnet.Si, nha net.IP, fn func(r *FibResult, nh *ip.NextHop)) {
 	for ri, r := range *rs {
 		for i, nh := range r.Nhs {
-			if nh.Address.Equal(nha) {
+			if (si == vnet.SiNil || nh.Si == si) && nh.Address.Equal(nha) {
 				fn(&r, &nh)
 				r.Nhs[i] = nh
 				(*rs)[ri] = r
@@ -422,6 +427,48 @@ func (m *Main) ForeachUnresolved(fn func(fi ip.FibIndex, p net.IPNet)) {
 	}
 }
 
+// ForeachRoute calls fn for each route with next hops (e.g. static or netlink routes) in each fib.
+func (m *Main) ForeachRoute(fn func(fi ip.FibIndex, p net.IPNet, r *FibResult)) {
+	for _, f := range m.fibs {
+		if f == nil {
+			continue
+		}
+		f.routeFib.foreach(func(p net.IPNet, r FibResult) { fn(f.index, p, &r) })
+	}
+}
+
+// LookupAdjacency returns adjacencies of installed route with longest prefix matching given
+// address in given fib.
+func (m *Main) LookupAdjacency(fi ip.FibIndex, a net.IP) (as []ip.Adjacency, ok bool) {
+	f := m.fibByIndex(fi, false)
+	if f == nil {
+		return
+	}
+	x := NetIPToV4Address(a)
+	adj, _ := f.lookupAdj(&x)
+	if adj == ip.AdjNil || adj == ip.AdjMiss || m.IsAdjFree(adj) {
+		return
+	}
+	as, ok = m.GetAdj(adj), true
+	return
+}
+
+// LookupAdjacencyForSi returns adjacencies of installed route with longest prefix matching
+// given address in fib of given sw interface.  Neither fibs nor interface fib indices are
+// created so it may be called from data path.
+func (m *Main) LookupAdjacencyForSi(si vnet.Si, a *Address) (as []ip.Adjacency, ok bool) {
+	i := m.FibIndexForSi(si)
+	if uint(i) >= uint(len(m.fibs)) || m.fibs[i] == nil {
+		return
+	}
+	adj, _ := m.fibs[i].lookupAdj(a)
+	if adj == ip.AdjNil || adj == ip.AdjMiss || m.IsAdjFree(adj) {
+		return
+	}
+	as, ok = m.GetAdj(adj), true
+	return
+}
+
 func (m *MapFib) foreach(fn func(p net.IPNet, r FibResult)) {
 	for l := 32; l >= 0; l-- {
 		//p.Len = uint32(l)
@@ -496,6 +543,9 @@ type Fib struct {
 	routeFib     MapFib //i.e. via nexthop
 	local, glean MapFib
 	punt, drop   MapFib //punt goes to linux, drop drops at hardware
+
+	// Installed routes for data path lookups.
+	mtrie mtrie
 }
 
 //go:generate gentemplate -d Package=ip4 -id Fib -d VecType=FibVec -d Type=*Fib github.com/platinasystems/elib/vec.tmpl
@@ -525,6 +575,7 @@ func (f *Fib) addFib(m *Main, r *FibResult) (installed bool) {
 
 	if !found { // install new
 		m.callFibAddDelHooks(f.index, &p, r.Adj, false)
+		f.mtrieAddDel(&p, r.Adj, false)
 		installed = true
 		r.Installed = installed
 		dbgvnet.Adj.Log("installed new")
@@ -564,6 +615,7 @@ func (f *Fib) addFib(m *Main, r *FibResult) (installed bool) {
 	dbgvnet.Adj.Log("call FibAddDelHook", &p, "adj", r.Adj)
 	// AddDelHook replaced any previous adj with new on
 	m.callFibAddDelHooks(f.index, &p, r.Adj, false)
+	f.mtrieAddDel(&p, r.Adj, false)
 	oldr.Installed = false
 	installed = true
 	r.Installed = installed
@@ -602,6 +654,7 @@ func (f *Fib) delFib(m *Main, r *FibResult) {
 	dbgvnet.Adj.Log("call FibAddDelHook", &p, "adj", r.Adj)
 	m.callFibAddDelHooks(f.index, &p, r.Adj, true)
 	r.Installed = false
+	f.mtrieAddDel(&p, r.Adj, true)
 	if found {
 		dbgvnet.Adj.Logf("call f.addFib to replace with %v\n", newr)
 		// install replacement
@@ -1233,6 +1286,9 @@ func (m *Main) updateAdjAndUsedBy(f *Fib, p *net.IPNet, nhs *ip.NextHopVec, isDe
 		// if add, need to update the adj as it will not have been filled in yet
 		if !isDel {
 			(*nhs)[nhi].Adj = adj
+			if m.isNextHopDown(nh.Si, nh.Address) {
+				(*nhs)[nhi].Adj = ip.AdjMiss
+			}
 
 			if adj == ip.AdjMiss {
 				// adding a punt to arp
@@ -1323,6 +1379,11 @@ func (m *Main) AddDelRouteNextHop(p *net.IPNet, nh *NextHop, isDel bool, isRepla
 // Update each matching routeFibResult with a newAdj
 // Note this doesn't actually remove the nexthop from Prefix; that's done via AddDelRouteNextHops when Linux explicitly deletes or replaces a via route
 func (f *Fib) addDelRouteNextHop(m *Main, p *net.IPNet, nhIP net.IP, nhr NextHopper, nhAdj ip.Adj, isDel bool) (err error) {
+	return f.addDelRouteNextHopSi(m, p, vnet.SiNil, nhIP, nhr, nhAdj, isDel)
+}
+
+// As addDelRouteNextHop but only for next hops via nhSi unless nhSi is SiNil.
+func (f *Fib) addDelRouteNextHopSi(m *Main, p *net.IPNet, nhSi vnet.Si, nhIP net.IP, nhr NextHopper, nhAdj ip.Adj, isDel bool) (err error) {
 	var (
 		oldAdj, newAdj ip.Adj
 		ok             bool
@@ -1339,12 +1400,14 @@ func (f *Fib) addDelRouteNextHop(m *Main, p *net.IPNet, nhIP net.IP, nhr NextHop
 	newAdj = ip.AdjNil
 
 	// update rs with nhAdj if reachable (add) or a new arp adj if unreachale (del); detele oldAj
-	rs.ForeachMatchingNhAddress(nhIP, func(r *FibResult, nh *ip.NextHop) {
+	rs.foreachMatchingNh(nhSi, nhIP, func(r *FibResult, nh *ip.NextHop) {
 		if isDel {
 			//ai, as := m.NewAdj(1)
 			//m.setArpAdjacency(&as[0], nh.Si)
 			//nh.Adj = ai
 			nh.Adj = ip.AdjMiss
+		} else if m.isNextHopDown(nh.Si, nhIP) {
+			nh.Adj = ip.AdjMiss
 		} else {
 			nh.Adj = nhAdj
 		}
@@ -1352,7 +1415,7 @@ func (f *Fib) addDelRouteNextHop(m *Main, p *net.IPNet, nhIP net.IP, nhr NextHop
 
 	// Do this as separate ForEach because r.Nhs will not have been updated until the ForeachMatchingNhAddress completed
 	// update with newAdj and addFib
-	rs.ForeachMatchingNhAddress(nhIP, func(r *FibResult, nh *ip.NextHop) {
+	rs.foreachMatchingNh(nhSi, nhIP, func(r *FibResult, nh *ip.NextHop) {
 		if newAdj, ok = m.AddNextHopsAdj(r.Nhs); ok {
 			if newAdj != r.Adj {
 				if newAdj == ip.AdjNil {
@@ -1637,6 +1700,7 @@ func (f *Fib) Reset() {
 	f.local.reset()
 	f.glean.reset()
 	f.punt.reset()
+	f.mtrie.reset()
 }
 
 func (m *Main) FibReset(fi ip.FibIndex) {
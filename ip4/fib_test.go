@@ -0,0 +1,36 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+
+	"net"
+	"testing"
+)
+
+func TestLookupAdjacencyForSi(t *testing.T) {
+	m := newTestMain()
+	m.testAddNeighbor(t, "10.0.0.0/8", 1)
+	m.testAddNeighbor(t, "10.1.0.0/16", 2)
+	for _, x := range []struct {
+		si  vnet.Si
+		dst string
+		ok  bool
+		via vnet.Si
+	}{
+		{0, "10.1.2.3", true, 2},
+		{0, "10.2.0.1", true, 1},
+		{0, "11.0.0.1", false, 0},
+		// Interface without fib index uses default fib.
+		{100, "10.1.2.3", true, 2},
+	} {
+		a := NetIPToV4Address(net.ParseIP(x.dst))
+		as, ok := m.LookupAdjacencyForSi(x.si, &a)
+		if ok != x.ok || (ok && as[0].Si != x.via) {
+			t.Errorf("si %d dst %s: ok %v adjacencies %v", x.si, x.dst, ok, as)
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Multicast routes are keyed by table, source and group.  Zero source is (*,G).
+type mfibKey struct {
+	fi       ip.FibIndex
+	src, grp Address
+}
+
+// Outgoing interface with rewrite for replicated packets.
+type mfibOif struct {
+	si vnet.Si
+	rw vnet.Rewrite
+}
+
+// Forwarding state of route.  Never modified once published; changes publish a new copy.
+type mfibRoute struct {
+	// Reverse path interface: packets received on any other interface are dropped.
+	// SiNil accepts packets from all interfaces.
+	rpf vnet.Si
+	// Outgoing interface list.
+	oil []mfibOif
+}
+
+type mfibEntry struct {
+	// Current *mfibRoute; nil once route is deleted with packets still waiting for replication.
+	route atomic.Value
+
+	// Counters are updated atomically by data path.
+	forwarded vnet.CombinedCounter
+	rpfDrops  vnet.CombinedCounter
+	// Packets dropped since replication backlog was full.
+	queueDrops vnet.CombinedCounter
+}
+
+func (e *mfibEntry) getRoute() (r *mfibRoute) {
+	r, _ = e.route.Load().(*mfibRoute)
+	return
+}
+
+func (e *mfibEntry) setRoute(r *mfibRoute) { e.route.Store(r) }
+
+func mfibCount(c *vnet.CombinedCounter, size uint) {
+	atomic.AddUint64(&c.Packets, 1)
+	atomic.AddUint64(&c.Bytes, uint64(size))
+}
+
+func mfibCounter(c *vnet.CombinedCounter) vnet.CombinedCounter {
+	return vnet.CombinedCounter{Packets: atomic.LoadUint64(&c.Packets), Bytes: atomic.LoadUint64(&c.Bytes)}
+}
+
+func mfibClear(c *vnet.CombinedCounter) {
+	atomic.StoreUint64(&c.Packets, 0)
+	atomic.StoreUint64(&c.Bytes, 0)
+}
+
+// Packet waiting for replication.
+type mfibPending struct {
+	r    vnet.Ref
+	pool *vnet.BufferPool
+	e    *mfibEntry
+	// Index of next outgoing interface to send copy to.
+	i uint
+	// Set when original buffer has been sent.
+	sent bool
+}
+
+// Maximum number of packets waiting for replication.
+const mfibMaxPending = 4 * vnet.MaxVectorLen
+
+// Multicast routes looked up by data path; replaced as a whole when routes are added or deleted.
+type mfibTable map[mfibKey]*mfibEntry
+
+type mfibMain struct {
+	// Serializes route changes; never taken by data path.
+	mfibMu  sync.Mutex
+	mroutes mfibTable
+	// Number of multicast routes in all tables.
+	nMroute uint
+	// Copy of mroutes (mfibTable) for lock-free lookup.
+	mfibRoutes atomic.Value
+
+	mfibReplicateNode mfibReplicateNode
+	// Packets queued by data path for replication.
+	mfibPending chan mfibPending
+}
+
+func (a *Address) IsMulticast() bool { return a[0]&0xf0 == 0xe0 }
+
+// Link local groups 224.0.0.0/24 are for control protocols and are never forwarded.
+func (a *Address) isLinkLocalMulticast() bool { return a[0] == 224 && a[1] == 0 && a[2] == 0 }
+
+// Ethernet multicast address for group.
+func (a *Address) multicastEthernetAddress() []byte {
+	return []byte{0x01, 0x00, 0x5e, a[1] & 0x7f, a[2], a[3]}
+}
+
+var ErrMrouteNotFound = errors.New("multicast route not found")
+
+// AddDelMroute adds or deletes multicast route in given table.  Zero source address gives (*,G) route.
+// Adding existing route replaces its reverse path interface and outgoing interface list.
+func (m *Main) AddDelMroute(fi ip.FibIndex, src, grp Address, rpf vnet.Si, oifs []vnet.Si, isDel bool) (err error) {
+	if !grp.IsMulticast() {
+		err = fmt.Errorf("%s: not a multicast group", &grp)
+		return
+	}
+	k := mfibKey{fi: fi, src: src, grp: grp}
+
+	var oil []mfibOif
+	if !isDel {
+		v := m.Vnet
+		oil = make([]mfibOif, 0, len(oifs))
+		for _, si := range oifs {
+			if si == rpf {
+				continue
+			}
+			oif := mfibOif{si: si}
+			v.SetRewrite(&oif.rw, si, &m.mfibReplicateNode, vnet.IP4, grp.multicastEthernetAddress())
+			oil = append(oil, oif)
+		}
+	}
+
+	m.mfibMu.Lock()
+	defer m.mfibMu.Unlock()
+	e, ok := m.mroutes[k]
+	if isDel {
+		if !ok {
+			err = ErrMrouteNotFound
+			return
+		}
+		m.mfibDel(k, e)
+		m.mfibPublish()
+		return
+	}
+	// Replacing existing route keeps its counters; new entries get their route before
+	// data path can find them.
+	if !ok {
+		e = &mfibEntry{}
+	}
+	e.setRoute(&mfibRoute{rpf: rpf, oil: oil})
+	if !ok {
+		if m.mroutes == nil {
+			m.mroutes = make(mfibTable)
+		}
+		m.mroutes[k] = e
+		m.nMroute++
+		m.mfibPublish()
+	}
+	return
+}
+
+// Delete route; packets waiting for replication see it deleted.  Called with lock held.
+func (m *Main) mfibDel(k mfibKey, e *mfibEntry) {
+	e.setRoute(nil)
+	delete(m.mroutes, k)
+	m.nMroute--
+}
+
+// Publish copy of routes for data path.  Called with lock held.
+func (m *Main) mfibPublish() {
+	t := make(mfibTable, len(m.mroutes))
+	for k, e := range m.mroutes {
+		t[k] = e
+	}
+	m.mfibRoutes.Store(t)
+}
+
+// Multicast routes for data path lookups.
+func (m *Main) mfibTable() (t mfibTable) {
+	t, _ = m.mfibRoutes.Load().(mfibTable)
+	return
+}
+
+// Reports whether any multicast routes are installed.
+func (m *Main) mfibActive() bool { return len(m.mfibTable()) > 0 }
+
+// Longest match in given routes: (S,G) then (*,G).
+func (t mfibTable) lookup(fi ip.FibIndex, src, grp *Address) (e *mfibEntry, ok bool) {
+	k := mfibKey{fi: fi, src: *src, grp: *grp}
+	if e, ok = t[k]; ok {
+		return
+	}
+	k.src = Address{}
+	e, ok = t[k]
+	return
+}
+
+// Longest match: (S,G) then (*,G).
+func (m *Main) mfibLookup(fi ip.FibIndex, src, grp *Address) (e *mfibEntry, ok bool) {
+	return m.mfibTable().lookup(fi, src, grp)
+}
+
+// Remove deleted interface from all multicast routes.
+func (m *Main) mfibSwIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if !isDel {
+		return
+	}
+	m.mfibMu.Lock()
+	defer m.mfibMu.Unlock()
+	deleted := false
+	for k, e := range m.mroutes {
+		x := e.getRoute()
+		if x.rpf == si {
+			m.mfibDel(k, e)
+			deleted = true
+			continue
+		}
+		y := &mfibRoute{rpf: x.rpf, oil: x.oil[:0:0]}
+		for i := range x.oil {
+			if x.oil[i].si != si {
+				y.oil = append(y.oil, x.oil[i])
+			}
+		}
+		if len(y.oil) != len(x.oil) {
+			e.setRoute(y)
+		}
+	}
+	if deleted {
+		m.mfibPublish()
+	}
+	return
+}
+
+// Look for multicast route for packet.  Packets matching routes which pass reverse path check
+// are queued for replication.  Otherwise next is returned for packet.
+func (m *Main) mfibInput(n *vnet.InOutNode, p *vnet.BufferPool, r0 *vnet.Ref) (x0 uint, queued bool) {
+	x0 = input_next_punt
+	b := r0.DataSlice()
+	if len(b) < SizeofHeader {
+		return
+	}
+	var src, grp Address
+	copy(src[:], b[12:16])
+	copy(grp[:], b[16:20])
+	// Control protocols (IGMP, PIM, ...) are always handled by linux.
+	if !grp.IsMulticast() || grp.isLinkLocalMulticast() || ip.Protocol(b[9]) == ip.IGMP {
+		return
+	}
+
+	fi := m.FibIndexForSi(r0.Si)
+	size := r0.DataLen()
+
+	e, ok := m.mfibLookup(fi, &src, &grp)
+	if !ok {
+		return
+	}
+	x := e.getRoute()
+	if x == nil {
+		// Deleted since routes were loaded.
+		return
+	}
+	switch {
+	case x.rpf != vnet.SiNil && x.rpf != r0.Si:
+		mfibCount(&e.rpfDrops, size)
+		n.SetError(r0, input_error_mfib_rpf)
+		x0 = input_next_drop
+		return
+	case b[8] <= 1:
+		n.SetError(r0, input_error_ttl_expired)
+		x0 = input_next_drop
+		return
+	}
+
+	// Decrement ttl and incrementally update checksum.
+	b[8]--
+	c := uint32(b[10])<<8 | uint32(b[11])
+	c += 0x100
+	c = (c & 0xffff) + c>>16
+	b[10], b[11] = byte(c>>8), byte(c)
+
+	select {
+	case m.mfibPending <- mfibPending{r: *r0, pool: p, e: e}:
+		mfibCount(&e.forwarded, size)
+		// Replicate node stays active until it has sent all queued packets.
+		m.mfibReplicateNode.AddDataActivity(1)
+		queued = true
+	default:
+		mfibCount(&e.queueDrops, size)
+		n.SetError(r0, input_error_mfib_queue_full)
+		x0 = input_next_drop
+	}
+	return
+}
+
+// Node which sends copies of multicast packets to each outgoing interface.
+type mfibReplicateNode struct {
+	vnet.InputNode
+	m   *Main
+	tmp vnet.RefVec
+	// Packets taken from pending queue; first may be partially replicated.
+	pending []mfibPending
+}
+
+// Copy buffer chain into newly allocated buffers.
+func (n *mfibReplicateNode) copyChain(p *vnet.BufferPool, r *vnet.Ref) (c vnet.Ref) {
+	var chain vnet.RefChain
+	n.tmp.Validate(0)
+	for x := r; x != nil; x = x.NextRef() {
+		p.AllocRefs(n.tmp[:1])
+		t := &n.tmp[0]
+		t.SetDataLen(x.DataLen())
+		copy(t.DataSlice(), x.DataSlice())
+		chain.Append(t)
+	}
+	c = chain.Done()
+	c.RefOpaque = r.RefOpaque
+	return
+}
+
+func (n *mfibReplicateNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+
+	for len(n.pending) < vnet.MaxVectorLen {
+		select {
+		case p := <-m.mfibPending:
+			n.pending = append(n.pending, p)
+			continue
+		default:
+		}
+		break
+	}
+
+	full := false
+	done := 0
+	for ; done < len(n.pending); done++ {
+		p := &n.pending[done]
+		var oil []mfibOif
+		if x := p.e.getRoute(); x != nil {
+			oil = x.oil
+		}
+		for ; p.i < uint(len(oil)); p.i++ {
+			f := &oil[p.i]
+			out := &o.Outs[f.rw.NextIndex]
+			if out.GetLen(v) >= out.Cap() {
+				full = true
+				break
+			}
+			var r vnet.Ref
+			// Last interface gets original buffer.
+			if p.i+1 == uint(len(oil)) {
+				r = p.r
+				p.sent = true
+			} else {
+				r = n.copyChain(p.pool, &p.r)
+			}
+			vnet.PerformRewrite(&r, &f.rw)
+			r.Si = f.rw.Si
+			out.BufferPool = p.pool
+			out.Refs[out.AddLen(v)] = r
+		}
+		if full {
+			break
+		}
+		if !p.sent {
+			p.pool.FreeRefs(&p.r, 1, true)
+		}
+	}
+
+	l := copy(n.pending, n.pending[done:])
+	n.pending = n.pending[:l]
+	if done > 0 {
+		n.AddDataActivity(-done)
+	}
+}
+
+type showMroute struct {
+	Table     string `format:"%-12s" align:"left"`
+	Source    string `format:"%-16s" align:"left"`
+	Group     string `format:"%-16s" align:"left"`
+	Iif       string `format:"%-20s" align:"left"`
+	Oifs      string `format:"%-30s" align:"left"`
+	Packets   uint64 `format:"%16d"`
+	Bytes     uint64 `format:"%16d"`
+	RpfDrops  uint64 `format:"%12d"`
+	QueueDrop uint64 `format:"%12d"`
+}
+
+// show ip mfib [table NAME]
+func (m *Main) showMfib(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var table string
+	for !in.End() {
+		switch {
+		case in.Parse("t%*able %s", &table):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+
+	m.mfibMu.Lock()
+	ks := make([]mfibKey, 0, len(m.mroutes))
+	for k := range m.mroutes {
+		if table == "" || m.FibNameForIndex(k.fi) == table {
+			ks = append(ks, k)
+		}
+	}
+	sort.Slice(ks, func(i, j int) bool {
+		a, b := &ks[i], &ks[j]
+		if a.fi != b.fi {
+			return a.fi < b.fi
+		}
+		if d := a.grp.Diff(&b.grp); d != 0 {
+			return d < 0
+		}
+		return a.src.Diff(&b.src) < 0
+	})
+	xs := make([]showMroute, 0, len(ks))
+	for _, k := range ks {
+		e := m.mroutes[k]
+		r := e.getRoute()
+		forwarded := mfibCounter(&e.forwarded)
+		x := showMroute{
+			Table:     m.FibNameForIndex(k.fi),
+			Source:    "*",
+			Group:     k.grp.String(),
+			Iif:       "any",
+			Packets:   forwarded.Packets,
+			Bytes:     forwarded.Bytes,
+			RpfDrops:  mfibCounter(&e.rpfDrops).Packets,
+			QueueDrop: mfibCounter(&e.queueDrops).Packets,
+		}
+		if !k.src.IsZero() {
+			x.Source = k.src.String()
+		}
+		if r.rpf != vnet.SiNil {
+			x.Iif = vnet.SiName{V: v, Si: r.rpf}.String()
+		}
+		var oifs []string
+		for i := range r.oil {
+			oifs = append(oifs, vnet.SiName{V: v, Si: r.oil[i].si}.String())
+		}
+		x.Oifs = strings.Join(oifs, ",")
+		xs = append(xs, x)
+	}
+	m.mfibMu.Unlock()
+
+	if len(xs) == 0 {
+		fmt.Fprintln(w, "No multicast routes")
+		return
+	}
+	elib.Tabulate(xs).Write(w)
+	return
+}
+
+func (m *Main) clearMfib(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.mfibMu.Lock()
+	for _, e := range m.mroutes {
+		mfibClear(&e.forwarded)
+		mfibClear(&e.rpfDrops)
+		mfibClear(&e.queueDrops)
+	}
+	m.mfibMu.Unlock()
+	return
+}
+
+// ip mroute add|del [table NAME] [source ADDR] group ADDR [iif INTERFACE] [oif INTERFACE]...
+func (m *Main) mrouteAddDel(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		isDel      bool
+		table      string
+		src, grp   Address
+		grpValid   bool
+		si         vnet.Si
+		oifs       []vnet.Si
+		fi         ip.FibIndex
+		tableValid bool
+	)
+	v := m.Vnet
+	rpf := vnet.SiNil
+	switch {
+	case in.Parse("add"):
+	case in.Parse("del"):
+		isDel = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("t%*able %s", &table):
+			tableValid = true
+		case in.Parse("s%*ource %v", &src):
+		case in.Parse("g%*roup %v", &grp):
+			grpValid = true
+		case in.Parse("iif %v", &si, v):
+			rpf = si
+		case in.Parse("oif %v", &si, v):
+			oifs = append(oifs, si)
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if !grpValid {
+		err = fmt.Errorf("group not specified")
+		return
+	}
+	if tableValid {
+		var ok bool
+		if fi, ok = m.FibIndexForName(table); !ok {
+			err = fmt.Errorf("%s: unknown table", table)
+			return
+		}
+	}
+	err = m.AddDelMroute(fi, src, grp, rpf, oifs, isDel)
+	return
+}
+
+func (m *Main) mfibInit(v *vnet.Vnet) {
+	n := &m.mfibReplicateNode
+	n.m = m
+	m.mfibPending = make(chan mfibPending, mfibMaxPending)
+	// Nexts to interface output nodes are added with rewrites.
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "ip4-mfib-replicate")
+	v.RegisterSwIfAddDelHook(m.mfibSwIfAddDel)
+
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "ip mroute",
+			ShortHelp: "add/delete ip4 multicast route: ip mroute add|del [table NAME] [source ADDR] group ADDR [iif INTERFACE] [oif INTERFACE]...",
+			Action:    m.mrouteAddDel,
+		},
+		cli.Command{
+			Name:      "show ip mfib",
+			ShortHelp: "show ip4 multicast forwarding table",
+			Action:    m.showMfib,
+		},
+		cli.Command{
+			Name:      "clear ip mfib",
+			ShortHelp: "clear ip4 multicast forwarding counters",
+			Action:    m.clearMfib,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
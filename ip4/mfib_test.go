@@ -0,0 +1,162 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"net"
+	"testing"
+)
+
+func addr(s string) Address { return NetIPToV4Address(net.ParseIP(s)) }
+
+func TestMfibLookup(t *testing.T) {
+	m := newTestMain()
+	s, g := addr("10.0.0.1"), addr("239.1.1.1")
+	var any Address
+	if err := m.AddDelMroute(0, any, addr("10.1.1.1"), vnet.SiNil, nil, false); err == nil {
+		t.Error("added route for unicast group")
+	}
+	if err := m.AddDelMroute(0, any, g, 1, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddDelMroute(0, s, g, 2, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddDelMroute(1, any, g, 3, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if m.nMroute != 3 {
+		t.Errorf("%d routes, want 3", m.nMroute)
+	}
+
+	// (S,G) is preferred over (*,G); tables are separate.
+	tests := []struct {
+		fi  ip.FibIndex
+		src Address
+		rpf vnet.Si
+		ok  bool
+	}{
+		{fi: 0, src: s, rpf: 2, ok: true},
+		{fi: 0, src: addr("10.0.0.2"), rpf: 1, ok: true},
+		{fi: 1, src: s, rpf: 3, ok: true},
+		{fi: 2, src: s, ok: false},
+	}
+	for _, x := range tests {
+		e, ok := m.mfibLookup(x.fi, &x.src, &g)
+		if ok != x.ok || (ok && e.getRoute().rpf != x.rpf) {
+			t.Errorf("fib %d src %s: got %v %+v, want %v rpf %d", x.fi, &x.src, ok, e, x.ok, x.rpf)
+		}
+	}
+	other := addr("239.1.1.2")
+	if _, ok := m.mfibLookup(0, &s, &other); ok {
+		t.Error("found route for other group")
+	}
+
+	// Replacing route keeps its counters.
+	e, _ := m.mfibLookup(0, &s, &g)
+	e.forwarded.Packets = 1
+	if err := m.AddDelMroute(0, s, g, 4, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := m.mfibLookup(0, &s, &g); f != e || f.getRoute().rpf != 4 || f.forwarded.Packets != 1 {
+		t.Errorf("replaced route %+v", f)
+	}
+	if m.nMroute != 3 {
+		t.Errorf("%d routes after replace, want 3", m.nMroute)
+	}
+
+	// Deleting (S,G) falls back to (*,G).
+	if err := m.AddDelMroute(0, s, g, vnet.SiNil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if e.getRoute() != nil {
+		t.Error("deleted route not marked deleted")
+	}
+	if f, ok := m.mfibLookup(0, &s, &g); !ok || f.getRoute().rpf != 1 {
+		t.Errorf("got %v %+v, want (*,G) route", ok, f)
+	}
+	if err := m.AddDelMroute(0, s, g, vnet.SiNil, nil, true); err != ErrMrouteNotFound {
+		t.Errorf("delete of unknown route: got %v, want %v", err, ErrMrouteNotFound)
+	}
+	if m.nMroute != 2 {
+		t.Errorf("%d routes after delete, want 2", m.nMroute)
+	}
+}
+
+func TestMfibSwIfDel(t *testing.T) {
+	m := newTestMain()
+	g := addr("239.1.1.1")
+	var any Address
+	m.AddDelMroute(0, any, g, 1, nil, false)
+	m.AddDelMroute(1, any, g, 2, nil, false)
+	e, _ := m.mfibLookup(1, &any, &g)
+	e.setRoute(&mfibRoute{rpf: 2, oil: []mfibOif{{si: 1}, {si: 3}}})
+
+	// Routes with deleted interface as reverse path interface are deleted; others lose it as
+	// outgoing interface.
+	m.mfibSwIfAddDel(m.Vnet, 1, true)
+	if _, ok := m.mfibLookup(0, &any, &g); ok {
+		t.Error("route with deleted reverse path interface remains")
+	}
+	if f, ok := m.mfibLookup(1, &any, &g); !ok || len(f.getRoute().oil) != 1 || f.getRoute().oil[0].si != 3 {
+		t.Errorf("got %v %+v, want route with outgoing interface 3", ok, f)
+	}
+	if m.nMroute != 1 {
+		t.Errorf("%d routes, want 1", m.nMroute)
+	}
+}
+
+func TestMulticastAddress(t *testing.T) {
+	g := addr("239.129.2.3")
+	if !g.IsMulticast() || g.isLinkLocalMulticast() {
+		t.Errorf("%s: multicast %v link local %v", &g, g.IsMulticast(), g.isLinkLocalMulticast())
+	}
+	if l := addr("224.0.0.13"); !l.isLinkLocalMulticast() {
+		t.Errorf("%s not link local", &l)
+	}
+	if u := addr("10.0.0.1"); u.IsMulticast() {
+		t.Errorf("%s is multicast", &u)
+	}
+	// Upper bit of second byte is not mapped.
+	want := []byte{0x01, 0x00, 0x5e, 0x01, 0x02, 0x03}
+	if e := g.multicastEthernetAddress(); string(e) != string(want) {
+		t.Errorf("ethernet address %x, want %x", e, want)
+	}
+}
+
+// Data path lookups run while routes are changed.
+func TestMfibLookupConcurrent(t *testing.T) {
+	m := newTestMain()
+	s, g := addr("10.0.0.1"), addr("239.1.1.1")
+	var any Address
+	m.AddDelMroute(0, any, g, 1, nil, false)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.AddDelMroute(0, s, g, 2, nil, false)
+			m.AddDelMroute(0, any, g, vnet.Si(1+i%2), nil, false)
+			m.AddDelMroute(0, s, g, vnet.SiNil, nil, true)
+		}
+	}()
+	for stop := false; !stop; {
+		select {
+		case <-done:
+			stop = true
+		default:
+		}
+		e, ok := m.mfibLookup(m.FibIndexForSi(100), &s, &g)
+		if !ok {
+			t.Fatal("no route")
+		}
+		if r := e.getRoute(); r != nil && r.rpf != 1 && r.rpf != 2 {
+			t.Fatalf("rpf %d", r.rpf)
+		}
+		mfibCount(&e.forwarded, 100)
+	}
+}
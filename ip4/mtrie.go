@@ -6,6 +6,8 @@ package ip4
 
 import (
 	"github.com/platinasystems/vnet/ip"
+
+	"net"
 )
 
 type leaf uint32
@@ -106,23 +108,31 @@ func (m *mtrie) freePly(p *ply) {
 
 func (m *mtrie) Free() { m.freePly(&m.plys[0]) }
 
-func (m *mtrie) lookup(dst *Address) (a ip.Adj) {
-	a = ip.AdjMiss
+// Lookup terminal leaf for address and prefix length of its route.
+func (m *mtrie) lookupLeaf(dst *Address) (l leaf, n uint8) {
+	l = m.defaultLeaf
 	if len(m.plys) == 0 {
 		return
 	}
 	p := &m.plys[0]
 	for i := range dst {
-		l := p.leaves[dst[i]]
-		if l.isTerminal() {
-			a = l.ResultIndex()
+		x := p.leaves[dst[i]]
+		if x.isTerminal() {
+			if x != emptyLeaf {
+				l, n = x, p.lens[dst[i]]
+			}
 			return
 		}
-		p = m.plyForLeaf(l)
+		p = m.plyForLeaf(x)
 	}
 	panic("no terminal leaf found")
 }
 
+func (m *mtrie) lookup(dst *Address) (a ip.Adj) {
+	l, _ := m.lookupLeaf(dst)
+	return l.ResultIndex()
+}
+
 func (m *mtrie) setPlyWithMoreSpecificLeaf(p *ply, l leaf, n uint8) {
 	for i, pl := range p.leaves {
 		if !pl.isTerminal() {
@@ -130,7 +140,7 @@ func (m *mtrie) setPlyWithMoreSpecificLeaf(p *ply, l leaf, n uint8) {
 		} else if n >= p.lens[i] {
 			p.leaves[i] = l
 			p.lens[i] = n
-			if pl != emptyLeaf {
+			if pl == emptyLeaf {
 				p.nNonEmpty++
 			}
 		}
@@ -139,8 +149,11 @@ func (m *mtrie) setPlyWithMoreSpecificLeaf(p *ply, l leaf, n uint8) {
 
 func (p *ply) replaceLeaf(new, old leaf, i uint8) {
 	p.leaves[i] = new
-	if old != emptyLeaf {
+	switch {
+	case old == emptyLeaf && new != emptyLeaf:
 		p.nNonEmpty++
+	case old != emptyLeaf && new == emptyLeaf:
+		p.nNonEmpty--
 	}
 }
 
@@ -148,6 +161,9 @@ type addDelLeaf struct {
 	key    Address
 	keyLen uint8
 	result ip.Adj
+	// Longest less specific route replacing deleted leaves.
+	cover    leaf
+	coverLen uint8
 }
 
 func (s *addDelLeaf) setLeafHelper(m *mtrie, oldPlyIndex, keyByteIndex uint) {
@@ -158,7 +174,8 @@ func (s *addDelLeaf) setLeafHelper(m *mtrie, oldPlyIndex, keyByteIndex uint) {
 	// Number of bits next plies <= 0 => insert leaves this ply.
 	if nBits <= 0 {
 		nBits = -nBits
-		for i := k; i < k+1<<uint(nBits); i++ {
+		for j := 0; j < 1<<uint(nBits); j++ {
+			i := k + uint8(j)
 			oldLeaf := oldPly.leaves[i]
 			oldTerm := oldLeaf.isTerminal()
 
@@ -201,40 +218,58 @@ func (s *addDelLeaf) setLeafHelper(m *mtrie, oldPlyIndex, keyByteIndex uint) {
 	}
 }
 
-func (s *addDelLeaf) unsetLeafHelper(m *mtrie, oldPlyIndex, keyByteIndex uint) (oldPlyWasDeleted bool) {
+func (s *addDelLeaf) unsetLeafHelper(m *mtrie, oldPlyIndex, keyByteIndex uint) {
 	k := s.key[keyByteIndex]
 	nBits := int(s.keyLen) - 8*int(keyByteIndex+1)
-	if nBits <= 0 {
-		nBits = -nBits
-		k &^= 1<<uint(nBits) - 1
-		if nBits > 8 {
-			nBits = 8
+	oldPly := &m.plys[oldPlyIndex]
+	if nBits > 0 {
+		// Prefix continues in next ply.
+		if l := oldPly.leaves[k]; l.isPly() {
+			s.unsetLeafHelper(m, l.plyIndex(), keyByteIndex+1)
+			m.collapsePly(oldPly, k)
+		}
+	} else {
+		for j := 0; j < 1<<uint(-nBits); j++ {
+			s.unsetLeaf(m, oldPly, k+uint8(j))
 		}
 	}
-	delLeaf := setResult(s.result)
-	oldPly := &m.plys[oldPlyIndex]
-	for i := k; i < k+1<<uint(nBits); i++ {
-		oldLeaf := oldPly.leaves[i]
-		oldTerm := oldLeaf.isTerminal()
-		if oldLeaf == delLeaf ||
-			(!oldTerm && s.unsetLeafHelper(m, oldLeaf.plyIndex(), keyByteIndex+1)) {
-			oldPly.leaves[i] = emptyLeaf
-			oldPly.lens[i] = 0
-			oldPly.nNonEmpty--
-			oldPlyWasDeleted = oldPly.nNonEmpty == 0 && keyByteIndex > 0
-			if oldPlyWasDeleted {
-				m.plyPool.PutIndex(oldPly.poolIndex)
-				// Nothing more to do.
-				break
-			}
+}
+
+// Replace leaf set by deleted prefix with cover; leaves of more specific plys are painted with prefix.
+func (s *addDelLeaf) unsetLeaf(m *mtrie, p *ply, i uint8) {
+	l := p.leaves[i]
+	if l.isPly() {
+		q := m.plyForLeaf(l)
+		for j := range q.leaves {
+			s.unsetLeaf(m, q, uint8(j))
 		}
+		m.collapsePly(p, i)
+	} else if l == setResult(s.result) && p.lens[i] == s.keyLen {
+		p.lens[i] = s.coverLen
+		p.replaceLeaf(s.cover, l, i)
 	}
+}
 
-	return
+// Free ply pointed to by leaf i of p when all of its leaves are the same terminal leaf
+// and replace it with that leaf.
+func (m *mtrie) collapsePly(p *ply, i uint8) {
+	q := m.plyForLeaf(p.leaves[i])
+	l, n := q.leaves[0], q.lens[0]
+	if !l.isTerminal() {
+		return
+	}
+	for j := range q.leaves {
+		if q.leaves[j] != l || q.lens[j] != n {
+			return
+		}
+	}
+	m.plyPool.PutIndex(q.poolIndex)
+	p.lens[i] = n
+	p.replaceLeaf(l, p.leaves[i], i)
 }
 
-func (s *addDelLeaf) set(m *mtrie)        { s.setLeafHelper(m, rootPlyIndex, 0) }
-func (s *addDelLeaf) unset(m *mtrie) bool { return s.unsetLeafHelper(m, rootPlyIndex, 0) }
+func (s *addDelLeaf) set(m *mtrie)   { s.setLeafHelper(m, rootPlyIndex, 0) }
+func (s *addDelLeaf) unset(m *mtrie) { s.unsetLeafHelper(m, rootPlyIndex, 0) }
 
 func (l *leaf) remap(from, to ip.Adj) (remapEmpty int) {
 	if l.isTerminal() {
@@ -277,5 +312,46 @@ func (m *mtrie) init() {
 
 func (m *mtrie) reset() {
 	m.plyPool.Reset()
+	m.plys = m.plys[:0]
 	m.defaultLeaf = emptyLeaf
 }
+
+// Add or delete route installed in fib.  Deleted leaves are replaced with longest less
+// specific installed route.
+func (f *Fib) mtrieAddDel(p *net.IPNet, adj ip.Adj, isDel bool) {
+	t := &f.mtrie
+	if len(t.plys) == 0 {
+		t.init()
+	}
+	l, _ := p.Mask.Size()
+	a := NetIPToV4Address(p.IP)
+	if l == 0 {
+		t.defaultLeaf = setResult(adj)
+		if isDel {
+			t.defaultLeaf = emptyLeaf
+		}
+		return
+	}
+	s := addDelLeaf{key: a.Mask(uint(l)), keyLen: uint8(l), result: adj}
+	if !isDel {
+		s.set(t)
+		return
+	}
+	s.cover = emptyLeaf
+	for cl := l - 1; cl > 0; cl-- {
+		mask := net.CIDRMask(cl, 32)
+		c := net.IPNet{IP: a.ToNetIP().Mask(mask), Mask: mask}
+		if r, ok := f.GetInstalled(&c); ok {
+			s.cover, s.coverLen = setResult(r.Adj), uint8(cl)
+			break
+		}
+	}
+	s.unset(t)
+}
+
+// Lookup adjacency and prefix length of installed route with longest prefix matching address.
+func (f *Fib) lookupAdj(a *Address) (adj ip.Adj, l uint8) {
+	x, l := f.mtrie.lookupLeaf(a)
+	adj = x.ResultIndex()
+	return
+}
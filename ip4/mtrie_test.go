@@ -0,0 +1,173 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet/ip"
+
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// Mtrie with reference table of routes to check lookups against.
+type mtrieTest struct {
+	t      *testing.T
+	m      mtrie
+	routes map[string]ip.Adj
+}
+
+func newMtrieTest(t *testing.T) *mtrieTest {
+	x := &mtrieTest{t: t, routes: make(map[string]ip.Adj)}
+	x.m.init()
+	return x
+}
+
+func parsePrefix(t *testing.T, prefix string) *net.IPNet {
+	_, p, err := net.ParseCIDR(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// Longest route in reference table matching address with prefix length less than max.
+func (x *mtrieTest) longest(a net.IP, max int) (adj ip.Adj, l int) {
+	adj, l = ip.AdjMiss, -1
+	for s, r := range x.routes {
+		p := parsePrefix(x.t, s)
+		if n, _ := p.Mask.Size(); n < max && n > l && p.Contains(a) {
+			adj, l = r, n
+		}
+	}
+	return
+}
+
+func (x *mtrieTest) addDel(prefix string, adj ip.Adj, isDel bool) {
+	p := parsePrefix(x.t, prefix)
+	l, _ := p.Mask.Size()
+	s := addDelLeaf{key: NetIPToV4Address(p.IP), keyLen: uint8(l), result: adj}
+	if !isDel {
+		s.set(&x.m)
+		x.routes[p.String()] = adj
+		return
+	}
+	s.cover = emptyLeaf
+	if c, cl := x.longest(p.IP, l); cl > 0 {
+		s.cover, s.coverLen = setResult(c), uint8(cl)
+	}
+	s.unset(&x.m)
+	delete(x.routes, p.String())
+}
+
+func (x *mtrieTest) check(addr string) {
+	a := net.ParseIP(addr)
+	wantAdj, wantLen := x.longest(a, 33)
+	if wantLen < 0 {
+		wantLen = 0
+	}
+	k := NetIPToV4Address(a)
+	l, n := x.m.lookupLeaf(&k)
+	if adj := l.ResultIndex(); adj != wantAdj || int(n) != wantLen {
+		x.t.Errorf("%s: adj %d len %d, want adj %d len %d", addr, adj, n, wantAdj, wantLen)
+	}
+}
+
+// Number of plys in use beside root ply.
+func (x *mtrieTest) nPlys() uint { return x.m.plyPool.Elts() - 1 }
+
+func TestMtrieAddDel(t *testing.T) {
+	x := newMtrieTest(t)
+	x.addDel("10.1.2.0/24", 1, false)
+	x.check("10.1.2.3")
+	x.check("10.1.3.1")
+	x.addDel("10.1.2.0/24", 1, true)
+	x.check("10.1.2.3")
+	if n := x.nPlys(); n != 0 {
+		t.Errorf("%d plys after delete", n)
+	}
+}
+
+var mtrieOverlapping = []struct {
+	prefix string
+	adj    ip.Adj
+}{
+	{"10.0.0.0/8", 1},
+	{"10.1.0.0/16", 2},
+	{"10.1.2.0/24", 3},
+	{"10.1.2.128/25", 4},
+	{"10.1.2.7/32", 5},
+	{"10.1.2.0/23", 6},
+}
+
+var mtrieAddrs = []string{
+	"10.1.2.3", "10.1.2.7", "10.1.2.200", "10.1.3.1", "10.1.4.1", "10.2.0.1", "11.0.0.1",
+}
+
+func (x *mtrieTest) checkAll() {
+	for _, a := range mtrieAddrs {
+		x.check(a)
+	}
+}
+
+func TestMtrieOverlapping(t *testing.T) {
+	// Less specific first, then more specific first.
+	for _, reverse := range []bool{false, true} {
+		x := newMtrieTest(t)
+		for i := range mtrieOverlapping {
+			if reverse {
+				i = len(mtrieOverlapping) - 1 - i
+			}
+			r := &mtrieOverlapping[i]
+			x.addDel(r.prefix, r.adj, false)
+			x.checkAll()
+		}
+	}
+}
+
+// Deleting a covering prefix restores the less specific route in its place.
+func TestMtrieDeleteCover(t *testing.T) {
+	x := newMtrieTest(t)
+	for _, r := range mtrieOverlapping {
+		x.addDel(r.prefix, r.adj, false)
+	}
+	for _, i := range []int{1, 5, 2, 0, 3, 4} {
+		r := &mtrieOverlapping[i]
+		x.addDel(r.prefix, r.adj, true)
+		x.checkAll()
+	}
+	if n := x.nPlys(); n != 0 {
+		t.Errorf("%d plys after deleting all routes", n)
+	}
+}
+
+func TestMtrieRandom(t *testing.T) {
+	x := newMtrieTest(t)
+	r := rand.New(rand.NewSource(1))
+	addr := func() net.IP { return net.IPv4(10, byte(r.Intn(4)), byte(r.Intn(4)), byte(r.Intn(256))) }
+	for i := 0; i < 2000; i++ {
+		l := 8 + r.Intn(25)
+		p := net.IPNet{IP: addr().Mask(net.CIDRMask(l, 32)), Mask: net.CIDRMask(l, 32)}
+		s := p.String()
+		if adj, ok := x.routes[s]; ok {
+			x.addDel(s, adj, true)
+		} else {
+			x.addDel(s, ip.Adj(1+r.Intn(8)), false)
+		}
+		for j := 0; j < 8; j++ {
+			x.check(addr().String())
+		}
+		if t.Failed() {
+			t.Fatalf("after %d route changes", i+1)
+		}
+	}
+	for s, adj := range x.routes {
+		x.addDel(s, adj, true)
+	}
+	x.check("10.0.0.1")
+	if n := x.nPlys(); n != 0 {
+		t.Errorf("%d plys after deleting all routes", n)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+	"net"
+)
+
+type nextHopKey struct {
+	si vnet.Si
+	a  Address
+}
+
+type nextHopMain struct {
+	// Next hops marked down by liveness detection (e.g. bfd).
+	nextHopsDown map[nextHopKey]struct{}
+}
+
+func (m *Main) isNextHopDown(si vnet.Si, a net.IP) (down bool) {
+	if len(m.nextHopsDown) > 0 {
+		_, down = m.nextHopsDown[nextHopKey{si: si, a: NetIPToV4Address(a)}]
+	}
+	return
+}
+
+// IsNextHopDown returns true when next hop has been marked down by SetNextHopDown.
+func (m *Main) IsNextHopDown(si vnet.Si, a net.IP) bool { return m.isNextHopDown(si, a) }
+
+// SetNextHopDown withdraws next hop with given interface and address from multipath adjacencies
+// of all via routes using it or, with isDown false, restores it.  Routes keep the next hop so
+// that it is restored when it comes back up; while down it is not used even if its neighbor
+// is resolved or new routes via it are added.
+func (m *Main) SetNextHopDown(si vnet.Si, a net.IP, isDown bool) (err error) {
+	if a.To4() == nil {
+		return fmt.Errorf("%s: not an ip4 address", a)
+	}
+	k := nextHopKey{si: si, a: NetIPToV4Address(a)}
+	if _, ok := m.nextHopsDown[k]; ok == isDown {
+		return
+	}
+	if isDown {
+		if m.nextHopsDown == nil {
+			m.nextHopsDown = make(map[nextHopKey]struct{})
+		}
+		m.nextHopsDown[k] = struct{}{}
+	} else {
+		delete(m.nextHopsDown, k)
+	}
+
+	nhAdj := ip.AdjMiss
+	if !isDown {
+		nhp := net.IPNet{IP: a.To4(), Mask: net.IPv4Mask(255, 255, 255, 255)}
+		nhf := m.fibByIndex(m.FibIndexForSi(si), true)
+		if adj, _, found := nhf.GetReachable(&nhp, si); found {
+			nhAdj = adj
+		}
+	}
+	nhr := &NextHop{Address: a, Si: si}
+	for _, f := range m.fibs {
+		if f == nil {
+			continue
+		}
+		// Collect prefixes first since routes are modified as next hop is added or deleted.
+		var ps []net.IPNet
+		seen := make(map[string]bool)
+		f.routeFib.foreach(func(p net.IPNet, r FibResult) {
+			for _, nh := range r.Nhs {
+				if nh.Si == si && nh.Address.Equal(a) && !seen[p.String()] {
+					seen[p.String()] = true
+					ps = append(ps, p)
+				}
+			}
+		})
+		for i := range ps {
+			if e := f.addDelRouteNextHopSi(m, &ps[i], si, a, nhr, nhAdj, isDown); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return
+}
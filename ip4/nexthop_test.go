@@ -0,0 +1,49 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"net"
+	"testing"
+)
+
+func testNextHops(a net.IP) FibResultVec {
+	nhs := ip.NextHopVec{
+		{Address: a, Si: 1},
+		{Address: a, Si: 2},
+		{Address: net.ParseIP("10.0.0.3"), Si: 1},
+	}
+	for i := range nhs {
+		nhs[i].Adj = 5
+	}
+	return FibResultVec{{Nhs: nhs}}
+}
+
+func TestForeachMatchingNh(t *testing.T) {
+	a := net.ParseIP("10.0.0.2")
+	tests := []struct {
+		si   vnet.Si
+		want []ip.Adj
+	}{
+		// Any interface as for neighbor and reachability changes.
+		{si: vnet.SiNil, want: []ip.Adj{ip.AdjMiss, ip.AdjMiss, 5}},
+		// Next hops with same address on other interfaces are not matched.
+		{si: 1, want: []ip.Adj{ip.AdjMiss, 5, 5}},
+	}
+	for _, x := range tests {
+		rs := testNextHops(a)
+		rs.foreachMatchingNh(x.si, a, func(r *FibResult, nh *ip.NextHop) {
+			nh.Adj = ip.AdjMiss
+		})
+		for i, want := range x.want {
+			if got := rs[0].Nhs[i].Adj; got != want {
+				t.Errorf("si %d: next hop %d adj %v, want %v", x.si, i, got, want)
+			}
+		}
+	}
+}
@@ -13,18 +13,42 @@ func GetHeader(r *vnet.Ref) *Header { return (*Header)(r.Data()) }
 type nodeMain struct {
 	inputNode              inputNode
 	inputValidChecksumNode inputValidChecksumNode
-	rewriteNode            inputNode
-	arpNode                inputNode
+	// Continues ip4 input for packets which have passed input features.
+	postFeaturesNode inputNode
+	rewriteNode      inputNode
+	arpNode          inputNode
+	// Features applied to packets received on software interfaces before ip4 input.
+	// Packets start with ip4 header.
+	InputFeatures vnet.FeatureArc
 }
 
 func (m *Main) nodeInit(v *vnet.Vnet) {
+	m.inputNode.m = m
 	m.inputNode.Next = []string{
 		input_next_drop: "error",
 		input_next_punt: "punt",
 	}
+	m.inputNode.Errors = []string{
+		input_error_urpf:            "reverse path check failed",
+		input_error_mfib_rpf:        "multicast reverse path check failed",
+		input_error_ttl_expired:     "ttl expired",
+		input_error_mfib_queue_full: "multicast replication queue full",
+	}
 	v.RegisterInOutNode(&m.inputNode, "ip4-input")
+	m.inputValidChecksumNode.m = m
 	m.inputValidChecksumNode.Next = m.inputNode.Next
+	m.inputValidChecksumNode.Errors = m.inputNode.Errors
 	v.RegisterInOutNode(&m.inputValidChecksumNode, "ip4-input-valid-checksum")
+	m.postFeaturesNode.m = m
+	m.postFeaturesNode.postFeatures = true
+	m.postFeaturesNode.Next = m.inputNode.Next
+	m.postFeaturesNode.Errors = m.inputNode.Errors
+	v.RegisterInOutNode(&m.postFeaturesNode, "ip4-input-post-features")
+	m.InputFeatures.Init(v, "ip4-input", "ip4-input-post-features")
+	m.InputFeatures.AddStart(&m.inputNode)
+	m.InputFeatures.AddStart(&m.inputValidChecksumNode)
+	// Not a start node but added so that all input nodes share next indices.
+	m.InputFeatures.AddStart(&m.postFeaturesNode)
 	v.RegisterInOutNode(&m.arpNode, "ip4-arp")
 	v.RegisterInOutNode(&m.rewriteNode, "ip4-rewrite")
 }
@@ -34,14 +58,71 @@ const (
 	input_next_punt
 )
 
-type inputNode struct{ vnet.InOutNode }
+const (
+	input_error_urpf = iota
+	input_error_mfib_rpf
+	input_error_ttl_expired
+	input_error_mfib_queue_full
+)
+
+type inputNode struct {
+	vnet.InOutNode
+	// Set for ip4-input to enable input features, reverse path checks, local udp dispatch
+	// and multicast forwarding.
+	m *Main
+	// Input features have been applied.
+	postFeatures bool
+}
 
 func (node *inputNode) NodeInput(in *vnet.RefIn, out *vnet.RefOut) {
+	if m := node.m; m != nil && (m.inputEnabled() || !node.postFeatures && m.InputFeatures.Active()) {
+		m.input(&node.InOutNode, in, out, !node.postFeatures)
+		return
+	}
 	node.Redirect(in, out, input_next_punt)
 }
 
-type inputValidChecksumNode struct{ vnet.InOutNode }
+type inputValidChecksumNode struct {
+	vnet.InOutNode
+	m *Main
+}
 
 func (node *inputValidChecksumNode) NodeInput(in *vnet.RefIn, out *vnet.RefOut) {
+	if m := node.m; m.inputEnabled() || m.InputFeatures.Active() {
+		m.input(&node.InOutNode, in, out, true)
+		return
+	}
 	node.Redirect(in, out, input_next_punt)
 }
+
+func (m *Main) inputEnabled() bool {
+	return m.nUrpf > 0 || m.mfibActive() || len(m.udpLocalNexts) > 0
+}
+
+// Send packets to input features, check packets, dispatch local udp and forward multicast;
+// all others are punted as before.
+func (m *Main) input(n *vnet.InOutNode, in *vnet.RefIn, o *vnet.RefOut, features bool) {
+	q := n.GetEnqueue(in)
+	t := in.ThreadId()
+	i, n_left := in.Range()
+	for n_left >= 1 {
+		r0 := in.Get1(i)
+		x0 := uint(input_next_punt)
+		queued := false
+		if x, ok := m.InputFeatures.First(r0.Si); features && ok {
+			x0 = x
+		} else if !m.urpfAccept(r0) {
+			x0 = input_next_drop
+			m.urpfDrop(n, t, r0)
+		} else if x, ok := m.udpLocalNext(r0.Si, r0.DataSlice()); ok {
+			x0 = x
+		} else if m.mfibActive() {
+			x0, queued = m.mfibInput(n, in.BufferPool, r0)
+		}
+		if !queued {
+			q.Put1(r0, x0)
+		}
+		n_left -= 1
+		i += 1
+	}
+}
@@ -45,6 +45,10 @@ type Main struct {
 	fibMain
 	nodeMain
 	pgMain
+	urpfMain
+	mfibMain
+	udpLocalMain
+	nextHopMain
 	ifAddrAddDelHooks IfAddrAddDelHookVec
 	FibShowUsageHooks fibShowUsageHookVec
 }
@@ -94,6 +98,8 @@ func (m *Main) Init() (err error) {
 	m.nodeInit(v)
 	m.pgInit(v)
 	m.cliInit(v)
+	m.urpfInit(v)
+	m.mfibInit(v)
 	RegisterLayer(v, ip.IP_IN_IP, m)
 	ethernet.RegisterLayer(v, ethernet.TYPE_IP4, m)
 	return
@@ -33,6 +33,15 @@ func (m *pgMain) initProtocolMap() {
 	}
 	m.protocolMap = make(map[ip.Protocol]pg.StreamType)
 	m.protocolMap[ip.ICMP] = pg.GetStreamType(m.v, "icmp4")
+	for p, name := range map[ip.Protocol]string{
+		ip.IP_IN_IP:  "ip4",
+		ip.IP6_IN_IP: "ip6",
+		ip.GRE:       "gre",
+	} {
+		if t := pg.GetStreamType(m.v, name); t != nil {
+			m.protocolMap[p] = t
+		}
+	}
 }
 
 func (m *pgMain) Name() string { return "ip4" }
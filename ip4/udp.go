@@ -0,0 +1,65 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+)
+
+type udpLocalMain struct {
+	// Next of ip4 input nodes indexed by udp destination port of packets for local addresses.
+	udpLocalNexts map[uint16]uint
+}
+
+// RegisterUdpLocalPort sends udp packets with given destination port addressed to a local or
+// broadcast address to named node instead of punting them.  Must be called at init time.
+func (m *Main) RegisterUdpLocalPort(port uint16, nodeName string) {
+	if _, ok := m.udpLocalNexts[port]; ok {
+		panic(fmt.Errorf("ip4 udp local port %d already registered", port))
+	}
+	v := m.Vnet
+	x := v.AddNamedNext(&m.inputNode, nodeName)
+	// All input nodes share nexts.
+	if y := v.AddNamedNext(&m.inputValidChecksumNode, nodeName); y != x {
+		panic(fmt.Errorf("ip4 udp local port %d: next %d != %d", port, x, y))
+	}
+	if y := v.AddNamedNext(&m.postFeaturesNode, nodeName); y != x {
+		panic(fmt.Errorf("ip4 udp local port %d: next %d != %d", port, x, y))
+	}
+	if m.udpLocalNexts == nil {
+		m.udpLocalNexts = make(map[uint16]uint)
+	}
+	m.udpLocalNexts[port] = x
+}
+
+// Next for packet received on given interface if it is for a registered local udp port.
+func (m *Main) udpLocalNext(si vnet.Si, b []byte) (x uint, ok bool) {
+	if len(b) < SizeofHeader || ip.Protocol(b[9]) != ip.UDP {
+		return
+	}
+	// Only first fragment has udp header.
+	if b[6]&0x1f != 0 || b[7] != 0 {
+		return
+	}
+	l := int(b[0]&0xf) * 4
+	if l < SizeofHeader || len(b) < l+4 {
+		return
+	}
+	if x, ok = m.udpLocalNexts[uint16(b[l+2])<<8|uint16(b[l+3])]; !ok {
+		return
+	}
+	var dst Address
+	copy(dst[:], b[16:20])
+	// Limited broadcast is local to receiving interface.
+	if dst == (Address{0xff, 0xff, 0xff, 0xff}) {
+		return
+	}
+	adj, _ := m.fibBySi(si).lookupAdj(&dst)
+	ok = adj.IsLocal(&m.Main)
+	return
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet/ip"
+
+	"net"
+	"testing"
+)
+
+func udpPacket(dst string, port uint16) []byte {
+	b := make([]byte, SizeofHeader+8)
+	b[0] = 0x45
+	b[9] = byte(ip.UDP)
+	d := addr(dst)
+	copy(b[16:20], d[:])
+	b[SizeofHeader+2] = byte(port >> 8)
+	b[SizeofHeader+3] = byte(port)
+	return b
+}
+
+func TestUdpLocalNext(t *testing.T) {
+	m := newTestMain()
+	ai, as := m.NewAdj(1)
+	as[0].LookupNextIndex = ip.LookupNextLocal
+	as[0].Si = 1
+	_, p, _ := net.ParseCIDR("10.0.0.1/32")
+	m.fibByIndex(0, true).mtrieAddDel(p, ai, false)
+	m.testAddNeighbor(t, "10.0.0.0/24", 1)
+	m.udpLocalNexts = map[uint16]uint{67: 5}
+
+	frag := udpPacket("10.0.0.1", 67)
+	frag[7] = 1
+	short := udpPacket("10.0.0.1", 67)[:SizeofHeader+2]
+	tcp := udpPacket("10.0.0.1", 67)
+	tcp[9] = byte(ip.TCP)
+	tests := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{name: "local", b: udpPacket("10.0.0.1", 67), ok: true},
+		{name: "broadcast", b: udpPacket("255.255.255.255", 67), ok: true},
+		{name: "unregistered port", b: udpPacket("10.0.0.1", 68)},
+		{name: "forwarded", b: udpPacket("10.0.0.2", 67)},
+		{name: "no route", b: udpPacket("20.0.0.1", 67)},
+		{name: "fragment", b: frag},
+		{name: "short", b: short},
+		{name: "tcp", b: tcp},
+	}
+	for _, x := range tests {
+		n, ok := m.udpLocalNext(1, x.b)
+		if ok != x.ok || (ok && n != 5) {
+			t.Errorf("%s: got %d %v, want ok %v", x.name, n, ok, x.ok)
+		}
+	}
+}
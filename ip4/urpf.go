@@ -0,0 +1,252 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+)
+
+// Unicast reverse path forwarding check mode.
+type UrpfMode uint8
+
+const (
+	UrpfOff UrpfMode = iota
+	// Source address must be reachable via receiving interface.
+	UrpfStrict
+	// Source address must be reachable via any interface.
+	UrpfLoose
+)
+
+var urpfModeStrings = [...]string{
+	UrpfOff:    "off",
+	UrpfStrict: "strict",
+	UrpfLoose:  "loose",
+}
+
+func (x UrpfMode) String() string { return elib.Stringer(urpfModeStrings[:], int(x)) }
+
+func (x *UrpfMode) Parse(in *parse.Input) {
+	switch {
+	case in.Parse("strict"):
+		*x = UrpfStrict
+	case in.Parse("loose"):
+		*x = UrpfLoose
+	case in.Parse("off"):
+		*x = UrpfOff
+	default:
+		in.ParseError()
+	}
+}
+
+type urpfConfig struct {
+	mode UrpfMode
+	// Accept sources which only match default route.
+	allowDefault bool
+}
+
+type urpfMain struct {
+	// Configuration indexed by sw interface.
+	urpfs []urpfConfig
+	// Number of interfaces with checks enabled.
+	nUrpf uint
+	// Drops indexed by thread then sw interface.
+	urpfDrops vnet.CombinedCountersVec
+}
+
+// SetUrpf sets reverse path check mode for ip4 packets received on given sw interface.
+func (m *Main) SetUrpf(si vnet.Si, mode UrpfMode, allowDefault bool) {
+	if i := uint(si); i >= uint(len(m.urpfs)) {
+		if mode == UrpfOff {
+			return
+		}
+		m.urpfs = append(m.urpfs, make([]urpfConfig, 1+i-uint(len(m.urpfs)))...)
+	}
+	c := &m.urpfs[si]
+	if c.mode != UrpfOff {
+		m.nUrpf--
+	}
+	*c = urpfConfig{mode: mode, allowDefault: allowDefault}
+	if mode != UrpfOff {
+		m.nUrpf++
+	}
+}
+
+// Urpf returns reverse path check mode for given sw interface.
+func (m *Main) Urpf(si vnet.Si) (mode UrpfMode, allowDefault bool) {
+	if uint(si) < uint(len(m.urpfs)) {
+		c := &m.urpfs[si]
+		mode, allowDefault = c.mode, c.allowDefault
+	}
+	return
+}
+
+func (m *Main) urpfSwIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		m.SetUrpf(si, UrpfOff, false)
+		for t := range m.urpfDrops {
+			cs := &m.urpfDrops[t]
+			cs.Validate(uint(si))
+			cs.Clear(uint(si))
+		}
+	}
+	return
+}
+
+// Check that source address of packet received on given interface is reachable.
+func (m *Main) urpfCheck(si vnet.Si, c *urpfConfig, src *Address) (ok bool) {
+	// Unspecified source is used by dhcp clients without address.
+	if src.IsZero() {
+		return true
+	}
+	f := m.fibBySi(si)
+	adj, l := f.lookupAdj(src)
+	switch {
+	case adj == ip.AdjMiss || adj == ip.AdjDrop || adj == ip.AdjNil || m.IsAdjFree(adj):
+		return false
+	case l == 0 && !c.allowDefault:
+		return false
+	case c.mode == UrpfLoose:
+		return true
+	}
+	as := m.GetAdj(adj)
+	for i := range as {
+		a := &as[i]
+		if a.Si == si && (a.IsRewrite() || a.IsGlean() || a.IsLocal()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Main) urpfAccept(r *vnet.Ref) bool {
+	si := r.Si
+	if uint(si) >= uint(len(m.urpfs)) {
+		return true
+	}
+	c := &m.urpfs[si]
+	if c.mode == UrpfOff {
+		return true
+	}
+	b := r.DataSlice()
+	// Short packets are left for header validation.
+	if len(b) < SizeofHeader {
+		return true
+	}
+	var src Address
+	copy(src[:], b[12:16])
+	return m.urpfCheck(si, c, &src)
+}
+
+func (m *Main) urpfDrop(n *vnet.InOutNode, t uint, r0 *vnet.Ref) {
+	n.SetError(r0, input_error_urpf)
+	cs := m.urpfDrops.Validate(t)
+	cs.Validate(uint(r0.Si))
+	cs.Add(uint(r0.Si), 1, r0.DataLen())
+}
+
+// Drop counter for given interface summed over all threads.
+func (m *Main) urpfDropCount(si vnet.Si) (c vnet.CombinedCounter) {
+	for t := range m.urpfDrops {
+		cs := &m.urpfDrops[t]
+		cs.Validate(uint(si))
+		v := cs.Value(uint(si))
+		c.Packets += v.Packets
+		c.Bytes += v.Bytes
+	}
+	return
+}
+
+// set ip urpf INTERFACE strict|loose|off [allow-default]
+func (m *Main) setUrpf(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si           vnet.Si
+		mode         UrpfMode
+		allowDefault bool
+	)
+	if !in.Parse("%v %v", &si, m.Vnet, &mode) {
+		err = cli.ParseError
+		return
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("allow-default"):
+			allowDefault = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	m.SetUrpf(si, mode, allowDefault)
+	return
+}
+
+type showUrpf struct {
+	Interface    string `format:"%-30s" align:"left"`
+	Mode         string `format:"%-8s" align:"left"`
+	AllowDefault bool
+	Drops        uint64 `format:"%16d"`
+	DropBytes    uint64 `format:"%16d"`
+}
+
+func (m *Main) showUrpf(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	v := m.Vnet
+	var xs []showUrpf
+	for i := range m.urpfs {
+		x := &m.urpfs[i]
+		if x.mode == UrpfOff {
+			continue
+		}
+		si := vnet.Si(i)
+		d := m.urpfDropCount(si)
+		xs = append(xs, showUrpf{
+			Interface:    vnet.SiName{V: v, Si: si}.String(),
+			Mode:         x.mode.String(),
+			AllowDefault: x.allowDefault,
+			Drops:        d.Packets,
+			DropBytes:    d.Bytes,
+		})
+	}
+	if len(xs) == 0 {
+		fmt.Fprintln(w, "No interfaces with reverse path checks")
+		return
+	}
+	elib.Tabulate(xs).Write(w)
+	return
+}
+
+func (m *Main) clearUrpf(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.urpfDrops.ClearAll()
+	return
+}
+
+func (m *Main) urpfInit(v *vnet.Vnet) {
+	v.RegisterSwIfAddDelHook(m.urpfSwIfAddDel)
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "set ip urpf",
+			ShortHelp: "set ip4 unicast reverse path check: set ip urpf INTERFACE strict|loose|off [allow-default]",
+			Action:    m.setUrpf,
+		},
+		cli.Command{
+			Name:      "show ip urpf",
+			ShortHelp: "show ip4 unicast reverse path check mode and drops",
+			Action:    m.showUrpf,
+		},
+		cli.Command{
+			Name:      "clear ip urpf",
+			ShortHelp: "clear ip4 unicast reverse path drop counters",
+			Action:    m.clearUrpf,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip4
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"net"
+	"testing"
+)
+
+func newTestMain() *Main {
+	v := &vnet.Vnet{}
+	Init(v)
+	m := GetMain(v)
+	// Build special adjacencies.
+	m.Main.Init(v)
+	return m
+}
+
+// Add neighbor route with rewrite adjacency via given interface.
+func (m *Main) testAddNeighbor(t *testing.T, prefix string, si vnet.Si) ip.Adj {
+	ai, as := m.NewAdj(1)
+	as[0].LookupNextIndex = ip.LookupNextRewrite
+	as[0].Si = si
+	m.testAddDel(t, prefix, ai, false)
+	return ai
+}
+
+func (m *Main) testAddDel(t *testing.T, prefix string, adj ip.Adj, isDel bool) {
+	_, p, err := net.ParseCIDR(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.addDelRoute(p, 0, adj, isDel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (m *Main) testUrpf(si vnet.Si, mode UrpfMode, allowDefault bool, src string) bool {
+	a := NetIPToV4Address(net.ParseIP(src))
+	return m.urpfCheck(si, &urpfConfig{mode: mode, allowDefault: allowDefault}, &a)
+}
+
+type urpfTest struct {
+	si           vnet.Si
+	allowDefault bool
+	src          string
+	ok           bool
+}
+
+func (m *Main) testUrpfs(t *testing.T, mode UrpfMode, tests []urpfTest) {
+	for _, x := range tests {
+		if got := m.testUrpf(x.si, mode, x.allowDefault, x.src); got != x.ok {
+			t.Errorf("%s si %d src %s allow-default %v: got %v, want %v", mode, x.si, x.src, x.allowDefault, got, x.ok)
+		}
+	}
+}
+
+func TestUrpfStrict(t *testing.T) {
+	m := newTestMain()
+	m.testAddNeighbor(t, "10.0.0.0/24", 1)
+	m.testAddNeighbor(t, "0.0.0.0/0", 2)
+	m.testAddNeighbor(t, "128.0.0.0/1", 4)
+	m.testAddDel(t, "192.168.0.0/16", ip.AdjDrop, false)
+	m.testUrpfs(t, UrpfStrict, []urpfTest{
+		{si: 1, src: "10.0.0.5", ok: true},
+		{si: 2, src: "10.0.0.5", ok: false},
+		{si: 4, src: "200.1.1.1", ok: true},
+		{si: 1, src: "200.1.1.1", ok: false},
+		// Sources only reachable via default route.
+		{si: 2, src: "20.0.0.1", ok: false},
+		{si: 2, allowDefault: true, src: "20.0.0.1", ok: true},
+		{si: 1, allowDefault: true, src: "20.0.0.1", ok: false},
+		{si: 1, src: "192.168.1.1", ok: false},
+		{si: 1, src: "0.0.0.0", ok: true},
+	})
+
+	// More specific route moves sources to its interface until it is deleted.
+	a := m.testAddNeighbor(t, "10.0.0.128/25", 3)
+	m.testUrpfs(t, UrpfStrict, []urpfTest{
+		{si: 3, src: "10.0.0.200", ok: true},
+		{si: 1, src: "10.0.0.200", ok: false},
+		{si: 1, src: "10.0.0.5", ok: true},
+	})
+	m.testAddDel(t, "10.0.0.128/25", a, true)
+	m.testUrpfs(t, UrpfStrict, []urpfTest{
+		{si: 3, src: "10.0.0.200", ok: false},
+		{si: 1, src: "10.0.0.200", ok: true},
+	})
+}
+
+func TestUrpfLoose(t *testing.T) {
+	m := newTestMain()
+	a := m.testAddNeighbor(t, "10.0.0.0/24", 1)
+	m.testAddDel(t, "10.0.0.1/32", ip.AdjPunt, false)
+	m.testAddDel(t, "192.168.0.0/16", ip.AdjDrop, false)
+	m.testUrpfs(t, UrpfLoose, []urpfTest{
+		{si: 1, src: "10.0.0.5", ok: true},
+		{si: 2, src: "10.0.0.5", ok: true},
+		{si: 2, src: "10.0.0.1", ok: true},
+		{si: 2, src: "10.0.1.1", ok: false},
+		{si: 2, src: "192.168.1.1", ok: false},
+	})
+
+	// Default route only matches with allow-default.
+	d := m.testAddNeighbor(t, "0.0.0.0/0", 2)
+	m.testUrpfs(t, UrpfLoose, []urpfTest{
+		{si: 1, src: "10.0.1.1", ok: false},
+		{si: 1, allowDefault: true, src: "10.0.1.1", ok: true},
+	})
+	m.testAddDel(t, "0.0.0.0/0", d, true)
+
+	// Less specific route is removed; more specific route remains.
+	m.testAddDel(t, "10.0.0.0/24", a, true)
+	m.testUrpfs(t, UrpfLoose, []urpfTest{
+		{si: 1, src: "10.0.0.5", ok: false},
+		{si: 1, src: "10.0.0.1", ok: true},
+		{si: 1, allowDefault: true, src: "10.0.1.1", ok: false},
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"fmt"
 	"net"
+	"sync/atomic"
 )
 
 var masks = compute_masks()
@@ -88,6 +89,10 @@ func (a *Address) toPrefix() (p Prefix) {
 	p.Address = *a
 	return
 }
+func (a Address) ToNetIP() (ip net.IP) {
+	ip = append(a[:0:0], a[:]...)
+	return
+}
 func (p Prefix) ToIPNet() (ipn net.IPNet) {
 	mask := AddressMaskForLen(uint(p.Len))
 	// an empty ipn has nil for Mask and IP so use append
@@ -106,3 +111,254 @@ func (p *Prefix) ToIpPrefix() (i ip.Prefix) {
 	i.Len = p.Len
 	return
 }
+
+// Fib holds local, connected and neighbor routes of a table.  Lookups are longest prefix match.
+type Fib struct {
+	index ip.FibIndex
+	// Adjacencies by prefix length and masked address.
+	routes fibRoutes
+	// Copy of routes for lookups from data path threads.  Holds *fibRoutes whose maps are
+	// replaced, never modified, when routes change.
+	lookupRoutes atomic.Value
+}
+
+type fibRoutes [129]map[Address]ip.Adj
+
+// Publish copy of routes of given prefix length for lookups.
+func (f *Fib) publish(l uint32) {
+	var rs fibRoutes
+	if x, ok := f.lookupRoutes.Load().(*fibRoutes); ok {
+		rs = *x
+	}
+	rs[l] = nil
+	if len(f.routes[l]) > 0 {
+		rs[l] = make(map[Address]ip.Adj, len(f.routes[l]))
+		for a, adj := range f.routes[l] {
+			rs[l][a] = adj
+		}
+	}
+	f.lookupRoutes.Store(&rs)
+}
+
+// Called with address masked to prefix length.
+func (f *Fib) get(p *Prefix) (adj ip.Adj, ok bool) {
+	adj, ok = f.routes[p.Len][p.Address]
+	return
+}
+
+func (f *Fib) set(p *Prefix, adj ip.Adj) (oldAdj ip.Adj, ok bool) {
+	m := f.routes[p.Len]
+	if m == nil {
+		m = make(map[Address]ip.Adj)
+		f.routes[p.Len] = m
+	}
+	oldAdj, ok = m[p.Address]
+	m[p.Address] = adj
+	f.publish(p.Len)
+	return
+}
+
+func (f *Fib) unset(p *Prefix) (oldAdj ip.Adj, ok bool) {
+	if oldAdj, ok = f.routes[p.Len][p.Address]; ok {
+		delete(f.routes[p.Len], p.Address)
+		f.publish(p.Len)
+	}
+	return
+}
+
+func (a *Address) mask(l uint) (v Address) {
+	m := AddressMaskForLen(l)
+	for i := range a {
+		v[i] = a[i] & m[i]
+	}
+	return
+}
+
+// Lookup is safe to call from data path threads while routes change.
+func (f *Fib) lookup(a *Address) (adj ip.Adj, p Prefix, ok bool) {
+	rs, _ := f.lookupRoutes.Load().(*fibRoutes)
+	if rs == nil {
+		return
+	}
+	for l := 128; l >= 0; l-- {
+		if len(rs[l]) == 0 {
+			continue
+		}
+		p = Prefix{Address: a.mask(uint(l)), Len: uint32(l)}
+		if adj, ok = rs[l][p.Address]; ok {
+			return
+		}
+	}
+	return
+}
+
+type fibMain struct {
+	fibs []*Fib
+	// Copy of fibs for data path threads; holds []*Fib replaced when a fib is created.
+	lookupFibs        atomic.Value
+	ifAddrAddDelHooks []IfAddrAddDelHook
+}
+
+// IfAddrAddDelHook is called when an interface address is added or deleted.
+type IfAddrAddDelHook func(si vnet.Si, p *net.IPNet, isDel bool)
+
+func (m *Main) RegisterIfAddrAddDelHook(h IfAddrAddDelHook) {
+	m.ifAddrAddDelHooks = append(m.ifAddrAddDelHooks, h)
+}
+
+func (m *Main) fibByIndex(i ip.FibIndex, create bool) (f *Fib) {
+	for uint(len(m.fibs)) <= uint(i) {
+		m.fibs = append(m.fibs, nil)
+	}
+	if create && m.fibs[i] == nil {
+		m.fibs[i] = &Fib{index: i}
+		m.lookupFibs.Store(append([]*Fib(nil), m.fibs...))
+	}
+	return m.fibs[i]
+}
+
+// Fib with given index for data path lookups or nil if it does not exist.
+func (m *Main) lookupFib(i ip.FibIndex) *Fib {
+	if fs, _ := m.lookupFibs.Load().([]*Fib); uint(i) < uint(len(fs)) {
+		return fs[i]
+	}
+	return nil
+}
+
+func netIPNetToPrefix(p *net.IPNet) (q Prefix) {
+	copy(q.Address[:], p.IP.To16())
+	l, _ := p.Mask.Size()
+	q.Len = uint32(l)
+	q.Address = q.Address.mask(uint(l))
+	return
+}
+
+func (m *Main) getRouteFibIndex(p *net.IPNet, fi ip.FibIndex) (ai ip.Adj, ok bool) {
+	if f := m.fibByIndex(fi, false); f != nil {
+		q := netIPNetToPrefix(p)
+		ai, ok = f.get(&q)
+	}
+	return
+}
+
+func (m *Main) getRoute(p *net.IPNet, si vnet.Si) (ai ip.Adj, as []ip.Adjacency, ok bool) {
+	if ai, ok = m.getRouteFibIndex(p, m.FibIndexForSi(si)); ok {
+		as = m.GetAdj(ai)
+	}
+	return
+}
+
+// Neighbor routes are reachable via the interface of their rewrite.
+func (m *Main) getReachable(p *net.IPNet, si vnet.Si) (ai ip.Adj, as []ip.Adjacency, ok bool) {
+	if ai, as, ok = m.getRoute(p, si); ok {
+		if connected, asi := ai.IsConnectedRoute(&m.Main); !connected || asi != si {
+			ai, as, ok = ip.AdjNil, nil, false
+		}
+	}
+	return
+}
+
+func (m *Main) addDelRoute(p *net.IPNet, fi ip.FibIndex, adj ip.Adj, isDel bool) (oldAdj ip.Adj, err error) {
+	oldAdj = ip.AdjNil
+	f := m.fibByIndex(fi, !isDel)
+	q := netIPNetToPrefix(p)
+	var ok bool
+	if isDel {
+		if f != nil {
+			oldAdj, ok = f.unset(&q)
+		}
+		if !ok {
+			err = fmt.Errorf("%s: route %s not found", m.FibNameForIndex(fi), p)
+		}
+		return
+	}
+	if oldAdj, ok = f.set(&q, adj); !ok {
+		oldAdj = ip.AdjNil
+	}
+	return
+}
+
+// Lookup returns adjacency and prefix of longest matching route for address in given fib.
+func (m *Main) Lookup(fi ip.FibIndex, a net.IP) (adj ip.Adj, p net.IPNet, ok bool) {
+	f := m.fibByIndex(fi, false)
+	if f == nil || a.To16() == nil || a.To4() != nil {
+		return
+	}
+	var x Address
+	copy(x[:], a.To16())
+	var q Prefix
+	if adj, q, ok = f.lookup(&x); ok {
+		p = q.ToIPNet()
+	}
+	return
+}
+
+// LookupAdjacency returns adjacencies of longest matching route for address in given fib.
+func (m *Main) LookupAdjacency(fi ip.FibIndex, a net.IP) (as []ip.Adjacency, ok bool) {
+	adj, _, found := m.Lookup(fi, a)
+	if !found || adj == ip.AdjNil || adj == ip.AdjMiss || m.IsAdjFree(adj) {
+		return
+	}
+	as, ok = m.GetAdj(adj), true
+	return
+}
+
+// FibReset deletes all routes of given fib.  Glean adjacencies are owned by the fib and are freed.
+func (m *Main) FibReset(fi ip.FibIndex) {
+	f := m.fibByIndex(fi, false)
+	if f == nil {
+		return
+	}
+	for l := range f.routes {
+		for _, adj := range f.routes[l] {
+			if adj != ip.AdjPunt && !m.IsAdjFree(adj) && m.GetAdj(adj)[0].IsGlean() {
+				m.DelAdj(adj)
+			}
+		}
+		f.routes[l] = nil
+	}
+	f.lookupRoutes.Store(&fibRoutes{})
+}
+
+// AddDelInterfaceAddress adds or deletes interface address with local route to address and
+// glean route to its connected prefix.
+func (m *Main) AddDelInterfaceAddress(si vnet.Si, addr *net.IPNet, isDel bool) (err error) {
+	v := m.Vnet
+	ia, exists, err := m.Main.AddDelInterfaceAddress(si, addr, isDel)
+	if err != nil {
+		return
+	}
+	fi := m.FibIndexForSi(si)
+	f := m.fibByIndex(fi, true)
+	local := netIPNetToPrefix(&net.IPNet{IP: addr.IP, Mask: net.CIDRMask(128, 128)})
+	connected := netIPNetToPrefix(addr)
+	if isDel {
+		f.unset(&local)
+		if adj, ok := f.get(&connected); ok && adj != ip.AdjPunt && !m.IsAdjFree(adj) {
+			if as := m.GetAdj(adj); as[0].IsGlean() && as[0].Si == si {
+				f.unset(&connected)
+				m.DelAdj(adj)
+			}
+		}
+	} else if !exists {
+		f.set(&local, ip.AdjPunt)
+		if connected.Len < 128 {
+			if _, ok := f.get(&connected); !ok {
+				ai, as := m.NewAdj(1)
+				as[0].LookupNextIndex = ip.LookupNextGlean
+				as[0].Si = si
+				if hw := v.SupHwIf(v.SwIf(si)); hw != nil {
+					v.SetRewrite(&as[0].Rewrite, si, &m.rewriteNode, vnet.IP6, nil)
+				}
+				f.set(&connected, ai)
+				m.GetIfAddr(ia).NeighborProbeAdj = ai
+			}
+		}
+	}
+	if isDel || !exists {
+		for _, h := range m.ifAddrAddDelHooks {
+			h(si, addr, isDel)
+		}
+	}
+	return
+}
@@ -15,6 +15,18 @@ func (a *Address) String() string {
 	return (net.IP)(a[:]).String()
 }
 
+func (a *Address) Parse(in *parse.Input) {
+	var s string
+	if !in.Parse("%s", &s) {
+		in.ParseError()
+	}
+	x := net.ParseIP(s)
+	if x == nil || x.To4() != nil {
+		in.ParseError()
+	}
+	copy(a[:], x.To16())
+}
+
 func (h *Header) String() (s string) {
 	s = fmt.Sprintf("%s: %s -> %s", h.Protocol.String(), h.Src.String(), h.Dst.String())
 	return
@@ -23,17 +35,40 @@ func (h *Header) String() (s string) {
 const DefaultTtl = 64
 
 func (h *Header) Parse(in *parse.Input) {
+	h.Ip_version_traffic_class_and_flow_label.Set(DefaultVersionTrafficClassAndFlowLabel)
 	h.Ttl = DefaultTtl
 	if !in.ParseLoose("%v: %v -> %v", &h.Protocol, &h.Src, &h.Dst) {
 		in.ParseError()
 	}
 loop:
 	for {
+		var tc, fl uint32
 		switch {
 		case in.Parse("ttl %d", &h.Ttl):
+		case in.Parse("traffic-class %x", &tc):
+			x := h.Ip_version_traffic_class_and_flow_label.ToHost()
+			x = (x &^ (0xff << 20)) | (tc&0xff)<<20
+			h.Ip_version_traffic_class_and_flow_label.Set(uint(x))
+		case in.Parse("flow-label %x", &fl):
+			x := h.Ip_version_traffic_class_and_flow_label.ToHost()
+			x = (x &^ 0xfffff) | fl&0xfffff
+			h.Ip_version_traffic_class_and_flow_label.Set(uint(x))
 		default:
 			break loop
 		}
 	}
 	return
 }
+
+func (h *ExtensionHeader) String() string {
+	return fmt.Sprintf("IP6 extension: next %s", h.Protocol.String())
+}
+
+func (h *FragmentHeader) String() (s string) {
+	x := h.Fragment_offset_and_flags.ToHost()
+	s = fmt.Sprintf("IP6 fragment: next %s, id 0x%x, offset %d", h.Protocol.String(), h.Id.ToHost(), 8*(x>>3))
+	if x&FragmentMoreFragments != 0 {
+		s += ", more"
+	}
+	return
+}
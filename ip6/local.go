@@ -0,0 +1,106 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip6
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+)
+
+type localMain struct {
+	// Next of ip6-input indexed by icmp6 type of messages for local and multicast addresses.
+	icmp6LocalNexts map[uint8]uint
+	// Nexts of ip6-input for packets to glean adjacencies, packets with hop limit exceeded
+	// and packets to drop routes; zero when not registered.
+	gleanNext, timeExceededNext, unreachableNext uint
+}
+
+func (m *Main) inputEnabled() bool {
+	return len(m.icmp6LocalNexts) > 0 || m.gleanNext != 0 || m.timeExceededNext != 0 || m.unreachableNext != 0
+}
+
+// Add next to ip6-input, ip6-input-post-features and ip6-rewrite which share nexts.
+func (m *Main) addLocalNext(nodeName string) (x uint) {
+	v := m.Vnet
+	x = v.AddNamedNext(&m.inputNode, nodeName)
+	if y := v.AddNamedNext(&m.postFeaturesNode, nodeName); y != x {
+		panic(fmt.Errorf("ip6 %s: next %d != %d", nodeName, x, y))
+	}
+	if y := v.AddNamedNext(&m.rewriteNode, nodeName); y != x {
+		panic(fmt.Errorf("ip6 %s: next %d != %d", nodeName, x, y))
+	}
+	return
+}
+
+// RegisterIcmp6LocalType sends icmp6 messages of given type addressed to a local or multicast
+// address to named node instead of punting them.  Must be called at init time.
+func (m *Main) RegisterIcmp6LocalType(t uint8, nodeName string) {
+	if _, ok := m.icmp6LocalNexts[t]; ok {
+		panic(fmt.Errorf("ip6 icmp6 local type %d already registered", t))
+	}
+	if m.icmp6LocalNexts == nil {
+		m.icmp6LocalNexts = make(map[uint8]uint)
+	}
+	m.icmp6LocalNexts[t] = m.addLocalNext(nodeName)
+}
+
+func (m *Main) registerNext(x *uint, what, nodeName string) {
+	if *x != 0 {
+		panic(fmt.Errorf("ip6 %s node already registered", what))
+	}
+	*x = m.addLocalNext(nodeName)
+}
+
+// RegisterGleanNode sends packets to unresolved neighbors of connected prefixes to named node
+// instead of punting them.  Must be called at init time.
+func (m *Main) RegisterGleanNode(nodeName string) {
+	m.registerNext(&m.gleanNext, "glean", nodeName)
+}
+
+// RegisterTimeExceededNode sends packets which would be forwarded with hop limit exceeded to
+// named node instead of punting them.  Must be called at init time.
+func (m *Main) RegisterTimeExceededNode(nodeName string) {
+	m.registerNext(&m.timeExceededNext, "time exceeded", nodeName)
+}
+
+// RegisterUnreachableNode sends packets which would be forwarded via drop routes to named
+// node instead of punting them.  Must be called at init time.
+func (m *Main) RegisterUnreachableNode(nodeName string) {
+	m.registerNext(&m.unreachableNext, "unreachable", nodeName)
+}
+
+// Next for packet received on given interface.  Called from data path threads.
+func (m *Main) localNext(si vnet.Si, b []byte) (x uint) {
+	x = input_next_punt
+	if len(b) < SizeofHeader || b[0]>>4 != 6 {
+		return
+	}
+	var dst Address
+	copy(dst[:], b[24:40])
+	adj := ip.AdjMiss
+	if f := m.lookupFib(m.FibIndexForSi(si)); f != nil {
+		adj, _, _ = f.lookup(&dst)
+	}
+	if dst[0] == 0xff || adj == ip.AdjPunt || adj.IsLocal(&m.Main) {
+		if ip.Protocol(b[6]) == ip.ICMP6 && len(b) > SizeofHeader {
+			if n, ok := m.icmp6LocalNexts[b[SizeofHeader]]; ok {
+				x = n
+			}
+		}
+		return
+	}
+	// Packet would be forwarded.
+	switch {
+	case b[7] <= 1 && m.timeExceededNext != 0:
+		x = m.timeExceededNext
+	case adj == ip.AdjDrop && m.unreachableNext != 0:
+		x = m.unreachableNext
+	case m.gleanNext != 0 && adj.IsGlean(&m.Main):
+		x = m.gleanNext
+	}
+	return
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip6
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+	"net"
+	"testing"
+)
+
+func icmp6Packet(dst string, t uint8) []byte {
+	b := make([]byte, SizeofHeader+4)
+	b[0] = 6 << 4
+	b[6] = byte(ip.ICMP6)
+	b[7] = 64
+	copy(b[24:40], net.ParseIP(dst))
+	b[SizeofHeader] = t
+	return b
+}
+
+func TestLocalNext(t *testing.T) {
+	v := &vnet.Vnet{}
+	Init(v)
+	m := GetMain(v)
+	// Build special adjacencies.
+	m.Main.Init(v)
+	add := func(prefix string, adj ip.Adj) {
+		_, p, _ := net.ParseCIDR(prefix)
+		m.addDelRoute(p, 0, adj, false)
+	}
+	add("2001:db8::1/128", ip.AdjPunt)
+	ai, as := m.NewAdj(1)
+	as[0].LookupNextIndex = ip.LookupNextGlean
+	as[0].Si = 1
+	add("2001:db8::/64", ai)
+	add("2001:db9::/32", ip.AdjDrop)
+	m.icmp6LocalNexts = map[uint8]uint{135: 5}
+	m.gleanNext = 6
+	m.timeExceededNext = 7
+	m.unreachableNext = 8
+
+	udp := icmp6Packet("2001:db8::2", 135)
+	udp[6] = byte(ip.UDP)
+	expired := icmp6Packet("2001:db8::2", 128)
+	expired[7] = 1
+	localExpired := icmp6Packet("2001:db8::1", 135)
+	localExpired[7] = 1
+	tests := []struct {
+		name string
+		b    []byte
+		next uint
+	}{
+		{name: "local", b: icmp6Packet("2001:db8::1", 135), next: 5},
+		{name: "multicast", b: icmp6Packet("ff02::1:ff00:1", 135), next: 5},
+		{name: "other type", b: icmp6Packet("2001:db8::1", 128), next: input_next_punt},
+		{name: "glean", b: icmp6Packet("2001:db8::2", 135), next: 6},
+		{name: "glean udp", b: udp, next: 6},
+		{name: "hop limit exceeded", b: expired, next: 7},
+		{name: "local hop limit 1", b: localExpired, next: 5},
+		{name: "drop route", b: icmp6Packet("2001:db9::1", 128), next: 8},
+		{name: "no route", b: icmp6Packet("2001:dba::1", 135), next: input_next_punt},
+		{name: "short", b: icmp6Packet("2001:db8::1", 135)[:SizeofHeader-1], next: input_next_punt},
+	}
+	for _, x := range tests {
+		if got := m.localNext(1, x.b); got != x.next {
+			t.Errorf("%s: next %d, want %d", x.name, got, x.next)
+		}
+	}
+}
+
+// Data path lookups run while routes change.
+func TestLocalNextConcurrent(t *testing.T) {
+	v := &vnet.Vnet{}
+	Init(v)
+	m := GetMain(v)
+	m.Main.Init(v)
+	m.icmp6LocalNexts = map[uint8]uint{135: 5}
+	_, p, _ := net.ParseCIDR("2001:db8::1/128")
+	m.addDelRoute(p, 0, ip.AdjPunt, false)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_, q, _ := net.ParseCIDR(fmt.Sprintf("2001:db8::%x/128", 2+i))
+			m.addDelRoute(q, 0, ip.AdjPunt, false)
+			m.addDelRoute(q, 0, ip.AdjPunt, true)
+		}
+	}()
+	b := icmp6Packet("2001:db8::1", 135)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// Interface without fib index set uses default fib.
+		if got := m.localNext(100, b); got != 5 {
+			t.Fatalf("next %d, want 5", got)
+		}
+	}
+}
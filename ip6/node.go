@@ -11,17 +11,37 @@ import (
 func GetHeader(r *vnet.Ref) *Header { return (*Header)(r.Data()) }
 
 type nodeMain struct {
-	inputNode   inputNode
-	rewriteNode vnet.Node
-	arpNode     vnet.Node
+	inputNode inputNode
+	// Continues ip6 input for packets which have passed input features.
+	postFeaturesNode inputNode
+	rewriteNode      inputNode
+	arpNode          vnet.Node
+	// Features applied to packets received on software interfaces before ip6 input.
+	// Packets start with ip6 header.
+	InputFeatures vnet.FeatureArc
 }
 
 func (m *Main) nodeInit(v *vnet.Vnet) {
+	m.inputNode.m = m
 	m.inputNode.Next = []string{
 		input_next_drop: "error",
 		input_next_punt: "punt",
 	}
 	v.RegisterInOutNode(&m.inputNode, "ip6-input")
+	m.postFeaturesNode.m = m
+	m.postFeaturesNode.postFeatures = true
+	m.postFeaturesNode.Next = m.inputNode.Next
+	v.RegisterInOutNode(&m.postFeaturesNode, "ip6-input-post-features")
+	// Packets sent to neighbor and glean adjacencies by software are handled as for ip6-input.
+	m.rewriteNode.m = m
+	m.rewriteNode.postFeatures = true
+	m.rewriteNode.Next = m.inputNode.Next
+	v.RegisterInOutNode(&m.rewriteNode, "ip6-rewrite")
+	m.InputFeatures.Init(v, "ip6-input", "ip6-input-post-features")
+	m.InputFeatures.AddStart(&m.inputNode)
+	// Not start nodes but added so that nodes sharing nexts with ip6-input keep same indices.
+	m.InputFeatures.AddStart(&m.postFeaturesNode)
+	m.InputFeatures.AddStart(&m.rewriteNode)
 }
 
 const (
@@ -29,8 +49,31 @@ const (
 	input_next_punt
 )
 
-type inputNode struct{ vnet.InOutNode }
+type inputNode struct {
+	vnet.InOutNode
+	// Dispatches packets to input features, local icmp6, glean and forwarding errors to
+	// registered nodes.
+	m *Main
+	// Input features have been applied or are not applied by this node.
+	postFeatures bool
+}
 
 func (node *inputNode) NodeInput(in *vnet.RefIn, out *vnet.RefOut) {
-	node.Redirect(in, out, input_next_punt)
+	m := node.m
+	features := m != nil && !node.postFeatures && m.InputFeatures.Active()
+	if m == nil || !m.inputEnabled() && !features {
+		node.Redirect(in, out, input_next_punt)
+		return
+	}
+	q := node.GetEnqueue(in)
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		if x, ok := m.InputFeatures.First(r0.Si); features && ok {
+			q.Put1(r0, x)
+		} else {
+			q.Put1(r0, m.localNext(r0.Si, r0.DataSlice()))
+		}
+		i++
+	}
 }
@@ -24,7 +24,12 @@ func Init(v *vnet.Vnet) *ip.Main {
 		RewriteNode:     &m.rewriteNode,
 		PacketType:      vnet.IP6,
 	}
+	cf.GetRoute = m.getRoute
+	cf.GetReachable = m.getReachable
+	cf.GetRouteFibIndex = m.getRouteFibIndex
+	cf.AddDelRoute = m.addDelRoute
 	m.Main.PackageInit(v, cf)
+	m.DependsOn("pg")
 	return &m.Main
 }
 
@@ -35,7 +40,10 @@ func ipAddressStringer(a *ip.Address) string { return IpAddress(a).String() }
 type Main struct {
 	vnet.Package
 	ip.Main
+	fibMain
+	localMain
 	nodeMain
+	pgMain
 }
 
 func RegisterLayer(v *vnet.Vnet, t ip.Protocol, l vnet.Layer) {
@@ -80,6 +88,7 @@ func (m *Main) Init() (err error) {
 	v := m.Vnet
 	m.Main.Init(v)
 	m.nodeInit(v)
+	m.pgInit(v)
 	RegisterLayer(v, ip.IP6_IN_IP, m)
 	ethernet.RegisterLayer(v, ethernet.TYPE_IP6, m)
 	return
@@ -20,11 +20,11 @@ type Address [AddressBytes]byte
 
 type Header struct {
 	/* 4 bit version, 8 bit traffic class and 20 bit flow label. */
-	Ip_version_traffic_class_and_flow_label uint32
+	Ip_version_traffic_class_and_flow_label vnet.Uint32
 
 	/* Total packet length not including this header (but including
 	   any extension headers if present). */
-	Payload_length uint16
+	Payload_length vnet.Uint16
 
 	/* Protocol for next header. */
 	Protocol ip.Protocol
@@ -36,6 +36,9 @@ type Header struct {
 	Src, Dst Address
 }
 
+// Version 6 with zero traffic class and flow label.
+const DefaultVersionTrafficClassAndFlowLabel = 6 << 28
+
 func (a *Address) AsUint32(i uint) vnet.Uint32 {
 	return vnet.Uint32(a[4*i+3]) | vnet.Uint32(a[4*i+2])<<8 | vnet.Uint32(a[4*i+1])<<16 | vnet.Uint32(a[4*i+0])<<24
 }
@@ -56,18 +59,77 @@ func (a *Address) FromUint32(i uint, x uint32) {
 	a[4*i+3] = byte(x)
 }
 
+func (a *Address) Add(x uint64) { vnet.ByteAdd(a[:], x) }
+
 func IpAddress(a *ip.Address) *Address { return (*Address)(unsafe.Pointer(&a[0])) }
 
-func (h *Header) Len() int { return SizeofHeader }
+// Implement vnet.PacketHeader interface.
+func (h *Header) Len() uint { return SizeofHeader }
 func (h *Header) Write(b []byte) {
+	h.Payload_length.Set(uint(len(b)) - SizeofHeader)
 	type t struct{ data [SizeofHeader]byte }
 	i := (*t)(unsafe.Pointer(h))
 	copy(b[:], i.data[:])
 }
-func (h *Header) Finalize(hs []vnet.PacketHeader) {
-	sum := uint(0)
-	for _, h := range hs {
-		sum += h.Len()
-	}
-	h.Payload_length = uint16(sum)
+func (h *Header) Read(b []byte) vnet.PacketHeader { return (*Header)(vnet.Pointer(b)) }
+
+// Hop-by-hop, routing and destination options extension headers.
+// Options are padded so that header is always 8 bytes.
+type ExtensionHeader struct {
+	// Protocol for next header.
+	Protocol ip.Protocol
+
+	// Length in 8 byte units not including first 8 bytes.
+	Length uint8
+
+	// Options for hop-by-hop and destination options headers.
+	// Routing type and segments left followed by reserved bytes for routing header.
+	Data [6]byte
+}
+
+const (
+	SizeofExtensionHeader = 8
+	SizeofFragmentHeader  = 8
+)
+
+// Pad1 and PadN option types for hop-by-hop and destination options.
+const (
+	OptionPad1 = 0
+	OptionPadN = 1
+)
+
+func (h *ExtensionHeader) Len() uint { return SizeofExtensionHeader }
+func (h *ExtensionHeader) Write(b []byte) {
+	type t struct{ data [SizeofExtensionHeader]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
+func (h *ExtensionHeader) Read(b []byte) vnet.PacketHeader {
+	return (*ExtensionHeader)(vnet.Pointer(b))
+}
+
+// Fragment extension header.
+type FragmentHeader struct {
+	// Protocol for next header.
+	Protocol ip.Protocol
+
+	Reserved uint8
+
+	// 13 bit fragment offset (in units of 8 bytes), 2 reserved bits and more fragments flag.
+	Fragment_offset_and_flags vnet.Uint16
+
+	// Identification for re-assembly.
+	Id vnet.Uint32
+}
+
+const FragmentMoreFragments = 1 << 0
+
+func (h *FragmentHeader) Len() uint { return SizeofFragmentHeader }
+func (h *FragmentHeader) Write(b []byte) {
+	type t struct{ data [SizeofFragmentHeader]byte }
+	i := (*t)(unsafe.Pointer(h))
+	copy(b[:], i.data[:])
+}
+func (h *FragmentHeader) Read(b []byte) vnet.PacketHeader {
+	return (*FragmentHeader)(vnet.Pointer(b))
 }
@@ -0,0 +1,236 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ip6
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/pg"
+
+	"fmt"
+)
+
+type pgStream struct {
+	pg.Stream
+	ai_src, ai_dst addressIncrement
+}
+
+type pgMain struct {
+	v           *vnet.Vnet
+	protocolMap map[ip.Protocol]pg.StreamType
+}
+
+func (m *pgMain) initProtocolMap() {
+	if m.protocolMap != nil {
+		return
+	}
+	m.protocolMap = make(map[ip.Protocol]pg.StreamType)
+	for p, name := range map[ip.Protocol]string{
+		ip.IP_IN_IP:  "ip4",
+		ip.IP6_IN_IP: "ip6",
+		ip.GRE:       "gre",
+		ip.ICMP6:     "icmp6",
+	} {
+		if t := pg.GetStreamType(m.v, name); t != nil {
+			m.protocolMap[p] = t
+		}
+	}
+}
+
+func (m *pgMain) Name() string { return "ip6" }
+
+// Extension header as parsed; protocol is type of this header.
+type pgExtensionHeader struct {
+	protocol ip.Protocol
+	h        vnet.PacketHeader
+}
+
+func (x *pgExtensionHeader) setNext(p ip.Protocol) {
+	switch h := x.h.(type) {
+	case *ExtensionHeader:
+		h.Protocol = p
+	case *FragmentHeader:
+		h.Protocol = p
+	}
+}
+
+func (m *pgMain) parseExtensionHeader(in *parse.Input) (x pgExtensionHeader, ok bool) {
+	ok = true
+	switch {
+	case in.Parse("hop-by-hop"):
+		x.protocol = ip.IP6_HOP_BY_HOP_OPTIONS
+		x.h = newPadOptionsHeader()
+	case in.Parse("dst-options"):
+		x.protocol = ip.IP6_DST_OPTIONS
+		x.h = newPadOptionsHeader()
+	case in.Parse("routing"):
+		x.protocol = ip.IP6_ROUTE
+		h := &ExtensionHeader{}
+		in.Parse("type %d", &h.Data[0])
+		x.h = h
+	case in.Parse("fragment"):
+		x.protocol = ip.IP6_FRAG
+		h := &FragmentHeader{}
+		var id, offset uint
+		more := false
+	loop:
+		for {
+			switch {
+			case in.Parse("id %d", &id):
+			case in.Parse("offset %d", &offset):
+			case in.Parse("more"):
+				more = true
+			default:
+				break loop
+			}
+		}
+		f := (offset / 8) << 3
+		if more {
+			f |= FragmentMoreFragments
+		}
+		h.Fragment_offset_and_flags.Set(f)
+		h.Id.Set(id)
+		x.h = h
+	default:
+		ok = false
+	}
+	return
+}
+
+// Hop-by-hop and destination options headers are padded with a single PadN option.
+func newPadOptionsHeader() (h *ExtensionHeader) {
+	h = &ExtensionHeader{}
+	h.Data[0] = OptionPadN
+	h.Data[1] = uint8(len(h.Data) - 2)
+	return
+}
+
+func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
+	m.initProtocolMap()
+	var s pgStream
+	h := Header{}
+	for !in.End() {
+		var min, max uint64
+		switch {
+		case in.Parse("%v", &h):
+			var xs []pgExtensionHeader
+		incLoop:
+			for {
+				switch {
+				case in.Parse("src %v-%v", &min, &max):
+					s.addInc(true, false, &h, min, max)
+				case in.Parse("src %v", &max):
+					s.addInc(true, false, &h, 0, max-1)
+				case in.Parse("dst %v-%v", &min, &max):
+					s.addInc(false, false, &h, min, max)
+				case in.Parse("dst %v", &max):
+					s.addInc(false, false, &h, 0, max-1)
+				case in.Parse("rand%*om src %v-%v", &min, &max):
+					s.addInc(true, true, &h, min, max)
+				case in.Parse("rand%*om dst %v-%v", &min, &max):
+					s.addInc(false, true, &h, min, max)
+				default:
+					if x, ok := m.parseExtensionHeader(in); ok {
+						xs = append(xs, x)
+					} else {
+						break incLoop
+					}
+				}
+			}
+
+			// Chain extension headers: protocol given in header is protocol of upper layer.
+			upper := h.Protocol
+			if len(xs) > 0 {
+				h.Protocol = xs[0].protocol
+				for i := range xs {
+					p := upper
+					if i+1 < len(xs) {
+						p = xs[i+1].protocol
+					}
+					xs[i].setNext(p)
+				}
+			}
+
+			s.AddHeader(&h)
+			for i := range xs {
+				s.AddHeader(xs[i].h)
+			}
+			if t, ok := m.protocolMap[upper]; ok {
+				var sub_r pg.Streamer
+				sub_r, err = t.ParseStream(in)
+				if err != nil {
+					err = fmt.Errorf("ip6 %s: %s `%s'", t.Name(), err, in)
+					return
+				}
+				s.AddStreamer(sub_r)
+			}
+		default:
+			in.ParseError()
+		}
+	}
+	if err == nil {
+		r = &s
+	}
+	return
+}
+
+func (s *pgStream) addInc(isSrc, isRandom bool, h *Header, min, max uint64) {
+	ai := addressIncrement{}
+	ai.Set(min, max, isRandom)
+	if isSrc {
+		ai.base = h.Src
+		s.ai_src = ai
+	} else {
+		ai.base = h.Dst
+		s.ai_dst = ai
+	}
+}
+
+type addressIncrement struct {
+	base Address
+	pg.Increment
+}
+
+func (ai *addressIncrement) do(dst []vnet.Ref, dataOffset uint, isSrc bool) {
+	for i := range dst {
+		h := (*Header)(dst[i].DataOffset(dataOffset))
+		a := &h.Dst
+		if isSrc {
+			a = &h.Src
+		}
+		*a = ai.base
+		a.Add(ai.Next())
+	}
+}
+
+func (s *pgStream) Finalize(r []vnet.Ref, data_offset uint) (changed bool) {
+	if s.ai_src.Valid() {
+		s.ai_src.do(r, data_offset, true)
+		changed = true
+	}
+	if s.ai_dst.Valid() {
+		s.ai_dst.do(r, data_offset, false)
+		changed = true
+	}
+	if s.IsVariableSize() {
+		s.setLength(r, data_offset)
+		changed = true
+	}
+	return
+}
+
+func (s *pgStream) setLength(dst []vnet.Ref, dataOffset uint) {
+	for i := range dst {
+		r := &dst[i]
+		h := (*Header)(r.DataOffset(dataOffset))
+		h.Payload_length.Set(r.ChainLen() - dataOffset - SizeofHeader)
+	}
+}
+
+func (m *pgMain) pgInit(v *vnet.Vnet) {
+	m.v = v
+	pg.AddStreamType(v, "ip6", m)
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lldp
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+	"strings"
+)
+
+// lldp INTERFACE enable|disable
+func (m *Main) lldpEnable(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var hi vnet.Hi
+	switch {
+	case in.Parse("%v enable", &hi, m.Vnet):
+		err = m.Enable(hi, true)
+	case in.Parse("%v disable", &hi, m.Vnet):
+		err = m.Enable(hi, false)
+	default:
+		err = cli.ParseError
+	}
+	return
+}
+
+type showPort struct {
+	Interface string `format:"%-30s" align:"left"`
+	Neighbors uint   `format:"%10d"`
+	Tx        uint64 `format:"%12d"`
+	Rx        uint64 `format:"%12d"`
+	Discards  uint64 `format:"%10d"`
+	Ageouts   uint64 `format:"%10d"`
+}
+
+type showNeighbor struct {
+	Interface string `format:"%-20s" align:"left"`
+	Chassis   string `format:"%-20s" align:"left"`
+	Port      string `format:"%-20s" align:"left"`
+	System    string `format:"%-20s" align:"left"`
+	Address   string `format:"%-16s" align:"left"`
+	Expires   string `format:"%8s"`
+}
+
+// show lldp interfaces
+func (m *Main) showLldp(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	v := m.Vnet
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "system name %s, tx interval %gs, ttl %ds\n", m.SystemName, m.TxInterval, m.ttl())
+	if len(m.ports) == 0 {
+		fmt.Fprintln(w, "LLDP not enabled on any interface")
+		return
+	}
+	var ps []showPort
+	for _, p := range m.sortedPorts() {
+		ps = append(ps, showPort{
+			Interface: v.HwIf(p.hi).Name(),
+			Neighbors: p.nNeighbors,
+			Tx:        p.counters[counterTx],
+			Rx:        p.counters[counterRx],
+			Discards:  p.counters[counterDiscard],
+			Ageouts:   p.counters[counterAgeout],
+		})
+	}
+	elib.Tabulate(ps).Write(w)
+	return
+}
+
+// show lldp neighbors [detail]
+func (m *Main) showNeighbors(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var detail bool
+	for !in.End() {
+		switch {
+		case in.Parse("d%*etail"):
+			detail = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	now := cpu.TimeNow()
+	ns := m.Neighbors()
+	if len(ns) == 0 {
+		fmt.Fprintln(w, "No neighbors")
+		return
+	}
+	expires := func(n *Neighbor) string {
+		if n.expires <= now {
+			return "0s"
+		}
+		return fmt.Sprintf("%.0fs", (n.expires - now).Seconds())
+	}
+	if detail {
+		for i := range ns {
+			n := &ns[i]
+			fmt.Fprintf(w, "%s: chassis %s port %s, expires %s\n", v.HwIf(n.Hi).Name(), n.ChassisId, n.PortId, expires(n))
+			if n.PortDescription != "" {
+				fmt.Fprintf(w, "  port description: %s\n", n.PortDescription)
+			}
+			if n.SystemName != "" {
+				fmt.Fprintf(w, "  system name: %s\n", n.SystemName)
+			}
+			if n.SystemDescription != "" {
+				fmt.Fprintf(w, "  system description: %s\n", n.SystemDescription)
+			}
+			fmt.Fprintf(w, "  capabilities: %s\n", capabilities(n.Capabilities))
+			for _, a := range n.MgmtAddrs {
+				fmt.Fprintf(w, "  management address: %s\n", a)
+			}
+		}
+		return
+	}
+	var sns []showNeighbor
+	for i := range ns {
+		n := &ns[i]
+		var a string
+		if len(n.MgmtAddrs) > 0 {
+			a = n.MgmtAddrs[0].String()
+		}
+		sns = append(sns, showNeighbor{
+			Interface: v.HwIf(n.Hi).Name(),
+			Chassis:   n.ChassisId,
+			Port:      n.PortId,
+			System:    n.SystemName,
+			Address:   a,
+			Expires:   expires(n),
+		})
+	}
+	elib.Tabulate(sns).Write(w)
+	return
+}
+
+var capabilityNames = [...]string{
+	"other", "repeater", "bridge", "wlan-ap", "router", "telephone", "docsis", "station",
+	"c-vlan", "s-vlan", "tpmr",
+}
+
+func capabilities(c uint16) string {
+	var s []string
+	for i, n := range capabilityNames {
+		if c&(1<<uint(i)) != 0 {
+			s = append(s, n)
+		}
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+// clear lldp
+func (m *Main) clearLldp(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.ClearNeighbors()
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "lldp",
+			ShortHelp: "enable/disable lldp on interface: lldp INTERFACE enable|disable",
+			Action:    m.lldpEnable,
+		},
+		cli.Command{
+			Name:      "show lldp interfaces",
+			ShortHelp: "show lldp configuration and interface counters",
+			Action:    m.showLldp,
+		},
+		cli.Command{
+			Name:      "show lldp neighbors",
+			ShortHelp: "show lldp neighbor table [detail]",
+			Action:    m.showNeighbors,
+		},
+		cli.Command{
+			Name:      "clear lldp",
+			ShortHelp: "flush lldp neighbors and zero counters",
+			Action:    m.clearLldp,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lldp
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+
+	"net"
+	"reflect"
+	"testing"
+)
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+var src = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+
+func TestFrame(t *testing.T) {
+	c := Config{TxInterval: 30, TxHold: 4, SystemName: "leaf1", SystemDescription: "test switch"}
+	b := c.frame(src, "eth-1-1", net.ParseIP("10.0.0.1"), c.ttl())
+	if len(b) < minFrameLength || !reflect.DeepEqual(net.HardwareAddr(b[:6]), destination) {
+		t.Fatalf("frame % x", b)
+	}
+	var n Neighbor
+	ok, err := n.parse(b)
+	if !ok || err != nil {
+		t.Fatalf("parse: %v %v", ok, err)
+	}
+	want := Neighbor{
+		ChassisId:         "leaf1",
+		PortId:            "eth-1-1",
+		SystemName:        "leaf1",
+		SystemDescription: "test switch",
+		Capabilities:      capBridge | capRouter,
+		MgmtAddrs:         []net.IP{net.ParseIP("10.0.0.1").To4()},
+		Ttl:               120,
+	}
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("got %+v want %+v", n, want)
+	}
+
+	c.ChassisId = net.HardwareAddr{2, 0, 0, 0, 0, 0xaa}
+	b = c.frame(src, "eth-1-1", net.ParseIP("2001:db8::1"), 0)
+	if _, err = n.parse(b); err != nil || n.ChassisId != "02:00:00:00:00:aa" || n.Ttl != 0 ||
+		!n.MgmtAddrs[0].Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("mac chassis id %+v %v", n, err)
+	}
+
+	// Mandatory tlvs out of order and truncated frames are errors.
+	b = c.frame(src, "eth-1-1", nil, 120)
+	x := append([]byte(nil), b...)
+	x[sizeofHeader] = tlvPortId << 1
+	if _, err = n.parse(x); err == nil {
+		t.Errorf("out of order tlvs parsed")
+	}
+	if _, err = n.parse(b[:sizeofHeader+10]); err == nil {
+		t.Errorf("truncated frame parsed")
+	}
+	x = append([]byte(nil), b...)
+	x[12] = 0x08
+	if ok, _ = n.parse(x); ok {
+		t.Errorf("ip4 frame parsed")
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	m := &Main{}
+	// Nothing is due for transmission during test.
+	never := seconds(1e6)
+	m.ports = map[vnet.Hi]*port{1: &port{hi: 1, nextTx: never}, 2: &port{hi: 2, nextTx: never}}
+	type event struct {
+		system string
+		isDel  bool
+	}
+	var events []event
+	m.RegisterNeighborHook(func(n *Neighbor, isDel bool) { events = append(events, event{n.SystemName, isDel}) })
+
+	c := Config{SystemName: "spine1", ChassisId: src}
+	now := seconds(100)
+	m.input(1, c.frame(src, "eth-2-1", nil, 120), now)
+	m.input(1, c.frame(src, "eth-2-1", nil, 120), now+seconds(30))
+	// Not enabled on interface 3.
+	m.input(3, c.frame(src, "eth-2-3", nil, 120), now)
+	if ns := m.Neighbors(); len(ns) != 1 || ns[0].Hi != 1 || ns[0].PortId != "eth-2-1" {
+		t.Fatalf("neighbors %+v", ns)
+	}
+	// Refresh does not call hooks; change does.
+	c.SystemName = "spine2"
+	m.input(1, c.frame(src, "eth-2-1", nil, 120), now+seconds(30))
+	if !reflect.DeepEqual(events, []event{{"spine1", false}, {"spine2", false}}) {
+		t.Errorf("events %v", events)
+	}
+	if p := m.ports[1]; p.counters[counterRx] != 3 || p.nNeighbors != 1 {
+		t.Errorf("port counters %v neighbors %d", p.counters, p.nNeighbors)
+	}
+
+	// Neighbor ages out after ttl from last refresh.
+	m.timer(now + seconds(149))
+	if len(m.Neighbors()) != 1 {
+		t.Errorf("neighbor aged early")
+	}
+	m.timer(now + seconds(151))
+	if len(m.Neighbors()) != 0 || m.ports[1].counters[counterAgeout] != 1 {
+		t.Errorf("neighbor not aged")
+	}
+
+	// Shutdown removes neighbor at once.
+	events = nil
+	m.input(2, c.frame(src, "eth-2-2", nil, 120), now)
+	m.input(2, c.frame(src, "eth-2-2", nil, 0), now)
+	if len(m.Neighbors()) != 0 || !reflect.DeepEqual(events, []event{{"spine2", false}, {"spine2", true}}) {
+		t.Errorf("shutdown events %v", events)
+	}
+
+	// Malformed frames are counted.
+	b := c.frame(src, "eth-2-2", nil, 120)
+	m.input(2, b[:sizeofHeader+4], now)
+	if m.ports[2].counters[counterDiscard] != 1 {
+		t.Errorf("discards %v", m.ports[2].counters)
+	}
+}
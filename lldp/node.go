@@ -0,0 +1,112 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lldp
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+)
+
+const (
+	rx_next_punt uint = iota
+)
+
+// Node parsing LLDPDUs from ethernet-input.  Frames start with ethernet header; all are passed on to punt.
+type rxNode struct {
+	vnet.InOutNode
+	m *Main
+}
+
+func (n *rxNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{
+		rx_next_punt: "punt",
+	}
+	v.RegisterInOutNode(n, "lldp-input")
+}
+
+func (n *rxNode) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+	if len(m.ports) > 0 {
+		now := cpu.TimeNow()
+		i, n_left := in.Range()
+		for ; n_left > 0; n_left-- {
+			r0 := in.Get1(i)
+			if h := v.SupHwIf(v.SwIf(r0.Si)); h != nil {
+				m.input(h.Hi(), r0.DataSlice(), now)
+			}
+			i++
+		}
+	}
+	n.Redirect(in, o, rx_next_punt)
+}
+
+// Frame waiting for transmission.
+type txFrame struct {
+	next uint
+	si   vnet.Si
+	b    []byte
+}
+
+// Maximum number of frames waiting for transmission.
+const maxTxFrames = vnet.MaxVectorLen
+
+// Node transmitting LLDPDUs.  Nexts to interface output nodes are added as interfaces are enabled.
+type txNode struct {
+	vnet.InputNode
+	m      *Main
+	pool   vnet.BufferPool
+	tmp    vnet.RefVec
+	frames []txFrame
+}
+
+func (n *txNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "lldp-tx")
+	p := &n.pool
+	p.BufferTemplate = vnet.DefaultBufferPool.BufferTemplate
+	p.Name = "lldp-tx"
+	v.AddBufferPool(p)
+}
+
+// Queue frame for transmission on given next.  Called with lock held.
+func (n *txNode) queue(next uint, si vnet.Si, b []byte) (ok bool) {
+	if len(n.frames) >= maxTxFrames {
+		return
+	}
+	n.frames = append(n.frames, txFrame{next: next, si: si, b: b})
+	if len(n.frames) == 1 {
+		n.Activate(true)
+	}
+	return true
+}
+
+func (n *txNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	done := 0
+	for ; done < len(n.frames); done++ {
+		f := &n.frames[done]
+		out := &o.Outs[f.next]
+		if out.GetLen(v) >= out.Cap() {
+			break
+		}
+		n.tmp.Validate(0)
+		n.pool.AllocRefs(n.tmp[:1])
+		r := n.tmp[0]
+		r.SetDataLen(uint(len(f.b)))
+		copy(r.DataSlice(), f.b)
+		r.Si = f.si
+		out.BufferPool = &n.pool
+		out.Refs[out.AddLen(v)] = r
+	}
+	l := copy(n.frames, n.frames[done:])
+	n.frames = n.frames[:l]
+	n.Activate(l > 0)
+}
@@ -0,0 +1,459 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lldp provides a link layer discovery protocol (IEEE 802.1AB) agent.
+//
+// LLDP is enabled per hardware interface.  Enabled interfaces send LLDPDUs with
+// chassis id, interface name as port id, system name and management address
+// every transmit interval and when link comes up.  Ethernet input sends
+// LLDPDUs to the lldp-input node which parses those received on enabled
+// interfaces into a neighbor table and passes all frames on to punt.
+// Neighbors age out after the ttl they advertise; hooks registered with
+// RegisterNeighborHook are called when neighbors are added, change or go away.
+package lldp
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var packageIndex uint
+
+type Config struct {
+	// Seconds between transmissions.
+	TxInterval float64
+	// Neighbors keep our information for TxHold times TxInterval.
+	TxHold            uint
+	SystemName        string
+	SystemDescription string
+	// Chassis id sent as mac address; system name is sent as locally assigned chassis id when empty.
+	ChassisId net.HardwareAddr
+	// Management address; first ip4 address of interface is sent when nil.
+	MgmtAddr net.IP
+}
+
+// Ttl advertised by enabled interfaces.
+func (c *Config) ttl() uint16 {
+	t := c.TxInterval * float64(c.TxHold)
+	if t > 0xffff {
+		t = 0xffff
+	}
+	return uint16(t)
+}
+
+type Neighbor struct {
+	// Interface neighbor was received on.
+	Hi                vnet.Hi
+	ChassisId         string
+	PortId            string
+	PortDescription   string
+	SystemName        string
+	SystemDescription string
+	// Enabled system capabilities.
+	Capabilities uint16
+	MgmtAddrs    []net.IP
+	Ttl          uint16
+
+	expires cpu.Time
+}
+
+// NeighborHook is called when a neighbor is added or changes and, with isDel set, when it
+// ages out, shuts down or its interface goes down.
+type NeighborHook func(n *Neighbor, isDel bool)
+
+type neighborKey struct {
+	hi      vnet.Hi
+	chassis string
+	port    string
+}
+
+type neighborChange struct {
+	n     Neighbor
+	isDel bool
+}
+
+const (
+	counterTx = iota
+	counterRx
+	counterDiscard
+	counterAgeout
+	nCounter
+)
+
+type port struct {
+	hi vnet.Hi
+	// Next of tx node for interface output node.
+	next   uint
+	nextTx cpu.Time
+	// Set when shutdown LLDPDU is to be sent.
+	shutdown   bool
+	nNeighbors uint
+	counters   [nCounter]uint64
+}
+
+// Maximum number of neighbors per interface; LLDPDUs from further neighbors are discarded.
+const maxNeighbors = 32
+
+type Main struct {
+	vnet.Package
+	Config
+
+	mu        sync.Mutex
+	ports     map[vnet.Hi]*port
+	neighbors map[neighborKey]*Neighbor
+
+	hooks   []NeighborHook
+	changes []neighborChange
+
+	rxNode rxNode
+	txNode txNode
+
+	timerEvent timerEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	m.TxInterval = 30
+	m.TxHold = 4
+	m.SystemName, _ = os.Hostname()
+	packageIndex = v.AddPackage("lldp", m)
+	m.DependsOn("ethernet", "ip4")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. lldp { tx-interval 10 tx-hold 3 system-name leaf1 management-address 10.0.0.1 }
+func (m *Main) Configure(in *parse.Input) {
+	c := &m.Config
+	var (
+		mac  net.HardwareAddr
+		addr net.IP
+		s    string
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("tx-interval %f", &c.TxInterval) && c.TxInterval >= 1:
+		case in.Parse("tx-hold %d", &c.TxHold) && c.TxHold > 0:
+		case in.Parse("system-name %s", &c.SystemName):
+		case in.Parse("system-description %s", &s):
+			c.SystemDescription = s
+		case in.Parse("chassis-id %s", &s):
+			var err error
+			if mac, err = net.ParseMAC(s); err != nil || len(mac) != 6 {
+				in.ParseError()
+			}
+			c.ChassisId = mac
+		case in.Parse("management-address %s", &s):
+			if addr = net.ParseIP(s); addr == nil {
+				in.ParseError()
+			}
+			c.MgmtAddr = addr
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between timer scans: neighbor aging and transmit.
+const timerInterval = 1
+
+type timerEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *timerEvent) String() string { return "lldp timer" }
+func (e *timerEvent) EventAction() {
+	e.m.timer(cpu.TimeNow())
+	e.SignalEventAfter(e, timerInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.rxNode.init(v, m)
+	m.txNode.init(v, m)
+	ethernet.RegisterInputType(v, etherType, "lldp-input")
+	v.RegisterHwIfAddDelHook(m.hwIfAddDel)
+	v.RegisterHwIfLinkUpDownHook(m.hwIfLinkUpDown)
+	m.timerEvent.m = m
+	v.SignalEventAfter(&m.timerEvent, timerInterval)
+	m.cliInit()
+	return
+}
+
+// RegisterNeighborHook registers function called when neighbors change.
+func (m *Main) RegisterNeighborHook(h NeighborHook) {
+	m.mu.Lock()
+	m.hooks = append(m.hooks, h)
+	m.mu.Unlock()
+}
+
+// Enable enables or disables LLDP on hardware interface.  Disabled interfaces send
+// a shutdown LLDPDU and forget their neighbors.
+func (m *Main) Enable(hi vnet.Hi, enable bool) (err error) {
+	v := m.Vnet
+	h := v.HwIf(hi)
+	m.mu.Lock()
+	p, ok := m.ports[hi]
+	if !enable {
+		if ok {
+			p.shutdown = true
+			m.send(p, h)
+			m.delPort(p)
+		}
+		m.mu.Unlock()
+		m.notify()
+		return
+	}
+	m.mu.Unlock()
+	if ok {
+		return
+	}
+	output := h.OutputNodeName()
+	if len(output) == 0 {
+		return fmt.Errorf("%s: no output node", h.Name())
+	}
+	p = &port{hi: hi}
+	p.next = v.AddNamedNext(&m.txNode, output)
+	p.nextTx = cpu.TimeNow()
+	m.mu.Lock()
+	if m.ports == nil {
+		m.ports = make(map[vnet.Hi]*port)
+	}
+	m.ports[hi] = p
+	m.mu.Unlock()
+	return
+}
+
+// Enabled returns true if LLDP is enabled on hardware interface.
+func (m *Main) Enabled(hi vnet.Hi) (ok bool) {
+	m.mu.Lock()
+	_, ok = m.ports[hi]
+	m.mu.Unlock()
+	return
+}
+
+// Forget port and its neighbors.  Called with lock held.
+func (m *Main) delPort(p *port) {
+	m.delNeighbors(p.hi)
+	delete(m.ports, p.hi)
+}
+
+func (m *Main) delNeighbors(hi vnet.Hi) {
+	for k, n := range m.neighbors {
+		if k.hi == hi {
+			m.delNeighbor(k, n)
+		}
+	}
+}
+
+func (m *Main) delNeighbor(k neighborKey, n *Neighbor) {
+	delete(m.neighbors, k)
+	if p, ok := m.ports[k.hi]; ok {
+		p.nNeighbors--
+	}
+	if len(m.hooks) > 0 {
+		m.changes = append(m.changes, neighborChange{n: *n, isDel: true})
+	}
+}
+
+// Call neighbor hooks for queued changes.  Called without lock so hooks may call back.
+func (m *Main) notify() {
+	m.mu.Lock()
+	cs, hs := m.changes, m.hooks
+	m.changes = nil
+	m.mu.Unlock()
+	for i := range cs {
+		for _, h := range hs {
+			h(&cs[i].n, cs[i].isDel)
+		}
+	}
+}
+
+// Neighbors returns neighbors sorted by interface, chassis and port id.
+func (m *Main) Neighbors() (ns []Neighbor) {
+	m.mu.Lock()
+	for _, n := range m.neighbors {
+		ns = append(ns, *n)
+	}
+	m.mu.Unlock()
+	sort.Slice(ns, func(i, j int) bool {
+		a, b := &ns[i], &ns[j]
+		if a.Hi != b.Hi {
+			return a.Hi < b.Hi
+		}
+		if a.ChassisId != b.ChassisId {
+			return a.ChassisId < b.ChassisId
+		}
+		return a.PortId < b.PortId
+	})
+	return
+}
+
+// Input adds neighbor from frame received on hardware interface.
+func (m *Main) input(hi vnet.Hi, b []byte, now cpu.Time) {
+	var n Neighbor
+	ok, err := n.parse(b)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	p, ok := m.ports[hi]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	if err != nil {
+		p.counters[counterDiscard]++
+		m.mu.Unlock()
+		return
+	}
+	p.counters[counterRx]++
+	n.Hi = hi
+	k := neighborKey{hi: hi, chassis: n.ChassisId, port: n.PortId}
+	old, exists := m.neighbors[k]
+	if exists {
+		n.expires = old.expires
+	}
+	switch {
+	case n.Ttl == 0:
+		// Shutdown: neighbor goes away at once.
+		if exists {
+			m.delNeighbor(k, old)
+		}
+	case exists && reflect.DeepEqual(&n, old):
+		old.expires = after(now, float64(n.Ttl))
+	case !exists && p.nNeighbors >= maxNeighbors:
+		p.counters[counterDiscard]++
+	default:
+		n.expires = after(now, float64(n.Ttl))
+		if m.neighbors == nil {
+			m.neighbors = make(map[neighborKey]*Neighbor)
+		}
+		if !exists {
+			p.nNeighbors++
+		}
+		m.neighbors[k] = &n
+		if len(m.hooks) > 0 {
+			m.changes = append(m.changes, neighborChange{n: n})
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+func after(now cpu.Time, secs float64) cpu.Time {
+	var dt cpu.Time
+	dt.Cycles(secs)
+	return now + dt
+}
+
+// Age neighbors and send LLDPDUs on interfaces which are due.
+func (m *Main) timer(now cpu.Time) {
+	m.mu.Lock()
+	m.age(now)
+	v := m.Vnet
+	for _, p := range m.ports {
+		if p.nextTx > now {
+			continue
+		}
+		if h := v.HwIf(p.hi); h.IsLinkUp() {
+			m.send(p, h)
+		}
+		p.nextTx = after(now, m.TxInterval)
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+// Called with lock held.
+func (m *Main) age(now cpu.Time) {
+	for k, n := range m.neighbors {
+		if n.expires <= now {
+			if p, ok := m.ports[k.hi]; ok {
+				p.counters[counterAgeout]++
+			}
+			m.delNeighbor(k, n)
+		}
+	}
+}
+
+// Queue LLDPDU for transmission on interface.  Called with lock held.
+func (m *Main) send(p *port, h *vnet.HwIf) {
+	v := m.Vnet
+	mgmt := m.MgmtAddr
+	if mgmt == nil {
+		if a := ip4.GetMain(v).IfFirstAddress(h.Si()); a != nil {
+			mgmt = a.Prefix.IP
+		}
+	}
+	ttl := m.ttl()
+	if p.shutdown {
+		ttl = 0
+	}
+	src := net.HardwareAddr(h.Hi().GetAddress(v))
+	b := m.Config.frame(src, h.Name(), mgmt, ttl)
+	if m.txNode.queue(p.next, h.Si(), b) {
+		p.counters[counterTx]++
+	}
+}
+
+func (m *Main) hwIfAddDel(v *vnet.Vnet, hi vnet.Hi, isDel bool) (err error) {
+	if !isDel {
+		return
+	}
+	m.mu.Lock()
+	if p, ok := m.ports[hi]; ok {
+		m.delPort(p)
+	}
+	m.mu.Unlock()
+	m.notify()
+	return
+}
+
+// Neighbors go away with link; LLDPDU is sent as soon as link comes up.
+func (m *Main) hwIfLinkUpDown(v *vnet.Vnet, hi vnet.Hi, isUp bool) (err error) {
+	m.mu.Lock()
+	if p, ok := m.ports[hi]; ok {
+		if isUp {
+			p.nextTx = cpu.TimeNow()
+		} else {
+			m.delNeighbors(hi)
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+	return
+}
+
+// ClearNeighbors forgets neighbors learned on all interfaces and zeros counters.
+func (m *Main) ClearNeighbors() {
+	m.mu.Lock()
+	for k, n := range m.neighbors {
+		m.delNeighbor(k, n)
+	}
+	for _, p := range m.ports {
+		p.counters = [nCounter]uint64{}
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+func (m *Main) sortedPorts() (ps []*port) {
+	for _, p := range m.ports {
+		ps = append(ps, p)
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].hi < ps[j].hi })
+	return
+}
@@ -0,0 +1,203 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lldp
+
+import (
+	"github.com/platinasystems/vnet/ethernet"
+
+	"fmt"
+	"net"
+	"unicode"
+)
+
+// Nearest bridge destination address and ethernet type of LLDPDUs (IEEE 802.1AB).
+var destination = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+
+const etherType = 0x88cc
+
+// TLV types.
+const (
+	tlvEnd = iota
+	tlvChassisId
+	tlvPortId
+	tlvTtl
+	tlvPortDescription
+	tlvSystemName
+	tlvSystemDescription
+	tlvCapabilities
+	tlvMgmtAddr
+)
+
+// Chassis and port id subtypes.
+const (
+	chassisMacAddress     = 4
+	chassisNetworkAddress = 5
+	chassisLocal          = 7
+	portMacAddress        = 3
+	portNetworkAddress    = 4
+	portInterfaceName     = 5
+)
+
+// System capabilities.
+const (
+	capBridge = 1 << 2
+	capRouter = 1 << 4
+)
+
+// Address family numbers of management and network addresses.
+const (
+	familyIp4 = 1
+	familyIp6 = 2
+)
+
+const (
+	sizeofHeader   = ethernet.SizeofHeader
+	minFrameLength = 60
+)
+
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) tlv(t uint, v ...[]byte) {
+	l := 0
+	for _, x := range v {
+		l += len(x)
+	}
+	e.b = append(e.b, byte(t<<1|uint(l)>>8), byte(l))
+	for _, x := range v {
+		e.b = append(e.b, x...)
+	}
+}
+
+func ipFamily(a net.IP) (family byte, b []byte) {
+	if b = a.To4(); b != nil {
+		family = familyIp4
+	} else if b = a.To16(); b != nil {
+		family = familyIp6
+	}
+	return
+}
+
+// LLDPDU sent from given source address and port with given ttl.  Management address is optional.
+func (c *Config) frame(src net.HardwareAddr, port string, mgmt net.IP, ttl uint16) []byte {
+	e := encoder{b: make([]byte, sizeofHeader, 256)}
+	copy(e.b[0:], destination)
+	copy(e.b[6:], src)
+	e.b[12], e.b[13] = etherType>>8, etherType&0xff
+
+	if len(c.ChassisId) > 0 {
+		e.tlv(tlvChassisId, []byte{chassisMacAddress}, c.ChassisId)
+	} else {
+		e.tlv(tlvChassisId, []byte{chassisLocal}, []byte(c.SystemName))
+	}
+	e.tlv(tlvPortId, []byte{portInterfaceName}, []byte(port))
+	e.tlv(tlvTtl, []byte{byte(ttl >> 8), byte(ttl)})
+	if len(c.SystemName) > 0 {
+		e.tlv(tlvSystemName, []byte(c.SystemName))
+	}
+	if len(c.SystemDescription) > 0 {
+		e.tlv(tlvSystemDescription, []byte(c.SystemDescription))
+	}
+	const caps = capBridge | capRouter
+	e.tlv(tlvCapabilities, []byte{caps >> 8, caps & 0xff, caps >> 8, caps & 0xff})
+	if family, a := ipFamily(mgmt); family != 0 {
+		// Address string length, family and address; unknown interface numbering and no oid.
+		e.tlv(tlvMgmtAddr, []byte{byte(1 + len(a)), family}, a, []byte{1, 0, 0, 0, 0, 0})
+	}
+	e.tlv(tlvEnd)
+	for len(e.b) < minFrameLength {
+		e.b = append(e.b, 0)
+	}
+	return e.b
+}
+
+// Format chassis or port id of given subtype.
+func formatId(subtype byte, b []byte, mac, network byte) string {
+	switch {
+	case subtype == mac && len(b) == 6:
+		return net.HardwareAddr(b).String()
+	case subtype == network && len(b) > 0:
+		if (b[0] == familyIp4 && len(b) == 5) || (b[0] == familyIp6 && len(b) == 17) {
+			return net.IP(b[1:]).String()
+		}
+	}
+	return printable(b)
+}
+
+func printable(b []byte) string {
+	for _, c := range string(b) {
+		if !unicode.IsPrint(c) {
+			return fmt.Sprintf("%x", b)
+		}
+	}
+	return string(b)
+}
+
+// Parse neighbor from ethernet frame.  Returns false if frame is not an LLDPDU; error
+// for malformed LLDPDUs.
+func (n *Neighbor) parse(b []byte) (ok bool, err error) {
+	if len(b) < sizeofHeader || uint(b[12])<<8|uint(b[13]) != etherType {
+		return
+	}
+	ok = true
+	*n = Neighbor{}
+	b = b[sizeofHeader:]
+	for i := 0; ; i++ {
+		if len(b) < 2 {
+			err = fmt.Errorf("truncated tlv")
+			return
+		}
+		t, l := uint(b[0]>>1), uint(b[0]&1)<<8|uint(b[1])
+		if uint(len(b)) < 2+l {
+			err = fmt.Errorf("tlv %d: length %d exceeds frame", t, l)
+			return
+		}
+		v := b[2 : 2+l]
+		b = b[2+l:]
+		// Chassis id, port id and ttl must come first and in order.
+		if i < 3 && t != uint(tlvChassisId+i) {
+			err = fmt.Errorf("tlv %d: expected mandatory tlv %d", t, tlvChassisId+i)
+			return
+		}
+		switch t {
+		case tlvEnd:
+			return
+		case tlvChassisId, tlvPortId:
+			if l < 2 {
+				err = fmt.Errorf("tlv %d: short id", t)
+				return
+			}
+			if t == tlvChassisId {
+				n.ChassisId = formatId(v[0], v[1:], chassisMacAddress, chassisNetworkAddress)
+			} else {
+				n.PortId = formatId(v[0], v[1:], portMacAddress, portNetworkAddress)
+			}
+		case tlvTtl:
+			if l < 2 {
+				err = fmt.Errorf("short ttl")
+				return
+			}
+			n.Ttl = uint16(v[0])<<8 | uint16(v[1])
+		case tlvPortDescription:
+			n.PortDescription = printable(v)
+		case tlvSystemName:
+			n.SystemName = printable(v)
+		case tlvSystemDescription:
+			n.SystemDescription = printable(v)
+		case tlvCapabilities:
+			if l >= 4 {
+				n.Capabilities = uint16(v[2])<<8 | uint16(v[3])
+			}
+		case tlvMgmtAddr:
+			if l >= 2 && int(v[0]) >= 2 && int(v[0])+1 <= len(v) {
+				a := v[2 : 1+v[0]]
+				if (v[1] == familyIp4 && len(a) == 4) || (v[1] == familyIp6 && len(a) == 16) {
+					n.MgmtAddrs = append(n.MgmtAddrs, append(net.IP(nil), a...))
+				}
+			}
+		}
+	}
+}
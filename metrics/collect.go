@@ -0,0 +1,93 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+
+	"fmt"
+	"sort"
+)
+
+// Collect all metrics.  Must be called from vnet event context since counters are not locked.
+func (m *Main) collect(x *exposition) {
+	m.collectInterfaces(x)
+	m.collectErrors(x)
+	m.collectBuffers(x)
+	m.collectAdjacencies(x)
+}
+
+func (m *Main) collectInterfaces(x *exposition) {
+	v := m.Vnet
+	v.SyncSwIfCounters()
+	v.ForeachSwIfCounter(m.zero, func(si vnet.Si, siName, counterName string, value uint64) {
+		x.counter("vnet_interface_counter", "Software interface counters.", value,
+			"interface", siName, "counter", counterName)
+	})
+	v.ForeachHwIfCounter(m.zero, false, func(hi vnet.Hi, counterName string, value uint64) {
+		x.counter("vnet_hw_interface_counter", "Hardware interface counters.", value,
+			"interface", v.HwIf(hi).Name(), "counter", counterName)
+	})
+}
+
+func (m *Main) collectErrors(x *exposition) {
+	m.Vnet.ForeachError(m.zero, func(nodeName, errorName string, count uint64) {
+		x.counter("vnet_node_errors", "Per node error counts.", count,
+			"node", nodeName, "error", errorName)
+	})
+}
+
+func (m *Main) collectBuffers(x *exposition) {
+	bm := &m.Vnet.BufferMain
+	names := make([]string, 0, len(bm.PoolByName))
+	for name := range bm.PoolByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := bm.PoolByName[name]
+		x.gauge("vnet_buffer_pool_buffer_bytes", "Size of data area of each buffer in pool.",
+			float64(p.Size), "pool", name)
+		x.gauge("vnet_buffer_pool_free_bytes", "Bytes in free buffers of pool.",
+			float64(p.SizeIncludingOverhead()*p.FreeLen()), "pool", name)
+		x.gauge("vnet_buffer_pool_dma_allocated_bytes", "DMA memory allocated by pool.",
+			float64(p.DmaMemAllocBytes), "pool", name)
+	}
+}
+
+func (m *Main) collectAdjacencies(x *exposition) {
+	v := m.Vnet
+	if i, ok := v.PackageByName("ip4"); ok {
+		m.collectAdjacencyCounters(x, "ip4", &v.GetPackage(i).(*ip4.Main).Main)
+	}
+	if i, ok := v.PackageByName("ip6"); ok {
+		m.collectAdjacencyCounters(x, "ip6", &v.GetPackage(i).(*ip6.Main).Main)
+	}
+}
+
+func (m *Main) collectAdjacencyCounters(x *exposition, family string, im *ip.Main) {
+	v := m.Vnet
+	// Sync adjacency stats with hardware.
+	im.CallAdjSyncCounterHooks()
+	im.ForeachAdj(func(a ip.Adj, adj *ip.Adjacency) {
+		intf := ""
+		if adj.IsRewrite() {
+			intf = vnet.SiName{V: v, Si: adj.Si}.String()
+		}
+		adjName := fmt.Sprintf("%d", a)
+		im.ForeachAdjCounter(a, func(tag string, c vnet.CombinedCounter) {
+			if c.Packets == 0 && !m.zero {
+				return
+			}
+			x.counter("vnet_adjacency_packets", "Packets forwarded via adjacency.", c.Packets,
+				"family", family, "adj", adjName, "interface", intf, "tag", tag)
+			x.counter("vnet_adjacency_bytes", "Bytes forwarded via adjacency.", c.Bytes,
+				"family", family, "adj", adjName, "interface", intf, "tag", tag)
+		})
+	})
+}
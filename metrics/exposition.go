@@ -0,0 +1,111 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Prometheus text exposition format version 0.0.4.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricType int
+
+const (
+	counter metricType = iota
+	gauge
+)
+
+var metricTypeStrings = [...]string{
+	counter: "counter",
+	gauge:   "gauge",
+}
+
+func (t metricType) String() string { return metricTypeStrings[t] }
+
+type sample struct {
+	labels []string // name, value pairs
+	value  float64
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	samples []sample
+}
+
+// Metric families in order of first use.
+type exposition struct {
+	families []*family
+	byName   map[string]*family
+}
+
+func (x *exposition) family(name, help string, typ metricType) (f *family) {
+	if x.byName == nil {
+		x.byName = make(map[string]*family)
+	}
+	var ok bool
+	if f, ok = x.byName[name]; !ok {
+		f = &family{name: name, help: help, typ: typ}
+		x.byName[name] = f
+		x.families = append(x.families, f)
+	}
+	return
+}
+
+// Add sample to named family.  Labels are given as name, value pairs.
+func (f *family) add(value float64, labels ...string) {
+	if len(labels)%2 != 0 {
+		panic("metrics: odd number of label arguments")
+	}
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+func (x *exposition) counter(name, help string, value uint64, labels ...string) {
+	x.family(name, help, counter).add(float64(value), labels...)
+}
+
+func (x *exposition) gauge(name, help string, value float64, labels ...string) {
+	x.family(name, help, gauge).add(value, labels...)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (x *exposition) write(w io.Writer) (err error) {
+	b := bufio.NewWriter(w)
+	for _, f := range x.families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "# HELP %s %s\n", f.name, helpEscaper.Replace(f.help))
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+		for i := range f.samples {
+			s := &f.samples[i]
+			b.WriteString(f.name)
+			if len(s.labels) > 0 {
+				b.WriteByte('{')
+				for j := 0; j < len(s.labels); j += 2 {
+					if j > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(b, "%s=\"%s\"", s.labels[j], labelEscaper.Replace(s.labels[j+1]))
+				}
+				b.WriteByte('}')
+			}
+			fmt.Fprintf(b, " %s\n", formatValue(s.value))
+		}
+	}
+	return b.Flush()
+}
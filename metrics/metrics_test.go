@@ -0,0 +1,116 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testExposition() (x *exposition) {
+	x = &exposition{}
+	x.counter("vnet_interface_counter", "Software interface counters.", 10,
+		"interface", "eth-0-0", "counter", "rx packets")
+	x.counter("vnet_interface_counter", "Software interface counters.", 1234,
+		"interface", "eth-0-0", "counter", "rx bytes")
+	x.counter("vnet_node_errors", "Per node error counts.", 3,
+		"node", "ip4-input", "error", `bad "checksum"`)
+	x.gauge("vnet_buffer_pool_free_bytes", "Bytes in free buffers of pool.", 2048, "pool", "default")
+	return
+}
+
+const testExpected = `# HELP vnet_interface_counter Software interface counters.
+# TYPE vnet_interface_counter counter
+vnet_interface_counter{interface="eth-0-0",counter="rx packets"} 10
+vnet_interface_counter{interface="eth-0-0",counter="rx bytes"} 1234
+# HELP vnet_node_errors Per node error counts.
+# TYPE vnet_node_errors counter
+vnet_node_errors{node="ip4-input",error="bad \"checksum\""} 3
+# HELP vnet_buffer_pool_free_bytes Bytes in free buffers of pool.
+# TYPE vnet_buffer_pool_free_bytes gauge
+vnet_buffer_pool_free_bytes{pool="default"} 2048
+`
+
+func testGather(w io.Writer, cancel <-chan struct{}) error { return testExposition().write(w) }
+
+func scrape(t *testing.T, c *http.Client, url string) {
+	r, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Fatalf("status %s", r.Status)
+	}
+	if got := r.Header.Get("Content-Type"); got != ContentType {
+		t.Errorf("content type: got %q want %q", got, ContentType)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testExpected {
+		t.Errorf("got:\n%s\nwant:\n%s", b, testExpected)
+	}
+}
+
+func TestScrapeTcp(t *testing.T) {
+	s := &server{network: "tcp", address: "127.0.0.1:0"}
+	if err := s.listen(testGather); err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	scrape(t, http.DefaultClient, "http://"+s.l.Addr().String()+"/metrics")
+}
+
+func TestScrapeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vnet-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.sock")
+	s := &server{network: "unix", address: path}
+	if err := s.listen(testGather); err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	c := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	scrape(t, c, "http://unix/metrics")
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	s := &server{network: "tcp", address: "127.0.0.1:0", timeout: 10 * time.Millisecond}
+	err := s.listen(func(w io.Writer, cancel <-chan struct{}) error {
+		<-cancel
+		return errScrapeCancelled
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	r, err := http.Get("http://" + s.l.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status: got %s want %d", r.Status, http.StatusServiceUnavailable)
+	}
+}
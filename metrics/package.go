@@ -0,0 +1,102 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics exports vnet interface, error, buffer and adjacency
+// counters in Prometheus text format via HTTP at /metrics.
+package metrics
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+
+	"bytes"
+	"io"
+	"time"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+	server
+
+	// Report zero counters.
+	zero bool
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("metrics", m)
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. metrics { tcp :9100 } or metrics { unix /run/vnet-metrics.sock zero }
+func (m *Main) Configure(in *parse.Input) {
+	for !in.End() {
+		var secs float64
+		switch {
+		case in.Parse("tcp %s", &m.address):
+			m.network = "tcp"
+		case in.Parse("unix %s", &m.address):
+			m.network = "unix"
+		case in.Parse("zero"):
+			m.zero = true
+		case in.Parse("timeout %f", &secs):
+			m.timeout = time.Duration(secs * float64(time.Second))
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func (m *Main) Init() (err error) {
+	if len(m.address) == 0 {
+		return
+	}
+	return m.listen(m.gather)
+}
+
+func (m *Main) Exit() (err error) {
+	m.close()
+	return
+}
+
+// WriteMetrics writes all metrics in Prometheus text format.
+// Must be called from vnet event context (e.g. CLI or event action).
+func (m *Main) WriteMetrics(w io.Writer) error {
+	var x exposition
+	m.collect(&x)
+	return x.write(w)
+}
+
+type scrapeEvent struct {
+	vnet.Event
+	m    *Main
+	b    bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+func (e *scrapeEvent) String() string { return "metrics scrape" }
+func (e *scrapeEvent) EventAction() {
+	e.err = e.m.WriteMetrics(&e.b)
+	close(e.done)
+}
+
+// Collect metrics from outside of vnet event context by signalling an event and waiting for it to finish.
+func (m *Main) gather(w io.Writer, cancel <-chan struct{}) (err error) {
+	e := &scrapeEvent{m: m, done: make(chan struct{})}
+	m.Vnet.SignalEvent(e)
+	select {
+	case <-e.done:
+	case <-cancel:
+		return errScrapeCancelled
+	}
+	if err = e.err; err != nil {
+		return
+	}
+	_, err = e.b.WriteTo(w)
+	return
+}
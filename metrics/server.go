@@ -0,0 +1,88 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+var errScrapeCancelled = errors.New("scrape cancelled")
+
+// Write metrics to given writer; gather should give up when cancel is closed.
+type gatherFunc func(w io.Writer, cancel <-chan struct{}) error
+
+type server struct {
+	// Either tcp or unix.
+	network string
+	// Listen address: host:port for tcp; path for unix sockets.
+	address string
+
+	// Scrapes taking longer than this fail.
+	timeout time.Duration
+
+	l net.Listener
+	s *http.Server
+}
+
+const defaultTimeout = 10 * time.Second
+
+func (s *server) listen(f gatherFunc) (err error) {
+	if s.network == "unix" {
+		// Remove stale socket left from previous run.
+		os.Remove(s.address)
+	}
+	if s.l, err = net.Listen(s.network, s.address); err != nil {
+		err = fmt.Errorf("metrics listen %s %s: %v", s.network, s.address, err)
+		return
+	}
+	if s.timeout == 0 {
+		s.timeout = defaultTimeout
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &handler{gather: f, timeout: s.timeout})
+	s.s = &http.Server{Handler: mux}
+	go s.s.Serve(s.l)
+	return
+}
+
+func (s *server) close() {
+	if s.s == nil {
+		return
+	}
+	s.s.Close()
+	s.s, s.l = nil, nil
+	if s.network == "unix" {
+		os.Remove(s.address)
+	}
+}
+
+type handler struct {
+	gather  gatherFunc
+	timeout time.Duration
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cancel := make(chan struct{})
+	t := time.AfterFunc(h.timeout, func() { close(cancel) })
+	defer t.Stop()
+	var b bytes.Buffer
+	if err := h.gather(&b, cancel); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	b.WriteTo(w)
+}
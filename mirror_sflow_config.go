@@ -4,37 +4,45 @@
 package vnet
 
 import (
-	"errors"
-	"fmt"
 	"gopkg.in/yaml.v2"
+
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
+// Default path of mirror and sflow configuration; may be changed with vnet { msconfig PATH }.
+const DefaultMirrorSflowConfigFile = "/etc/goes/msconfig.cfg"
+
 type MirrorConfigData struct {
-	Name string
-	Src string
-	Dst string
-	Type string
-	Active string
+	Name string `yaml:"name" json:"name"`
+	Src  string `yaml:"src" json:"src"`
+	// Destination profile name.
+	Dst    string `yaml:"dst" json:"dst"`
+	Type   string `yaml:"type" json:"type"`
+	Active string `yaml:"active" json:"active"`
 }
 
 type DestConfigData struct {
-	Name string
-	Encap string
-	Agent_IP string
-	Binded_to string
-	Used_by string
+	Name     string `yaml:"name" json:"name"`
+	Encap    string `yaml:"encap" json:"encap"`
+	Agent_IP string `yaml:"agent_ip" json:"agent_ip"`
+	// Mirror or sflow profile names.
+	Binded_to string `yaml:"binded_to" json:"binded_to"`
+	Used_by   string `yaml:"used_by" json:"used_by"`
 }
 
 type SflowConfigData struct {
-	Name	string
-	Src		string
-	Active	string
-	Cpu		string
-	Mirror  string
-	Rate 	string
-	Dst 	string
+	Name   string `yaml:"name" json:"name"`
+	Src    string `yaml:"src" json:"src"`
+	Active string `yaml:"active" json:"active"`
+	Cpu    string `yaml:"cpu" json:"cpu"`
+	// Mirror profile name.
+	Mirror string `yaml:"mirror" json:"mirror"`
+	Rate   string `yaml:"rate" json:"rate"`
+	// Destination profile name.
+	Dst string `yaml:"dst" json:"dst"`
 }
 
 type MirrorConfigFileData struct {
@@ -49,86 +57,282 @@ type SflowConfigFileData struct {
 	Sflow []SflowConfigData
 }
 
-type ConfigFileData struct{
+type ConfigFileData struct {
 	MirrorCfgFileData MirrorConfigFileData
-	DestCfgFileData DestConfigFileData
-	SflowCfgFileData SflowConfigFileData
+	DestCfgFileData   DestConfigFileData
+	SflowCfgFileData  SflowConfigFileData
+
+	// Path of config file; DefaultMirrorSflowConfigFile if empty.
+	Path string
 }
 
-func (cfd *ConfigFileData) ReadConfigFile() (err error){
-	var fileData []byte
+// Config file as stored on disk.
+type mirrorSflowConfigFile struct {
+	Dest   []DestConfigData   `yaml:"dest,omitempty" json:"dest"`
+	Mirror []MirrorConfigData `yaml:"mirror,omitempty" json:"mirror"`
+	Sflow  []SflowConfigData  `yaml:"sflow,omitempty" json:"sflow"`
+}
 
-	// Open file
-	file, err := os.Open("/etc/goes/msconfig.cfg")
-	if err != nil {
-		return err
+type mirrorSflowConfigMain struct {
+	msConfigFile string
+}
+
+// MirrorSflowConfig returns empty configuration for file as configured for vnet.
+func (v *Vnet) MirrorSflowConfig() *ConfigFileData {
+	return &ConfigFileData{Path: v.msConfigFile}
+}
+
+func (cfd *ConfigFileData) path() string {
+	if len(cfd.Path) > 0 {
+		return cfd.Path
 	}
+	return DefaultMirrorSflowConfigFile
+}
 
-	// Close file at the end of function
-	defer file.Close()
+func (cfd *ConfigFileData) file() mirrorSflowConfigFile {
+	return mirrorSflowConfigFile{
+		Dest:   cfd.DestCfgFileData.Dest,
+		Mirror: cfd.MirrorCfgFileData.Mirror,
+		Sflow:  cfd.SflowCfgFileData.Sflow,
+	}
+}
 
-	// Read config file
-	fileData, err = ioutil.ReadFile(file.Name())
-	if err != nil {
-		return err
+// Parse parses config file contents.  Errors give line numbers; unknown keys are errors.
+// Cross references are checked by Validate.
+func (cfd *ConfigFileData) Parse(b []byte) (err error) {
+	var f mirrorSflowConfigFile
+	if err = yaml.UnmarshalStrict(b, &f); err != nil {
+		return
 	}
+	cfd.DestCfgFileData.Dest = f.Dest
+	cfd.MirrorCfgFileData.Mirror = f.Mirror
+	cfd.SflowCfgFileData.Sflow = f.Sflow
+	return
+}
 
-	// Parse mirror config from file fileData
-	yaml.Unmarshal(fileData, &cfd.MirrorCfgFileData)
+func (cfd *ConfigFileData) ReadConfigFile() (err error) {
+	fileData, err := ioutil.ReadFile(cfd.path())
 	if err != nil {
-		err = errors.New("yaml unmarshal failed while reading mirror config.")
-		return err
+		return
+	}
+	if err = cfd.Parse(fileData); err != nil {
+		err = fmt.Errorf("%s: %v", cfd.path(), err)
 	}
+	return
+}
 
-	// Parse destination config from file fileData
-	yaml.Unmarshal(fileData, &cfd.DestCfgFileData)
+// WriteConfigFile validates configuration and atomically replaces config file
+// by writing a temporary file in the same directory and renaming it.
+func (cfd *ConfigFileData) WriteConfigFile() (err error) {
+	if err = cfd.Validate(); err != nil {
+		return
+	}
+	f := cfd.file()
+	fileData, err := yaml.Marshal(&f)
 	if err != nil {
-		err = errors.New("yaml unmarshal failed while reading destination config.")
-		return err
+		return
+	}
+	path := cfd.path()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(fileData); err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
 	}
-
-	// Parse sflow config from file fileData
-	yaml.Unmarshal(fileData, &cfd.SflowCfgFileData)
 	if err != nil {
-		err = errors.New("yaml unmarshal failed while reading sflow config.")
-		return err
+		return
+	}
+	err = os.Rename(tmp.Name(), path)
+	return
+}
+
+// EditConfigFile reads config file (a missing file is empty), calls edit and writes
+// the result back.  Nothing is written if edit or validation fails.
+func (cfd *ConfigFileData) EditConfigFile(edit func(cfd *ConfigFileData) error) (err error) {
+	if err = cfd.ReadConfigFile(); os.IsNotExist(err) {
+		*cfd = ConfigFileData{Path: cfd.Path}
+	} else if err != nil {
+		return
+	}
+	if err = edit(cfd); err != nil {
+		return
 	}
+	return cfd.WriteConfigFile()
+}
 
-	return err
+func (cfd *ConfigFileData) destIndex(name string) int {
+	for i := range cfd.DestCfgFileData.Dest {
+		if cfd.DestCfgFileData.Dest[i].Name == name {
+			return i
+		}
+	}
+	return -1
 }
 
-func (cfd *ConfigFileData) WriteConfigFile() (err error){
+func (cfd *ConfigFileData) mirrorIndex(name string) int {
+	for i := range cfd.MirrorCfgFileData.Mirror {
+		if cfd.MirrorCfgFileData.Mirror[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
 
-	// Create file
-	file, err := os.Create("/etc/goes/msconfig.cfg")
-	if err != nil {
-		fmt.Println(err)
+func (cfd *ConfigFileData) sflowIndex(name string) int {
+	for i := range cfd.SflowCfgFileData.Sflow {
+		if cfd.SflowCfgFileData.Sflow[i].Name == name {
+			return i
+		}
 	}
+	return -1
+}
 
-	// Close file at the end of function
-	defer file.Close()
+// Validate checks that profile names are given and unique and that
+// profiles referenced by other profiles exist.
+func (cfd *ConfigFileData) Validate() (err error) {
+	ds, ms, ss := cfd.DestCfgFileData.Dest, cfd.MirrorCfgFileData.Mirror, cfd.SflowCfgFileData.Sflow
+	for i := range ds {
+		if err = checkProfileName("dest", ds[i].Name, cfd.destIndex(ds[i].Name) != i); err != nil {
+			return
+		}
+	}
+	for i := range ms {
+		if err = checkProfileName("mirror", ms[i].Name, cfd.mirrorIndex(ms[i].Name) != i); err != nil {
+			return
+		}
+	}
+	for i := range ss {
+		if err = checkProfileName("sflow", ss[i].Name, cfd.sflowIndex(ss[i].Name) != i); err != nil {
+			return
+		}
+	}
+	isMirrorOrSflow := func(name string) bool { return cfd.mirrorIndex(name) >= 0 || cfd.sflowIndex(name) >= 0 }
+	for i := range ds {
+		d := &ds[i]
+		if len(d.Binded_to) > 0 && !isMirrorOrSflow(d.Binded_to) {
+			return fmt.Errorf("dest %s: binded_to: no mirror or sflow profile named `%s'", d.Name, d.Binded_to)
+		}
+		if len(d.Used_by) > 0 && !isMirrorOrSflow(d.Used_by) {
+			return fmt.Errorf("dest %s: used_by: no mirror or sflow profile named `%s'", d.Name, d.Used_by)
+		}
+	}
+	for i := range ms {
+		m := &ms[i]
+		if len(m.Dst) > 0 && cfd.destIndex(m.Dst) < 0 {
+			return fmt.Errorf("mirror %s: dst: no dest profile named `%s'", m.Name, m.Dst)
+		}
+	}
+	for i := range ss {
+		s := &ss[i]
+		if len(s.Mirror) > 0 && cfd.mirrorIndex(s.Mirror) < 0 {
+			return fmt.Errorf("sflow %s: mirror: no mirror profile named `%s'", s.Name, s.Mirror)
+		}
+		if len(s.Dst) > 0 && cfd.destIndex(s.Dst) < 0 {
+			return fmt.Errorf("sflow %s: dst: no dest profile named `%s'", s.Name, s.Dst)
+		}
+	}
+	return
+}
 
-	// Write to file in yaml format
+func checkProfileName(kind, name string, isDup bool) (err error) {
+	switch {
+	case len(name) == 0:
+		err = fmt.Errorf("%s profile with empty name", kind)
+	case isDup:
+		err = fmt.Errorf("%s %s: duplicate profile name", kind, name)
+	}
+	return
+}
 
-	mirrorYamlData, _ := yaml.Marshal(&cfd.MirrorCfgFileData.Mirror)
-	destYamlData, _ :=   yaml.Marshal(&cfd.DestCfgFileData.Dest)
-	sflowYamlData,_ :=  yaml.Marshal(&cfd.SflowCfgFileData.Sflow)
+func profileExistsError(kind, name string, exists bool) (err error) {
+	if exists {
+		err = fmt.Errorf("%s %s: profile already exists", kind, name)
+	} else {
+		err = fmt.Errorf("%s %s: no such profile", kind, name)
+	}
+	return
+}
 
-	fileData := ""
+// SetDest adds a new destination profile or, with isUpdate, replaces an existing one.
+func (cfd *ConfigFileData) SetDest(d DestConfigData, isUpdate bool) (err error) {
+	i := cfd.destIndex(d.Name)
+	if exists := i >= 0; exists != isUpdate {
+		return profileExistsError("dest", d.Name, exists)
+	}
+	if isUpdate {
+		cfd.DestCfgFileData.Dest[i] = d
+	} else {
+		cfd.DestCfgFileData.Dest = append(cfd.DestCfgFileData.Dest, d)
+	}
+	return
+}
 
-	if len(cfd.DestCfgFileData.Dest) > 0 {
-		fileData += "dest:\n" + (string)(destYamlData)
+func (cfd *ConfigFileData) DelDest(name string) (err error) {
+	i := cfd.destIndex(name)
+	if i < 0 {
+		return profileExistsError("dest", name, false)
 	}
+	ds := cfd.DestCfgFileData.Dest
+	cfd.DestCfgFileData.Dest = append(ds[:i:i], ds[i+1:]...)
+	return
+}
 
-	if len(cfd.MirrorCfgFileData.Mirror) > 0 {
-		fileData += "\n\n" + "mirror:\n" + (string)(mirrorYamlData)
+// SetMirror adds a new mirror profile or, with isUpdate, replaces an existing one.
+func (cfd *ConfigFileData) SetMirror(m MirrorConfigData, isUpdate bool) (err error) {
+	i := cfd.mirrorIndex(m.Name)
+	if exists := i >= 0; exists != isUpdate {
+		return profileExistsError("mirror", m.Name, exists)
+	}
+	if isUpdate {
+		cfd.MirrorCfgFileData.Mirror[i] = m
+	} else {
+		cfd.MirrorCfgFileData.Mirror = append(cfd.MirrorCfgFileData.Mirror, m)
 	}
+	return
+}
 
-	if len(cfd.SflowCfgFileData.Sflow) > 0 {
-		fileData += "\n\n" + "sflow:\n" + (string)(sflowYamlData)
+func (cfd *ConfigFileData) DelMirror(name string) (err error) {
+	i := cfd.mirrorIndex(name)
+	if i < 0 {
+		return profileExistsError("mirror", name, false)
 	}
+	ms := cfd.MirrorCfgFileData.Mirror
+	cfd.MirrorCfgFileData.Mirror = append(ms[:i:i], ms[i+1:]...)
+	return
+}
 
-	file.Write(([]byte)(fileData))
+// SetSflow adds a new sflow profile or, with isUpdate, replaces an existing one.
+func (cfd *ConfigFileData) SetSflow(s SflowConfigData, isUpdate bool) (err error) {
+	i := cfd.sflowIndex(s.Name)
+	if exists := i >= 0; exists != isUpdate {
+		return profileExistsError("sflow", s.Name, exists)
+	}
+	if isUpdate {
+		cfd.SflowCfgFileData.Sflow[i] = s
+	} else {
+		cfd.SflowCfgFileData.Sflow = append(cfd.SflowCfgFileData.Sflow, s)
+	}
+	return
+}
 
-	return err
-}
\ No newline at end of file
+func (cfd *ConfigFileData) DelSflow(name string) (err error) {
+	i := cfd.sflowIndex(name)
+	if i < 0 {
+		return profileExistsError("sflow", name, false)
+	}
+	ss := cfd.SflowCfgFileData.Sflow
+	cfd.SflowCfgFileData.Sflow = append(ss[:i:i], ss[i+1:]...)
+	return
+}
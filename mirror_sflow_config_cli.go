@@ -0,0 +1,199 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+
+	"fmt"
+)
+
+func parseDest(in *cli.Input, d *DestConfigData) (err error) {
+	for !in.End() {
+		switch {
+		case in.Parse("encap %s", &d.Encap):
+		case in.Parse("agent%*_ip %s", &d.Agent_IP):
+		case in.Parse("binded%*_to %s", &d.Binded_to):
+		case in.Parse("used%*_by %s", &d.Used_by):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	return
+}
+
+func parseMirror(in *cli.Input, m *MirrorConfigData) (err error) {
+	for !in.End() {
+		switch {
+		case in.Parse("src %s", &m.Src):
+		case in.Parse("dst %s", &m.Dst):
+		case in.Parse("type %s", &m.Type):
+		case in.Parse("active %s", &m.Active):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	return
+}
+
+func parseSflow(in *cli.Input, s *SflowConfigData) (err error) {
+	for !in.End() {
+		switch {
+		case in.Parse("src %s", &s.Src):
+		case in.Parse("active %s", &s.Active):
+		case in.Parse("cpu %s", &s.Cpu):
+		case in.Parse("mirror %s", &s.Mirror):
+		case in.Parse("rate %s", &s.Rate):
+		case in.Parse("dst %s", &s.Dst):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	return
+}
+
+// Edit profiles in config file, e.g.
+//
+//	msconfig add dest d0 encap erspan agent_ip 10.0.0.1
+//	msconfig update mirror m0 active true
+//	msconfig delete sflow s0
+//
+// Update changes only the fields given.
+func (v *Vnet) msconfigEdit(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		isUpdate, isDel bool
+		kind, name      string
+	)
+	switch {
+	case in.Parse("add"):
+	case in.Parse("update"):
+		isUpdate = true
+	case in.Parse("del%*ete"):
+		isDel = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	switch {
+	case in.Parse("dest %s", &name):
+		kind = "dest"
+	case in.Parse("mirror %s", &name):
+		kind = "mirror"
+	case in.Parse("sflow %s", &name):
+		kind = "sflow"
+	default:
+		err = cli.ParseError
+		return
+	}
+	if isDel && !in.End() {
+		err = cli.ParseError
+		return
+	}
+
+	cfd := v.MirrorSflowConfig()
+	err = cfd.EditConfigFile(func(cfd *ConfigFileData) (err error) {
+		switch kind {
+		case "dest":
+			if isDel {
+				return cfd.DelDest(name)
+			}
+			d := DestConfigData{Name: name}
+			if i := cfd.destIndex(name); i >= 0 && isUpdate {
+				d = cfd.DestCfgFileData.Dest[i]
+			}
+			if err = parseDest(in, &d); err == nil {
+				err = cfd.SetDest(d, isUpdate)
+			}
+		case "mirror":
+			if isDel {
+				return cfd.DelMirror(name)
+			}
+			m := MirrorConfigData{Name: name}
+			if i := cfd.mirrorIndex(name); i >= 0 && isUpdate {
+				m = cfd.MirrorCfgFileData.Mirror[i]
+			}
+			if err = parseMirror(in, &m); err == nil {
+				err = cfd.SetMirror(m, isUpdate)
+			}
+		case "sflow":
+			if isDel {
+				return cfd.DelSflow(name)
+			}
+			s := SflowConfigData{Name: name}
+			if i := cfd.sflowIndex(name); i >= 0 && isUpdate {
+				s = cfd.SflowCfgFileData.Sflow[i]
+			}
+			if err = parseSflow(in, &s); err == nil {
+				err = cfd.SetSflow(s, isUpdate)
+			}
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	what := "written"
+	if isDel {
+		what = "deleted"
+	}
+	fmt.Fprintf(w, "%s: %s %s %s\n", cfd.path(), kind, name, what)
+	return
+}
+
+func (v *Vnet) showMsconfig(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var format ShowFormat
+	for !in.End() {
+		switch {
+		case in.Parse("f%*ormat %v", &format):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	cfd := v.MirrorSflowConfig()
+	if err = cfd.ReadConfigFile(); err != nil {
+		return
+	}
+	if !format.IsText() {
+		f := cfd.file()
+		return format.Write(w, &f)
+	}
+	fmt.Fprintf(w, "%s:\n", cfd.path())
+	if ds := cfd.DestCfgFileData.Dest; len(ds) > 0 {
+		fmt.Fprintln(w, "Destination profiles:")
+		elib.Tabulate(ds).Write(w)
+	}
+	if ms := cfd.MirrorCfgFileData.Mirror; len(ms) > 0 {
+		fmt.Fprintln(w, "Mirror profiles:")
+		elib.Tabulate(ms).Write(w)
+	}
+	if ss := cfd.SflowCfgFileData.Sflow; len(ss) > 0 {
+		fmt.Fprintln(w, "Sflow profiles:")
+		elib.Tabulate(ss).Write(w)
+	}
+	if e := cfd.Validate(); e != nil {
+		fmt.Fprintf(w, "Warning: %v\n", e)
+	}
+	return
+}
+
+func init() {
+	AddInit(func(v *Vnet) {
+		v.CliAdd(&cli.Command{
+			Name:      "msconfig",
+			ShortHelp: "add, update or delete mirror/sflow profiles: msconfig add|update|delete dest|mirror|sflow NAME [FIELD VALUE]...",
+			Action:    v.msconfigEdit,
+		})
+		v.CliAdd(&cli.Command{
+			Name:      "show msconfig",
+			ShortHelp: "show mirror/sflow profiles",
+			Action:    v.showMsconfig,
+		})
+	})
+}
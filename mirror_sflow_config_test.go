@@ -0,0 +1,77 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorSflowConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "msconfig.cfg")
+
+	// Missing file is empty; references must exist.
+	cfd := &ConfigFileData{Path: path}
+	err = cfd.EditConfigFile(func(cfd *ConfigFileData) error {
+		return cfd.SetMirror(MirrorConfigData{Name: "m0", Dst: "d0"}, false)
+	})
+	if err == nil || !strings.Contains(err.Error(), "no dest profile named `d0'") {
+		t.Fatalf("expected missing dst error; got %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("invalid config written: %v", err)
+	}
+
+	err = cfd.EditConfigFile(func(cfd *ConfigFileData) (err error) {
+		if err = cfd.SetDest(DestConfigData{Name: "d0", Encap: "erspan", Agent_IP: "10.0.0.1"}, false); err != nil {
+			return
+		}
+		if err = cfd.SetMirror(MirrorConfigData{Name: "m0", Src: "eth-0-0", Dst: "d0"}, false); err != nil {
+			return
+		}
+		return cfd.SetSflow(SflowConfigData{Name: "s0", Mirror: "m0", Dst: "d0", Rate: "1000"}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfd = &ConfigFileData{Path: path}
+	if err = cfd.ReadConfigFile(); err != nil {
+		t.Fatal(err)
+	}
+	if d := cfd.DestCfgFileData.Dest; len(d) != 1 || d[0].Agent_IP != "10.0.0.1" {
+		t.Errorf("dest: got %+v", d)
+	}
+	if err = cfd.SetDest(DestConfigData{Name: "d0"}, false); err == nil {
+		t.Errorf("expected duplicate add to fail")
+	}
+	if err = cfd.SetSflow(SflowConfigData{Name: "s1"}, true); err == nil {
+		t.Errorf("expected update of missing profile to fail")
+	}
+
+	// Deleting referenced profile fails validation and leaves file unchanged.
+	before, _ := ioutil.ReadFile(path)
+	if err = cfd.EditConfigFile(func(cfd *ConfigFileData) error { return cfd.DelMirror("m0") }); err == nil {
+		t.Errorf("expected delete of referenced mirror to fail")
+	}
+	if after, _ := ioutil.ReadFile(path); string(after) != string(before) {
+		t.Errorf("file changed after failed edit")
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 1 {
+		t.Errorf("temporary files left behind: %v", fs)
+	}
+
+	if err = cfd.Parse([]byte("dest:\n- name: d0\n  agent-ip: 10.0.0.1\n")); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected error at line 3; got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mpls
+
+import (
+	"github.com/platinasystems/elib/parse"
+
+	"fmt"
+)
+
+func (h *Header) String() (s string) {
+	s = fmt.Sprintf("MPLS: label %d exp %d ttl %d", h.GetLabel(), h.GetExp(), h.GetTTL())
+	if h.IsBottomOfStack() {
+		s += " bottom-of-stack"
+	}
+	return
+}
+
+const DefaultTtl = 64
+
+// Parse parses a single label entry: LABEL [exp EXP] [ttl TTL].
+// Bottom of stack bit is set when stream is created.
+func (h *Header) Parse(in *parse.Input) {
+	var (
+		l        Label
+		exp, ttl uint8
+	)
+	ttl = DefaultTtl
+	if !in.Parse("%d", &l) || l > MaxLabel {
+		in.ParseError()
+	}
+loop:
+	for {
+		switch {
+		case in.Parse("exp %d", &exp):
+		case in.Parse("ttl %d", &ttl):
+		default:
+			break loop
+		}
+	}
+	h.Set(l, exp, false, ttl)
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mpls
+
+import (
+	"github.com/platinasystems/vnet"
+)
+
+var packageIndex uint
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("mpls", m)
+	m.DependsOn("pg")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+type Main struct {
+	vnet.Package
+	pgMain
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.pgInit(v)
+	return
+}
@@ -24,6 +24,39 @@ func (h *Header) FromUint32(x vnet.Uint32) { *(*vnet.Uint32)(unsafe.Pointer(&h[0
 func (h *Header) GetLabel() Label          { return Label(h.AsUint32().ToHost() >> 12) }
 func (h *Header) GetTTL() uint8            { return h[3] }
 func (h *Header) IsBottomOfStack() bool    { return h[2]&1 != 0 }
+func (h *Header) GetExp() uint8            { return (h[2] >> 1) & 7 }
+
+func (h *Header) Set(l Label, exp uint8, bos bool, ttl uint8) {
+	x := uint32(l&MaxLabel)<<12 | uint32(exp&7)<<9 | uint32(ttl)
+	if bos {
+		x |= 1 << 8
+	}
+	h.FromUint32(vnet.Uint32(x).FromHost())
+}
+func (h *Header) SetLabel(l Label) {
+	x := h.AsUint32().ToHost()
+	x = (x &^ (MaxLabel << 12)) | uint32(l&MaxLabel)<<12
+	h.FromUint32(vnet.Uint32(x).FromHost())
+}
+func (h *Header) SetBottomOfStack(bos bool) {
+	if bos {
+		h[2] |= 1
+	} else {
+		h[2] &^= 1
+	}
+}
+
+const (
+	SizeofHeader = 4
+	MaxLabel     = 1<<20 - 1
+)
+
+// Implement vnet.PacketHeader interface.
+func (h *Header) Len() uint { return SizeofHeader }
+func (h *Header) Write(b []byte) {
+	copy(b[:], h[:])
+}
+func (h *Header) Read(b []byte) vnet.PacketHeader { return (*Header)(vnet.Pointer(b)) }
 
 // Special labels 0-15
 // 16-239 Unassigned.
@@ -0,0 +1,117 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mpls
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/pg"
+
+	"fmt"
+)
+
+type pgStream struct {
+	pg.Stream
+	// Label increments indexed by position in label stack.
+	labelIncs []pg.Increment
+}
+
+type pgMain struct {
+	v *vnet.Vnet
+}
+
+func (m *pgMain) Name() string { return "mpls" }
+
+// Inner stream types allowed after bottom of stack.
+var pgInnerTypes = [...]string{"ip4", "ip6", "ethernet"}
+
+// Stream syntax: label LABEL|MIN-MAX|random MIN-MAX [exp EXP] [ttl TTL] ... INNER-STREAM
+func (m *pgMain) ParseStream(in *parse.Input) (r pg.Streamer, err error) {
+	var (
+		s  pgStream
+		hs []Header
+	)
+	for !in.End() && in.Parse("label") {
+		var (
+			h   Header
+			inc pg.Increment
+			l   Label
+		)
+		exp, ttl := uint8(0), uint8(DefaultTtl)
+		switch {
+		case in.Parse("%v", &inc):
+			l = Label(inc.Min)
+		case in.Parse("%d", &l):
+		default:
+			in.ParseError()
+		}
+	loop:
+		for {
+			switch {
+			case in.Parse("exp %d", &exp):
+			case in.Parse("ttl %d", &ttl):
+			default:
+				break loop
+			}
+		}
+		if l > MaxLabel || inc.Max > MaxLabel {
+			in.ParseError()
+		}
+		h.Set(l, exp, false, ttl)
+		hs = append(hs, h)
+		s.labelIncs = append(s.labelIncs, inc)
+	}
+	if len(hs) == 0 {
+		err = fmt.Errorf("mpls: empty label stack")
+		return
+	}
+	hs[len(hs)-1].SetBottomOfStack(true)
+	for i := range hs {
+		s.AddHeader(&hs[i])
+	}
+
+	if !in.End() {
+		var t pg.StreamType
+		for _, name := range pgInnerTypes {
+			if in.Parse(name) {
+				t = pg.GetStreamType(m.v, name)
+				break
+			}
+		}
+		if t == nil {
+			in.ParseError()
+		}
+		var sub_r pg.Streamer
+		sub_r, err = t.ParseStream(in)
+		if err != nil {
+			err = fmt.Errorf("mpls %s: %s `%s'", t.Name(), err, in)
+			return
+		}
+		s.AddStreamer(sub_r)
+	}
+	r = &s
+	return
+}
+
+func (s *pgStream) Finalize(r []vnet.Ref, data_offset uint) (changed bool) {
+	for li := range s.labelIncs {
+		inc := &s.labelIncs[li]
+		if !inc.Valid() {
+			continue
+		}
+		o := data_offset + uint(li)*SizeofHeader
+		for i := range r {
+			h := (*Header)(r[i].DataOffset(o))
+			h.SetLabel(Label(inc.Next()))
+		}
+		changed = true
+	}
+	return
+}
+
+func (m *pgMain) pgInit(v *vnet.Vnet) {
+	m.v = v
+	pg.AddStreamType(v, "mpls", m)
+}
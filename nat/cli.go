@@ -0,0 +1,261 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nat
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"sync/atomic"
+)
+
+// nat44 interface INTERFACE inside|outside|none
+func (m *Main) natInterface(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si vnet.Si
+		r  Role
+	)
+	if !in.Parse("%v %v", &si, m.Vnet, &r) {
+		err = cli.ParseError
+		return
+	}
+	m.SetRole(si, r)
+	return
+}
+
+// nat44 pool add|del ADDRESS [ADDRESS]
+func (m *Main) natPool(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		isDel  bool
+		lo, hi ip4.Address
+	)
+	switch {
+	case in.Parse("add"):
+	case in.Parse("del%*ete"):
+		isDel = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	switch {
+	case in.Parse("%v - %v", &lo, &hi):
+	case in.Parse("%v %v", &lo, &hi):
+	case in.Parse("%v", &lo):
+		hi = lo
+	default:
+		err = cli.ParseError
+		return
+	}
+	if lo.Diff(&hi) > 0 {
+		err = fmt.Errorf("nat44 pool: %s > %s", &lo, &hi)
+		return
+	}
+	for a := lo; ; a.Add(1) {
+		if err = m.AddDelPoolAddress(a, isDel); err != nil || a == hi {
+			return
+		}
+	}
+}
+
+// nat44 static add|del INSIDE OUTSIDE [tcp|udp INSIDE-PORT OUTSIDE-PORT]
+func (m *Main) natStatic(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		isDel bool
+		s     StaticMapping
+	)
+	switch {
+	case in.Parse("add"):
+	case in.Parse("del%*ete"):
+		isDel = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	if !in.Parse("%v %v", &s.Inside, &s.Outside) {
+		err = cli.ParseError
+		return
+	}
+	switch {
+	case in.End():
+	case in.Parse("tcp %d %d", &s.InsidePort, &s.OutsidePort):
+		s.Protocol = ip.TCP
+	case in.Parse("udp %d %d", &s.InsidePort, &s.OutsidePort):
+		s.Protocol = ip.UDP
+	default:
+		err = cli.ParseError
+		return
+	}
+	return m.AddDelStatic(&s, isDel)
+}
+
+// nat44 timeout tcp-established|tcp-transitory|udp|icmp SECONDS
+func (m *Main) natTimeout(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		t       timeout
+		seconds float64
+	)
+	if !in.Parse("%v %f", &t, &seconds) {
+		err = cli.ParseError
+		return
+	}
+	return m.setTimeout(t, seconds)
+}
+
+type showInterface struct {
+	Interface string `format:"%-30s" align:"left"`
+	Role      string `format:"%-8s" align:"left"`
+}
+
+type showPool struct {
+	Address string `format:"%-16s" align:"left"`
+	Tcp     uint   `format:"%8d"`
+	Udp     uint   `format:"%8d"`
+	Icmp    uint   `format:"%8d"`
+}
+
+type showSession struct {
+	Protocol string `format:"%-6s" align:"left"`
+	Inside   string `format:"%-22s" align:"left"`
+	Outside  string `format:"%-22s" align:"left"`
+	Remote   string `format:"%-22s" align:"left"`
+	Idle     string `format:"%8s"`
+	In2out   string `format:"%16s"`
+	Out2in   string `format:"%16s"`
+}
+
+func (m *Main) showNat(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var sessions bool
+	for !in.End() {
+		switch {
+		case in.Parse("sess%*ions"):
+			sessions = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	t := &m.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sessions {
+		now := cpu.TimeNow()
+		var ss []showSession
+		t.foreach(func(s *session) {
+			in2out, out2in := s.getCounter(0), s.getCounter(1)
+			ss = append(ss, showSession{
+				Protocol: s.protocol.String(),
+				Inside:   s.in.String(),
+				Outside:  s.out.String(),
+				Remote:   s.getRemote().String(),
+				Idle:     fmt.Sprintf("%.0fs", (now - s.getLastUsed()).Seconds()),
+				In2out:   fmt.Sprintf("%d/%d", in2out.Packets, in2out.Bytes),
+				Out2in:   fmt.Sprintf("%d/%d", out2in.Packets, out2in.Bytes),
+			})
+		})
+		if len(ss) == 0 {
+			fmt.Fprintln(w, "No sessions")
+			return
+		}
+		elib.Tabulate(ss).Write(w)
+		return
+	}
+
+	var is []showInterface
+	for i, r := range m.roles {
+		if r != RoleNone {
+			is = append(is, showInterface{
+				Interface: vnet.SiName{V: v, Si: vnet.Si(i)}.String(),
+				Role:      r.String(),
+			})
+		}
+	}
+	if len(is) > 0 {
+		fmt.Fprintln(w, "Interfaces:")
+		elib.Tabulate(is).Write(w)
+	}
+	if len(t.pool) > 0 {
+		fmt.Fprintln(w, "Pool (allocated ports):")
+		ps := make([]showPool, len(t.pool))
+		for i := range t.pool {
+			a := &t.pool[i]
+			ps[i] = showPool{
+				Address: a.addr.String(),
+				Tcp:     a.nPorts[protocolTcp],
+				Udp:     a.nPorts[protocolUdp],
+				Icmp:    a.nPorts[protocolIcmp],
+			}
+		}
+		elib.Tabulate(ps).Write(w)
+	}
+	if len(t.statics) > 0 {
+		fmt.Fprintln(w, "Static mappings:")
+		for i := range t.statics {
+			fmt.Fprintf(w, "  %s\n", &t.statics[i])
+		}
+	}
+	fmt.Fprintf(w, "Timeouts:")
+	for i := range t.timeouts {
+		fmt.Fprintf(w, " %s %gs", timeout(i), t.timeouts[i])
+	}
+	fmt.Fprintln(w)
+	x := &t.counters
+	fmt.Fprintf(w, "%d sessions, %d created, %d aged, %d allocation failures\n",
+		t.nSessions, x.Created, x.Aged, x.AllocFailures)
+	fmt.Fprintf(w, "%d static matches, %d dynamic matches, %d outside packets without session, %d icmp errors not translated\n",
+		atomic.LoadUint64(&x.StaticMatches), atomic.LoadUint64(&x.DynamicMatches),
+		atomic.LoadUint64(&x.OutsideNoMatch), atomic.LoadUint64(&x.UnsupportedIcmp))
+	return
+}
+
+func (m *Main) clearNatSessions(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	m.ClearSessions()
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := []cli.Command{
+		cli.Command{
+			Name:      "nat44 interface",
+			ShortHelp: "set nat role of interface: nat44 interface INTERFACE inside|outside|none",
+			Action:    m.natInterface,
+		},
+		cli.Command{
+			Name:      "nat44 pool",
+			ShortHelp: "add or delete outside pool addresses: nat44 pool add|del ADDRESS [- ADDRESS]",
+			Action:    m.natPool,
+		},
+		cli.Command{
+			Name:      "nat44 static",
+			ShortHelp: "add or delete static mapping: nat44 static add|del INSIDE OUTSIDE [tcp|udp INSIDE-PORT OUTSIDE-PORT]",
+			Action:    m.natStatic,
+		},
+		cli.Command{
+			Name:      "nat44 timeout",
+			ShortHelp: "set session timeout: nat44 timeout tcp-established|tcp-transitory|udp|icmp SECONDS",
+			Action:    m.natTimeout,
+		},
+		cli.Command{
+			Name:      "show nat44",
+			ShortHelp: "show nat interfaces, pool, static mappings and counters or, with sessions, dynamic sessions",
+			Action:    m.showNat,
+		},
+		cli.Command{
+			Name:      "clear nat44 sessions",
+			ShortHelp: "delete all dynamic nat sessions",
+			Action:    m.clearNatSessions,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,534 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nat
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// Dynamic ports (and icmp query ids) are allocated from this range.
+const (
+	minDynamicPort = 1024
+	nPortWords     = (1 << 16) / 64
+)
+
+type protocol uint8
+
+const (
+	protocolTcp protocol = iota
+	protocolUdp
+	protocolIcmp
+	nProtocol
+)
+
+func protocolIndex(p ip.Protocol) (x protocol, ok bool) {
+	switch p {
+	case ip.TCP:
+		x, ok = protocolTcp, true
+	case ip.UDP:
+		x, ok = protocolUdp, true
+	case ip.ICMP:
+		x, ok = protocolIcmp, true
+	}
+	return
+}
+
+type tableKey struct {
+	protocol ip.Protocol
+	endpoint
+}
+
+// Outside address available for dynamic translation.
+type poolAddress struct {
+	addr ip4.Address
+	// Bitmap of allocated ports per protocol.
+	ports [nProtocol][nPortWords]uint64
+	// Number of allocated ports per protocol.
+	nPorts [nProtocol]uint
+}
+
+func (a *poolAddress) isAllocated(p protocol, port uint16) bool {
+	return a.ports[p][port/64]&(1<<(port%64)) != 0
+}
+
+func (a *poolAddress) setAllocated(p protocol, port uint16, isAlloc bool) {
+	if isAlloc {
+		a.ports[p][port/64] |= 1 << (port % 64)
+		a.nPorts[p]++
+	} else {
+		a.ports[p][port/64] &^= 1 << (port % 64)
+		a.nPorts[p]--
+	}
+}
+
+// Find free port at or after start wrapping around; ok is false if all dynamic ports are in use.
+func (a *poolAddress) findFree(p protocol, start uint16) (port uint16, ok bool) {
+	const n = nPortWords - minDynamicPort/64
+	if start < minDynamicPort {
+		start = minDynamicPort
+	}
+	w0 := uint(start / 64)
+	for i := uint(0); i <= n; i++ {
+		w := minDynamicPort/64 + (w0-minDynamicPort/64+i)%n
+		x := ^a.ports[p][w]
+		if i == 0 {
+			x &= ^uint64(0) << (start % 64)
+		}
+		if x != 0 {
+			return uint16(64*w) + uint16(bits.TrailingZeros64(x)), true
+		}
+	}
+	return
+}
+
+// StaticMapping translates inside address to outside address (1:1 mapping) or, with
+// protocol set, inside address and port to outside address and port (port forward).
+type StaticMapping struct {
+	Protocol                ip.Protocol
+	Inside, Outside         ip4.Address
+	InsidePort, OutsidePort uint16
+}
+
+func (s *StaticMapping) isPortForward() bool { return s.Protocol != 0 }
+
+func (s *StaticMapping) String() string {
+	if !s.isPortForward() {
+		return fmt.Sprintf("%s <-> %s", &s.Inside, &s.Outside)
+	}
+	return fmt.Sprintf("%s %s <-> %s", s.Protocol, endpoint{s.Inside, s.InsidePort}, endpoint{s.Outside, s.OutsidePort})
+}
+
+// Sessions are updated by packet processing threads with atomic operations.
+type session struct {
+	protocol ip.Protocol
+	in, out  endpoint
+	// Last remote endpoint seen packed by endpoint.pack.
+	remote uint64
+	// Non-zero when tcp fin or reset seen.
+	closing  uint32
+	created  cpu.Time
+	lastUsed cpu.Time
+	// Packets and bytes translated inside to outside (0) and outside to inside (1).
+	counters [2]vnet.CombinedCounter
+	// Index of pool address.
+	pool uint
+}
+
+func (e endpoint) pack() uint64 {
+	return uint64(e.addr[0])<<40 | uint64(e.addr[1])<<32 | uint64(e.addr[2])<<24 | uint64(e.addr[3])<<16 | uint64(e.port)
+}
+
+func unpackEndpoint(x uint64) (e endpoint) {
+	e.addr = ip4.Address{byte(x >> 40), byte(x >> 32), byte(x >> 24), byte(x >> 16)}
+	e.port = uint16(x)
+	return
+}
+
+func (s *session) getRemote() endpoint { return unpackEndpoint(atomic.LoadUint64(&s.remote)) }
+
+func (s *session) getLastUsed() cpu.Time {
+	return cpu.Time(atomic.LoadUint64((*uint64)(&s.lastUsed)))
+}
+
+func (s *session) getCounter(dir int) (c vnet.CombinedCounter) {
+	c.Packets = atomic.LoadUint64(&s.counters[dir].Packets)
+	c.Bytes = atomic.LoadUint64(&s.counters[dir].Bytes)
+	return
+}
+
+type timeout uint8
+
+const (
+	timeoutTcpEstablished timeout = iota
+	timeoutTcpTransitory
+	timeoutUdp
+	timeoutIcmp
+	nTimeout
+)
+
+var timeoutStrings = [...]string{
+	timeoutTcpEstablished: "tcp-established",
+	timeoutTcpTransitory:  "tcp-transitory",
+	timeoutUdp:            "udp",
+	timeoutIcmp:           "icmp",
+}
+
+func (t timeout) String() string { return elib.Stringer(timeoutStrings[:], int(t)) }
+
+func (t *timeout) Parse(in *parse.Input) {
+	text := in.Token()
+	for i := range timeoutStrings {
+		if timeoutStrings[i] == text {
+			*t = timeout(i)
+			return
+		}
+	}
+	in.ParseError()
+}
+
+// Default timeouts in seconds (RFC 5382, RFC 4787, RFC 5508).
+var defaultTimeouts = [nTimeout]float64{
+	timeoutTcpEstablished: 7440,
+	timeoutTcpTransitory:  240,
+	timeoutUdp:            300,
+	timeoutIcmp:           60,
+}
+
+func (s *session) timeout() timeout {
+	switch s.protocol {
+	case ip.TCP:
+		if atomic.LoadUint32(&s.closing) != 0 {
+			return timeoutTcpTransitory
+		}
+		return timeoutTcpEstablished
+	case ip.UDP:
+		return timeoutUdp
+	default:
+		return timeoutIcmp
+	}
+}
+
+type counters struct {
+	Created       uint64
+	Aged          uint64
+	AllocFailures uint64
+	// Counted by packet processing threads with atomic adds.
+	StaticMatches   uint64
+	DynamicMatches  uint64
+	OutsideNoMatch  uint64
+	UnsupportedIcmp uint64
+}
+
+// Static mappings and pool addresses read by packet processing threads without locking.
+// Replaced whenever configuration changes.
+type config struct {
+	statics []StaticMapping
+	// Static port forwards indexed by inside and outside endpoint.
+	staticByIn, staticByOut map[tableKey]uint
+	// Static 1:1 address mappings.
+	staticAddrByIn, staticAddrByOut map[ip4.Address]uint
+	pool                            map[ip4.Address]bool
+}
+
+type table struct {
+	// Packet processing threads look up and update sessions without locking.
+	// Configuration, session allocation and aging are serialized by mu.
+	mu sync.Mutex
+
+	pool []poolAddress
+
+	statics []StaticMapping
+	// Static port forwards indexed by inside and outside endpoint.
+	staticByIn, staticByOut map[tableKey]uint
+	// Static 1:1 address mappings.
+	staticAddrByIn, staticAddrByOut map[ip4.Address]uint
+
+	// Snapshot of configuration; value is *config.
+	cfg atomic.Value
+
+	// Dynamic sessions indexed by inside and outside key; values are *session.
+	byIn, byOut sync.Map
+	nSessions   uint
+	timeouts    [nTimeout]float64
+	timeoutDts  [nTimeout]cpu.Time
+
+	counters counters
+}
+
+func (t *table) init() {
+	t.staticByIn = make(map[tableKey]uint)
+	t.staticByOut = make(map[tableKey]uint)
+	t.staticAddrByIn = make(map[ip4.Address]uint)
+	t.staticAddrByOut = make(map[ip4.Address]uint)
+	for i := range t.timeouts {
+		if t.timeouts[i] == 0 {
+			t.timeouts[i] = defaultTimeouts[i]
+		}
+		t.timeoutDts[i].Cycles(t.timeouts[i])
+	}
+	t.publish()
+}
+
+// Publish copy of configuration for packet processing threads.  Must be called with lock held.
+func (t *table) publish() {
+	c := &config{
+		statics:         append([]StaticMapping(nil), t.statics...),
+		staticByIn:      make(map[tableKey]uint, len(t.staticByIn)),
+		staticByOut:     make(map[tableKey]uint, len(t.staticByOut)),
+		staticAddrByIn:  make(map[ip4.Address]uint, len(t.staticAddrByIn)),
+		staticAddrByOut: make(map[ip4.Address]uint, len(t.staticAddrByOut)),
+		pool:            make(map[ip4.Address]bool, len(t.pool)),
+	}
+	for k, i := range t.staticByIn {
+		c.staticByIn[k] = i
+	}
+	for k, i := range t.staticByOut {
+		c.staticByOut[k] = i
+	}
+	for a, i := range t.staticAddrByIn {
+		c.staticAddrByIn[a] = i
+	}
+	for a, i := range t.staticAddrByOut {
+		c.staticAddrByOut[a] = i
+	}
+	for i := range t.pool {
+		c.pool[t.pool[i].addr] = true
+	}
+	t.cfg.Store(c)
+}
+
+func (t *table) config() *config { return t.cfg.Load().(*config) }
+
+func (t *table) count(c *uint64) { atomic.AddUint64(c, 1) }
+
+// Lookup dynamic session in given map (byIn or byOut).
+func lookup(m *sync.Map, k tableKey) (s *session, ok bool) {
+	var x interface{}
+	if x, ok = m.Load(k); ok {
+		s = x.(*session)
+	}
+	return
+}
+
+// Calls fn for each session.  Must be called with lock held.
+func (t *table) foreach(fn func(s *session)) {
+	t.byIn.Range(func(k, x interface{}) bool {
+		fn(x.(*session))
+		return true
+	})
+}
+
+func (t *table) setTimeout(x timeout, seconds float64) (err error) {
+	if seconds <= 0 {
+		return fmt.Errorf("timeout must be positive: %v", seconds)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeouts[x] = seconds
+	t.timeoutDts[x].Cycles(seconds)
+	return
+}
+
+func (t *table) poolIndex(a ip4.Address) int {
+	for i := range t.pool {
+		if t.pool[i].addr == a {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *table) addDelPoolAddress(a ip4.Address, isDel bool) (err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.publish()
+	i := t.poolIndex(a)
+	switch {
+	case !isDel && i >= 0:
+		err = fmt.Errorf("%s: already in pool", &a)
+	case isDel && i < 0:
+		err = fmt.Errorf("%s: not in pool", &a)
+	case !isDel:
+		if _, ok := t.staticAddrByOut[a]; ok {
+			err = fmt.Errorf("%s: used by static mapping", &a)
+			return
+		}
+		t.pool = append(t.pool, poolAddress{addr: a})
+		// Reserve ports of port forwards to new pool address.
+		pa := &t.pool[len(t.pool)-1]
+		for j := range t.statics {
+			if s := &t.statics[j]; s.isPortForward() && s.Outside == a {
+				x, _ := protocolIndex(s.Protocol)
+				pa.setAllocated(x, s.OutsidePort, true)
+			}
+		}
+	default:
+		// Delete sessions using address and renumber sessions using addresses after it.
+		t.foreach(func(s *session) {
+			switch {
+			case s.pool == uint(i):
+				t.del(s)
+			case s.pool > uint(i):
+				s.pool--
+			}
+		})
+		t.pool = append(t.pool[:i:i], t.pool[i+1:]...)
+	}
+	return
+}
+
+func (t *table) addDelStatic(s *StaticMapping, isDel bool) (err error) {
+	if s.isPortForward() && s.Protocol != ip.TCP && s.Protocol != ip.UDP {
+		return fmt.Errorf("%s: port forward protocol must be tcp or udp", s)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.publish()
+	ki := tableKey{s.Protocol, endpoint{s.Inside, s.InsidePort}}
+	ko := tableKey{s.Protocol, endpoint{s.Outside, s.OutsidePort}}
+	var (
+		i      uint
+		exists bool
+	)
+	if s.isPortForward() {
+		i, exists = t.staticByIn[ki]
+	} else {
+		i, exists = t.staticAddrByIn[s.Inside]
+	}
+	if exists && t.statics[i] != *s {
+		return fmt.Errorf("%s: conflicts with %s", s, &t.statics[i])
+	}
+	if isDel {
+		if !exists {
+			return fmt.Errorf("%s: no such static mapping", s)
+		}
+		t.delStatic(i)
+		return
+	}
+	if exists {
+		return fmt.Errorf("%s: static mapping already exists", s)
+	}
+	if s.isPortForward() {
+		if _, ok := t.staticByOut[ko]; ok {
+			return fmt.Errorf("%s: outside endpoint already mapped", s)
+		}
+		if p := t.poolIndex(s.Outside); p >= 0 {
+			x, _ := protocolIndex(s.Protocol)
+			if t.pool[p].isAllocated(x, s.OutsidePort) {
+				return fmt.Errorf("%s: outside port in use by dynamic session", s)
+			}
+			t.pool[p].setAllocated(x, s.OutsidePort, true)
+		}
+	} else {
+		if _, ok := t.staticAddrByOut[s.Outside]; ok || t.poolIndex(s.Outside) >= 0 {
+			return fmt.Errorf("%s: outside address already in use", s)
+		}
+	}
+	i = uint(len(t.statics))
+	t.statics = append(t.statics, *s)
+	t.indexStatic(i)
+	return
+}
+
+func (t *table) indexStatic(i uint) {
+	s := &t.statics[i]
+	if s.isPortForward() {
+		t.staticByIn[tableKey{s.Protocol, endpoint{s.Inside, s.InsidePort}}] = i
+		t.staticByOut[tableKey{s.Protocol, endpoint{s.Outside, s.OutsidePort}}] = i
+	} else {
+		t.staticAddrByIn[s.Inside] = i
+		t.staticAddrByOut[s.Outside] = i
+	}
+}
+
+func (t *table) delStatic(i uint) {
+	s := &t.statics[i]
+	if s.isPortForward() {
+		delete(t.staticByIn, tableKey{s.Protocol, endpoint{s.Inside, s.InsidePort}})
+		delete(t.staticByOut, tableKey{s.Protocol, endpoint{s.Outside, s.OutsidePort}})
+		if p := t.poolIndex(s.Outside); p >= 0 {
+			x, _ := protocolIndex(s.Protocol)
+			t.pool[p].setAllocated(x, s.OutsidePort, false)
+		}
+	} else {
+		delete(t.staticAddrByIn, s.Inside)
+		delete(t.staticAddrByOut, s.Outside)
+	}
+	t.statics = append(t.statics[:i:i], t.statics[i+1:]...)
+	for j := i; j < uint(len(t.statics)); j++ {
+		t.indexStatic(j)
+	}
+}
+
+// Allocate dynamic session for inside endpoint unless another thread allocated it first.
+// Endpoint independent: all connections from the same inside endpoint share one outside
+// endpoint.  Inside addresses are paired with the same pool address when possible and
+// inside ports are preserved when free.
+func (t *table) allocate(p ip.Protocol, in endpoint, now cpu.Time) (s *session, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s, ok = lookup(&t.byIn, tableKey{p, in}); ok {
+		return
+	}
+	x, ok := protocolIndex(p)
+	if !ok || len(t.pool) == 0 {
+		ok = false
+		return
+	}
+	h := uint(in.addr[0])<<24 | uint(in.addr[1])<<16 | uint(in.addr[2])<<8 | uint(in.addr[3])
+	h ^= h >> 16
+	ok = false
+	var (
+		pi   uint
+		port uint16
+	)
+	for i := range t.pool {
+		pi = (h + uint(i)) % uint(len(t.pool))
+		a := &t.pool[pi]
+		if in.port >= minDynamicPort && !a.isAllocated(x, in.port) {
+			port, ok = in.port, true
+		} else {
+			port, ok = a.findFree(x, uint16(h*2654435761>>16))
+		}
+		if ok {
+			break
+		}
+	}
+	if !ok {
+		t.counters.AllocFailures++
+		return
+	}
+	t.pool[pi].setAllocated(x, port, true)
+	s = &session{
+		protocol: p,
+		in:       in,
+		out:      endpoint{t.pool[pi].addr, port},
+		pool:     pi,
+		created:  now,
+		lastUsed: now,
+	}
+	t.byIn.Store(tableKey{p, s.in}, s)
+	t.byOut.Store(tableKey{p, s.out}, s)
+	t.nSessions++
+	t.counters.Created++
+	return
+}
+
+// Must be called with lock held.
+func (t *table) del(s *session) {
+	t.byIn.Delete(tableKey{s.protocol, s.in})
+	t.byOut.Delete(tableKey{s.protocol, s.out})
+	x, _ := protocolIndex(s.protocol)
+	t.pool[s.pool].setAllocated(x, s.out.port, false)
+	t.nSessions--
+}
+
+func (t *table) age(now cpu.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.foreach(func(s *session) {
+		// Packets on other threads may have been seen after now was sampled.
+		if last := s.getLastUsed(); now > last && now-last > t.timeoutDts[s.timeout()] {
+			t.del(s)
+			t.counters.Aged++
+		}
+	})
+}
+
+func (t *table) clearSessions() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.foreach(t.del)
+}
@@ -0,0 +1,177 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nat
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"bytes"
+	"testing"
+)
+
+func checksum(bs ...[]byte) uint16 {
+	var sum uint32
+	for _, b := range bs {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(be16(b[i:]))
+		}
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Build udp packet with correct ip and udp checksums.
+func udpPacket(src, dst ip4.Address, sport, dport uint16) []byte {
+	payload := []byte("hello, world")
+	b := make([]byte, 20+8+len(payload))
+	b[0], b[8], b[9] = 0x45, 64, byte(ip.UDP)
+	put16(b[2:], uint16(len(b)))
+	copy(b[12:], src[:])
+	copy(b[16:], dst[:])
+	put16(b[10:], checksum(b[:20]))
+	u := b[20:]
+	put16(u[0:], sport)
+	put16(u[2:], dport)
+	put16(u[4:], uint16(len(u)))
+	copy(u[8:], payload)
+	put16(u[6:], udpChecksum(b))
+	return b
+}
+
+func udpChecksum(b []byte) uint16 {
+	u := b[20:]
+	var pseudo [12]byte
+	copy(pseudo[0:], b[12:20])
+	pseudo[9] = byte(ip.UDP)
+	put16(pseudo[10:], uint16(len(u)))
+	c := make([]byte, len(u)+1)
+	copy(c, u)
+	put16(c[6:], 0)
+	return checksum(pseudo[:], c)
+}
+
+func checkChecksums(t *testing.T, b []byte) {
+	if c := checksum(b[:20]); c != 0 {
+		t.Errorf("bad ip checksum: %x", c)
+	}
+	if c := be16(b[26:]); c != udpChecksum(b) {
+		t.Errorf("bad udp checksum: got %x want %x", c, udpChecksum(b))
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	var tb table
+	tb.init()
+	inside := ip4.Address{192, 168, 1, 10}
+	outside := ip4.Address{203, 0, 113, 1}
+	remote := ip4.Address{198, 51, 100, 7}
+	if err := tb.addDelPoolAddress(outside, false); err != nil {
+		t.Fatal(err)
+	}
+	b := udpPacket(inside, remote, 5000, 53)
+	var p packet
+	if !p.parse(b) {
+		t.Fatal("parse failed")
+	}
+	if _, ok := tb.in2out(&p, uint(len(b)), 0); !ok {
+		t.Fatal("in2out failed")
+	}
+	out := p.endpoint(true)
+	if out != (endpoint{outside, 5000}) {
+		t.Errorf("in2out source %s", out)
+	}
+	checkChecksums(t, b)
+
+	// Second inside host using same port gets a different outside port.
+	b2 := udpPacket(ip4.Address{192, 168, 1, 11}, remote, 5000, 53)
+	p.parse(b2)
+	tb.in2out(&p, uint(len(b2)), 0)
+	if out2 := p.endpoint(true); out2 == out {
+		t.Errorf("outside endpoint %s allocated twice", out2)
+	}
+
+	// Reply is translated back to inside host.
+	r := udpPacket(remote, outside, 53, 5000)
+	p.parse(r)
+	if _, ok := tb.out2in(&p, uint(len(r)), 0); !ok {
+		t.Fatal("out2in failed")
+	}
+	if in := p.endpoint(false); in != (endpoint{inside, 5000}) {
+		t.Errorf("out2in destination %s", in)
+	}
+	checkChecksums(t, r)
+	if want := udpPacket(remote, inside, 53, 5000); !bytes.Equal(r, want) {
+		t.Errorf("got % x\nwant % x", r, want)
+	}
+
+	// Packets to pool address without session are dropped.
+	u := udpPacket(remote, outside, 53, 6000)
+	p.parse(u)
+	if e, ok := tb.out2in(&p, uint(len(u)), 0); ok || e != error_no_session {
+		t.Errorf("out2in without session: ok %v error %d", ok, e)
+	}
+
+	// Port forward.
+	s := StaticMapping{Protocol: ip.UDP, Inside: inside, InsidePort: 53, Outside: outside, OutsidePort: 53}
+	if err := tb.addDelStatic(&s, false); err != nil {
+		t.Fatal(err)
+	}
+	u = udpPacket(remote, outside, 4000, 53)
+	p.parse(u)
+	tb.out2in(&p, uint(len(u)), 0)
+	if in := p.endpoint(false); in != (endpoint{inside, 53}) {
+		t.Errorf("port forward destination %s", in)
+	}
+	checkChecksums(t, u)
+
+	// Session used after aging scan started must not wrap to look idle.
+	r = udpPacket(remote, outside, 53, 5000)
+	p.parse(r)
+	tb.out2in(&p, uint(len(r)), 50)
+	n := tb.nSessions
+	if tb.age(10); tb.nSessions != n {
+		t.Errorf("session used at 50 aged at 10")
+	}
+
+	tb.age(50 + tb.timeoutDts[timeoutUdp] + 1)
+	if n := tb.nSessions; n != 0 || tb.pool[0].nPorts[protocolUdp] != 1 {
+		t.Errorf("after aging: %d sessions, %d ports allocated", n, tb.pool[0].nPorts[protocolUdp])
+	}
+}
+
+// Interface roles enable translation nodes as ip4 input features.
+func TestSetRole(t *testing.T) {
+	v := &vnet.Vnet{}
+	pg.Init(v)
+	ethernet.Init(v, ip4.Init(v), ip6.Init(v))
+	Init(v)
+	if err := ip4.GetMain(v).Init(); err != nil {
+		t.Fatal(err)
+	}
+	m := GetMain(v)
+	m.in2outNode.init(v, m, false)
+	m.out2inNode.init(v, m, true)
+	a := &ip4.GetMain(v).InputFeatures
+	const si = vnet.Si(2)
+	check := func(r Role, in2out, out2in bool) {
+		m.SetRole(si, r)
+		if a.IsEnabled(si, m.in2outNode.feature) != in2out || a.IsEnabled(si, m.out2inNode.feature) != out2in {
+			t.Errorf("role %s: in2out %v out2in %v", r, !in2out, !out2in)
+		}
+	}
+	check(RoleInside, true, false)
+	check(RoleOutside, false, true)
+	check(RoleNone, false, false)
+	if a.Active() {
+		t.Error("ip4 input features active with no roles")
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nat
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"sync/atomic"
+)
+
+const (
+	next_error uint = iota
+)
+
+const (
+	error_bad_header uint = iota
+	error_no_translation
+	error_no_session
+	error_unsupported
+	error_icmp_error
+)
+
+// Translation node: in2out translates source of packets received on inside interfaces;
+// out2in translates destination of packets received on outside interfaces.
+// Nodes are ip4 input features enabled by interface role; translated packets continue
+// to the next enabled feature.
+type node struct {
+	vnet.InOutNode
+	m     *Main
+	isOut bool
+	// Ip4 input feature arc and index of node's feature.
+	arc     *vnet.FeatureArc
+	feature uint
+}
+
+func (n *node) init(v *vnet.Vnet, m *Main, isOut bool) {
+	n.m, n.isOut = m, isOut
+	n.Next = []string{
+		next_error: "error",
+	}
+	n.Errors = []string{
+		error_bad_header:     "bad ip4 header",
+		error_no_translation: "no outside port available",
+		error_no_session:     "no session for packet to pool address",
+		error_unsupported:    "protocol not translated",
+		error_icmp_error:     "icmp error message not translated",
+	}
+	dir := "in2out"
+	if isOut {
+		dir = "out2in"
+	}
+	v.RegisterInOutNode(n, "nat44-%s", dir)
+	n.arc = &ip4.GetMain(v).InputFeatures
+	n.feature = n.arc.Register(n)
+}
+
+func (s *session) update(p *packet, dir int, nBytes uint, now cpu.Time) {
+	atomic.StoreUint64((*uint64)(&s.lastUsed), uint64(now))
+	atomic.AddUint64(&s.counters[dir].Packets, 1)
+	atomic.AddUint64(&s.counters[dir].Bytes, uint64(nBytes))
+	if dir == 0 {
+		atomic.StoreUint64(&s.remote, p.endpoint(false).pack())
+	}
+	if p.protocol == ip.TCP && p.l4[13]&(tcpFlagFin|tcpFlagRst) != 0 {
+		atomic.StoreUint32(&s.closing, 1)
+	}
+}
+
+const (
+	tcpFlagFin = 1 << 0
+	tcpFlagRst = 1 << 2
+)
+
+// Translate source of packet from inside interface.
+func (t *table) in2out(p *packet, nBytes uint, now cpu.Time) (error0 uint, ok bool) {
+	c := t.config()
+	src := p.endpoint(true)
+	if p.hasPort() {
+		if i, found := c.staticByIn[tableKey{p.protocol, src}]; found {
+			s := &c.statics[i]
+			p.rewrite(true, endpoint{s.Outside, s.OutsidePort})
+			t.count(&t.counters.StaticMatches)
+			return 0, true
+		}
+	}
+	if i, found := c.staticAddrByIn[src.addr]; found {
+		p.rewrite(true, endpoint{c.statics[i].Outside, src.port})
+		t.count(&t.counters.StaticMatches)
+		return 0, true
+	}
+	switch {
+	case p.isIcmpError():
+		t.count(&t.counters.UnsupportedIcmp)
+		return error_icmp_error, false
+	case !p.hasPort():
+		return error_unsupported, false
+	}
+	s, found := lookup(&t.byIn, tableKey{p.protocol, src})
+	if !found {
+		if s, found = t.allocate(p.protocol, src, now); !found {
+			return error_no_translation, false
+		}
+	} else {
+		t.count(&t.counters.DynamicMatches)
+	}
+	s.update(p, 0, nBytes, now)
+	p.rewrite(true, s.out)
+	return 0, true
+}
+
+// Translate destination of packet from outside interface.  Packets not addressed to
+// pool or static outside addresses pass untranslated.
+func (t *table) out2in(p *packet, nBytes uint, now cpu.Time) (error0 uint, ok bool) {
+	c := t.config()
+	dst := p.endpoint(false)
+	if p.hasPort() {
+		if i, found := c.staticByOut[tableKey{p.protocol, dst}]; found {
+			s := &c.statics[i]
+			p.rewrite(false, endpoint{s.Inside, s.InsidePort})
+			t.count(&t.counters.StaticMatches)
+			return 0, true
+		}
+	}
+	if i, found := c.staticAddrByOut[dst.addr]; found {
+		p.rewrite(false, endpoint{c.statics[i].Inside, dst.port})
+		t.count(&t.counters.StaticMatches)
+		return 0, true
+	}
+	if p.hasPort() {
+		if s, found := lookup(&t.byOut, tableKey{p.protocol, dst}); found {
+			s.update(p, 1, nBytes, now)
+			p.rewrite(false, s.in)
+			t.count(&t.counters.DynamicMatches)
+			return 0, true
+		}
+	}
+	if c.pool[dst.addr] {
+		t.count(&t.counters.OutsideNoMatch)
+		if p.isIcmpError() {
+			t.count(&t.counters.UnsupportedIcmp)
+			return error_icmp_error, false
+		}
+		return error_no_session, false
+	}
+	return 0, true
+}
+
+func (n *node) translate(r0 *vnet.Ref, now cpu.Time) (next0 uint) {
+	role := RoleInside
+	if n.isOut {
+		role = RoleOutside
+	}
+	m := n.m
+	next := n.arc.Next(r0.Si, n.feature)
+	if m.Role(r0.Si) != role {
+		return next
+	}
+	var p packet
+	if !p.parse(r0.DataSlice()) {
+		n.SetError(r0, error_bad_header)
+		return next_error
+	}
+	// Traffic between inside interfaces or to local addresses passes untranslated.
+	if !n.isOut && !m.egressOutside(r0.Si, &p) {
+		return next
+	}
+	t := &m.table
+	var (
+		e0 uint
+		ok bool
+	)
+	if n.isOut {
+		e0, ok = t.out2in(&p, r0.DataLen(), now)
+	} else {
+		e0, ok = t.in2out(&p, r0.DataLen(), now)
+	}
+	if !ok {
+		n.SetError(r0, e0)
+		return next_error
+	}
+	return next
+}
+
+// Reports whether route to destination of packet received on given interface transmits
+// on outside interfaces.  Local, punt and drop adjacencies do not.
+func (m *Main) egressOutside(si vnet.Si, p *packet) bool {
+	dst := p.endpoint(false).addr
+	as, ok := m.ip4.LookupAdjacencyForSi(si, &dst)
+	if !ok {
+		return false
+	}
+	for i := range as {
+		a := &as[i]
+		if !(a.IsRewrite() || a.IsGlean()) || m.Role(a.Si) != RoleOutside {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *node) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	i, n_left := in.Range()
+	for n_left >= 1 {
+		r0 := in.Get1(i)
+		x0 := n.translate(r0, now)
+		q.Put1(r0, x0)
+		n_left -= 1
+		i += 1
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nat provides ip4 network address translation (NAT44).
+//
+// Sw interfaces are given inside or outside roles which enable the nat44-in2out
+// or nat44-out2in node as ip4 input feature of the interface.  The nat44-in2out
+// node translates sources of packets received on inside interfaces and routed to
+// outside interfaces using static 1:1 address mappings, static port forwards or
+// dynamic endpoint-independent mappings allocated from an outside address pool
+// (port overloading).  The
+// nat44-out2in node translates destinations of packets received on outside
+// interfaces.  Tcp/udp ports and icmp echo query ids are translated; ip and
+// layer 4 checksums are updated incrementally.  Dynamic sessions are looked up
+// without locking and aged from the vnet event loop.
+package nat
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip4"
+)
+
+var packageIndex uint
+
+type Role uint8
+
+const (
+	RoleNone Role = iota
+	RoleInside
+	RoleOutside
+)
+
+var roleStrings = [...]string{
+	RoleNone:    "none",
+	RoleInside:  "inside",
+	RoleOutside: "outside",
+}
+
+func (r Role) String() string { return elib.Stringer(roleStrings[:], int(r)) }
+
+func (r *Role) Parse(in *parse.Input) {
+	switch text := in.Token(); text {
+	case "none":
+		*r = RoleNone
+	case "inside", "in":
+		*r = RoleInside
+	case "outside", "out":
+		*r = RoleOutside
+	default:
+		in.ParseError()
+	}
+}
+
+type Main struct {
+	vnet.Package
+
+	// Interface roles indexed by sw interface.
+	roles []Role
+
+	in2outNode, out2inNode node
+
+	ip4 *ip4.Main
+
+	table
+
+	ageEvent ageEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("nat", m)
+	m.DependsOn("ip4")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. nat { timeout udp 120 }
+func (m *Main) Configure(in *parse.Input) {
+	var (
+		t       timeout
+		seconds float64
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("timeout %v %f", &t, &seconds) && seconds > 0:
+			m.timeouts[t] = seconds
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between session aging scans.
+const ageInterval = 1
+
+type ageEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *ageEvent) String() string { return "nat44 session aging" }
+func (e *ageEvent) EventAction() {
+	e.m.age(cpu.TimeNow())
+	e.SignalEventAfter(e, ageInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.ip4 = ip4.GetMain(v)
+	m.table.init()
+	m.in2outNode.init(v, m, false)
+	m.out2inNode.init(v, m, true)
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.ageEvent.m = m
+	v.SignalEventAfter(&m.ageEvent, ageInterval)
+	m.cliInit()
+	return
+}
+
+// Role returns inside/outside role of given sw interface.
+func (m *Main) Role(si vnet.Si) (r Role) {
+	if uint(si) < uint(len(m.roles)) {
+		r = m.roles[si]
+	}
+	return
+}
+
+// SetRole sets inside/outside role of given sw interface enabling nat44-in2out or
+// nat44-out2in as ip4 input feature of interface.
+func (m *Main) SetRole(si vnet.Si, r Role) {
+	if i := uint(si); i >= uint(len(m.roles)) {
+		if r == RoleNone {
+			return
+		}
+		m.roles = append(m.roles, make([]Role, 1+i-uint(len(m.roles)))...)
+	}
+	m.roles[si] = r
+	m.in2outNode.arc.Enable(si, m.in2outNode.feature, r == RoleInside)
+	m.out2inNode.arc.Enable(si, m.out2inNode.feature, r == RoleOutside)
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		m.SetRole(si, RoleNone)
+	}
+	return
+}
+
+// AddDelPoolAddress adds or deletes outside address used for dynamic translation.
+// Deleting an address deletes sessions using it.
+func (m *Main) AddDelPoolAddress(a ip4.Address, isDel bool) error {
+	return m.addDelPoolAddress(a, isDel)
+}
+
+// AddDelStatic adds or deletes static mapping.
+func (m *Main) AddDelStatic(s *StaticMapping, isDel bool) error { return m.addDelStatic(s, isDel) }
+
+// ClearSessions deletes all dynamic sessions.
+func (m *Main) ClearSessions() { m.clearSessions() }
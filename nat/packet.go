@@ -0,0 +1,162 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nat
+
+import (
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"fmt"
+)
+
+// Address and layer 4 port (or icmp query id) of one end of a connection.
+type endpoint struct {
+	addr ip4.Address
+	port uint16
+}
+
+func (e endpoint) String() string { return fmt.Sprintf("%s:%d", &e.addr, e.port) }
+
+const (
+	icmpEchoReply   = 0
+	icmpEchoRequest = 8
+)
+
+func be16(b []byte) uint16     { return uint16(b[0])<<8 | uint16(b[1]) }
+func put16(b []byte, x uint16) { b[0], b[1] = byte(x>>8), byte(x) }
+
+// Incrementally update ones complement checksum at c[0:2] for data changing from
+// old to new (RFC 1624: HC' = ~(~HC + ~m + m')).  Old and new have even length.
+func updateChecksum(c, old, new []byte) {
+	sum := uint32(^be16(c))
+	for i := 0; i < len(old); i += 2 {
+		sum += uint32(^be16(old[i:])) + uint32(be16(new[i:]))
+	}
+	sum = sum&0xffff + sum>>16
+	sum = sum&0xffff + sum>>16
+	put16(c, ^uint16(sum))
+}
+
+// Ip4 packet with layer 4 header located.
+type packet struct {
+	b        []byte
+	protocol ip.Protocol
+	// Layer 4 header; nil for non-first fragments.
+	l4 []byte
+}
+
+// Parse packet returning false if it is too short or not ip4.
+func (p *packet) parse(b []byte) bool {
+	if len(b) < ip4.SizeofHeader || b[0]>>4 != 4 {
+		return false
+	}
+	l := int(b[0]&0xf) * 4
+	if l < ip4.SizeofHeader || len(b) < l {
+		return false
+	}
+	p.b, p.protocol, p.l4 = b, ip.Protocol(b[9]), nil
+	if isFirst := b[6]&0x1f == 0 && b[7] == 0; isFirst {
+		p.l4 = b[l:]
+	}
+	return true
+}
+
+// Translatable packets have ports (tcp, udp) or query id (icmp echo) present.
+// Packets of other protocols may only be translated by static address mappings.
+func (p *packet) hasPort() bool {
+	switch p.protocol {
+	case ip.TCP:
+		return len(p.l4) >= 20
+	case ip.UDP:
+		return len(p.l4) >= 8
+	case ip.ICMP:
+		return len(p.l4) >= 8 && (p.l4[0] == icmpEchoRequest || p.l4[0] == icmpEchoReply)
+	}
+	return false
+}
+
+func (p *packet) isIcmpError() bool {
+	return p.protocol == ip.ICMP && len(p.l4) > 0 && !p.hasPort()
+}
+
+func (p *packet) addrOffset(isSrc bool) int {
+	if isSrc {
+		return 12
+	}
+	return 16
+}
+
+func (p *packet) portOffset(isSrc bool) int {
+	if p.protocol == ip.ICMP {
+		// Query id.
+		return 4
+	}
+	if isSrc {
+		return 0
+	}
+	return 2
+}
+
+// Source or destination endpoint; port is zero if packet has no port.
+func (p *packet) endpoint(isSrc bool) (e endpoint) {
+	o := p.addrOffset(isSrc)
+	copy(e.addr[:], p.b[o:o+4])
+	if p.hasPort() {
+		e.port = be16(p.l4[p.portOffset(isSrc):])
+	}
+	return
+}
+
+// Layer 4 checksum location and whether it covers ip pseudo header.
+func (p *packet) l4Checksum() (c []byte, pseudo bool) {
+	switch p.protocol {
+	case ip.TCP:
+		if len(p.l4) >= 20 {
+			c, pseudo = p.l4[16:18], true
+		}
+	case ip.UDP:
+		// Zero udp checksum means no checksum.
+		if len(p.l4) >= 8 && be16(p.l4[6:]) != 0 {
+			c, pseudo = p.l4[6:8], true
+		}
+	case ip.ICMP:
+		if len(p.l4) >= 4 {
+			c = p.l4[2:4]
+		}
+	}
+	return
+}
+
+// Rewrite source or destination endpoint updating ip and layer 4 checksums incrementally.
+func (p *packet) rewrite(isSrc bool, e endpoint) {
+	o := p.addrOffset(isSrc)
+	var old endpoint
+	copy(old.addr[:], p.b[o:o+4])
+	if old.addr != e.addr {
+		updateChecksum(p.b[10:12], old.addr[:], e.addr[:])
+		copy(p.b[o:o+4], e.addr[:])
+	}
+	c, pseudo := p.l4Checksum()
+	if c != nil && pseudo && old.addr != e.addr {
+		updateChecksum(c, old.addr[:], e.addr[:])
+	}
+	if !p.hasPort() {
+		return
+	}
+	po := p.portOffset(isSrc)
+	var oldPort, newPort [2]byte
+	copy(oldPort[:], p.l4[po:po+2])
+	put16(newPort[:], e.port)
+	if oldPort != newPort {
+		copy(p.l4[po:po+2], newPort[:])
+		if c != nil {
+			updateChecksum(c, oldPort[:], newPort[:])
+		}
+	}
+	// Computed udp checksum of zero is sent as all ones.
+	if p.protocol == ip.UDP && c != nil && be16(c) == 0 {
+		put16(c, 0xffff)
+	}
+}
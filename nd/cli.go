@@ -0,0 +1,234 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nd
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ip6 nd ra INTERFACE disable
+// ip6 nd ra INTERFACE [interval MIN MAX] [lifetime SECS] [no-default-router] [hop-limit N]
+// [reachable-time MS] [retrans-timer MS] [managed] [other] [mtu N]
+// [prefix PREFIX [valid SECS] [preferred SECS] [off-link] [no-autoconf]]...
+func (m *Main) raConfig(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si  vnet.Si
+		cf  RouterAdvertConfig
+		n   uint
+		s   string
+		pfx *RouterAdvertPrefix
+	)
+	if !in.Parse("%v", &si, m.Vnet) {
+		err = cli.ParseError
+		return
+	}
+	if in.Parse("disable") {
+		if !in.End() {
+			err = cli.ParseError
+			return
+		}
+		return m.SetRouterAdvert(si, nil)
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("interval %f %f", &cf.MinInterval, &cf.MaxInterval):
+		case in.Parse("lifetime %d", &n) && n <= 0xffff:
+			cf.Lifetime = uint16(n)
+		case in.Parse("no-default-router"):
+			cf.NoDefaultRouter = true
+		case in.Parse("hop-limit %d", &n) && n > 0 && n <= 255:
+			cf.CurHopLimit = uint8(n)
+		case in.Parse("reachable-time %d", &n):
+			cf.ReachableTime = uint32(n)
+		case in.Parse("retrans-timer %d", &n):
+			cf.RetransTimer = uint32(n)
+		case in.Parse("managed"):
+			cf.Managed = true
+		case in.Parse("other"):
+			cf.Other = true
+		case in.Parse("mtu %d", &n):
+			cf.Mtu = uint32(n)
+		case in.Parse("prefix %s", &s):
+			var p *net.IPNet
+			if _, p, err = net.ParseCIDR(s); err != nil {
+				return
+			}
+			cf.Prefixes = append(cf.Prefixes, RouterAdvertPrefix{Prefix: *p})
+			pfx = &cf.Prefixes[len(cf.Prefixes)-1]
+		case pfx != nil && in.Parse("valid %d", &n):
+			pfx.ValidLifetime = uint32(n)
+		case pfx != nil && in.Parse("preferred %d", &n):
+			pfx.PreferredLifetime = uint32(n)
+		case pfx != nil && in.Parse("off-link"):
+			pfx.OffLink = true
+		case pfx != nil && in.Parse("no-autoconf"):
+			pfx.NoAutoconf = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	return m.SetRouterAdvert(si, &cf)
+}
+
+type showInterface struct {
+	Interface string `format:"%-30s" align:"left"`
+	Address   string `format:"%-45s" align:"left"`
+	State     string `format:"%-10s" align:"left"`
+}
+
+// show ip6 nd interfaces [detail]
+func (m *Main) showInterfaces(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var detail bool
+	for !in.End() {
+		switch {
+		case in.Parse("d%*etail"):
+			detail = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	is := m.Interfaces()
+	if len(is) == 0 {
+		fmt.Fprintln(w, "No ip6 neighbor discovery interfaces")
+		return
+	}
+	if detail {
+		for i := range is {
+			x := &is[i]
+			fmt.Fprintf(w, "%s: ns tx %d na tx %d ra tx %d\n", vnet.SiName{V: v, Si: x.Si}, x.NsTx, x.NaTx, x.RaTx)
+			for j := range x.Addresses {
+				a := &x.Addresses[j]
+				fmt.Fprintf(w, "  %s %s\n", &a.Prefix, addressState(a))
+			}
+			if c := x.RouterAdvert; c != nil {
+				var flags []string
+				if c.Managed {
+					flags = append(flags, "managed")
+				}
+				if c.Other {
+					flags = append(flags, "other")
+				}
+				fmt.Fprintf(w, "  router advertisements: interval %g-%gs, lifetime %ds, hop limit %d, mtu %d, flags [%s]\n",
+					c.MinInterval, c.MaxInterval, c.Lifetime, c.CurHopLimit, c.Mtu, strings.Join(flags, " "))
+				for j := range c.Prefixes {
+					p := &c.Prefixes[j]
+					fmt.Fprintf(w, "    prefix %s valid %d preferred %d", &p.Prefix, p.ValidLifetime, p.PreferredLifetime)
+					if p.OffLink {
+						fmt.Fprintf(w, " off-link")
+					}
+					if p.NoAutoconf {
+						fmt.Fprintf(w, " no-autoconf")
+					}
+					fmt.Fprintln(w)
+				}
+			}
+		}
+		return
+	}
+	var xs []showInterface
+	for i := range is {
+		x := &is[i]
+		name := vnet.SiName{V: v, Si: x.Si}.String()
+		if x.RouterAdvert != nil {
+			name += " (ra)"
+		}
+		for j := range x.Addresses {
+			a := &x.Addresses[j]
+			xs = append(xs, showInterface{
+				Interface: name,
+				Address:   a.Prefix.String(),
+				State:     addressState(a),
+			})
+		}
+		if len(x.Addresses) == 0 {
+			xs = append(xs, showInterface{Interface: name})
+		}
+	}
+	elib.Tabulate(xs).Write(w)
+	return
+}
+
+func addressState(a *InterfaceAddress) string {
+	switch {
+	case a.Duplicate:
+		return "duplicate"
+	case a.Tentative:
+		return "tentative"
+	}
+	return "preferred"
+}
+
+type showNeighbor struct {
+	Interface string `format:"%-30s" align:"left"`
+	Address   string `format:"%-40s" align:"left"`
+	Ethernet  string `format:"%-20s" align:"left"`
+	State     string `format:"%-12s" align:"left"`
+	Router    string `format:"%-6s" align:"left"`
+}
+
+// show ip6 nd neighbors
+func (m *Main) showNeighbors(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	if !in.End() {
+		err = cli.ParseError
+		return
+	}
+	v := m.Vnet
+	ns := m.Neighbors()
+	if len(ns) == 0 {
+		fmt.Fprintln(w, "No ip6 neighbors")
+		return
+	}
+	var xs []showNeighbor
+	for i := range ns {
+		n := &ns[i]
+		x := showNeighbor{
+			Interface: vnet.SiName{V: v, Si: n.Si}.String(),
+			Address:   n.Ip.String(),
+			State:     n.State.String(),
+		}
+		if n.State != NeighborIncomplete {
+			x.Ethernet = n.Ethernet.String()
+		}
+		if n.IsRouter {
+			x.Router = "yes"
+		}
+		xs = append(xs, x)
+	}
+	elib.Tabulate(xs).Write(w)
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "ip6 nd ra",
+			ShortHelp: "configure ip6 router advertisements: ip6 nd ra INTERFACE disable | [interval MIN MAX] [lifetime SECS] [no-default-router] [hop-limit N] [reachable-time MS] [retrans-timer MS] [managed] [other] [mtu N] [prefix PREFIX [valid SECS] [preferred SECS] [off-link] [no-autoconf]]...",
+			Action:    m.raConfig,
+		},
+		cli.Command{
+			Name:      "show ip6 nd interfaces",
+			ShortHelp: "show ip6 neighbor discovery interfaces [detail]",
+			Action:    m.showInterfaces,
+		},
+		cli.Command{
+			Name:      "show ip6 nd neighbors",
+			ShortHelp: "show ip6 neighbor cache",
+			Action:    m.showNeighbors,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
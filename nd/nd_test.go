@@ -0,0 +1,300 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nd
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip6"
+
+	"net"
+	"testing"
+	"time"
+)
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+func addr(s string) ip6.Address { return ip6Address(net.ParseIP(s)) }
+
+var (
+	ourEthernet   = ethernet.Address{0x02, 0, 0, 0, 0, 1}
+	theirEthernet = ethernet.Address{0x02, 0, 0, 0, 0, 2}
+)
+
+func TestPacket(t *testing.T) {
+	src, dst, target := addr("fe80::1"), addr("ff02::1:ff00:2"), addr("2001:db8::2")
+	if s := solicitedNode(&target); s != dst {
+		t.Errorf("solicited node %s", &s)
+	}
+	if e := multicastEthernet(&dst); e != (ethernet.Address{0x33, 0x33, 0xff, 0, 0, 2}) {
+		t.Errorf("multicast ethernet %s", &e)
+	}
+	if a := linkLocal(&ourEthernet); a != addr("fe80::ff:fe00:1") {
+		t.Errorf("link local %s", &a)
+	}
+
+	var x message
+	b := neighborSolicit(&src, &dst, &target, &ourEthernet)
+	if ok, err := x.parse(b); !ok || err != nil {
+		t.Fatalf("parse solicit: %v", err)
+	}
+	if x.typ != typeNeighborSolicit || x.src != src || x.target != target || !x.hasLladdr || x.lladdr != ourEthernet {
+		t.Errorf("solicit %+v", x)
+	}
+
+	// Duplicate address detection solicitations have no link address.
+	var unspecified ip6.Address
+	b = neighborSolicit(&unspecified, &dst, &target, &ourEthernet)
+	if ok, err := x.parse(b); !ok || err != nil || x.hasLladdr {
+		t.Errorf("parse dad solicit: %v %+v", err, x)
+	}
+
+	b = neighborAdvert(&target, &src, &target, naSolicited|naOverride, &theirEthernet)
+	if ok, err := x.parse(b); !ok || err != nil || x.flags != naSolicited|naOverride || x.lladdr != theirEthernet {
+		t.Errorf("parse advert: %v %+v", err, x)
+	}
+
+	bad := []func(x []byte){
+		func(x []byte) { x[7] = 64 },
+		func(x []byte) { x[ip6.SizeofHeader+1] = 1 },
+		func(x []byte) { x[ip6.SizeofHeader+10]++ },
+		func(x []byte) { x[ip6.SizeofHeader+24+1] = 0 },
+	}
+	for i, f := range bad {
+		c := append([]byte(nil), b...)
+		f(c)
+		if ok, err := x.parse(c); !ok || err == nil {
+			t.Errorf("bad message %d parsed", i)
+		}
+	}
+	// Other icmp6 messages are not neighbor discovery messages.
+	c := append([]byte(nil), b...)
+	c[ip6.SizeofHeader] = 128
+	if ok, _ := x.parse(c); ok {
+		t.Errorf("echo request parsed")
+	}
+
+	cf := RouterAdvertConfig{Managed: true, Mtu: 9000}
+	if err := cf.validate(); err != nil {
+		t.Fatal(err)
+	}
+	_, p, _ := net.ParseCIDR("2001:db8::/64")
+	cf.Prefixes = []RouterAdvertPrefix{{Prefix: *p, ValidLifetime: 100, PreferredLifetime: 50}}
+	b = routerAdvert(&src, &allNodes, &cf, 1800, &ourEthernet)
+	if ok, err := x.parse(b); !ok || err != nil || x.typ != typeRouterAdvert || x.lladdr != ourEthernet {
+		t.Fatalf("parse advert: %v %+v", err, x)
+	}
+	r := b[ip6.SizeofHeader:]
+	if r[4] != 64 || r[5] != raManaged || r[6] != 1800>>8 || r[7] != 1800&0xff {
+		t.Errorf("router advert % x", r[:16])
+	}
+	// Link address, mtu and prefix information options.
+	o := r[16+sizeofLinkAddress:]
+	if o[0] != optMtu || get32(o[4:]) != 9000 {
+		t.Errorf("mtu option % x", o[:8])
+	}
+	o = o[8:]
+	if o[0] != optPrefixInfo || o[2] != 64 || o[3] != prefixOnLink|prefixAutoconf ||
+		get32(o[4:]) != 100 || get32(o[8:]) != 50 || !net.IP(o[16:32]).Equal(p.IP) {
+		t.Errorf("prefix option % x", o)
+	}
+}
+
+func newMain() (m *Main, i *iface) {
+	m = &Main{
+		ReachableTime: 30 * time.Second,
+		RetransTimer:  time.Second,
+		MaxProbes:     3,
+		DadTransmits:  1,
+	}
+	i = &iface{si: 1, lladdr: ourEthernet, hasRw: true, addrs: make(map[ip6.Address]*address)}
+	m.addIface(i)
+	return
+}
+
+// Single queued frame parsed as neighbor discovery message.
+func sent(t *testing.T, m *Main) (x message, dst ethernet.Address) {
+	if len(m.frames) != 1 {
+		t.Fatalf("%d frames sent", len(m.frames))
+	}
+	f := m.frames[0]
+	m.frames = nil
+	if ok, err := x.parse(f.b); !ok || err != nil {
+		t.Fatalf("parse sent frame: %v", err)
+	}
+	return x, f.dst
+}
+
+func TestDad(t *testing.T) {
+	m, i := newMain()
+	a := addr("2001:db8::1")
+	now := seconds(10)
+	m.addAddress(i, a, 64, now)
+	m.timer(now + seconds(1))
+	x, dst := sent(t, m)
+	if x.typ != typeNeighborSolicit || !isUnspecified(&x.src) || x.dst != solicitedNode(&a) || x.target != a {
+		t.Errorf("dad solicit %+v", x)
+	}
+	if dst != multicastEthernet(&x.dst) {
+		t.Errorf("dad destination %s", &dst)
+	}
+
+	// Solicitations for tentative address are not answered.
+	src := addr("2001:db8::2")
+	ns := neighborSolicit(&src, &x.dst, &a, &theirEthernet)
+	if consumed, e := m.input(1, ns, now); !consumed || e != rx_error_neighbor_solicit || len(m.frames) != 0 {
+		t.Errorf("solicit for tentative address answered")
+	}
+	m.changes = nil
+
+	// No answer within retransmit timer: address is preferred.
+	m.timer(now + seconds(2.1))
+	if i.addrs[a].tentative || i.addrs[a].duplicate {
+		t.Errorf("address still tentative")
+	}
+
+	// Another node probing for same address is defended.
+	var unspecified ip6.Address
+	ns = neighborSolicit(&unspecified, &x.dst, &a, &theirEthernet)
+	if consumed, _ := m.input(1, ns, now); !consumed {
+		t.Errorf("dad solicit not consumed")
+	}
+	if x, _ = sent(t, m); x.typ != typeNeighborAdvert || x.dst != allNodes || x.target != a {
+		t.Errorf("dad defense %+v", x)
+	}
+
+	// Duplicate detected by advertisement for tentative address.
+	b := addr("2001:db8::3")
+	m.addAddress(i, b, 64, now)
+	na := neighborAdvert(&b, &allNodes, &b, naOverride, &theirEthernet)
+	if consumed, e := m.input(1, na, now); !consumed || e != rx_error_duplicate || !i.addrs[b].duplicate {
+		t.Errorf("duplicate not detected")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m, i := newMain()
+	m.DadTransmits = 0
+	a, peer := addr("2001:db8::1"), addr("2001:db8::2")
+	m.addAddress(i, a, 64, 0)
+
+	// Packet to unresolved address on connected prefix sends multicast solicitation.
+	now := seconds(10)
+	var y [ip6.SizeofHeader]byte
+	h := ip6.Header{Protocol: 17, Ttl: 64, Src: a, Dst: peer}
+	h.Ip_version_traffic_class_and_flow_label.Set(ip6.DefaultVersionTrafficClassAndFlowLabel)
+	h.Write(y[:])
+	if consumed, _ := m.input(1, y[:], now); consumed {
+		t.Errorf("packet consumed")
+	}
+	x, _ := sent(t, m)
+	if x.typ != typeNeighborSolicit || x.src != a || x.dst != solicitedNode(&peer) || x.target != peer {
+		t.Errorf("solicit %+v", x)
+	}
+	n := m.neighbors[neighborKey{si: 1, a: peer}]
+	if n == nil || n.state != NeighborIncomplete {
+		t.Fatalf("no incomplete neighbor")
+	}
+
+	// Solicited advertisement resolves neighbor and adds it to ethernet neighbor table.
+	na := neighborAdvert(&peer, &a, &peer, naSolicited|naOverride|naRouter, &theirEthernet)
+	if consumed, e := m.input(1, na, now); !consumed || e != rx_error_neighbor_advert {
+		t.Errorf("advert not consumed")
+	}
+	if n.state != NeighborReachable || n.ethernet != theirEthernet || !n.isRouter {
+		t.Errorf("neighbor %+v", n)
+	}
+	if len(m.changes) != 1 || m.changes[0].isDel || !m.changes[0].n.Ip.Equal(peer.ToNetIP()) {
+		t.Errorf("changes %+v", m.changes)
+	}
+	m.changes = nil
+
+	// Neighbor is probed with unicast solicitations after reachable time and deleted when
+	// probes are not answered.
+	now += seconds(30.1)
+	for p := uint(0); p < m.MaxProbes; p++ {
+		m.timer(now)
+		x, dst := sent(t, m)
+		if x.dst != peer || dst != theirEthernet || n.state != NeighborProbe {
+			t.Errorf("probe %d: %+v", p, x)
+		}
+		now += seconds(1.1)
+	}
+	m.timer(now)
+	if m.neighbors[n.neighborKey] != nil || len(m.changes) != 1 || !m.changes[0].isDel {
+		t.Errorf("neighbor not deleted: changes %+v", m.changes)
+	}
+
+	// Solicitation with link address is answered and teaches link address.
+	m.changes = nil
+	ns := neighborSolicit(&peer, &a, &a, &theirEthernet)
+	if consumed, _ := m.input(1, ns, now); !consumed {
+		t.Errorf("solicit not consumed")
+	}
+	x, dst := sent(t, m)
+	if x.typ != typeNeighborAdvert || x.dst != peer || dst != theirEthernet ||
+		x.flags != naRouter|naSolicited|naOverride || x.lladdr != ourEthernet {
+		t.Errorf("advert %+v", x)
+	}
+	if len(m.changes) != 1 {
+		t.Errorf("changes %+v", m.changes)
+	}
+}
+
+func TestRouterAdvert(t *testing.T) {
+	m, i := newMain()
+	m.DadTransmits = 0
+	m.addAddress(i, addr("fe80::1"), 64, 0)
+	m.addAddress(i, addr("2001:db8::1"), 64, 0)
+	cf := RouterAdvertConfig{MaxInterval: 30}
+	if err := cf.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cf.MinInterval != 10 || cf.Lifetime != 90 {
+		t.Errorf("defaults %+v", cf)
+	}
+	i.ra = &cf
+
+	now := seconds(10)
+	m.timer(now)
+	x, dst := sent(t, m)
+	if x.typ != typeRouterAdvert || x.src != addr("fe80::1") || x.dst != allNodes || dst != multicastEthernet(&allNodes) {
+		t.Errorf("advert %+v", x)
+	}
+	// Initial advertisements are sent at most 16 seconds apart.
+	if dt := (i.nextRa - now).Seconds(); dt < 10 || dt > 16.01 {
+		t.Errorf("next advert in %g seconds", dt)
+	}
+
+	// Solicitations are answered no sooner than 3 seconds after last advertisement.
+	rs := make([]byte, 8)
+	rs[0] = typeRouterSolicit
+	src := addr("fe80::2")
+	if consumed, e := m.input(1, packet(&src, &allRouters, rs), now+seconds(1)); !consumed || e != rx_error_router_solicit {
+		t.Errorf("solicit not consumed")
+	}
+	if dt := (i.nextRa - now).Seconds(); dt < 2.99 || dt > 3.01 {
+		t.Errorf("solicited advert in %g seconds", dt)
+	}
+	m.timer(now + seconds(3))
+	if _, _ = sent(t, m); i.raTx != 2 {
+		t.Errorf("ra tx %d", i.raTx)
+	}
+
+	bad := []RouterAdvertConfig{
+		{MaxInterval: 2},
+		{MaxInterval: 30, MinInterval: 25},
+		{MaxInterval: 30, Lifetime: 10},
+		{Prefixes: []RouterAdvertPrefix{{Prefix: net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}}},
+	}
+	for k := range bad {
+		if err := bad[k].validate(); err == nil {
+			t.Errorf("bad config %d validated", k)
+		}
+	}
+}
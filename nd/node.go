@@ -0,0 +1,111 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nd
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+)
+
+const (
+	rx_next_error uint = iota
+	rx_next_punt
+)
+
+const (
+	rx_error_neighbor_solicit uint = iota
+	rx_error_neighbor_advert
+	rx_error_router_solicit
+	rx_error_malformed
+	rx_error_duplicate
+)
+
+// Node receiving neighbor discovery messages.  Packets must start with ip6 header.
+type rxNode struct {
+	vnet.InOutNode
+	m *Main
+}
+
+func (n *rxNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{
+		rx_next_error: "error",
+		rx_next_punt:  "punt",
+	}
+	n.Errors = []string{
+		rx_error_neighbor_solicit: "neighbor solicitations",
+		rx_error_neighbor_advert:  "neighbor advertisements",
+		rx_error_router_solicit:   "router solicitations",
+		rx_error_malformed:        "malformed neighbor discovery message",
+		rx_error_duplicate:        "duplicate address detected",
+	}
+	v.RegisterInOutNode(n, "ip6-nd")
+}
+
+func (n *rxNode) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		x0 := rx_next_punt
+		if consumed, e := m.input(r0.Si, r0.DataSlice(), now); consumed {
+			n.SetError(r0, e)
+			x0 = rx_next_error
+		}
+		q.Put1(r0, x0)
+		i++
+	}
+	m.notify()
+}
+
+// Node transmitting queued neighbor discovery messages.  Nexts to interface output nodes
+// are added with interface rewrites.
+type txNode struct {
+	vnet.InputNode
+	m    *Main
+	pool vnet.BufferPool
+	tmp  vnet.RefVec
+}
+
+func (n *txNode) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{"error"}
+	v.RegisterInputNode(n, "ip6-nd-tx")
+	p := &n.pool
+	p.BufferTemplate = vnet.DefaultBufferPool.BufferTemplate
+	p.Name = "ip6-nd-tx"
+	v.AddBufferPool(p)
+}
+
+func (n *txNode) NodeInput(o *vnet.RefOut) {
+	m := n.m
+	v := m.Vnet
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	done := 0
+	for ; done < len(m.frames); done++ {
+		f := &m.frames[done]
+		out := &o.Outs[f.rw.NextIndex]
+		if out.GetLen(v) >= out.Cap() {
+			break
+		}
+		n.tmp.Validate(0)
+		n.pool.AllocRefs(n.tmp[:1])
+		r := n.tmp[0]
+		r.SetDataLen(uint(len(f.b)))
+		copy(r.DataSlice(), f.b)
+		vnet.PerformRewrite(&r, &f.rw)
+		// Rewrite has broadcast destination.
+		copy(r.DataSlice(), f.dst[:])
+		r.Si = f.rw.Si
+		out.BufferPool = &n.pool
+		out.Refs[out.AddLen(v)] = r
+	}
+	l := copy(m.frames, m.frames[done:])
+	m.frames = m.frames[:l]
+	n.Activate(l > 0)
+}
@@ -0,0 +1,891 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nd provides ip6 neighbor discovery (RFC 4861) with duplicate address
+// detection (RFC 4862) and router advertisements.
+//
+// Ip6 input sends neighbor discovery messages and packets to unresolved
+// neighbors to the ip6-nd node.  Neighbor solicitations and advertisements
+// for interface addresses are consumed: solicitations are answered and link
+// addresses learned from both are added as ip6 neighbors to the ethernet
+// neighbor table shared with arp.  Other packets are punted; packets to
+// unresolved addresses of connected prefixes start address resolution.
+// Addresses added to interfaces are tentative until duplicate address
+// detection completes.  Interfaces with router advertisements configured send
+// them periodically and in response to router solicitations.
+package nd
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip6"
+
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+var packageIndex uint
+
+// Neighbor cache entry state.
+type NeighborState uint8
+
+const (
+	// Address resolution in progress.
+	NeighborIncomplete NeighborState = iota
+	// Link address confirmed within reachable time.
+	NeighborReachable
+	// Reachable time expired; neighbor is being probed with unicast solicitations.
+	NeighborProbe
+)
+
+var neighborStateStrings = [...]string{
+	NeighborIncomplete: "incomplete",
+	NeighborReachable:  "reachable",
+	NeighborProbe:      "probe",
+}
+
+func (x NeighborState) String() string { return elib.Stringer(neighborStateStrings[:], int(x)) }
+
+// Neighbor status.
+type Neighbor struct {
+	Si       vnet.Si
+	Ip       net.IP
+	Ethernet ethernet.Address
+	State    NeighborState
+	IsRouter bool
+}
+
+// Prefix information option of router advertisements.
+type RouterAdvertPrefix struct {
+	Prefix net.IPNet
+	// Lifetimes in seconds; 30 and 7 days when both are zero.
+	ValidLifetime, PreferredLifetime uint32
+	// Clear on-link and autonomous address configuration flags.
+	OffLink, NoAutoconf bool
+}
+
+// Router advertisement configuration of an interface.
+type RouterAdvertConfig struct {
+	// Unsolicited advertisements are sent at random intervals between min and max seconds.
+	// Max defaults to 600 and min to a third of max.
+	MinInterval, MaxInterval float64
+	// Router lifetime in seconds; defaults to three times max interval.  With no default
+	// router lifetime is zero and hosts do not use this router as default router.
+	Lifetime        uint16
+	NoDefaultRouter bool
+	// Hop limit hosts use for outgoing packets; defaults to 64.
+	CurHopLimit uint8
+	// Reachable time and retransmit timer in milliseconds; zero is unspecified.
+	ReachableTime, RetransTimer uint32
+	// Managed and other configuration flags for dhcp6.
+	Managed, Other bool
+	// Link mtu option is sent unless zero.
+	Mtu uint32
+	// Advertised prefixes; global prefixes of interface addresses when empty.
+	Prefixes []RouterAdvertPrefix
+}
+
+// Interface address status.
+type InterfaceAddress struct {
+	Prefix net.IPNet
+	// Tentative while duplicate address detection is running; duplicate when it failed.
+	Tentative, Duplicate bool
+}
+
+// Interface status.
+type Interface struct {
+	Si        vnet.Si
+	Addresses []InterfaceAddress
+	// Nil unless router advertisements are sent.
+	RouterAdvert *RouterAdvertConfig
+	// Neighbor solicitations, neighbor advertisements and router advertisements sent.
+	NsTx, NaTx, RaTx uint64
+}
+
+type address struct {
+	len                  uint
+	tentative, duplicate bool
+	// Duplicate address detection solicitations sent and time of next one.
+	dadProbes uint
+	dadNext   cpu.Time
+}
+
+type iface struct {
+	si     vnet.Si
+	lladdr ethernet.Address
+	// Rewrite to interface with broadcast destination; destination is set per frame.
+	rw    vnet.Rewrite
+	hasRw bool
+	addrs map[ip6.Address]*address
+
+	ra *RouterAdvertConfig
+	// Time of next unsolicited advertisement and of last advertisement sent.
+	nextRa, lastRa cpu.Time
+	nInitialRa     uint
+
+	nsTx, naTx, raTx uint64
+}
+
+type neighborKey struct {
+	si vnet.Si
+	a  ip6.Address
+}
+
+type neighbor struct {
+	neighborKey
+	ethernet ethernet.Address
+	state    NeighborState
+	isRouter bool
+	// Solicitations sent in incomplete and probe states.
+	probes  uint
+	timeout cpu.Time
+	// Set when neighbor has been added to ethernet neighbor table.
+	installed bool
+}
+
+// Change to ethernet neighbor table.
+type change struct {
+	n     ethernet.IpNeighbor
+	isDel bool
+}
+
+// Frame waiting for transmission; b starts with ip6 header.
+type frame struct {
+	rw  vnet.Rewrite
+	dst ethernet.Address
+	b   []byte
+}
+
+type Main struct {
+	vnet.Package
+
+	m6 *ip6.Main
+
+	// Neighbor reachable time and interval between retransmitted solicitations.
+	ReachableTime, RetransTimer time.Duration
+	// Solicitations sent before resolution fails or a neighbor is deleted.
+	MaxProbes uint
+	// Duplicate address detection solicitations; zero disables detection.
+	DadTransmits uint
+
+	mu        sync.Mutex
+	ifs       map[vnet.Si]*iface
+	neighbors map[neighborKey]*neighbor
+	changes   []change
+	frames    []frame
+
+	rxNode rxNode
+	txNode txNode
+
+	timerEvent timerEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{
+		ReachableTime: 30 * time.Second,
+		RetransTimer:  time.Second,
+		MaxProbes:     3,
+		DadTransmits:  1,
+	}
+	packageIndex = v.AddPackage("nd", m)
+	m.DependsOn("ip6", "ethernet")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. nd { reachable-time 30000 retrans-timer 1000 max-probes 3 dad-transmits 1 }
+// with times in milliseconds.
+func (m *Main) Configure(in *parse.Input) {
+	var ms, n uint
+	for !in.End() {
+		switch {
+		case in.Parse("reachable-time %d", &ms) && ms > 0:
+			m.ReachableTime = time.Duration(ms) * time.Millisecond
+		case in.Parse("retrans-timer %d", &ms) && ms > 0:
+			m.RetransTimer = time.Duration(ms) * time.Millisecond
+		case in.Parse("max-probes %d", &n) && n > 0:
+			m.MaxProbes = n
+		case in.Parse("dad-transmits %d", &n):
+			m.DadTransmits = n
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between timer runs.
+const timerInterval = .25
+
+type timerEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *timerEvent) String() string { return "nd timer" }
+func (e *timerEvent) EventAction() {
+	e.m.timer(cpu.TimeNow())
+	e.m.notify()
+	e.SignalEventAfter(e, timerInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.m6 = ip6.GetMain(v)
+	m.rxNode.init(v, m)
+	m.txNode.init(v, m)
+	for _, t := range []uint8{typeRouterSolicit, typeRouterAdvert, typeNeighborSolicit, typeNeighborAdvert} {
+		m.m6.RegisterIcmp6LocalType(t, "ip6-nd")
+	}
+	m.m6.RegisterGleanNode("ip6-nd")
+	m.m6.RegisterIfAddrAddDelHook(m.ifAddrAddDel)
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	v.RegisterSwIfAdminUpDownHook(m.swIfAdminUpDown)
+	m.timerEvent.m = m
+	v.SignalEventAfter(&m.timerEvent, timerInterval)
+	m.cliInit()
+	return
+}
+
+func after(now cpu.Time, d time.Duration) cpu.Time {
+	var dt cpu.Time
+	dt.Cycles(d.Seconds())
+	return now + dt
+}
+
+func ip6Address(a net.IP) (x ip6.Address) {
+	copy(x[:], a.To16())
+	return
+}
+
+func masked(a *ip6.Address, l uint) (x ip6.Address) {
+	m := ip6.AddressMaskForLen(l)
+	for i := range a {
+		x[i] = a[i] & m[i]
+	}
+	return
+}
+
+// Create interface state.  Interfaces without hardware interface are not sent to.
+func (m *Main) newIface(si vnet.Si) (i *iface) {
+	v := m.Vnet
+	i = &iface{si: si, addrs: make(map[ip6.Address]*address)}
+	if h := v.SupHwIf(v.SwIf(si)); h != nil {
+		copy(i.lladdr[:], h.Hi().GetAddress(v))
+		v.SetRewrite(&i.rw, si, &m.txNode, vnet.IP6, nil)
+		i.hasRw = true
+	}
+	return
+}
+
+// Called with lock held.
+func (m *Main) addIface(i *iface) {
+	if m.ifs == nil {
+		m.ifs = make(map[vnet.Si]*iface)
+	}
+	m.ifs[i.si] = i
+}
+
+// Add or delete interface address; added addresses are tentative until duplicate address
+// detection completes.
+func (m *Main) ifAddrAddDel(si vnet.Si, p *net.IPNet, isDel bool) {
+	if p.IP.To4() != nil {
+		return
+	}
+	a := ip6Address(p.IP)
+	var ni *iface
+	if !isDel {
+		ni = m.newIface(si)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.ifs[si]
+	if isDel {
+		if i != nil {
+			delete(i.addrs, a)
+			if len(i.addrs) == 0 && i.ra == nil {
+				delete(m.ifs, si)
+			}
+		}
+		return
+	}
+	if i == nil {
+		i = ni
+		m.addIface(i)
+	}
+	l, _ := p.Mask.Size()
+	m.addAddress(i, a, uint(l), cpu.TimeNow())
+}
+
+// Called with lock held.
+func (m *Main) addAddress(i *iface, a ip6.Address, l uint, now cpu.Time) {
+	x := &address{len: l}
+	if m.DadTransmits > 0 {
+		x.tentative = true
+		// Delay first solicitation by up to a second (RFC 4862 section 5.4.2).
+		x.dadNext = after(now, time.Duration(rand.Int63n(int64(time.Second))))
+	}
+	i.addrs[a] = x
+}
+
+// Called with lock held.
+func (m *Main) delNeighbors(si vnet.Si) {
+	for k := range m.neighbors {
+		if k.si == si {
+			delete(m.neighbors, k)
+		}
+	}
+}
+
+// Neighbors in ethernet neighbor table are deleted by ethernet package when interfaces
+// are deleted or go down.
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		m.mu.Lock()
+		delete(m.ifs, si)
+		m.delNeighbors(si)
+		m.mu.Unlock()
+	}
+	return
+}
+
+// Interfaces coming up run duplicate address detection and send initial router
+// advertisements again.
+func (m *Main) swIfAdminUpDown(v *vnet.Vnet, si vnet.Si, isUp bool) (err error) {
+	now := cpu.TimeNow()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !isUp {
+		m.delNeighbors(si)
+		return
+	}
+	if i, ok := m.ifs[si]; ok {
+		for a, x := range i.addrs {
+			m.addAddress(i, a, x.len, now)
+		}
+		i.nextRa, i.nInitialRa = now, 0
+	}
+	return
+}
+
+// Default, minimum and maximum intervals between unsolicited router advertisements and
+// maximum interval for initial advertisements (RFC 4861 sections 6.2.1 and 10).
+const (
+	defaultMaxRaInterval     = 600
+	minMaxRaInterval         = 4
+	maxMaxRaInterval         = 1800
+	minMinRaInterval         = 3
+	maxInitialRaInterval     = 16
+	maxInitialRas            = 3
+	minDelayBetweenRas       = 3
+	maxRaDelay               = .5
+	defaultValidLifetime     = 30 * 24 * 60 * 60
+	defaultPreferredLifetime = 7 * 24 * 60 * 60
+	maxRouterLifetime        = 9000
+)
+
+// SetRouterAdvert enables router advertisements on interface with given configuration;
+// nil disables them after sending a final advertisement with zero router lifetime.
+func (m *Main) SetRouterAdvert(si vnet.Si, c *RouterAdvertConfig) (err error) {
+	v := m.Vnet
+	now := cpu.TimeNow()
+	if c == nil {
+		m.mu.Lock()
+		if i, ok := m.ifs[si]; ok && i.ra != nil {
+			m.sendRouterAdvert(i, 0, now)
+			i.ra = nil
+			if len(i.addrs) == 0 {
+				delete(m.ifs, si)
+			}
+		}
+		m.mu.Unlock()
+		m.notify()
+		return
+	}
+	cf := *c
+	if err = cf.validate(); err != nil {
+		return fmt.Errorf("%s: %v", vnet.SiName{V: v, Si: si}, err)
+	}
+	ni := m.newIface(si)
+	if !ni.hasRw {
+		return fmt.Errorf("%s: no hardware interface", vnet.SiName{V: v, Si: si})
+	}
+	m.mu.Lock()
+	i := m.ifs[si]
+	if i == nil {
+		i = ni
+		m.addIface(i)
+	}
+	if i.ra == nil {
+		i.nInitialRa = 0
+	}
+	i.ra = &cf
+	i.nextRa = now
+	m.mu.Unlock()
+	return
+}
+
+// Validate configuration and fill in defaults.
+func (c *RouterAdvertConfig) validate() (err error) {
+	if c.MaxInterval == 0 {
+		c.MaxInterval = defaultMaxRaInterval
+	}
+	if c.MaxInterval < minMaxRaInterval || c.MaxInterval > maxMaxRaInterval {
+		return fmt.Errorf("max interval %g not in [%d, %d] seconds", c.MaxInterval, minMaxRaInterval, maxMaxRaInterval)
+	}
+	if c.MinInterval == 0 {
+		c.MinInterval = c.MaxInterval / 3
+		if c.MinInterval < minMinRaInterval {
+			c.MinInterval = minMinRaInterval
+		}
+	}
+	if c.MinInterval < minMinRaInterval || c.MinInterval > .75*c.MaxInterval {
+		return fmt.Errorf("min interval %g not in [%d, %g] seconds", c.MinInterval, minMinRaInterval, .75*c.MaxInterval)
+	}
+	switch {
+	case c.NoDefaultRouter:
+		c.Lifetime = 0
+	case c.Lifetime == 0:
+		c.Lifetime = maxRouterLifetime
+		if l := 3 * c.MaxInterval; l < maxRouterLifetime {
+			c.Lifetime = uint16(l)
+		}
+	case float64(c.Lifetime) < c.MaxInterval || c.Lifetime > maxRouterLifetime:
+		return fmt.Errorf("router lifetime %d not in [%g, %d] seconds", c.Lifetime, c.MaxInterval, maxRouterLifetime)
+	}
+	if c.CurHopLimit == 0 {
+		c.CurHopLimit = 64
+	}
+	ps := make([]RouterAdvertPrefix, len(c.Prefixes))
+	for i := range c.Prefixes {
+		p := c.Prefixes[i]
+		if p.Prefix.IP.To4() != nil || p.Prefix.IP.To16() == nil {
+			return fmt.Errorf("%s: not an ip6 prefix", &p.Prefix)
+		}
+		if p.ValidLifetime == 0 && p.PreferredLifetime == 0 {
+			p.ValidLifetime, p.PreferredLifetime = defaultValidLifetime, defaultPreferredLifetime
+		}
+		if p.PreferredLifetime > p.ValidLifetime {
+			return fmt.Errorf("%s: preferred lifetime %d greater than valid lifetime %d",
+				&p.Prefix, p.PreferredLifetime, p.ValidLifetime)
+		}
+		ps[i] = p
+	}
+	c.Prefixes = ps
+	return
+}
+
+// RouterAdvert returns router advertisement configuration of interface.
+func (m *Main) RouterAdvert(si vnet.Si) (c RouterAdvertConfig, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i, exists := m.ifs[si]; exists && i.ra != nil {
+		c, ok = *i.ra, true
+		c.Prefixes = append([]RouterAdvertPrefix(nil), c.Prefixes...)
+	}
+	return
+}
+
+// Interfaces returns status of interfaces with ip6 addresses or router advertisements
+// sorted by interface.
+func (m *Main) Interfaces() (is []Interface) {
+	m.mu.Lock()
+	for _, i := range m.ifs {
+		x := Interface{Si: i.si, NsTx: i.nsTx, NaTx: i.naTx, RaTx: i.raTx}
+		for a, y := range i.addrs {
+			x.Addresses = append(x.Addresses, InterfaceAddress{
+				Prefix:    net.IPNet{IP: a.ToNetIP(), Mask: net.CIDRMask(int(y.len), 128)},
+				Tentative: y.tentative,
+				Duplicate: y.duplicate,
+			})
+		}
+		if i.ra != nil {
+			c := *i.ra
+			c.Prefixes = append([]RouterAdvertPrefix(nil), c.Prefixes...)
+			x.RouterAdvert = &c
+		}
+		is = append(is, x)
+	}
+	m.mu.Unlock()
+	sort.Slice(is, func(i, j int) bool { return is[i].Si < is[j].Si })
+	for k := range is {
+		as := is[k].Addresses
+		sort.Slice(as, func(i, j int) bool { return bytes.Compare(as[i].Prefix.IP, as[j].Prefix.IP) < 0 })
+	}
+	return
+}
+
+// Neighbors returns neighbor cache sorted by interface and address.
+func (m *Main) Neighbors() (ns []Neighbor) {
+	m.mu.Lock()
+	for _, n := range m.neighbors {
+		ns = append(ns, Neighbor{
+			Si:       n.si,
+			Ip:       n.a.ToNetIP(),
+			Ethernet: n.ethernet,
+			State:    n.state,
+			IsRouter: n.isRouter,
+		})
+	}
+	m.mu.Unlock()
+	sort.Slice(ns, func(i, j int) bool {
+		a, b := &ns[i], &ns[j]
+		if a.Si != b.Si {
+			return a.Si < b.Si
+		}
+		return bytes.Compare(a.Ip, b.Ip) < 0
+	})
+	return
+}
+
+// Source address for solicitations on interface: address on same prefix as destination,
+// else link local address.  Called with lock held.
+func (i *iface) source(dst *ip6.Address) (src ip6.Address) {
+	src = linkLocal(&i.lladdr)
+	for a, x := range i.addrs {
+		if x.tentative || x.duplicate {
+			continue
+		}
+		if isLinkLocal(&a) {
+			src = a
+		} else if x.len < 128 && masked(dst, x.len) == masked(&a, x.len) {
+			return a
+		}
+	}
+	return
+}
+
+// Interface address with connected prefix containing given address.  Called with lock held.
+func (i *iface) onLink(a *ip6.Address) bool {
+	for b, x := range i.addrs {
+		if x.len < 128 && !x.duplicate && masked(a, x.len) == masked(&b, x.len) {
+			return true
+		}
+	}
+	return false
+}
+
+// Maximum number of frames waiting for transmission.
+const maxFrames = vnet.MaxVectorLen
+
+// Queue frame for transmission.  Called with lock held.
+func (m *Main) send(i *iface, dst ethernet.Address, b []byte) {
+	if !i.hasRw || len(m.frames) >= maxFrames {
+		return
+	}
+	m.frames = append(m.frames, frame{rw: i.rw, dst: dst, b: b})
+}
+
+// Send solicitation for target; multicast to solicited node address unless destination
+// ethernet address is given.  Called with lock held.
+func (m *Main) sendSolicit(i *iface, target *ip6.Address, dst *ethernet.Address) {
+	var d ip6.Address
+	var e ethernet.Address
+	if dst != nil {
+		d, e = *target, *dst
+	} else {
+		d = solicitedNode(target)
+		e = multicastEthernet(&d)
+	}
+	src := i.source(target)
+	m.send(i, e, neighborSolicit(&src, &d, target, &i.lladdr))
+	i.nsTx++
+}
+
+// Send advertisement of prefixes for interface with given router lifetime.  Called with lock held.
+func (m *Main) sendRouterAdvert(i *iface, lifetime uint16, now cpu.Time) {
+	c := *i.ra
+	if len(c.Prefixes) == 0 {
+		for a, x := range i.addrs {
+			if x.len >= 128 || isLinkLocal(&a) || x.duplicate {
+				continue
+			}
+			p := RouterAdvertPrefix{ValidLifetime: defaultValidLifetime, PreferredLifetime: defaultPreferredLifetime}
+			p.Prefix.IP = masked(&a, x.len).ToNetIP()
+			p.Prefix.Mask = net.CIDRMask(int(x.len), 128)
+			c.Prefixes = append(c.Prefixes, p)
+		}
+		sort.Slice(c.Prefixes, func(i, j int) bool {
+			return bytes.Compare(c.Prefixes[i].Prefix.IP, c.Prefixes[j].Prefix.IP) < 0
+		})
+	}
+	src := i.source(&allNodes)
+	m.send(i, multicastEthernet(&allNodes), routerAdvert(&src, &allNodes, &c, lifetime, &i.lladdr))
+	i.raTx++
+	i.lastRa = now
+}
+
+// Add or update neighbor with link address and queue change to ethernet neighbor table.
+// Called with lock held.
+func (m *Main) learn(k neighborKey, e ethernet.Address, isRouter bool, now cpu.Time) (n *neighbor) {
+	n = m.neighbors[k]
+	if n == nil {
+		n = &neighbor{neighborKey: k}
+		if m.neighbors == nil {
+			m.neighbors = make(map[neighborKey]*neighbor)
+		}
+		m.neighbors[k] = n
+	}
+	if !n.installed || n.ethernet != e {
+		n.ethernet, n.installed = e, true
+		m.changes = append(m.changes, change{n: m.ipNeighbor(n)})
+	}
+	n.isRouter = n.isRouter || isRouter
+	n.state, n.probes = NeighborReachable, 0
+	n.timeout = after(now, m.ReachableTime)
+	return
+}
+
+func (m *Main) ipNeighbor(n *neighbor) ethernet.IpNeighbor {
+	return ethernet.IpNeighbor{Si: n.si, Ip: n.a.ToNetIP(), Ethernet: n.ethernet}
+}
+
+// Called with lock held.
+func (m *Main) delNeighbor(n *neighbor) {
+	delete(m.neighbors, n.neighborKey)
+	if n.installed {
+		m.changes = append(m.changes, change{n: m.ipNeighbor(n), isDel: true})
+	}
+}
+
+// Handle received ip6 packet.  Returns true when packet was consumed with rx node error;
+// otherwise packet is passed on.
+func (m *Main) input(si vnet.Si, b []byte, now cpu.Time) (consumed bool, e uint) {
+	var x message
+	ok, err := x.parse(b)
+	if ok && err != nil {
+		return true, rx_error_malformed
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.ifs[si]
+	if i == nil {
+		return
+	}
+	if !ok {
+		m.glean(i, b, now)
+		return
+	}
+	switch x.typ {
+	case typeNeighborSolicit:
+		return m.neighborSolicit(i, &x, now)
+	case typeNeighborAdvert:
+		return m.neighborAdvert(i, &x, now)
+	case typeRouterSolicit:
+		if x.hasLladdr {
+			m.learn(neighborKey{si: si, a: x.src}, x.lladdr, false, now)
+		}
+		if i.ra != nil {
+			// Solicited advertisements are delayed randomly and rate limited (RFC 4861 section 6.2.6).
+			t := after(now, time.Duration(rand.Float64()*maxRaDelay*float64(time.Second)))
+			if l := after(i.lastRa, minDelayBetweenRas*time.Second); i.lastRa != 0 && t < l {
+				t = l
+			}
+			if t < i.nextRa {
+				i.nextRa = t
+			}
+			return true, rx_error_router_solicit
+		}
+	case typeRouterAdvert:
+		if x.hasLladdr && isLinkLocal(&x.src) {
+			m.learn(neighborKey{si: si, a: x.src}, x.lladdr, true, now)
+		}
+	}
+	return
+}
+
+// Called with lock held.
+func (m *Main) neighborSolicit(i *iface, x *message, now cpu.Time) (consumed bool, e uint) {
+	a, ok := i.addrs[x.target]
+	if !ok {
+		return
+	}
+	consumed, e = true, rx_error_neighbor_solicit
+	if isUnspecified(&x.src) {
+		// Another node is probing for our tentative address.
+		if a.tentative {
+			a.tentative, a.duplicate = false, true
+			return true, rx_error_duplicate
+		}
+		if !a.duplicate {
+			m.send(i, multicastEthernet(&allNodes),
+				neighborAdvert(&x.target, &allNodes, &x.target, naRouter|naOverride, &i.lladdr))
+			i.naTx++
+		}
+		return
+	}
+	var dst ethernet.Address
+	if x.hasLladdr {
+		n := m.learn(neighborKey{si: i.si, a: x.src}, x.lladdr, false, now)
+		dst = n.ethernet
+	} else if n, ok := m.neighbors[neighborKey{si: i.si, a: x.src}]; ok && n.installed {
+		dst = n.ethernet
+	} else {
+		return
+	}
+	if a.tentative || a.duplicate {
+		return
+	}
+	m.send(i, dst, neighborAdvert(&x.target, &x.src, &x.target, naRouter|naSolicited|naOverride, &i.lladdr))
+	i.naTx++
+	return
+}
+
+// Called with lock held.
+func (m *Main) neighborAdvert(i *iface, x *message, now cpu.Time) (consumed bool, e uint) {
+	if a, ok := i.addrs[x.target]; ok {
+		if a.tentative {
+			a.tentative, a.duplicate = false, true
+		}
+		return true, rx_error_duplicate
+	}
+	consumed, e = true, rx_error_neighbor_advert
+	k := neighborKey{si: i.si, a: x.target}
+	n, ok := m.neighbors[k]
+	// Unsolicited advertisements do not create entries.
+	if !ok {
+		return
+	}
+	isRouter := x.flags&naRouter != 0
+	switch {
+	case n.state == NeighborIncomplete:
+		if x.hasLladdr {
+			m.learn(k, x.lladdr, isRouter, now)
+		}
+	case x.hasLladdr && x.lladdr != n.ethernet:
+		// Advertisements without override only update unchanged link addresses.
+		if x.flags&naOverride != 0 {
+			m.learn(k, x.lladdr, isRouter, now)
+		}
+	case x.flags&naSolicited != 0:
+		m.learn(k, n.ethernet, isRouter, now)
+	}
+	n.isRouter = isRouter
+	return
+}
+
+// Start address resolution for destination of packet on connected prefix of interface.
+// Called with lock held.
+func (m *Main) glean(i *iface, b []byte, now cpu.Time) {
+	if len(b) < ip6.SizeofHeader || b[0]>>4 != 6 {
+		return
+	}
+	var d ip6.Address
+	copy(d[:], b[24:40])
+	k := neighborKey{si: i.si, a: d}
+	if isMulticast(&d) || isUnspecified(&d) || m.neighbors[k] != nil || !i.onLink(&d) {
+		return
+	}
+	if _, ok := i.addrs[d]; ok {
+		return
+	}
+	n := &neighbor{neighborKey: k, state: NeighborIncomplete, probes: 1}
+	n.timeout = after(now, m.RetransTimer)
+	if m.neighbors == nil {
+		m.neighbors = make(map[neighborKey]*neighbor)
+	}
+	m.neighbors[k] = n
+	m.sendSolicit(i, &d, nil)
+}
+
+// Random interval in seconds until next unsolicited advertisement.  Called with lock held.
+func (i *iface) raInterval() (dt float64) {
+	c := i.ra
+	dt = c.MinInterval + rand.Float64()*(c.MaxInterval-c.MinInterval)
+	if i.nInitialRa <= maxInitialRas && dt > maxInitialRaInterval {
+		dt = maxInitialRaInterval
+	}
+	return
+}
+
+// Run neighbor, duplicate address detection and router advertisement timers.
+func (m *Main) timer(now cpu.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range m.neighbors {
+		if now < n.timeout {
+			continue
+		}
+		i := m.ifs[n.si]
+		if i == nil || (n.state != NeighborReachable && n.probes >= m.MaxProbes) {
+			m.delNeighbor(n)
+			continue
+		}
+		switch n.state {
+		case NeighborIncomplete:
+			m.sendSolicit(i, &n.a, nil)
+		case NeighborReachable, NeighborProbe:
+			n.state = NeighborProbe
+			m.sendSolicit(i, &n.a, &n.ethernet)
+		}
+		n.probes++
+		n.timeout = after(now, m.RetransTimer)
+	}
+	for _, i := range m.ifs {
+		for a, x := range i.addrs {
+			if !x.tentative || now < x.dadNext {
+				continue
+			}
+			if x.dadProbes >= m.DadTransmits {
+				x.tentative = false
+				continue
+			}
+			var src ip6.Address
+			d := solicitedNode(&a)
+			m.send(i, multicastEthernet(&d), neighborSolicit(&src, &d, &a, &i.lladdr))
+			i.nsTx++
+			x.dadProbes++
+			x.dadNext = after(now, m.RetransTimer)
+		}
+		if i.ra != nil && now >= i.nextRa {
+			m.sendRouterAdvert(i, i.ra.Lifetime, now)
+			i.nInitialRa++
+			var dt cpu.Time
+			dt.Cycles(i.raInterval())
+			i.nextRa = now + dt
+		}
+	}
+}
+
+type changeEvent struct {
+	vnet.Event
+	m  *Main
+	cs []change
+}
+
+func (e *changeEvent) String() string { return "nd neighbor change" }
+func (e *changeEvent) EventAction()   { e.m.apply(e.cs) }
+
+// Start transmission of queued frames and signal event to apply queued neighbor changes.
+func (m *Main) notify() {
+	m.mu.Lock()
+	cs, nf := m.changes, len(m.frames)
+	m.changes = nil
+	m.mu.Unlock()
+	if nf > 0 {
+		m.txNode.Activate(true)
+	}
+	if len(cs) > 0 {
+		m.Vnet.SignalEvent(&changeEvent{m: m, cs: cs})
+	}
+}
+
+// Add and delete neighbors in ethernet neighbor table.  Called in event context.
+func (m *Main) apply(cs []change) {
+	em := ethernet.GetMain(m.Vnet)
+	for i := range cs {
+		c := &cs[i]
+		_, err := em.AddDelIpNeighbor(&m.m6.Main, &c.n, c.isDel)
+		if err != nil && err != ethernet.ErrDelUnknownNeighbor {
+			m.Vnet.Logf("nd: %s %s: %v\n", vnet.SiName{V: m.Vnet, Si: c.n.Si}, c.n.Ip, err)
+		}
+	}
+}
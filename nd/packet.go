@@ -0,0 +1,266 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nd
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip6"
+
+	"fmt"
+)
+
+// ICMP6 neighbor discovery message types (RFC 4861).
+const (
+	typeRouterSolicit   = 133
+	typeRouterAdvert    = 134
+	typeNeighborSolicit = 135
+	typeNeighborAdvert  = 136
+	typeRedirect        = 137
+)
+
+// Options.
+const (
+	optSourceLinkAddress = 1
+	optTargetLinkAddress = 2
+	optPrefixInfo        = 3
+	optMtu               = 5
+)
+
+// Neighbor advertisement flags.
+const (
+	naRouter    = 1 << 7
+	naSolicited = 1 << 6
+	naOverride  = 1 << 5
+)
+
+// Router advertisement and prefix information flags.
+const (
+	raManaged      = 1 << 7
+	raOther        = 1 << 6
+	prefixOnLink   = 1 << 7
+	prefixAutoconf = 1 << 6
+)
+
+const (
+	// Neighbor discovery messages are sent and must be received with maximum hop limit.
+	hopLimit = 255
+
+	sizeofIcmpHeader  = 4
+	sizeofLinkAddress = 8
+	sizeofPrefixInfo  = 32
+)
+
+var (
+	allNodes   = ip6.Address{0: 0xff, 1: 0x02, 15: 0x01}
+	allRouters = ip6.Address{0: 0xff, 1: 0x02, 15: 0x02}
+)
+
+// Solicited-node multicast address of given address.
+func solicitedNode(a *ip6.Address) (s ip6.Address) {
+	s = ip6.Address{0: 0xff, 1: 0x02, 11: 0x01, 12: 0xff}
+	copy(s[13:], a[13:])
+	return
+}
+
+// Ethernet address of ip6 multicast address (RFC 2464).
+func multicastEthernet(a *ip6.Address) (e ethernet.Address) {
+	e[0], e[1] = 0x33, 0x33
+	copy(e[2:], a[12:])
+	return
+}
+
+func isMulticast(a *ip6.Address) bool   { return a[0] == 0xff }
+func isLinkLocal(a *ip6.Address) bool   { return a[0] == 0xfe && a[1]&0xc0 == 0x80 }
+func isUnspecified(a *ip6.Address) bool { return a.IsZero() }
+
+// Link local address with interface identifier from ethernet address (RFC 4291 appendix A).
+func linkLocal(e *ethernet.Address) (a ip6.Address) {
+	a[0], a[1] = 0xfe, 0x80
+	a[8], a[9], a[10] = e[0]^0x02, e[1], e[2]
+	a[11], a[12] = 0xff, 0xfe
+	a[13], a[14], a[15] = e[3], e[4], e[5]
+	return
+}
+
+func put16(b []byte, x uint) {
+	b[0], b[1] = byte(x>>8), byte(x)
+}
+func put32(b []byte, x uint32) {
+	b[0], b[1], b[2], b[3] = byte(x>>24), byte(x>>16), byte(x>>8), byte(x)
+}
+func get32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+// Checksum of icmp6 message with pseudo header.
+func checksum(src, dst *ip6.Address, icmp []byte) vnet.Uint16 {
+	var tail [8]byte
+	put32(tail[0:], uint32(len(icmp)))
+	tail[7] = uint8(ip.ICMP6)
+	c := ip.Checksum(0).AddBytes(src[:])
+	c = c.AddBytes(dst[:])
+	c = c.AddBytes(tail[:])
+	return ^c.AddBytes(icmp).Fold()
+}
+
+// Ip6 packet with given icmp6 message; checksum is filled in.
+func packet(src, dst *ip6.Address, icmp []byte) []byte {
+	b := make([]byte, ip6.SizeofHeader+len(icmp))
+	h := ip6.Header{Protocol: ip.ICMP6, Ttl: hopLimit, Src: *src, Dst: *dst}
+	h.Ip_version_traffic_class_and_flow_label.Set(ip6.DefaultVersionTrafficClassAndFlowLabel)
+	h.Write(b)
+	i := b[ip6.SizeofHeader:]
+	copy(i, icmp)
+	*(*vnet.Uint16)(vnet.Pointer(i[2:])) = checksum(src, dst, i)
+	return b
+}
+
+func linkAddressOption(t byte, e *ethernet.Address) []byte {
+	o := []byte{t, 1}
+	return append(o, e[:]...)
+}
+
+// Neighbor solicitation for target.  Solicitations for duplicate address detection are sent
+// from unspecified address without link address.
+func neighborSolicit(src, dst, target *ip6.Address, e *ethernet.Address) []byte {
+	b := make([]byte, 8, 8+16+sizeofLinkAddress)
+	b[0] = typeNeighborSolicit
+	b = append(b, target[:]...)
+	if !isUnspecified(src) {
+		b = append(b, linkAddressOption(optSourceLinkAddress, e)...)
+	}
+	return packet(src, dst, b)
+}
+
+func neighborAdvert(src, dst, target *ip6.Address, flags uint8, e *ethernet.Address) []byte {
+	b := make([]byte, 8, 8+16+sizeofLinkAddress)
+	b[0] = typeNeighborAdvert
+	b[4] = flags
+	b = append(b, target[:]...)
+	b = append(b, linkAddressOption(optTargetLinkAddress, e)...)
+	return packet(src, dst, b)
+}
+
+// Router advertisement with given router lifetime and prefixes.
+func routerAdvert(src, dst *ip6.Address, c *RouterAdvertConfig, lifetime uint16, e *ethernet.Address) []byte {
+	b := make([]byte, 16, 256)
+	b[0] = typeRouterAdvert
+	b[4] = c.CurHopLimit
+	if c.Managed {
+		b[5] |= raManaged
+	}
+	if c.Other {
+		b[5] |= raOther
+	}
+	put16(b[6:], uint(lifetime))
+	put32(b[8:], c.ReachableTime)
+	put32(b[12:], c.RetransTimer)
+	b = append(b, linkAddressOption(optSourceLinkAddress, e)...)
+	if c.Mtu != 0 {
+		o := make([]byte, 8)
+		o[0], o[1] = optMtu, 1
+		put32(o[4:], c.Mtu)
+		b = append(b, o...)
+	}
+	for i := range c.Prefixes {
+		p := &c.Prefixes[i]
+		o := make([]byte, sizeofPrefixInfo)
+		o[0], o[1] = optPrefixInfo, sizeofPrefixInfo/8
+		l, _ := p.Prefix.Mask.Size()
+		o[2] = uint8(l)
+		if !p.OffLink {
+			o[3] |= prefixOnLink
+		}
+		if !p.NoAutoconf {
+			o[3] |= prefixAutoconf
+		}
+		put32(o[4:], p.ValidLifetime)
+		put32(o[8:], p.PreferredLifetime)
+		copy(o[16:], p.Prefix.IP.Mask(p.Prefix.Mask).To16())
+		b = append(b, o...)
+	}
+	return packet(src, dst, b)
+}
+
+// Parsed neighbor discovery message.
+type message struct {
+	src, dst ip6.Address
+	typ      uint8
+	// Target of neighbor solicitation and advertisement.
+	target ip6.Address
+	// Flags of neighbor advertisement.
+	flags uint8
+	// Source or target link address option.
+	lladdr    ethernet.Address
+	hasLladdr bool
+}
+
+// Parse ip6 packet.  Returns false if packet is not a neighbor discovery message; error for
+// malformed or invalid messages (RFC 4861 sections 6.1, 7.1).
+func (x *message) parse(b []byte) (ok bool, err error) {
+	if len(b) < ip6.SizeofHeader+sizeofIcmpHeader || b[0]>>4 != 6 || ip.Protocol(b[6]) != ip.ICMP6 {
+		return
+	}
+	l := int(b[4])<<8 | int(b[5])
+	if ip6.SizeofHeader+l > len(b) || l < sizeofIcmpHeader {
+		return
+	}
+	i := b[ip6.SizeofHeader : ip6.SizeofHeader+l]
+	if i[0] < typeRouterSolicit || i[0] > typeRedirect {
+		return
+	}
+	ok = true
+	*x = message{typ: i[0]}
+	copy(x.src[:], b[8:24])
+	copy(x.dst[:], b[24:40])
+	if b[7] != hopLimit {
+		return ok, fmt.Errorf("hop limit %d", b[7])
+	}
+	if i[1] != 0 {
+		return ok, fmt.Errorf("code %d", i[1])
+	}
+	if c := checksum(&x.src, &x.dst, i); c != 0 && c != 0xffff {
+		return ok, fmt.Errorf("checksum")
+	}
+	var fixed int
+	switch x.typ {
+	case typeRouterSolicit:
+		fixed = 8
+	case typeRouterAdvert:
+		fixed = 16
+	case typeNeighborSolicit, typeNeighborAdvert:
+		fixed = 24
+	case typeRedirect:
+		fixed = 40
+	}
+	if len(i) < fixed {
+		return ok, fmt.Errorf("short message type %d", x.typ)
+	}
+	if x.typ == typeNeighborSolicit || x.typ == typeNeighborAdvert {
+		copy(x.target[:], i[8:24])
+		if isMulticast(&x.target) {
+			return ok, fmt.Errorf("multicast target %s", &x.target)
+		}
+		x.flags = i[4]
+	}
+	for o := i[fixed:]; len(o) > 0; {
+		if len(o) < 2 || o[1] == 0 || int(o[1])*8 > len(o) {
+			return ok, fmt.Errorf("bad option length")
+		}
+		ol := int(o[1]) * 8
+		if (o[0] == optSourceLinkAddress || o[0] == optTargetLinkAddress) && ol >= sizeofLinkAddress {
+			copy(x.lladdr[:], o[2:8])
+			x.hasLladdr = true
+		}
+		o = o[ol:]
+	}
+	// Solicitations from unspecified address are for duplicate address detection.
+	if isUnspecified(&x.src) && x.hasLladdr {
+		return ok, fmt.Errorf("link address from unspecified source")
+	}
+	return
+}
@@ -260,6 +260,7 @@ const (
 	InterfaceKindTun
 	InterfaceKindVeth
 	InterfaceKindVlan
+	InterfaceKindVrf
 )
 
 var kindStrings = [...]string{
@@ -276,6 +277,7 @@ var kindStrings = [...]string{
 	InterfaceKindUnknown:   "",
 	InterfaceKindVeth:      "veth",
 	InterfaceKindVlan:      "vlan",
+	InterfaceKindVrf:       "vrf",
 }
 
 func (k InterfaceKind) String() string { return kindStrings[k] }
@@ -293,6 +295,7 @@ var kindMap = map[string]InterfaceKind{
 	"tun":       InterfaceKindTun,
 	"veth":      InterfaceKindVeth,
 	"vlan":      InterfaceKindVlan,
+	"vrf":       InterfaceKindVrf,
 }
 
 func (m *IfInfoMessage) InterfaceKind() (k InterfaceKind) {
@@ -321,7 +324,10 @@ func parse_link_info(b []byte) *AttrArray {
 				l = l - 1
 			}
 			as.X[kind] = StringAttrBytes(v[:l])
-			linkKind = kindMap[string(v[:l])]
+			// Slave kind (e.g. vrf for interface enslaved to vrf) does not describe link data.
+			if kind == IFLA_INFO_KIND {
+				linkKind = kindMap[string(v[:l])]
+			}
 		case IFLA_INFO_DATA, IFLA_INFO_SLAVE_DATA:
 			as.X[kind] = StringAttrBytes(v)
 		default:
@@ -335,6 +341,10 @@ func parse_link_info(b []byte) *AttrArray {
 		as.X[IFLA_INFO_DATA] = parse_iptun_info([]byte(as.X[IFLA_INFO_DATA].(StringAttr)), linkKind)
 	case InterfaceKindIp4GRE, InterfaceKindIp4GRETap, InterfaceKindIp6GRE, InterfaceKindIp6GRETap:
 		as.X[IFLA_INFO_DATA] = parse_gre_info([]byte(as.X[IFLA_INFO_DATA].(StringAttr)), linkKind)
+	case InterfaceKindVrf:
+		if d, ok := as.X[IFLA_INFO_DATA].(StringAttr); ok {
+			as.X[IFLA_INFO_DATA] = parse_vrf_info([]byte(d))
+		}
 	}
 	return as
 }
@@ -671,6 +681,65 @@ func parse_gre_info(b []byte, linkKind InterfaceKind) (as *AttrArray) {
 	return as
 }
 
+const (
+	IFLA_VRF_UNSPEC IfVrfLinkInfoDataAttrKind = iota
+	IFLA_VRF_TABLE
+	IFLA_VRF_MAX
+)
+
+var ifVrfLinkInfoDataAttrKindNames = []string{
+	IFLA_VRF_UNSPEC: "VRF_UNSPEC",
+	IFLA_VRF_TABLE:  "VRF_TABLE",
+}
+
+func (t IfVrfLinkInfoDataAttrKind) String() string {
+	return elib.Stringer(ifVrfLinkInfoDataAttrKindNames, int(t))
+}
+
+type IfVrfLinkInfoDataAttrKind int
+type IfVrfLinkInfoDataAttrType Empty
+
+func NewIfVrfLinkInfoDataAttrType() *IfVrfLinkInfoDataAttrType {
+	return (*IfVrfLinkInfoDataAttrType)(pool.Empty.Get().(*Empty))
+}
+
+func (t *IfVrfLinkInfoDataAttrType) attrType() {}
+func (t *IfVrfLinkInfoDataAttrType) Close() error {
+	repool(t)
+	return nil
+}
+func (t *IfVrfLinkInfoDataAttrType) IthString(i int) string {
+	return elib.Stringer(ifVrfLinkInfoDataAttrKindNames, i)
+}
+
+func parse_vrf_info(b []byte) (as *AttrArray) {
+	as = pool.AttrArray.Get().(*AttrArray)
+	as.Type = NewIfVrfLinkInfoDataAttrType()
+	as.X.Validate(uint(IFLA_VRF_MAX - 1))
+	for i := 0; i < len(b); {
+		a, v, next := nextAttr(b, i)
+		i = next
+		kind := IfVrfLinkInfoDataAttrKind(a.Kind())
+		switch kind {
+		case IFLA_VRF_TABLE:
+			as.X[kind] = Uint32AttrBytes(v)
+		default:
+			panic("unknown vrf link data attribute kind " + kind.String())
+		}
+	}
+	return as
+}
+
+// VrfTable returns route table of vrf link.
+func (msg *IfInfoMessage) VrfTable() (table uint32, ok bool) {
+	if as := msg.GetLinkInfoData(); as != nil && msg.InterfaceKind() == InterfaceKindVrf {
+		if a, isTable := as.X[IFLA_VRF_TABLE].(Uint32Attr); isTable {
+			table, ok = a.Uint(), true
+		}
+	}
+	return
+}
+
 //go:generate gentemplate -d Package=netlink -id Attr -d VecType=AttrVec -d Type=Attr github.com/platinasystems/elib/vec.tmpl
 
 func (a AttrVec) Size() (l int) {
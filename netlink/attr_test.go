@@ -0,0 +1,74 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netlink
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// Append attribute with given kind and value padded to attribute alignment.
+func appendAttr(b []byte, kind uint16, v []byte) []byte {
+	var h [SizeofNlAttr]byte
+	a := (*NlAttr)(unsafe.Pointer(&h[0]))
+	a.Len = uint16(SizeofNlAttr + len(v))
+	a.kind = kind
+	b = append(b, h[:]...)
+	b = append(b, v...)
+	for len(b)%NLMSG_ALIGNTO != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func uint32Bytes(x uint32) []byte {
+	b := make([]byte, 4)
+	Uint32Attr(x).Set(b)
+	return b
+}
+
+func newLinkMessage(t *testing.T, kind string, data []byte) *IfInfoMessage {
+	b := make([]byte, SizeofHeader+SizeofIfInfomsg)
+	b = appendAttr(b, uint16(IFLA_IFNAME), []byte("red\x00"))
+	var li []byte
+	li = appendAttr(li, uint16(IFLA_INFO_KIND), []byte(kind+"\x00"))
+	if data != nil {
+		li = appendAttr(li, uint16(IFLA_INFO_DATA)|NLA_F_NESTED, data)
+	}
+	b = appendAttr(b, uint16(IFLA_LINKINFO)|NLA_F_NESTED, li)
+	m := NewIfInfoMessage()
+	if _, err := m.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestVrfTable(t *testing.T) {
+	m := newLinkMessage(t, "vrf", appendAttr(nil, uint16(IFLA_VRF_TABLE), uint32Bytes(1001)))
+	if k := m.InterfaceKind(); k != InterfaceKindVrf {
+		t.Errorf("kind %v, want vrf", k)
+	}
+	if name := m.Attrs[IFLA_IFNAME].String(); name != "red" {
+		t.Errorf("name %q, want red", name)
+	}
+	if table, ok := m.VrfTable(); !ok || table != 1001 {
+		t.Errorf("got table %d ok %v, want 1001 true", table, ok)
+	}
+
+	// Vrf link without data has no table.
+	m = newLinkMessage(t, "vrf", nil)
+	if table, ok := m.VrfTable(); ok {
+		t.Errorf("vrf without data has table %d", table)
+	}
+
+	// Only vrf links have tables.
+	m = newLinkMessage(t, "dummy", nil)
+	if k := m.InterfaceKind(); k != InterfaceKindDummy {
+		t.Errorf("kind %v, want dummy", k)
+	}
+	if table, ok := m.VrfTable(); ok {
+		t.Errorf("dummy link has table %d", table)
+	}
+}
@@ -602,6 +602,12 @@ const (
 	AF_VSOCK
 )
 
+// Families for multicast route messages.
+const (
+	RTNL_FAMILY_IPMR  AddressFamily = 128
+	RTNL_FAMILY_IP6MR AddressFamily = 129
+)
+
 var afNames = []string{
 	AF_UNSPEC:     "UNSPEC",
 	AF_UNIX:       "UNIX",
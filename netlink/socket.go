@@ -52,6 +52,7 @@ var (
 		{RTM_GETNEIGH, AF_INET6},
 		{RTM_GETROUTE, AF_INET},
 		{RTM_GETROUTE, AF_INET6},
+		{RTM_GETROUTE, RTNL_FAMILY_IPMR},
 	}
 	LinkListenReqs = []ListenReq{
 		{RTM_GETLINK, AF_PACKET},
@@ -63,6 +64,7 @@ var (
 	RouteListenReqs = []ListenReq{
 		{RTM_GETROUTE, AF_INET},
 		{RTM_GETROUTE, AF_INET6},
+		{RTM_GETROUTE, RTNL_FAMILY_IPMR},
 	}
 	NeighborListenReqs = []ListenReq{
 		{RTM_GETNEIGH, AF_INET},
@@ -19,6 +19,9 @@ type Node struct {
 	Dep       dep.Dep
 	Errors    []string
 	errorRefs []ErrorRef
+	runtime   nodeRuntime
+	// Next node names indexed by next index.
+	nextNames []string
 }
 
 func (n *Node) GetVnetNode() *Node { return n }
@@ -38,6 +41,7 @@ type Noder interface {
 
 func (v *Vnet) AddNamedNext(n Noder, name string) uint {
 	if nextIndex, err := v.loop.AddNamedNext(n, name); err == nil {
+		n.GetVnetNode().setNextName(nextIndex, name)
 		return nextIndex
 	} else {
 		panic(err)
@@ -49,9 +53,14 @@ type InputNode struct {
 	o InputNoder
 }
 
-func (n *InputNode) GetInputNode() *InputNode                 { return n }
-func (n *InputNode) MakeLoopOut() loop.LooperOut              { return &RefOut{} }
-func (n *InputNode) LoopInput(l *loop.Loop, o loop.LooperOut) { n.o.NodeInput(o.(*RefOut)) }
+func (n *InputNode) GetInputNode() *InputNode    { return n }
+func (n *InputNode) MakeLoopOut() loop.LooperOut { return &RefOut{} }
+func (n *InputNode) LoopInput(l *loop.Loop, o loop.LooperOut) {
+	t0 := n.runtimeStart()
+	out := o.(*RefOut)
+	n.o.NodeInput(out)
+	n.runtimeUpdate(n.ThreadId(), out.outLen(n.Vnet), t0)
+}
 
 type InputNoder interface {
 	Noder
@@ -70,9 +79,15 @@ type OutputNode struct {
 	o OutputNoder
 }
 
-func (n *OutputNode) GetOutputNode() *OutputNode               { return n }
-func (n *OutputNode) MakeLoopIn() loop.LooperIn                { return &RefIn{} }
-func (n *OutputNode) LoopOutput(l *loop.Loop, i loop.LooperIn) { n.o.NodeOutput(i.(*RefIn)) }
+func (n *OutputNode) GetOutputNode() *OutputNode { return n }
+func (n *OutputNode) MakeLoopIn() loop.LooperIn  { return &RefIn{} }
+func (n *OutputNode) LoopOutput(l *loop.Loop, i loop.LooperIn) {
+	t0 := n.runtimeStart()
+	in := i.(*RefIn)
+	nVec := in.InLen()
+	n.o.NodeOutput(in)
+	n.runtimeUpdate(in.ThreadId(), nVec, t0)
+}
 
 type OutputNoder interface {
 	Noder
@@ -251,12 +266,15 @@ func (n *InOutNode) LoopInputOutput(l *loop.Loop, i loop.LooperIn, o loop.Looper
 		}
 	}()
 	//
+	t0 := n.runtimeStart()
 	in, out := i.(*RefIn), o.(*RefOut)
+	nVec := in.InLen()
 	q := n.GetEnqueue(in)
 	q.n, q.i, q.o, q.v = 0, in, out, n.Vnet
 	n.t.NodeInput(in, out)
 	q.sync()
 	q.validate()
+	n.runtimeUpdate(in.ThreadId(), nVec, t0)
 }
 
 type InOutNoder interface {
@@ -279,6 +297,10 @@ type Vnet struct {
 	eventMain
 	interfaceMain
 	packageMain
+	runtimeMain
+	mirrorSflowConfigMain
+	egressMain
+	featureMain
 	BridgeAddDelHook       BridgeAddDelHook_t
 	BridgeMemberAddDelHook BridgeMemberAddDelHook_t
 	BridgeMemberLookup     BridgeMemberLookup_t
@@ -290,6 +312,10 @@ func (v *Vnet) RegisterNode(n Noder, format string, args ...interface{}) {
 	v.loop.RegisterNode(n, format, args...)
 	x := n.GetVnetNode()
 	x.Vnet = v
+	v.addRuntimeNode(x)
+	for i := range x.Next {
+		x.addNextName(x.Next[i])
+	}
 
 	x.errorRefs = make([]ErrorRef, len(x.Errors))
 	for i := range x.Errors {
@@ -151,6 +151,7 @@ func (v *Vnet) Configure(in *parse.Input) (err error) {
 				return
 			}
 			v.loop.Config.LogWriter = f
+		case in.Parse("msconfig %s", &v.msConfigFile):
 		case in.Parse("quit %f", &v.loop.Config.QuitAfterDuration):
 		case in.Parse("quit"):
 			v.loop.Config.QuitAfterDuration = 1e-6 // must be positive to enable
@@ -12,6 +12,7 @@ import (
 	"github.com/platinasystems/vnet"
 
 	"fmt"
+	"io"
 	"sort"
 )
 
@@ -34,6 +35,8 @@ const (
 	set_stream
 	set_interface
 	set_verbose
+	set_burst
+	set_schedule
 )
 
 func (m *main) edit_streams(cmder cli.Commander, w cli.Writer, in *cli.Input) (err error) {
@@ -53,6 +56,7 @@ func (m *main) edit_streams(cmder cli.Commander, w cli.Writer, in *cli.Input) (e
 	for !in.End() {
 		var (
 			x       float64
+			d       duration
 			sub_in  parse.Input
 			comment parse.Comment
 			index   uint
@@ -84,6 +88,27 @@ func (m *main) edit_streams(cmder cli.Commander, w cli.Writer, in *cli.Input) (e
 		case in.Parse("random"):
 			c.random_size = true
 			set_what |= set_size
+		case in.Parse("bursts %d", &c.n_bursts_limit):
+			set_what |= set_burst
+		case in.Parse("burst %d", &c.burst_size):
+			set_what |= set_burst
+			if set_what&set_limit == 0 {
+				c.n_packets_limit = 0
+			}
+		case in.Parse("gap %v", &d):
+			c.burst_gap = float64(d)
+			set_what |= set_burst
+		case in.Parse("start %v", &d):
+			c.start_time = float64(d)
+			set_what |= set_schedule
+		case in.Parse("stop %v", &d):
+			c.stop_time = float64(d)
+			set_what |= set_schedule
+			if set_what&set_limit == 0 {
+				c.n_packets_limit = 0
+			}
+		case in.Parse("after %s", &c.start_after):
+			set_what |= set_schedule
 		case in.Parse("ve%*rbose"):
 			c.verbose = true
 			set_what |= set_verbose
@@ -112,6 +137,18 @@ func (m *main) edit_streams(cmder cli.Commander, w cli.Writer, in *cli.Input) (e
 		}
 	}
 
+	// Stream to start after must already exist on some node.
+	if after := c.start_after; after != "" {
+		if after == stream_name {
+			err = fmt.Errorf("stream %s cannot start after itself", after)
+			return
+		}
+		if m.get_stream_by_name(after) == nil {
+			err = fmt.Errorf("after: unknown stream %s", after)
+			return
+		}
+	}
+
 	// If node was specified only apply changes to that node.
 	// Otherwise apply changes to all nodes.
 	for i := range m.nodes {
@@ -131,7 +168,7 @@ func (m *main) edit_streams(cmder cli.Commander, w cli.Writer, in *cli.Input) (e
 func (n *node) configure_streams(m *main, c *stream_config, w cli.Writer, stream_name string, set_what uint, r Streamer) {
 	create := r != nil
 	if create {
-		n.new_stream(r, stream_name)
+		n.new_stream(r, "%s", stream_name)
 	}
 
 	if r != nil {
@@ -180,10 +217,21 @@ func (n *node) configure_stream(r Streamer, m *main, c *stream_config, w cli.Wri
 		if set_what&set_verbose != 0 {
 			s.stream_config.verbose = c.verbose
 		}
+		if set_what&set_burst != 0 {
+			s.burst_size = c.burst_size
+			s.burst_gap = c.burst_gap
+			s.n_bursts_limit = c.n_bursts_limit
+		}
+		if set_what&set_schedule != 0 {
+			s.start_time = c.start_time
+			s.stop_time = c.stop_time
+			s.start_after = c.start_after
+		}
 	}
 
 	s.last_time = cpu.TimeNow()
 	s.credit_packets = 0
+	s.reset_schedule(s.last_time)
 	s.w = w
 	ave_packet_bits := 8 * .5 * float64(s.min_size+s.max_size)
 	if create || set_what&set_rate != 0 {
@@ -212,29 +260,76 @@ func (l limit) String() string {
 	}
 }
 
-func (m *main) show_streams(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
-	type cli_stream struct {
-		Node  uint   `format:"%d" align:"center"`
-		Name  string `format:"%-30s" align:"left"`
-		Limit string `format:"%16s" align:"right"`
-		Sent  uint64 `format:"%16d" align:"right"`
-	}
-	cs := []cli_stream{}
-
-	sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
+// Stream summary as returned by Streams.
+type StreamInfo struct {
+	Node uint   `json:"node"`
+	Name string `json:"name"`
+	// Packet limit; zero means no limit.
+	Limit uint64 `json:"limit"`
+	Sent  uint64 `json:"sent"`
+	State string `json:"state"`
+}
 
+// Streams returns summary of all streams on all packet generator nodes.
+func Streams(v *vnet.Vnet) (ss []StreamInfo) {
+	m := GetMain(v)
 	for i := range m.nodes {
 		n := &m.nodes[i]
 		n.stream_pool.Foreach(func(r Streamer) {
 			s := r.get_stream()
-			cs = append(cs, cli_stream{
+			ss = append(ss, StreamInfo{
 				Node:  n.index,
 				Name:  s.name,
-				Limit: limit(s.n_packets_limit).String(),
+				Limit: s.n_packets_limit,
 				Sent:  s.n_packets_sent,
+				State: s.state(),
 			})
 		})
 	}
+	return
+}
+
+// EditStreams creates or edits streams given arguments as for packet-generator command.
+// Must be called from vnet event context.
+func EditStreams(v *vnet.Vnet, w io.Writer, args string) (err error) {
+	in := &cli.Input{}
+	in.SetString(args)
+	return GetMain(v).edit_streams(nil, w, in)
+}
+
+// DelStream deletes named stream from all packet generator nodes.
+// Returns false if no stream with given name exists.
+func DelStream(v *vnet.Vnet, name string) (ok bool) {
+	m := GetMain(v)
+	for i := range m.nodes {
+		n := &m.nodes[i]
+		if _, found := n.stream_index_by_name[name]; found {
+			n.del_stream(n.get_stream_by_name(name))
+			ok = true
+		}
+	}
+	return
+}
+
+func (m *main) show_streams(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	type cli_stream struct {
+		Node  uint   `format:"%d" align:"center"`
+		Name  string `format:"%-30s" align:"left"`
+		Limit string `format:"%16s" align:"right"`
+		Sent  uint64 `format:"%16d" align:"right"`
+		State string `format:"%-16s" align:"left"`
+	}
+	cs := []cli_stream{}
+	for _, s := range Streams(m.Vnet) {
+		cs = append(cs, cli_stream{
+			Node:  s.Node,
+			Name:  s.Name,
+			Limit: limit(s.Limit).String(),
+			Sent:  s.Sent,
+			State: s.State,
+		})
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Name < cs[j].Name })
 	elib.Tabulate(cs).Write(w)
 	return
 }
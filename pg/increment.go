@@ -0,0 +1,53 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pg
+
+import (
+	"github.com/platinasystems/elib/parse"
+
+	"math/rand"
+)
+
+// Increment generates packet field values in range [Min, Max] either
+// sequentially or at random.  Stream types use it to vary header fields.
+type Increment struct {
+	Min, Max uint64
+	IsRandom bool
+	cur      uint64
+}
+
+func (i *Increment) Set(min, max uint64, isRandom bool) {
+	if max < min {
+		max = min
+	}
+	i.Min, i.Max, i.IsRandom = min, max, isRandom
+	i.cur = min
+}
+
+func (i *Increment) Valid() bool { return i.Max != i.Min }
+
+// Next returns next value in range.
+func (i *Increment) Next() (v uint64) {
+	if i.IsRandom {
+		v = i.Min + uint64(rand.Int63n(int64(1+i.Max-i.Min)))
+		return
+	}
+	v = i.cur
+	i.cur++
+	if i.cur > i.Max || i.cur < i.Min {
+		i.cur = i.Min
+	}
+	return
+}
+
+// Parse parses MIN-MAX or random MIN-MAX.
+func (i *Increment) Parse(in *parse.Input) {
+	var min, max uint64
+	isRandom := in.Parse("rand%*om")
+	if !in.Parse("%d-%d", &min, &max) {
+		in.ParseError()
+	}
+	i.Set(min, max, isRandom)
+}
@@ -30,6 +30,7 @@ type node struct {
 	vnet.InterfaceNode
 	vnet.HwIf
 	v      *vnet.Vnet
+	m      *main
 	enable bool
 	index  uint
 	pool   vnet.BufferPool
@@ -373,7 +374,23 @@ func (n *node) generate(s *Stream, dst []vnet.Ref, n_packets uint) (n_bytes uint
 	return
 }
 
-func (n *node) n_packets_this_input(s *Stream, cap uint) (p uint, dt_next float64) {
+func (n *node) n_packets_this_input(s *Stream, cap uint, now cpu.Time) (p uint, dt_next float64) {
+	var wait bool
+	if wait, dt_next = n.m.schedule_wait(s, n.Vnet, now); !wait {
+		p, dt_next = n.n_packets_credit(s, cap, now)
+	}
+	if elog.Enabled() {
+		elog.Add(&stream_elog{
+			node_name:   n.ElogName(),
+			stream_name: s.elog_name,
+			n_packets:   uint32(p),
+			dt_next:     dt_next,
+		})
+	}
+	return
+}
+
+func (n *node) n_packets_credit(s *Stream, cap uint, now cpu.Time) (p uint, dt_next float64) {
 	if s.n_packets_limit == 0 { // unlimited
 		p = cap
 	} else if s.n_packets_sent < s.n_packets_limit {
@@ -384,13 +401,13 @@ func (n *node) n_packets_this_input(s *Stream, cap uint) (p uint, dt_next float6
 			p = uint(max)
 		}
 	}
+	p = s.burst_limit(p)
 	if s.rate_packets_per_sec != 0 {
 		// Send a single packet at initial time.
-		if s.n_packets_sent == 0 {
+		if s.n_packets_sent == 0 && p > 0 {
 			p = 1
 		}
 
-		now := cpu.TimeNow()
 		dt := n.Vnet.TimeDiff(now, s.last_time)
 		s.credit_packets += dt * s.rate_packets_per_sec
 		if float64(p) > s.credit_packets {
@@ -402,14 +419,6 @@ func (n *node) n_packets_this_input(s *Stream, cap uint) (p uint, dt_next float6
 			dt_next = (1 - s.credit_packets) / s.rate_packets_per_sec
 		}
 	}
-	if elog.Enabled() {
-		elog.Add(&stream_elog{
-			node_name:   n.ElogName(),
-			stream_name: s.elog_name,
-			n_packets:   uint32(p),
-			dt_next:     dt_next,
-		})
-	}
 	return
 }
 
@@ -434,14 +443,16 @@ func (n *node) stream_input(o *vnet.RefOut, s *Stream) (done bool, dt float64) {
 	t := n.GetIfThread()
 
 	var n_packets uint
-	n_packets, dt = n.n_packets_this_input(s, out.Cap())
+	now := cpu.TimeNow()
+	n_packets, dt = n.n_packets_this_input(s, out.Cap(), now)
 	if n_packets > 0 {
 		n_bytes := n.generate(s, out.Refs[:], n_packets)
 		vnet.IfRxCounter.Add(t, n.Si(), n_packets, n_bytes)
 		out.SetPoolAndLen(n.Vnet, &n.pool, n_packets)
 		s.n_packets_sent += uint64(n_packets)
+		s.burst_sent(now, n_packets, n.Vnet)
 	}
-	done = s.n_packets_limit != 0 && s.n_packets_sent >= s.n_packets_limit
+	done = s.check_done(now, n.Vnet)
 	return
 }
 
@@ -41,6 +41,7 @@ func (m *main) Init() (err error) {
 		m.nodes = make([]node, 1)
 	}
 	for i := range m.nodes {
+		m.nodes[i].m = m
 		m.nodes[i].init(m.Vnet, uint(i))
 	}
 	m.cli_init()
@@ -0,0 +1,174 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pg
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+
+	"strconv"
+	"time"
+)
+
+// Burst and start/stop configuration for a stream.
+type stream_schedule_config struct {
+	// Packets per burst or 0 to send continuously.
+	burst_size uint64
+	// Seconds between end of one burst and start of next.
+	burst_gap float64
+	// Number of bursts to send or 0 for no limit.
+	n_bursts_limit uint64
+
+	// Start and stop times in seconds relative to when stream is enabled
+	// (or when start_after stream finishes).  Zero stop time means never stop.
+	start_time float64
+	stop_time  float64
+
+	// Name of stream which must finish before this stream starts.
+	start_after string
+}
+
+// Converts cpu time difference to seconds; implemented by vnet.Vnet.
+type timer interface {
+	TimeDiff(t0, t1 cpu.Time) float64
+}
+
+type stream_schedule struct {
+	// Time base for start, stop and burst times.
+	base_time cpu.Time
+
+	// Set when stream has started sending.
+	is_started bool
+
+	// Set while a burst is in progress.
+	in_burst bool
+
+	// Set when start_after stream has finished (or there is none).
+	after_done bool
+
+	// Seconds relative to base time when next burst may start.
+	next_burst_time float64
+
+	n_packets_this_burst uint64
+	n_bursts_sent        uint64
+
+	is_done   bool
+	done_time cpu.Time
+}
+
+func (s *Stream) reset_schedule(now cpu.Time) {
+	s.stream_schedule = stream_schedule{
+		base_time:       now,
+		after_done:      len(s.start_after) == 0,
+		next_burst_time: s.start_time,
+	}
+}
+
+// Returns true when stream may not send packets at given time.
+// When known, dt is number of seconds to wait.
+// Stream given by start_after may be on any packet generator node.
+func (m *main) schedule_wait(s *Stream, t timer, now cpu.Time) (wait bool, dt float64) {
+	if s.is_done {
+		wait = true
+		return
+	}
+	if !s.after_done {
+		r := m.get_stream_by_name(s.start_after)
+		if r == nil || !r.get_stream().is_done {
+			wait = true
+			return
+		}
+		// Times are now relative to when previous stream finished.
+		s.after_done = true
+		s.base_time = r.get_stream().done_time
+	}
+	elapsed := t.TimeDiff(now, s.base_time)
+	if elapsed < s.next_burst_time {
+		wait, dt = true, s.next_burst_time-elapsed
+		return
+	}
+	// Start of stream or new burst: do not accumulate rate credit while waiting.
+	if !s.is_started || (s.burst_size != 0 && !s.in_burst) {
+		s.is_started = true
+		s.in_burst = s.burst_size != 0
+		s.last_time = now
+		s.credit_packets = 0
+	}
+	return
+}
+
+// Limit number of packets to remainder of current burst.
+func (s *Stream) burst_limit(p uint) uint {
+	if s.burst_size != 0 {
+		if left := s.burst_size - s.n_packets_this_burst; uint64(p) > left {
+			p = uint(left)
+		}
+	}
+	return p
+}
+
+func (s *Stream) burst_sent(now cpu.Time, n_packets uint, t timer) {
+	if s.burst_size == 0 {
+		return
+	}
+	s.n_packets_this_burst += uint64(n_packets)
+	if s.n_packets_this_burst >= s.burst_size {
+		s.n_packets_this_burst = 0
+		s.in_burst = false
+		s.n_bursts_sent++
+		s.next_burst_time = t.TimeDiff(now, s.base_time) + s.burst_gap
+	}
+}
+
+// Check whether stream is finished: packet limit, burst limit or stop time reached.
+func (s *Stream) check_done(now cpu.Time, t timer) bool {
+	if s.is_done {
+		return true
+	}
+	done := s.n_packets_limit != 0 && s.n_packets_sent >= s.n_packets_limit
+	done = done || (s.n_bursts_limit != 0 && s.n_bursts_sent >= s.n_bursts_limit)
+	if s.stop_time != 0 && s.after_done {
+		done = done || t.TimeDiff(now, s.base_time) >= s.stop_time
+	}
+	if done {
+		s.is_done = true
+		s.done_time = now
+	}
+	return done
+}
+
+func (s *Stream) state() string {
+	switch {
+	case s.is_done:
+		return "done"
+	case !s.after_done:
+		return "after " + s.start_after
+	case !s.is_started:
+		return "waiting"
+	case s.burst_size != 0 && !s.in_burst:
+		return "gap"
+	default:
+		return "running"
+	}
+}
+
+// Time in seconds given either as duration (e.g. 10ms) or as floating point seconds.
+type duration float64
+
+func (d *duration) Parse(in *parse.Input) {
+	var s string
+	if !in.Parse("%s", &s) {
+		in.ParseError()
+	}
+	if x, err := time.ParseDuration(s); err == nil && x >= 0 {
+		*d = duration(x.Seconds())
+		return
+	}
+	if x, err := strconv.ParseFloat(s, 64); err == nil && x >= 0 {
+		*d = duration(x)
+		return
+	}
+	in.ParseError()
+}
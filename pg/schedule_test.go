@@ -0,0 +1,121 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pg
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"testing"
+)
+
+// One cpu cycle per second makes schedule times easy to follow.
+type testTimer struct{}
+
+func (testTimer) TimeDiff(t0, t1 cpu.Time) float64 { return float64(t0) - float64(t1) }
+
+func newTestMain(nNodes int) *main {
+	m := &main{nodes: make([]node, nNodes)}
+	for i := range m.nodes {
+		m.nodes[i].m = m
+		m.nodes[i].index = uint(i)
+	}
+	return m
+}
+
+func (m *main) newTestStream(ni uint, name string, c stream_schedule_config, now cpu.Time) *Stream {
+	s := &Stream{}
+	m.nodes[ni].new_stream(s, "%s", name)
+	s.stream_schedule_config = c
+	s.reset_schedule(now)
+	return s
+}
+
+func TestScheduleStartStop(t *testing.T) {
+	m := newTestMain(1)
+	var tm testTimer
+	s := m.newTestStream(0, "a", stream_schedule_config{start_time: 10, stop_time: 20}, 100)
+	if wait, dt := m.schedule_wait(s, tm, 105); !wait || dt != 5 {
+		t.Errorf("before start: got wait %v dt %v, want wait true dt 5", wait, dt)
+	}
+	if wait, _ := m.schedule_wait(s, tm, 110); wait {
+		t.Error("at start time: stream still waiting")
+	}
+	if got := s.state(); got != "running" {
+		t.Errorf("state %q, want running", got)
+	}
+	if s.check_done(119, tm) {
+		t.Error("done before stop time")
+	}
+	if !s.check_done(120, tm) {
+		t.Error("not done at stop time")
+	}
+	if wait, _ := m.schedule_wait(s, tm, 121); !wait {
+		t.Error("done stream does not wait")
+	}
+}
+
+func TestScheduleBurst(t *testing.T) {
+	m := newTestMain(1)
+	var tm testTimer
+	s := m.newTestStream(0, "a", stream_schedule_config{burst_size: 4, burst_gap: 2, n_bursts_limit: 2}, 0)
+	if wait, _ := m.schedule_wait(s, tm, 0); wait {
+		t.Fatal("stream waits at start of first burst")
+	}
+	if p := s.burst_limit(10); p != 4 {
+		t.Errorf("burst limit %d, want 4", p)
+	}
+	s.burst_sent(1, 3, tm)
+	if p := s.burst_limit(10); p != 1 {
+		t.Errorf("burst limit %d, want 1", p)
+	}
+	s.burst_sent(1, 1, tm)
+	if got := s.state(); got != "gap" {
+		t.Errorf("state %q, want gap", got)
+	}
+	if wait, dt := m.schedule_wait(s, tm, 2); !wait || dt != 1 {
+		t.Errorf("in gap: got wait %v dt %v, want wait true dt 1", wait, dt)
+	}
+	if wait, _ := m.schedule_wait(s, tm, 3); wait {
+		t.Error("second burst does not start after gap")
+	}
+	s.burst_sent(3, 4, tm)
+	if !s.check_done(3, tm) {
+		t.Error("not done after burst limit")
+	}
+}
+
+// Stream started after stream on another node.
+func TestScheduleAfterOtherNode(t *testing.T) {
+	m := newTestMain(2)
+	var tm testTimer
+	a := m.newTestStream(0, "a", stream_schedule_config{stop_time: 5}, 0)
+	b := m.newTestStream(1, "b", stream_schedule_config{start_time: 1, start_after: "a"}, 0)
+	if wait, _ := m.schedule_wait(b, tm, 3); !wait {
+		t.Fatal("stream does not wait for stream on other node")
+	}
+	if got := b.state(); got != "after a" {
+		t.Errorf("state %q, want after a", got)
+	}
+	a.check_done(5, tm)
+	// Start time is relative to when a finished.
+	if wait, dt := m.schedule_wait(b, tm, 5); !wait || dt != 1 {
+		t.Errorf("got wait %v dt %v, want wait true dt 1", wait, dt)
+	}
+	if wait, _ := m.schedule_wait(b, tm, 6); wait {
+		t.Error("stream does not start after other stream finished")
+	}
+}
+
+func TestScheduleAfterUnknown(t *testing.T) {
+	m := newTestMain(2)
+	var tm testTimer
+	s := m.newTestStream(0, "a", stream_schedule_config{start_after: "x"}, 0)
+	if wait, _ := m.schedule_wait(s, tm, 100); !wait {
+		t.Error("stream started after unknown stream")
+	}
+	if r := m.get_stream_by_name("x"); r != nil {
+		t.Error("found unknown stream")
+	}
+}
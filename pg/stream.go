@@ -41,6 +41,8 @@ type stream_config struct {
 	rate_bits_per_sec    float64
 	rate_packets_per_sec float64
 
+	stream_schedule_config
+
 	si vnet.Si
 
 	node_index uint
@@ -69,6 +71,8 @@ type Stream struct {
 
 	n_packets_sent uint64
 
+	stream_schedule
+
 	data         []byte
 	buffer_types elib.Uint32Vec
 
@@ -142,6 +146,16 @@ func (n *node) get_stream_by_name(name string) (r Streamer) {
 	return
 }
 
+// Finds stream with given name on any packet generator node.
+func (m *main) get_stream_by_name(name string) (r Streamer) {
+	for i := range m.nodes {
+		if r = m.nodes[i].get_stream_by_name(name); r != nil {
+			return
+		}
+	}
+	return
+}
+
 func (n *node) new_stream(r Streamer, format string, args ...interface{}) {
 	name := fmt.Sprintf(format, args...)
 	si, ok := n.stream_index_by_name[name]
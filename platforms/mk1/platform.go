@@ -7,15 +7,29 @@ package mk1
 import (
 	"github.com/platinasystems/i2c"
 	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+	"github.com/platinasystems/vnet/bfd"
+	"github.com/platinasystems/vnet/config"
 	"github.com/platinasystems/vnet/devices/bus/pci"
 	fe1 "github.com/platinasystems/vnet/devices/ethernet/switch/fe1"
+	"github.com/platinasystems/vnet/dhcp"
 	"github.com/platinasystems/vnet/ethernet"
 	"github.com/platinasystems/vnet/gre"
+	"github.com/platinasystems/vnet/icmp6"
 	ipcli "github.com/platinasystems/vnet/ip/cli"
 	"github.com/platinasystems/vnet/ip4"
 	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/lldp"
+	"github.com/platinasystems/vnet/metrics"
+	"github.com/platinasystems/vnet/mpls"
+	"github.com/platinasystems/vnet/nat"
+	"github.com/platinasystems/vnet/nd"
 	"github.com/platinasystems/vnet/pg"
 	fe1_platform "github.com/platinasystems/vnet/platforms/fe1"
+	"github.com/platinasystems/vnet/qos"
+	"github.com/platinasystems/vnet/redispub"
+	"github.com/platinasystems/vnet/rpc"
+	"github.com/platinasystems/vnet/snoop"
 	"github.com/platinasystems/vnet/unix"
 
 	"os"
@@ -34,10 +48,24 @@ func PlatformInit(v *vnet.Vnet, p *fe1_platform.Platform) (err error) {
 	m4 := ip4.Init(v)
 	m6 := ip6.Init(v)
 	gre.Init(v)
+	mpls.Init(v)
 	ethernet.Init(v, m4, m6)
 	pci.Init(v)
 	pg.Init(v)
 	ipcli.Init(v)
+	metrics.Init(v)
+	redispub.Init(v)
+	rpc.Init(v)
+	config.Init(v)
+	acl.Init(v)
+	nat.Init(v)
+	qos.Init(v)
+	snoop.Init(v)
+	dhcp.Init(v)
+	lldp.Init(v)
+	bfd.Init(v)
+	nd.Init(v)
+	icmp6.Init(v)
 	unix.Init(v, unix.Config{RxInjectNodeName: "fe1-cpu"})
 
 	gpio := pca9535_main{
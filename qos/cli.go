@@ -0,0 +1,229 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qos
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// qos policy NAME class CLASS [dscp N,...] [pcp N,...] [acl NAME] [set-dscp N] [set-pcp N] [police POLICER]
+func (m *Main) qosPolicy(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		name string
+		x    Class
+	)
+	if !in.Parse("%s class", &name) {
+		err = cli.ParseError
+		return
+	}
+	if err = x.Parse(&in.Input); err != nil {
+		return
+	}
+	return m.SetClass(name, &x)
+}
+
+// qos delete NAME [class CLASS]
+func (m *Main) qosDel(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var name, class string
+	switch {
+	case in.Parse("%s class %s", &name, &class):
+		return m.DelClass(name, class)
+	case in.Parse("%s", &name):
+		return m.DelPolicy(name)
+	default:
+		err = cli.ParseError
+	}
+	return
+}
+
+// qos attach NAME INTERFACE input|output
+func (m *Main) qosAttach(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		name string
+		si   vnet.Si
+		dir  acl.Direction
+	)
+	if !in.Parse("%s %v %v", &name, &si, m.Vnet, &dir) {
+		err = cli.ParseError
+		return
+	}
+	return m.Attach(si, name, dir)
+}
+
+// qos detach INTERFACE input|output
+func (m *Main) qosDetach(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si  vnet.Si
+		dir acl.Direction
+	)
+	if !in.Parse("%v %v", &si, m.Vnet, &dir) {
+		err = cli.ParseError
+		return
+	}
+	return m.Detach(si, dir)
+}
+
+type showClass struct {
+	Class   string `format:"%-16s" align:"left"`
+	Counter string `format:"%-8s" align:"left"`
+	Packets uint64 `format:"%16d"`
+	Bytes   uint64 `format:"%16d"`
+}
+
+var counterNames = [nCounter]string{
+	counterMatch:  "match",
+	counterGreen:  "green",
+	counterYellow: "yellow",
+	counterRed:    "red",
+	counterDrop:   "drop",
+}
+
+func (p *Policy) counter(i uint) (c vnet.CombinedCounter) {
+	if cs := p.getState().counters; i < uint(len(cs)) {
+		c.Packets = atomic.LoadUint64(&cs[i].Packets)
+		c.Bytes = atomic.LoadUint64(&cs[i].Bytes)
+	}
+	return
+}
+
+func (p *Policy) clearCounters() {
+	cs := p.getState().counters
+	for i := range cs {
+		atomic.StoreUint64(&cs[i].Packets, 0)
+		atomic.StoreUint64(&cs[i].Bytes, 0)
+	}
+}
+
+func (m *Main) attachedString(p *Policy) (s string) {
+	v := m.Vnet
+	for d := range m.nodes {
+		as := m.nodes[d].attachments
+		for si := range as {
+			if as[si].policy == p {
+				if len(s) > 0 {
+					s += ", "
+				}
+				s += fmt.Sprintf("%s %s", vnet.SiName{V: v, Si: vnet.Si(si)}, acl.Direction(d))
+			}
+		}
+	}
+	return
+}
+
+func (m *Main) showQos(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var name string
+	for !in.End() {
+		switch {
+		case in.Parse("%s", &name):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	var ps []*Policy
+	for _, p := range m.policies {
+		if len(name) == 0 || p.Name == name {
+			ps = append(ps, p)
+		}
+	}
+	if len(name) > 0 && len(ps) == 0 {
+		err = fmt.Errorf("qos %s: no such policy", name)
+		return
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+	for _, p := range ps {
+		fmt.Fprintf(w, "%s", p.Name)
+		if s := m.attachedString(p); len(s) > 0 {
+			fmt.Fprintf(w, ", attached to %s", s)
+		}
+		fmt.Fprintln(w)
+		var cs []showClass
+		for i := range p.Classes {
+			x := &p.Classes[i]
+			fmt.Fprintf(w, "  class %s\n", x)
+			for j := 0; j < nCounter; j++ {
+				if j != counterMatch && x.Policer == nil {
+					continue
+				}
+				v := p.counter(uint(i*nCounter + j))
+				cs = append(cs, showClass{
+					Class:   x.Name,
+					Counter: counterNames[j],
+					Packets: v.Packets,
+					Bytes:   v.Bytes,
+				})
+			}
+		}
+		if len(cs) > 0 {
+			elib.Tabulate(cs).Write(w)
+		}
+	}
+	return
+}
+
+func (m *Main) clearQos(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var name string
+	for !in.End() {
+		switch {
+		case in.Parse("counters"):
+		case in.Parse("%s", &name):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	for _, p := range m.policies {
+		if len(name) == 0 || p.Name == name {
+			p.clearCounters()
+		}
+	}
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := []cli.Command{
+		cli.Command{
+			Name:      "qos policy",
+			ShortHelp: "add or replace qos policy class: qos policy NAME class CLASS [dscp N,...] [pcp N,...] [acl NAME] [set-dscp N] [set-pcp N] [police single-rate cir BPS cbs BYTES ebs BYTES | two-rate cir BPS cbs BYTES pir BPS pbs BYTES] [green|yellow|red transmit|drop|set-dscp N]",
+			Action:    m.qosPolicy,
+		},
+		cli.Command{
+			Name:      "qos delete",
+			ShortHelp: "delete qos policy or class: qos delete NAME [class CLASS]",
+			Action:    m.qosDel,
+		},
+		cli.Command{
+			Name:      "qos attach",
+			ShortHelp: "attach qos policy to interface: qos attach NAME INTERFACE input|output",
+			Action:    m.qosAttach,
+		},
+		cli.Command{
+			Name:      "qos detach",
+			ShortHelp: "detach qos policy from interface: qos detach INTERFACE input|output",
+			Action:    m.qosDetach,
+		},
+		cli.Command{
+			Name:      "show qos",
+			ShortHelp: "show qos policies with per class and per color counters",
+			Action:    m.showQos,
+		},
+		cli.Command{
+			Name:      "clear qos",
+			ShortHelp: "clear qos policy counters",
+			Action:    m.clearQos,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
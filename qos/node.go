@@ -0,0 +1,227 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qos
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+	"github.com/platinasystems/vnet/ethernet"
+
+	"sync/atomic"
+)
+
+const (
+	next_error uint = iota
+)
+
+const (
+	error_police_drop uint = iota
+)
+
+// Qos node for given direction.  Input nodes are ethernet input features; output nodes
+// are output features.  Packets start with ethernet header and continue to the next
+// enabled feature unless dropped by a policer.
+type node struct {
+	vnet.InOutNode
+	dir acl.Direction
+	// Feature arc and index of node's feature.
+	arc     *vnet.FeatureArc
+	feature uint
+	// Attached policies indexed by sw interface.
+	attachments []attachment
+}
+
+type attachment struct {
+	policy *Policy
+}
+
+func (n *node) init(v *vnet.Vnet, dir acl.Direction) {
+	n.dir = dir
+	n.Next = []string{
+		next_error: "error",
+	}
+	n.Errors = []string{
+		error_police_drop: "dropped by policer",
+	}
+	v.RegisterInOutNode(n, "qos-%s", dir)
+	if dir == acl.Output {
+		n.arc = v.OutputFeatures()
+	} else {
+		n.arc = &ethernet.GetMain(v).InputFeatures
+	}
+	n.feature = n.arc.Register(n)
+}
+
+const (
+	ethernetTypeIp4  = 0x0800
+	ethernetTypeIp6  = 0x86dd
+	ethernetTypeVlan = 0x8100
+	ethernetTypeQinQ = 0x88a8
+)
+
+func be16(b []byte) uint16     { return uint16(b[0])<<8 | uint16(b[1]) }
+func put16(b []byte, x uint16) { b[0], b[1] = byte(x>>8), byte(x) }
+
+// Ethernet frame with location of outer vlan tag and ip header.
+type frame struct {
+	// Tag control information of outer vlan tag; nil if untagged.
+	tci []byte
+	// Ip4 or ip6 header; nil for other ethernet types.
+	ip  []byte
+	is6 bool
+}
+
+func (f *frame) parse(b []byte) {
+	*f = frame{}
+	o := 12
+	for len(b) >= o+2 {
+		switch be16(b[o:]) {
+		case ethernetTypeVlan, ethernetTypeQinQ:
+			if len(b) < o+4 {
+				return
+			}
+			if f.tci == nil {
+				f.tci = b[o+2 : o+4]
+			}
+			o += 4
+		case ethernetTypeIp4:
+			if len(b) >= o+2+20 {
+				f.ip = b[o+2:]
+			}
+			return
+		case ethernetTypeIp6:
+			if len(b) >= o+2+40 {
+				f.ip, f.is6 = b[o+2:], true
+			}
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (f *frame) dscp() uint8 {
+	switch {
+	case f.ip == nil:
+		return 0
+	case f.is6:
+		return (f.ip[0]<<4 | f.ip[1]>>4) >> 2
+	default:
+		return f.ip[1] >> 2
+	}
+}
+
+func (f *frame) setDscp(d uint8) {
+	switch {
+	case f.ip == nil:
+	case f.is6:
+		// Traffic class is bits 4-11 of first word; ecn is preserved.
+		tc := (d << 2) | (f.ip[1]>>4)&3
+		f.ip[0] = f.ip[0]&0xf0 | tc>>4
+		f.ip[1] = f.ip[1]&0x0f | tc<<4
+	default:
+		tos := d<<2 | f.ip[1]&3
+		if tos == f.ip[1] {
+			return
+		}
+		// Incremental header checksum update (RFC 1624) of word containing tos.
+		old, new := be16(f.ip[0:]), uint16(f.ip[0])<<8|uint16(tos)
+		sum := uint32(^be16(f.ip[10:])) + uint32(^old) + uint32(new)
+		sum = sum&0xffff + sum>>16
+		sum = sum&0xffff + sum>>16
+		put16(f.ip[10:], ^uint16(sum))
+		f.ip[1] = tos
+	}
+}
+
+func (f *frame) pcp() uint8 {
+	if f.tci == nil {
+		return 0
+	}
+	return f.tci[0] >> 5
+}
+
+func (f *frame) setPcp(p uint8) {
+	if f.tci != nil {
+		f.tci[0] = f.tci[0]&0x1f | p<<5
+	}
+}
+
+func (c *class) matches(f *frame) bool {
+	if c.Dscp != 0 && c.Dscp&(1<<f.dscp()) == 0 {
+		return false
+	}
+	if c.Pcp != 0 && c.Pcp&(1<<f.pcp()) == 0 {
+		return false
+	}
+	if c.acl != nil && (f.ip == nil || c.acl.Is6 != f.is6 || !c.acl.Permits(f.ip)) {
+		return false
+	}
+	return true
+}
+
+// Classify, mark and police frame; returns false if frame is to be dropped.
+func (p *Policy) apply(b []byte, now cpu.Time) (ok bool) {
+	var f frame
+	f.parse(b)
+	s := p.getState()
+	for i := range s.classes {
+		c := &s.classes[i]
+		if !c.matches(&f) {
+			continue
+		}
+		cs := s.counters[i*nCounter : (i+1)*nCounter]
+		l := uint(len(b))
+		count(&cs[counterMatch], l)
+		if c.HasSetDscp {
+			f.setDscp(c.SetDscp)
+		}
+		if c.HasSetPcp {
+			f.setPcp(c.SetPcp)
+		}
+		if c.policer == nil {
+			return true
+		}
+		color := c.policer.color(now, l)
+		count(&cs[counterGreen+int(color)], l)
+		switch a := &c.policer.Actions[color]; {
+		case a.Drop:
+			count(&cs[counterDrop], l)
+			return false
+		case a.SetDscp:
+			f.setDscp(a.Dscp)
+		}
+		return true
+	}
+	return true
+}
+
+func count(c *vnet.CombinedCounter, nBytes uint) {
+	atomic.AddUint64(&c.Packets, 1)
+	atomic.AddUint64(&c.Bytes, uint64(nBytes))
+}
+
+func (n *node) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	as := n.attachments
+	i, n_left := in.Range()
+	for n_left >= 1 {
+		r0 := in.Get1(i)
+		var a0 attachment
+		if uint(r0.Si) < uint(len(as)) {
+			a0 = as[r0.Si]
+		}
+		x0 := n.arc.Next(r0.Si, n.feature)
+		if a0.policy != nil && !a0.policy.apply(r0.DataSlice(), now) {
+			n.SetError(r0, error_police_drop)
+			x0 = next_error
+		}
+		q.Put1(r0, x0)
+		n_left -= 1
+		i += 1
+	}
+}
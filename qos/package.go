@@ -0,0 +1,150 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qos provides quality of service policies: ordered classes matching
+// dscp, vlan priority (pcp) or access lists with actions to remark dscp/pcp
+// and police with single rate (RFC 2697) or two rate (RFC 2698) three color
+// markers.  Policies are attached to the input or output of sw interfaces and
+// applied to ethernet frames by the qos-input node, an ethernet input feature,
+// and the qos-output node, an output feature.
+package qos
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+
+	"fmt"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+
+	policies map[string]*Policy
+
+	nodes [acl.Output + 1]node
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("qos", m)
+	m.DependsOn("acl", "ethernet")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	for d := range m.nodes {
+		m.nodes[d].init(v, acl.Direction(d))
+	}
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.cliInit()
+	return
+}
+
+// Policy returns policy with given name or nil if none exists.
+func (m *Main) Policy(name string) *Policy { return m.policies[name] }
+
+// SetClass adds class to named policy replacing class with the same name.
+// Policy is created if it does not exist.
+func (m *Main) SetClass(name string, c *Class) (err error) {
+	p := m.policies[name]
+	isNew := p == nil
+	if isNew {
+		p = &Policy{Name: name}
+	}
+	cs := append([]Class(nil), p.Classes...)
+	if i := p.classIndex(c.Name); i >= 0 {
+		cs[i] = *c
+	} else {
+		cs = append(cs, *c)
+	}
+	if err = p.setClasses(cs, acl.GetMain(m.Vnet)); err != nil {
+		return
+	}
+	if isNew {
+		if m.policies == nil {
+			m.policies = make(map[string]*Policy)
+		}
+		m.policies[name] = p
+	}
+	return
+}
+
+// DelClass deletes named class from policy.
+func (m *Main) DelClass(name, class string) (err error) {
+	p := m.policies[name]
+	if p == nil {
+		return fmt.Errorf("qos %s: no such policy", name)
+	}
+	i := p.classIndex(class)
+	if i < 0 {
+		return fmt.Errorf("qos %s: no class named `%s'", name, class)
+	}
+	return p.setClasses(append(p.Classes[:i:i], p.Classes[i+1:]...), acl.GetMain(m.Vnet))
+}
+
+// DelPolicy deletes named policy; policy must not be attached to any interface.
+func (m *Main) DelPolicy(name string) (err error) {
+	p := m.policies[name]
+	switch {
+	case p == nil:
+		err = fmt.Errorf("qos %s: no such policy", name)
+	case p.refs > 0:
+		err = fmt.Errorf("qos %s: policy is attached to %d interfaces", name, p.refs)
+	default:
+		delete(m.policies, name)
+	}
+	return
+}
+
+// Attach attaches named policy to given direction of sw interface replacing any
+// policy already attached.
+func (m *Main) Attach(si vnet.Si, name string, dir acl.Direction) (err error) {
+	p := m.policies[name]
+	if p == nil {
+		return fmt.Errorf("qos %s: no such policy", name)
+	}
+	n := &m.nodes[dir]
+	m.detach(n, si)
+	if i := uint(si); i >= uint(len(n.attachments)) {
+		n.attachments = append(n.attachments, make([]attachment, 1+i-uint(len(n.attachments)))...)
+	}
+	n.attachments[si] = attachment{policy: p}
+	p.refs++
+	n.arc.Enable(si, n.feature, true)
+	return
+}
+
+func (m *Main) detach(n *node, si vnet.Si) (ok bool) {
+	if uint(si) >= uint(len(n.attachments)) {
+		return
+	}
+	a := &n.attachments[si]
+	if ok = a.policy != nil; ok {
+		a.policy.refs--
+		*a = attachment{}
+		n.arc.Enable(si, n.feature, false)
+	}
+	return
+}
+
+// Detach detaches policy from given direction of sw interface.
+func (m *Main) Detach(si vnet.Si, dir acl.Direction) (err error) {
+	if !m.detach(&m.nodes[dir], si) {
+		err = fmt.Errorf("qos: no policy attached to %s %s", vnet.SiName{V: m.Vnet, Si: si}, dir)
+	}
+	return
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	if isDel {
+		for d := range m.nodes {
+			m.detach(&m.nodes[d], si)
+		}
+	}
+	return
+}
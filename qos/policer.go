@@ -0,0 +1,206 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qos
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+
+	"fmt"
+	"sync"
+)
+
+type Color uint8
+
+const (
+	Green Color = iota
+	Yellow
+	Red
+	nColor
+)
+
+var colorStrings = [...]string{
+	Green:  "green",
+	Yellow: "yellow",
+	Red:    "red",
+}
+
+func (c Color) String() string { return elib.Stringer(colorStrings[:], int(c)) }
+
+// Action taken for packets of given color.
+type ColorAction struct {
+	Drop bool
+	// Remark dscp of transmitted packets.
+	SetDscp bool
+	Dscp    uint8
+}
+
+func (a ColorAction) String() string {
+	switch {
+	case a.Drop:
+		return "drop"
+	case a.SetDscp:
+		return fmt.Sprintf("set-dscp %d", a.Dscp)
+	default:
+		return "transmit"
+	}
+}
+
+func (a *ColorAction) Parse(in *parse.Input) {
+	*a = ColorAction{}
+	switch {
+	case in.Parse("transmit"):
+	case in.Parse("drop"):
+		a.Drop = true
+	case in.Parse("set-dscp %d", &a.Dscp) && a.Dscp < 64:
+		a.SetDscp = true
+	default:
+		in.ParseError()
+	}
+}
+
+type PolicerKind uint8
+
+const (
+	// Single rate three color marker (RFC 2697).
+	SingleRate PolicerKind = iota
+	// Two rate three color marker (RFC 2698).
+	TwoRate
+)
+
+var policerKindStrings = [...]string{
+	SingleRate: "single-rate",
+	TwoRate:    "two-rate",
+}
+
+func (k PolicerKind) String() string { return elib.Stringer(policerKindStrings[:], int(k)) }
+
+// Color blind three color policer.
+type Policer struct {
+	Kind PolicerKind
+	// Committed and (two rate only) peak information rates in bits per second.
+	Cir, Pir uint64
+	// Committed burst size and excess (single rate) or peak (two rate) burst size in bytes.
+	Cbs, Ebs uint64
+	// Action for each color; default transmits green and yellow packets and drops red ones.
+	Actions [nColor]ColorAction
+}
+
+func (p *Policer) String() (s string) {
+	switch p.Kind {
+	case SingleRate:
+		s = fmt.Sprintf("single-rate cir %d cbs %d ebs %d", p.Cir, p.Cbs, p.Ebs)
+	case TwoRate:
+		s = fmt.Sprintf("two-rate cir %d cbs %d pir %d pbs %d", p.Cir, p.Cbs, p.Pir, p.Ebs)
+	}
+	for c := range p.Actions {
+		s += fmt.Sprintf(" %s %s", Color(c), p.Actions[c])
+	}
+	return
+}
+
+// Parse policer e.g. single-rate cir 1000000 cbs 10000 ebs 20000 yellow set-dscp 0
+func (p *Policer) Parse(in *parse.Input) {
+	*p = Policer{}
+	p.Actions[Red].Drop = true
+	switch {
+	case in.Parse("single-rate cir %d cbs %d ebs %d", &p.Cir, &p.Cbs, &p.Ebs):
+		p.Kind = SingleRate
+	case in.Parse("two-rate cir %d cbs %d pir %d pbs %d", &p.Cir, &p.Cbs, &p.Pir, &p.Ebs) && p.Pir >= p.Cir:
+		p.Kind = TwoRate
+	default:
+		in.ParseError()
+	}
+	for {
+		switch {
+		case in.Parse("green %v", &p.Actions[Green]):
+		case in.Parse("yellow %v", &p.Actions[Yellow]):
+		case in.Parse("red %v", &p.Actions[Red]):
+		default:
+			return
+		}
+	}
+}
+
+// Token bucket state of policer.
+type policerState struct {
+	mu sync.Mutex
+	Policer
+	// Tokens in bytes of committed and excess/peak buckets.
+	tc, te float64
+	last   cpu.Time
+}
+
+func newPolicerState(p *Policer) (s *policerState) {
+	s = &policerState{Policer: *p}
+	// Buckets start full.
+	s.tc, s.te = float64(p.Cbs), float64(p.Ebs)
+	return
+}
+
+func (s *policerState) refill(now cpu.Time) {
+	if s.last == 0 {
+		s.last = now
+		return
+	}
+	dt := (now - s.last).Seconds()
+	s.last = now
+	switch s.Kind {
+	case SingleRate:
+		// Committed bucket fills first; overflow goes to excess bucket.
+		s.tc += dt * float64(s.Cir) / 8
+		if x := s.tc - float64(s.Cbs); x > 0 {
+			s.tc = float64(s.Cbs)
+			s.te += x
+			if s.te > float64(s.Ebs) {
+				s.te = float64(s.Ebs)
+			}
+		}
+	case TwoRate:
+		s.tc += dt * float64(s.Cir) / 8
+		if s.tc > float64(s.Cbs) {
+			s.tc = float64(s.Cbs)
+		}
+		s.te += dt * float64(s.Pir) / 8
+		if s.te > float64(s.Ebs) {
+			s.te = float64(s.Ebs)
+		}
+	}
+}
+
+// Color packet of given size in bytes arriving at given time.
+func (s *policerState) color(now cpu.Time, size uint) (c Color) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refill(now)
+	b := float64(size)
+	switch s.Kind {
+	case SingleRate:
+		switch {
+		case s.tc >= b:
+			s.tc -= b
+			c = Green
+		case s.te >= b:
+			s.te -= b
+			c = Yellow
+		default:
+			c = Red
+		}
+	case TwoRate:
+		switch {
+		case s.te < b:
+			c = Red
+		case s.tc < b:
+			s.te -= b
+			c = Yellow
+		default:
+			s.te -= b
+			s.tc -= b
+			c = Green
+		}
+	}
+	return
+}
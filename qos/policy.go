@@ -0,0 +1,202 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qos
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Packet fields matched by class; all given fields must match.
+type Match struct {
+	// Bitmap of matching dscp code points; zero matches any.
+	Dscp uint64
+	// Bitmap of matching vlan priority code points; zero matches any.
+	// Packets without vlan tag have priority 0.
+	Pcp uint8
+	// Name of access list which must permit packet; empty matches any.
+	Acl string
+}
+
+type Class struct {
+	Name string
+	Match
+	// Remark dscp and/or vlan priority of matching packets.
+	SetDscp, SetPcp       uint8
+	HasSetDscp, HasSetPcp bool
+	// Police matching packets if non-nil.
+	Policer *Policer
+}
+
+// Policy is an ordered list of classes; first matching class applies.
+// Packets matching no class are transmitted unchanged.
+type Policy struct {
+	Name    string
+	Classes []Class
+
+	// Runtime state (*policyState) rebuilt when policy changes; read by data path without locking.
+	state atomic.Value
+
+	// Number of attached interfaces.
+	refs uint
+}
+
+type policyState struct {
+	classes []class
+	// Per class counters shared by all threads: index class*nCounter+counter.
+	// Sized when state is built; updated atomically.
+	counters []vnet.CombinedCounter
+}
+
+const (
+	counterMatch = iota
+	counterGreen
+	counterYellow
+	counterRed
+	counterDrop
+	nCounter
+)
+
+type class struct {
+	*Class
+	acl     *acl.List
+	policer *policerState
+}
+
+func bitsString(x uint64) string {
+	var s []string
+	for i := uint(0); i < 64; i++ {
+		if x&(1<<i) != 0 {
+			s = append(s, strconv.Itoa(int(i)))
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// Parse comma separated list of values less than max into bitmap.
+func parseBits(s string, max uint) (x uint64, err error) {
+	for _, f := range strings.Split(s, ",") {
+		i, e := strconv.ParseUint(f, 10, 8)
+		if e != nil || uint(i) >= max {
+			err = fmt.Errorf("invalid value `%s'", f)
+			return
+		}
+		x |= 1 << uint(i)
+	}
+	return
+}
+
+func (c *Class) String() string {
+	s := []string{c.Name}
+	if c.Dscp != 0 {
+		s = append(s, "dscp "+bitsString(c.Dscp))
+	}
+	if c.Pcp != 0 {
+		s = append(s, "pcp "+bitsString(uint64(c.Pcp)))
+	}
+	if c.Acl != "" {
+		s = append(s, "acl "+c.Acl)
+	}
+	if c.HasSetDscp {
+		s = append(s, fmt.Sprintf("set-dscp %d", c.SetDscp))
+	}
+	if c.HasSetPcp {
+		s = append(s, fmt.Sprintf("set-pcp %d", c.SetPcp))
+	}
+	if c.Policer != nil {
+		s = append(s, "police "+c.Policer.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// Parse class e.g. voice dscp 46 set-pcp 5 police single-rate cir 1000000 cbs 10000 ebs 0
+func (c *Class) Parse(in *parse.Input) (err error) {
+	var (
+		s    string
+		p    Policer
+		bits uint64
+	)
+	if !in.Parse("%s", &c.Name) {
+		return fmt.Errorf("expected class name: `%s'", in)
+	}
+	for !in.End() {
+		switch {
+		case in.Parse("dscp %s", &s):
+			if c.Dscp, err = parseBits(s, 64); err != nil {
+				return
+			}
+		case in.Parse("pcp %s", &s):
+			if bits, err = parseBits(s, 8); err != nil {
+				return
+			}
+			c.Pcp = uint8(bits)
+		case in.Parse("acl %s", &c.Acl):
+		case in.Parse("set-dscp %d", &c.SetDscp) && c.SetDscp < 64:
+			c.HasSetDscp = true
+		case in.Parse("set-pcp %d", &c.SetPcp) && c.SetPcp < 8:
+			c.HasSetPcp = true
+		case in.Parse("police %v", &p):
+			c.Policer = &p
+		default:
+			return fmt.Errorf("unexpected input: `%s'", in)
+		}
+	}
+	return
+}
+
+func (p *Policy) classIndex(name string) int {
+	for i := range p.Classes {
+		if p.Classes[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *Policy) getState() (s *policyState) {
+	if s, _ = p.state.Load().(*policyState); s == nil {
+		s = &policyState{}
+	}
+	return
+}
+
+// Build runtime state for given classes; policer buckets start full and counters from zero.
+func (p *Policy) newState(classes []Class, am *acl.Main) (s *policyState, err error) {
+	s = &policyState{
+		classes:  make([]class, len(classes)),
+		counters: make([]vnet.CombinedCounter, len(classes)*nCounter),
+	}
+	for i := range classes {
+		c := &classes[i]
+		s.classes[i].Class = c
+		if c.Acl != "" {
+			if s.classes[i].acl = am.List(c.Acl); s.classes[i].acl == nil {
+				err = fmt.Errorf("qos %s: class %s: no access list named `%s'", p.Name, c.Name, c.Acl)
+				return
+			}
+		}
+		if c.Policer != nil {
+			s.classes[i].policer = newPolicerState(c.Policer)
+		}
+	}
+	return
+}
+
+// Replace classes of policy and publish their runtime state.
+func (p *Policy) setClasses(classes []Class, am *acl.Main) (err error) {
+	s, err := p.newState(classes, am)
+	if err != nil {
+		return
+	}
+	p.Classes = classes
+	p.state.Store(s)
+	return
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qos
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/acl"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"testing"
+)
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+func TestSingleRate(t *testing.T) {
+	// 8000 bits/sec is 1000 bytes/sec.
+	s := newPolicerState(&Policer{Kind: SingleRate, Cir: 8000, Cbs: 1000, Ebs: 500})
+	now := seconds(1)
+	var got []Color
+	for i := 0; i < 4; i++ {
+		got = append(got, s.color(now, 400))
+	}
+	// 1000 committed bytes: 2 green; 500 excess bytes: 1 yellow; then red.
+	want := []Color{Green, Green, Yellow, Red}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+	// After 0.5 seconds 500 bytes refill committed bucket only.
+	if c := s.color(now+seconds(.5), 400); c != Green {
+		t.Errorf("after refill got %v", c)
+	}
+}
+
+func TestTwoRate(t *testing.T) {
+	s := newPolicerState(&Policer{Kind: TwoRate, Cir: 8000, Cbs: 500, Pir: 16000, Ebs: 1000})
+	now := seconds(1)
+	var got []Color
+	for i := 0; i < 3; i++ {
+		got = append(got, s.color(now, 400))
+	}
+	want := []Color{Green, Yellow, Red}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+}
+
+func TestMarking(t *testing.T) {
+	var c Class
+	var in parse.Input
+	in.SetString("voice dscp 46 pcp 5,6 set-dscp 34 set-pcp 3 police single-rate cir 8000 cbs 1000 ebs 0 yellow set-dscp 0")
+	if err := c.Parse(&in); err != nil {
+		t.Fatal(err)
+	}
+	p := &Policy{Name: "p"}
+	if err := p.setClasses([]Class{c}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Vlan tagged ip4 frame with pcp 5 and dscp 46 (EF).
+	b := make([]byte, 18+20)
+	put16(b[12:], ethernetTypeVlan)
+	put16(b[14:], 5<<13|10)
+	put16(b[16:], ethernetTypeIp4)
+	h := b[18:]
+	h[0], h[1], h[8], h[9] = 0x45, 46<<2, 64, 17
+	put16(h[2:], 20)
+	put16(h[10:], ipChecksum(h))
+
+	if !p.apply(b, seconds(1)) {
+		t.Fatal("frame dropped")
+	}
+	var f frame
+	f.parse(b)
+	if f.dscp() != 34 || f.pcp() != 3 || be16(b[14:])&0xfff != 10 {
+		t.Errorf("dscp %d pcp %d", f.dscp(), f.pcp())
+	}
+	if c := ipChecksum(h); c != 0 {
+		t.Errorf("bad ip checksum %x", c)
+	}
+	if v := p.counter(counterGreen); v.Packets != 1 {
+		t.Errorf("green packets %d", v.Packets)
+	}
+
+	// Frame with other pcp does not match and is unchanged.
+	put16(b[14:], 1<<13|10)
+	h[1] = 46 << 2
+	p.apply(b, seconds(1))
+	if f.dscp() != 46 {
+		t.Errorf("unmatched frame remarked: dscp %d", f.dscp())
+	}
+}
+
+// Bad values are reported as errors.
+func TestClassParseError(t *testing.T) {
+	for _, x := range []string{"c dscp 64", "c pcp 1,8", "c dscp x", "c foo"} {
+		var (
+			c  Class
+			in parse.Input
+		)
+		in.SetString(x)
+		if err := c.Parse(&in); err == nil {
+			t.Errorf("%s: no error", x)
+		}
+	}
+}
+
+func ipChecksum(h []byte) uint16 {
+	var sum uint32
+	for i := 0; i < 20; i += 2 {
+		sum += uint32(be16(h[i:]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Attached policies enable qos nodes as ethernet input and output features.
+func TestAttach(t *testing.T) {
+	v := &vnet.Vnet{}
+	pg.Init(v)
+	ethernet.Init(v, ip4.Init(v), ip6.Init(v))
+	acl.Init(v)
+	Init(v)
+	if err := ethernet.GetMain(v).Init(); err != nil {
+		t.Fatal(err)
+	}
+	m := GetMain(v)
+	for d := range m.nodes {
+		m.nodes[d].init(v, acl.Direction(d))
+	}
+	var c Class
+	var in parse.Input
+	in.SetString("af dscp 10")
+	if err := c.Parse(&in); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetClass("p", &c); err != nil {
+		t.Fatal(err)
+	}
+	const si = vnet.Si(1)
+	arcs := [...]*vnet.FeatureArc{acl.Input: &ethernet.GetMain(v).InputFeatures, acl.Output: v.OutputFeatures()}
+	for d := range m.nodes {
+		dir, n := acl.Direction(d), &m.nodes[d]
+		if err := m.Attach(si, "p", dir); err != nil {
+			t.Fatal(err)
+		}
+		if !arcs[d].IsEnabled(si, n.feature) {
+			t.Errorf("qos-%s not enabled on attached interface", dir)
+		}
+		if err := m.Detach(si, dir); err != nil {
+			t.Fatal(err)
+		}
+		if arcs[d].Active() {
+			t.Errorf("qos-%s enabled after detach", dir)
+		}
+	}
+	if err := m.DelPolicy("p"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package redispub publishes interface state and counters into a redis hash.
+//
+// Fields are named PREFIX IFNAME . NAME; for example vnet.eth-0-0.link or
+// vnet.eth-0-0.rx_packets.  Hardware counters are named port_COUNTER to
+// distinguish them from software interface counters with the same name.
+package redispub
+
+import (
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/redis"
+	"github.com/platinasystems/vnet"
+
+	"fmt"
+	"strings"
+)
+
+var packageIndex uint
+
+type config struct {
+	// Redis server network (tcp or unix) and address.
+	// When empty connect to platina redisd socket.
+	network, address string
+
+	// Hash to write into and prefix for field names.
+	hash, prefix string
+
+	// Seconds between counter snapshots.
+	interval float64
+}
+
+type Main struct {
+	vnet.Package
+	config
+	publisher
+
+	enable bool
+	event  snapshotEvent
+}
+
+const (
+	defaultHash     = "platina"
+	defaultPrefix   = "vnet."
+	defaultInterval = 5
+)
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	m.config = config{
+		prefix:   defaultPrefix,
+		interval: defaultInterval,
+	}
+	packageIndex = v.AddPackage("redis", m)
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. redis { tcp localhost:6379 hash platina prefix vnet. interval 10 }
+// Publishing is enabled when package is configured.
+func (m *Main) Configure(in *parse.Input) {
+	m.enable = true
+	for !in.End() {
+		switch {
+		case in.Parse("tcp %s", &m.address):
+			m.network = "tcp"
+		case in.Parse("unix %s", &m.address):
+			m.network = "unix"
+		case in.Parse("hash %s", &m.hash):
+		case in.Parse("prefix %s", &m.prefix):
+		case in.Parse("interval %f", &m.interval):
+			if m.interval <= 0 {
+				panic(fmt.Errorf("interval must be positive: %v", m.interval))
+			}
+		case in.Parse("disable"):
+			m.enable = false
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func (m *Main) Init() (err error) {
+	if !m.enable {
+		return
+	}
+	if len(m.hash) == 0 {
+		m.hash = redis.DefaultHash
+	}
+	if len(m.hash) == 0 {
+		m.hash = defaultHash
+	}
+	m.publisher.start(&m.config)
+
+	v := m.Vnet
+	v.RegisterHwIfLinkUpDownHook(m.hwIfLinkUpDown)
+	v.RegisterSwIfAdminUpDownHook(m.swIfAdminUpDown)
+
+	m.event.m = m
+	v.SignalEvent(&m.event)
+
+	v.CliAdd(&cli.Command{
+		Name:      "show redis publisher",
+		ShortHelp: "show redis publisher statistics",
+		Action:    m.showPublisher,
+	})
+	return
+}
+
+func (m *Main) Exit() (err error) {
+	if m.enable {
+		m.publisher.stop()
+	}
+	return
+}
+
+func (m *Main) field(ifName, name string) string {
+	return m.prefix + ifName + "." + strings.Replace(name, " ", "_", -1)
+}
+
+// Push link state immediately when it changes.
+func (m *Main) hwIfLinkUpDown(v *vnet.Vnet, hi vnet.Hi, isUp bool) (err error) {
+	h := v.HwIf(hi)
+	m.push([]field{{m.field(h.Name(), "link"), upDown(isUp)}})
+	return
+}
+
+func (m *Main) swIfAdminUpDown(v *vnet.Vnet, si vnet.Si, isUp bool) (err error) {
+	m.push([]field{{m.field(vnet.SiName{V: v, Si: si}.String(), "admin"), upDown(isUp)}})
+	return
+}
+
+func upDown(isUp bool) string {
+	if isUp {
+		return "up"
+	}
+	return "down"
+}
+
+// Snapshot of all interface state and counters.
+func (m *Main) snapshot() (fs []field) {
+	v := m.Vnet
+	v.ForeachHwIf(false, func(hi vnet.Hi) {
+		if !hi.IsProvisioned(v) {
+			return
+		}
+		h := v.HwIf(hi)
+		fs = append(fs,
+			field{m.field(h.Name(), "link"), upDown(h.IsLinkUp())},
+			field{m.field(h.Name(), "speed"), h.Speed().String()},
+			field{m.field(h.Name(), "media"), h.Media()},
+		)
+	})
+	v.ForeachSwIf(func(si vnet.Si) {
+		fs = append(fs, field{m.field(vnet.SiName{V: v, Si: si}.String(), "admin"), upDown(si.IsAdminUp(v))})
+	})
+	v.SyncSwIfCounters()
+	const zero = true
+	v.ForeachSwIfCounter(zero, func(si vnet.Si, siName, counterName string, value uint64) {
+		fs = append(fs, field{m.field(siName, counterName), value})
+	})
+	v.ForeachHwIfCounter(zero, false, func(hi vnet.Hi, counterName string, value uint64) {
+		fs = append(fs, field{m.field(v.HwIf(hi).Name(), "port "+counterName), value})
+	})
+	return
+}
+
+// Periodic snapshot event; runs in vnet event context since interface state is not locked.
+type snapshotEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *snapshotEvent) String() string { return "redis publish" }
+func (e *snapshotEvent) EventAction() {
+	m := e.m
+	if m.isStopped() {
+		return
+	}
+	m.push(m.snapshot())
+	m.Vnet.SignalEventAfter(e, m.interval)
+}
+
+func (m *Main) showPublisher(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	address := "redisd"
+	if len(m.address) > 0 {
+		address = m.network + " " + m.address
+	}
+	p := &m.publisher
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(w, "server %s, hash %s, prefix %s, interval %gs\n", address, m.hash, m.prefix, m.interval)
+	fmt.Fprintf(w, "%d fields written, %d errors\n", p.nFields, p.nErrors)
+	if p.lastErr != nil {
+		fmt.Fprintf(w, "last error: %v\n", p.lastErr)
+	}
+	return
+}
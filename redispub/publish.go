@@ -0,0 +1,132 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redispub
+
+import (
+	redigo "github.com/garyburd/redigo/redis"
+	"github.com/platinasystems/redis"
+
+	"sync"
+	"time"
+)
+
+type field struct {
+	name  string
+	value interface{}
+}
+
+// Writes fields to redis from its own go routine so that vnet event loop never waits for redis.
+type publisher struct {
+	cf   *config
+	c    chan []field
+	conn redigo.Conn
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped bool
+
+	// Count of fields written and write errors.
+	nFields, nErrors uint64
+	lastErr          error
+}
+
+// Number of pending writes before new ones are dropped.
+const maxPending = 64
+
+const (
+	connectTimeout = 2 * time.Second
+	ioTimeout      = 2 * time.Second
+)
+
+func (p *publisher) start(cf *config) {
+	p.cf = cf
+	p.c = make(chan []field, maxPending)
+	p.wg.Add(1)
+	go p.run()
+}
+
+func (p *publisher) stop() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.c)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *publisher) isStopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopped
+}
+
+// Queue fields for writing; drops fields when publisher is stopped or redis is not keeping up.
+func (p *publisher) push(fs []field) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped || len(fs) == 0 {
+		return
+	}
+	select {
+	case p.c <- fs:
+	default:
+		p.nErrors++
+	}
+}
+
+func (p *publisher) run() {
+	defer p.wg.Done()
+	for fs := range p.c {
+		if err := p.write(fs); err != nil {
+			p.mu.Lock()
+			p.nErrors++
+			p.lastErr = err
+			p.mu.Unlock()
+			// Reconnect on next write.
+			if p.conn != nil {
+				p.conn.Close()
+				p.conn = nil
+			}
+		}
+	}
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func (p *publisher) connect() (err error) {
+	if p.conn != nil {
+		return
+	}
+	if len(p.cf.address) == 0 {
+		p.conn, err = redis.Connect()
+	} else {
+		p.conn, err = redigo.Dial(p.cf.network, p.cf.address,
+			redigo.DialConnectTimeout(connectTimeout),
+			redigo.DialReadTimeout(ioTimeout),
+			redigo.DialWriteTimeout(ioTimeout))
+	}
+	return
+}
+
+func (p *publisher) write(fs []field) (err error) {
+	if err = p.connect(); err != nil {
+		return
+	}
+	args := make(redigo.Args, 0, 1+2*len(fs))
+	args = append(args, p.cf.hash)
+	for i := range fs {
+		args = append(args, fs[i].name, fs[i].value)
+	}
+	if _, err = p.conn.Do("HMSET", args...); err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.nFields += uint64(len(fs))
+	p.mu.Unlock()
+	return
+}
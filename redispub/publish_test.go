@@ -0,0 +1,104 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redispub
+
+import (
+	redigo "github.com/garyburd/redigo/redis"
+
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Start local redis-server listening on a unix socket; test is skipped if redis-server is not installed.
+func startRedis(t *testing.T) (path string, stop func()) {
+	server, err := exec.LookPath("redis-server")
+	if err != nil {
+		t.Skip("redis-server not found")
+	}
+	dir, err := ioutil.TempDir("", "vnet-redispub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path = filepath.Join(dir, "redis.sock")
+	cmd := exec.Command(server, "--port", "0", "--unixsocket", path, "--save", "", "--appendonly", "no")
+	if err = cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	stop = func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}
+	for i := 0; i < 100; i++ {
+		if c, err := redigo.Dial("unix", path); err == nil {
+			c.Close()
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	stop()
+	t.Fatal("redis-server did not start")
+	return
+}
+
+func TestField(t *testing.T) {
+	m := &Main{config: config{prefix: "vnet."}}
+	for _, x := range []struct{ ifName, name, want string }{
+		{"eth-0-0", "link", "vnet.eth-0-0.link"},
+		{"eth-0-0", "rx packets", "vnet.eth-0-0.rx_packets"},
+		{"eth-1-1", "port tx 64 byte packets", "vnet.eth-1-1.port_tx_64_byte_packets"},
+	} {
+		if got := m.field(x.ifName, x.name); got != x.want {
+			t.Errorf("field %q %q: got %q want %q", x.ifName, x.name, got, x.want)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	path, stop := startRedis(t)
+	defer stop()
+
+	cf := &config{network: "unix", address: path, hash: "test", prefix: "vnet."}
+	p := &publisher{}
+	p.start(cf)
+	p.push([]field{
+		{"vnet.eth-0-0.link", "up"},
+		{"vnet.eth-0-0.rx_packets", uint64(10)},
+	})
+	p.push([]field{{"vnet.eth-0-0.link", "down"}})
+	p.stop()
+	if p.nErrors != 0 {
+		t.Fatalf("%d errors: %v", p.nErrors, p.lastErr)
+	}
+	// Pushes after stop are dropped.
+	p.push([]field{{"vnet.eth-0-0.admin", "up"}})
+
+	c, err := redigo.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got, err := redigo.StringMap(c.Do("HGETALL", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"vnet.eth-0-0.link":       "down",
+		"vnet.eth-0-0.rx_packets": "10",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q want %q", k, got[k], v)
+		}
+	}
+}
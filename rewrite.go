@@ -93,6 +93,7 @@ func (v *Vnet) SetRewrite(rw *Rewrite, si Si, noder Noder, t PacketType, dstAddr
 	rw.Si = si
 	rw.NodeIndex = uint32(n.Index())
 	x, _ := v.loop.AddNext(noder, h)
+	noder.GetVnetNode().setNextName(x, h.GetNode().Name())
 	rw.NextIndex = uint32(x)
 	rw.MaxL3PacketSize = uint16(hw.maxPacketSize)
 	h.SetRewrite(v, rw, t, dstAddr)
@@ -103,6 +104,7 @@ func (v *Vnet) SetRewriteNodeHwIf(rw *Rewrite, hw *HwIf, noder Noder) (h HwInter
 	n := noder.GetNode()
 	rw.NodeIndex = uint32(n.Index())
 	x, _ := v.loop.AddNext(noder, h)
+	noder.GetVnetNode().setNextName(x, h.GetNode().Name())
 	rw.NextIndex = uint32(x)
 	rw.MaxL3PacketSize = uint16(hw.maxPacketSize)
 	return
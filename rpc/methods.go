@@ -0,0 +1,356 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"bytes"
+	"encoding/json"
+	"net"
+	"sort"
+)
+
+// Method handlers are called from vnet event context.
+type method func(m *Main, params json.RawMessage) (interface{}, error)
+
+var methods map[string]method
+
+func init() {
+	methods = map[string]method{
+		"version":        (*Main).version,
+		"interface.list": (*Main).interfaceList,
+		"interface.set":  (*Main).interfaceSet,
+		"counters.get":   (*Main).countersGet,
+		"route.add":      func(m *Main, p json.RawMessage) (interface{}, error) { return m.routeAddDel(p, false, false) },
+		"route.replace":  func(m *Main, p json.RawMessage) (interface{}, error) { return m.routeAddDel(p, false, true) },
+		"route.del":      func(m *Main, p json.RawMessage) (interface{}, error) { return m.routeAddDel(p, true, false) },
+		"neighbor.add":   func(m *Main, p json.RawMessage) (interface{}, error) { return m.neighborAddDel(p, false) },
+		"neighbor.del":   func(m *Main, p json.RawMessage) (interface{}, error) { return m.neighborAddDel(p, true) },
+		"pg.list":        (*Main).pgList,
+		"pg.edit":        (*Main).pgEdit,
+	}
+}
+
+type versionResult struct {
+	Version int      `json:"version"`
+	Methods []string `json:"methods"`
+}
+
+func (m *Main) version(params json.RawMessage) (result interface{}, err error) {
+	r := versionResult{Version: Version}
+	for name := range methods {
+		r.Methods = append(r.Methods, name)
+	}
+	r.Methods = append(r.Methods, "events.subscribe", "events.unsubscribe")
+	sort.Strings(r.Methods)
+	return r, nil
+}
+
+// Software interface given by name (e.g. eth-0-0 or eth-0-0.10).
+func (m *Main) siByName(name string) (si vnet.Si, err error) {
+	var in parse.Input
+	in.SetString(name)
+	if !in.Parse("%v", &si, m.Vnet) || !in.End() {
+		err = errorf(ErrNotFound, "unknown interface `%s'", name)
+	}
+	return
+}
+
+type Interface struct {
+	Name    string  `json:"name"`
+	Si      vnet.Si `json:"si"`
+	AdminUp bool    `json:"admin_up"`
+	// Hardware state of interface's supervising hardware interface.
+	Hi     vnet.Hi `json:"hi"`
+	LinkUp bool    `json:"link_up"`
+	Speed  string  `json:"speed"`
+	Mtu    uint    `json:"mtu"`
+}
+
+func (m *Main) interfaceList(params json.RawMessage) (result interface{}, err error) {
+	if err = decodeParams(params, &struct{}{}); err != nil {
+		return
+	}
+	v := m.Vnet
+	ifs := []Interface{}
+	v.ForeachSwIf(func(si vnet.Si) {
+		sw := v.SwIf(si)
+		x := Interface{
+			Name:    vnet.SiName{V: v, Si: si}.String(),
+			Si:      si,
+			AdminUp: sw.IsAdminUp(),
+			Hi:      vnet.HiNil,
+		}
+		if h := v.SupHwIf(sw); h != nil {
+			if !h.IsProvisioned() {
+				return
+			}
+			x.Hi = h.Hi()
+			x.LinkUp = h.IsLinkUp()
+			x.Speed = h.Speed().String()
+			x.Mtu = h.MaxPacketSize()
+		}
+		ifs = append(ifs, x)
+	})
+	sort.Slice(ifs, func(i, j int) bool { return ifs[i].Name < ifs[j].Name })
+	return ifs, nil
+}
+
+type interfaceSetParams struct {
+	Name string `json:"name"`
+	// Fields not given are left unchanged.
+	AdminUp *bool `json:"admin_up"`
+	Mtu     *uint `json:"mtu"`
+	// Speed as accepted by set hardware-interface speed (e.g. 100g, auto).
+	Speed *string `json:"speed"`
+}
+
+func (m *Main) interfaceSet(params json.RawMessage) (result interface{}, err error) {
+	var p interfaceSetParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	v := m.Vnet
+	var si vnet.Si
+	if si, err = m.siByName(p.Name); err != nil {
+		return
+	}
+	h := v.SupHwIf(v.SwIf(si))
+	if (p.Mtu != nil || p.Speed != nil) && h == nil {
+		err = errorf(ErrInvalidParams, "interface `%s' has no hardware interface", p.Name)
+		return
+	}
+	if p.Speed != nil {
+		var (
+			bw vnet.Bandwidth
+			in parse.Input
+		)
+		in.SetString(*p.Speed)
+		if !in.Parse("%v", &bw) || !in.End() {
+			err = errorf(ErrInvalidParams, "bad speed `%s'", *p.Speed)
+			return
+		}
+		if err = h.SetSpeed(bw); err != nil {
+			return
+		}
+	}
+	if p.Mtu != nil {
+		if err = h.SetMaxPacketSize(*p.Mtu); err != nil {
+			return
+		}
+	}
+	if p.AdminUp != nil {
+		if err = si.SetAdminUp(v, *p.AdminUp); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type countersGetParams struct {
+	// Only report counters for named software interface and its hardware interface.
+	Interface string `json:"interface"`
+	// Include zero counters.
+	Zero bool `json:"zero"`
+}
+
+type Counter struct {
+	Interface string `json:"interface"`
+	// True for hardware (port) counters.
+	Hw    bool   `json:"hw,omitempty"`
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+func (m *Main) countersGet(params json.RawMessage) (result interface{}, err error) {
+	var p countersGetParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	v := m.Vnet
+	var (
+		si vnet.Si = vnet.SiNil
+		hi vnet.Hi = vnet.HiNil
+	)
+	if len(p.Interface) > 0 {
+		if si, err = m.siByName(p.Interface); err != nil {
+			return
+		}
+		if h := v.SupHwIf(v.SwIf(si)); h != nil {
+			hi = h.Hi()
+		}
+	}
+	cs := []Counter{}
+	v.SyncSwIfCounters()
+	v.ForeachSwIfCounter(p.Zero, func(x vnet.Si, name, counter string, value uint64) {
+		if si == vnet.SiNil || x == si {
+			cs = append(cs, Counter{Interface: name, Name: counter, Value: value})
+		}
+	})
+	v.ForeachHwIfCounter(p.Zero, false, func(x vnet.Hi, counter string, value uint64) {
+		if (si == vnet.SiNil || x == hi) && x.IsProvisioned(v) {
+			cs = append(cs, Counter{Interface: v.HwIf(x).Name(), Hw: true, Name: counter, Value: value})
+		}
+	})
+	return cs, nil
+}
+
+type NextHop struct {
+	Address   string `json:"address"`
+	Interface string `json:"interface"`
+	// Defaults to 1.
+	Weight uint `json:"weight"`
+}
+
+type routeParams struct {
+	// Fib table name; defaults to table of first next hop's interface.
+	Table    string    `json:"table"`
+	Prefix   string    `json:"prefix"`
+	NextHops []NextHop `json:"next_hops"`
+}
+
+type routeResult struct {
+	Table  string `json:"table"`
+	Prefix string `json:"prefix"`
+}
+
+func (m *Main) routeAddDel(params json.RawMessage, isDel, isReplace bool) (result interface{}, err error) {
+	var p routeParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	_, prefix, e := net.ParseCIDR(p.Prefix)
+	if e != nil || prefix.IP.To4() == nil {
+		err = errorf(ErrInvalidParams, "bad ip4 prefix `%s'", p.Prefix)
+		return
+	}
+	if len(p.NextHops) == 0 {
+		err = errorf(ErrInvalidParams, "no next hops given")
+		return
+	}
+	m4 := ip4.GetMain(m.Vnet)
+	var nhs ip.NextHopVec
+	for i := range p.NextHops {
+		x := &p.NextHops[i]
+		nh := ip.NextHop{Address: net.ParseIP(x.Address).To4()}
+		if nh.Address == nil {
+			err = errorf(ErrInvalidParams, "bad next hop address `%s'", x.Address)
+			return
+		}
+		if nh.Si, err = m.siByName(x.Interface); err != nil {
+			return
+		}
+		nh.Weight = 1
+		if x.Weight != 0 {
+			nh.Weight = ip.NextHopWeight(x.Weight)
+		}
+		nhs = append(nhs, nh)
+	}
+	var fi ip.FibIndex
+	if len(p.Table) > 0 {
+		var ok bool
+		if fi, ok = m4.FibIndexForName(p.Table); !ok {
+			err = errorf(ErrNotFound, "unknown table `%s'", p.Table)
+			return
+		}
+	} else {
+		fi = m4.FibIndexForSi(nhs[0].Si)
+	}
+	if err = m4.AddDelRouteNextHops(fi, prefix, nhs, isDel, isReplace); err != nil {
+		if isDel {
+			err = errorf(ErrNotFound, "%v", err)
+		}
+		return
+	}
+	return routeResult{Table: m4.FibNameForIndex(fi), Prefix: prefix.String()}, nil
+}
+
+type neighborParams struct {
+	Interface string `json:"interface"`
+	// Ip4 or ip6 address.
+	Address string `json:"address"`
+	// Ethernet address; not needed for delete.
+	LinkAddress string `json:"lladdr"`
+}
+
+type neighborResult struct {
+	Adj ip.Adj `json:"adj"`
+}
+
+func (m *Main) neighborAddDel(params json.RawMessage, isDel bool) (result interface{}, err error) {
+	var p neighborParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	v := m.Vnet
+	n := ethernet.IpNeighbor{Ip: net.ParseIP(p.Address)}
+	if n.Ip == nil {
+		err = errorf(ErrInvalidParams, "bad address `%s'", p.Address)
+		return
+	}
+	if n.Si, err = m.siByName(p.Interface); err != nil {
+		return
+	}
+	if !isDel || len(p.LinkAddress) > 0 {
+		mac, e := net.ParseMAC(p.LinkAddress)
+		if e != nil || len(mac) != ethernet.SizeofAddress {
+			err = errorf(ErrInvalidParams, "bad ethernet address `%s'", p.LinkAddress)
+			return
+		}
+		copy(n.Ethernet[:], mac)
+	}
+	var im *ip.Main
+	if a4 := n.Ip.To4(); a4 != nil {
+		n.Ip = a4
+		im = &ip4.GetMain(v).Main
+	} else {
+		im = &ip6.GetMain(v).Main
+	}
+	var r neighborResult
+	if r.Adj, err = ethernet.GetMain(v).AddDelIpNeighbor(im, &n, isDel); err != nil {
+		return
+	}
+	return r, nil
+}
+
+func (m *Main) pgList(params json.RawMessage) (result interface{}, err error) {
+	if err = decodeParams(params, &struct{}{}); err != nil {
+		return
+	}
+	ss := pg.Streams(m.Vnet)
+	if ss == nil {
+		ss = []pg.StreamInfo{}
+	}
+	return ss, nil
+}
+
+type pgEditParams struct {
+	// Arguments as given to packet-generator command; e.g. "name s0 count 10 rate 1e3 enable".
+	Args string `json:"args"`
+}
+
+type pgEditResult struct {
+	Output string `json:"output"`
+}
+
+func (m *Main) pgEdit(params json.RawMessage) (result interface{}, err error) {
+	var p pgEditParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	var b bytes.Buffer
+	if err = pg.EditStreams(m.Vnet, &b, p.Args); err != nil {
+		err = errorf(ErrInvalidParams, "%v", err)
+		return
+	}
+	return pgEditResult{Output: b.String()}, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rpc provides a versioned JSON-RPC 2.0 control API over a unix socket.
+//
+// Requests and responses are JSON objects, one per line.  Methods cover
+// interface admin state, MTU and speed, ip4 routes, neighbors, packet
+// generator streams and counters; call "version" for the list of methods.
+// Clients may call "events.subscribe" to receive link, admin and route change
+// notifications as "event.TYPE" requests without id.
+package rpc
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+var packageIndex uint
+
+type Main struct {
+	vnet.Package
+	server
+
+	// Requests not processed by vnet within timeout fail with ErrTimeout.
+	timeout time.Duration
+}
+
+const defaultTimeout = 10 * time.Second
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	packageIndex = v.AddPackage("rpc", m)
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. rpc { unix /run/vnet/rpc.sock timeout 5 }
+func (m *Main) Configure(in *parse.Input) {
+	for !in.End() {
+		var secs float64
+		switch {
+		case in.Parse("unix %s", &m.path):
+		case in.Parse("timeout %f", &secs):
+			m.timeout = time.Duration(secs * float64(time.Second))
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	v.CliAdd(&cli.Command{
+		Name:      "show rpc",
+		ShortHelp: "show rpc server clients",
+		Action:    m.showRpc,
+	})
+	if len(m.path) == 0 {
+		return
+	}
+	if m.timeout == 0 {
+		m.timeout = defaultTimeout
+	}
+	v.RegisterHwIfLinkUpDownHook(m.hwIfLinkUpDown)
+	v.RegisterSwIfAdminUpDownHook(m.swIfAdminUpDown)
+	ip4.GetMain(v).RegisterFibAddDelHook(m.ip4FibAddDel)
+	return m.listen(m.call)
+}
+
+func (m *Main) Exit() (err error) {
+	m.close()
+	return
+}
+
+type callEvent struct {
+	vnet.Event
+	m      *Main
+	name   string
+	f      method
+	params json.RawMessage
+	result interface{}
+	err    error
+	done   chan struct{}
+}
+
+func (e *callEvent) String() string { return "rpc " + e.name }
+func (e *callEvent) EventAction() {
+	defer func() {
+		if x := recover(); x != nil {
+			e.err = errorf(ErrInternal, "%v", x)
+		}
+		close(e.done)
+	}()
+	e.result, e.err = e.f(e.m, e.params)
+}
+
+// Call method in vnet event context and wait for result.
+func (m *Main) call(name string, params json.RawMessage) (result interface{}, err error) {
+	f, ok := methods[name]
+	if !ok {
+		err = errorf(ErrMethodNotFound, "unknown method `%s'", name)
+		return
+	}
+	e := &callEvent{m: m, name: name, f: f, params: params, done: make(chan struct{})}
+	m.Vnet.SignalEvent(e)
+	select {
+	case <-e.done:
+	case <-time.After(m.timeout):
+		err = errorf(ErrTimeout, "%s: no response from vnet after %v", name, m.timeout)
+		return
+	}
+	return e.result, e.err
+}
+
+type linkEvent struct {
+	Interface string `json:"interface"`
+	Up        bool   `json:"up"`
+}
+
+func (m *Main) hwIfLinkUpDown(v *vnet.Vnet, hi vnet.Hi, isUp bool) (err error) {
+	m.broadcast(EventLink, linkEvent{Interface: v.HwIf(hi).Name(), Up: isUp})
+	return
+}
+
+func (m *Main) swIfAdminUpDown(v *vnet.Vnet, si vnet.Si, isUp bool) (err error) {
+	m.broadcast(EventAdmin, linkEvent{Interface: vnet.SiName{V: v, Si: si}.String(), Up: isUp})
+	return
+}
+
+type routeEvent struct {
+	Table  string `json:"table"`
+	Prefix string `json:"prefix"`
+	Adj    ip.Adj `json:"adj"`
+	IsDel  bool   `json:"is_del"`
+}
+
+func (m *Main) ip4FibAddDel(fi ip.FibIndex, p *ip4.Prefix, adj ip.Adj, isDel bool) {
+	m4 := ip4.GetMain(m.Vnet)
+	m.broadcast(EventRoute, routeEvent{
+		Table:  m4.FibNameForIndex(fi),
+		Prefix: p.String(),
+		Adj:    adj,
+		IsDel:  isDel,
+	})
+}
+
+func (m *Main) showRpc(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	if len(m.path) == 0 {
+		fmt.Fprintln(w, "rpc server not configured")
+		return
+	}
+	fmt.Fprintf(w, "Listening on %s, api version %d\n", m.path, Version)
+	if cs := m.clients(); len(cs) > 0 {
+		elib.Tabulate(cs).Write(w)
+	}
+	return
+}
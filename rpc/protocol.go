@@ -0,0 +1,92 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// API version; incremented on incompatible changes to methods, params or results.
+const Version = 1
+
+const jsonrpcVersion = "2.0"
+
+// Request as sent by client. Requests without id are notifications and get no response.
+type Request struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Id      json.RawMessage `json:"id,omitempty"`
+}
+
+type Response struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+}
+
+// Notification sent from server to subscribed clients.
+type Notification struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type ErrorCode int
+
+// JSON-RPC 2.0 error codes plus vnet specific codes in implementation defined range.
+const (
+	ErrParse          ErrorCode = -32700
+	ErrInvalidRequest ErrorCode = -32600
+	ErrMethodNotFound ErrorCode = -32601
+	ErrInvalidParams  ErrorCode = -32602
+	ErrInternal       ErrorCode = -32603
+
+	// Operation failed in vnet.
+	ErrFailed ErrorCode = -32000
+	// Named interface, table, route or stream does not exist.
+	ErrNotFound ErrorCode = -32001
+	// Vnet did not process request in time.
+	ErrTimeout ErrorCode = -32002
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrParse:          "parse error",
+	ErrInvalidRequest: "invalid request",
+	ErrMethodNotFound: "method not found",
+	ErrInvalidParams:  "invalid params",
+	ErrInternal:       "internal error",
+	ErrFailed:         "failed",
+	ErrNotFound:       "not found",
+	ErrTimeout:        "timeout",
+}
+
+func (c ErrorCode) String() string {
+	if s, ok := errorCodeStrings[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("error %d", int(c))
+}
+
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s: %s", e.Code, e.Message) }
+
+func errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Errors not already of type *Error are reported as ErrFailed.
+func toError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Code: ErrFailed, Message: err.Error()}
+}
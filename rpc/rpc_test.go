@@ -0,0 +1,183 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testEchoParams struct {
+	Value int `json:"value"`
+}
+
+func testDispatch(name string, params json.RawMessage) (interface{}, error) {
+	switch name {
+	case "version":
+		return methods[name](nil, params)
+	case "echo":
+		var p testEchoParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "fail":
+		return nil, fmt.Errorf("failed")
+	}
+	return nil, errorf(ErrMethodNotFound, "unknown method `%s'", name)
+}
+
+type testClient struct {
+	t *testing.T
+	c net.Conn
+	r *bufio.Reader
+}
+
+func startServer(t *testing.T) (s *server, dir string) {
+	dir, err := ioutil.TempDir("", "vnet-rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = &server{path: filepath.Join(dir, "rpc.sock")}
+	if err = s.listen(testDispatch); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return
+}
+
+func (s *server) dial(t *testing.T) *testClient {
+	c, err := net.Dial("unix", s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testClient{t: t, c: c, r: bufio.NewReader(c)}
+}
+
+func (c *testClient) send(s string) {
+	if _, err := fmt.Fprintln(c.c, s); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) recv(x interface{}) {
+	l, err := c.r.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err = json.Unmarshal(l, x); err != nil {
+		c.t.Fatalf("%s: %v", l, err)
+	}
+}
+
+type testResponse struct {
+	Jsonrpc string
+	Result  json.RawMessage
+	Error   *Error
+	Id      json.RawMessage
+}
+
+func (c *testClient) call(req string) (r testResponse) {
+	c.send(req)
+	c.recv(&r)
+	return
+}
+
+func TestRequests(t *testing.T) {
+	s, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer s.close()
+	c := s.dial(t)
+	defer c.c.Close()
+
+	r := c.call(`{"jsonrpc":"2.0","method":"echo","params":{"value":42},"id":1}`)
+	if r.Error != nil || string(r.Id) != "1" || string(r.Result) != `{"value":42}` {
+		t.Errorf("echo: %+v", r)
+	}
+
+	// Notification: no response; next response must be for id 2.
+	c.send(`{"jsonrpc":"2.0","method":"echo","params":{"value":1}}`)
+	r = c.call(`{"jsonrpc":"2.0","method":"version","id":"2"}`)
+	var v versionResult
+	if err := json.Unmarshal(r.Result, &v); err != nil || string(r.Id) != `"2"` || v.Version != Version || len(v.Methods) == 0 {
+		t.Errorf("version: %+v", r)
+	}
+
+	for _, x := range []struct {
+		req  string
+		code ErrorCode
+	}{
+		{`{"jsonrpc":"2.0","method":"nope","id":3}`, ErrMethodNotFound},
+		{`{"jsonrpc":"2.0","method":"echo","params":{"bogus":1},"id":4}`, ErrInvalidParams},
+		{`{"jsonrpc":"2.0","method":"fail","id":5}`, ErrFailed},
+		{`{"jsonrpc":"1.0","method":"echo","id":6}`, ErrInvalidRequest},
+		{`[{"jsonrpc":"2.0","method":"echo","id":7}]`, ErrInvalidRequest},
+		{`{"jsonrpc":"2.0","method":"events.subscribe","params":{"events":["bogus"]},"id":8}`, ErrInvalidParams},
+	} {
+		if r = c.call(x.req); r.Error == nil || r.Error.Code != x.code {
+			t.Errorf("%s: got %+v want code %d", x.req, r.Error, x.code)
+		}
+	}
+
+	// Bad JSON closes connection after parse error.
+	if r = c.call(`{"jsonrpc":}`); r.Error == nil || r.Error.Code != ErrParse {
+		t.Errorf("parse error: got %+v", r.Error)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s, dir := startServer(t)
+	defer os.RemoveAll(dir)
+	defer s.close()
+	c0, c1 := s.dial(t), s.dial(t)
+	defer c0.c.Close()
+	defer c1.c.Close()
+
+	r := c0.call(`{"jsonrpc":"2.0","method":"events.subscribe","params":{"events":["link"]},"id":1}`)
+	if r.Error != nil || string(r.Result) != `{"events":["link"]}` {
+		t.Fatalf("subscribe: %+v", r)
+	}
+	r = c1.call(`{"jsonrpc":"2.0","method":"events.subscribe","id":1}`)
+	if r.Error != nil || string(r.Result) != `{"events":["admin","link","route"]}` {
+		t.Fatalf("subscribe all: %+v", r)
+	}
+
+	s.broadcast(EventRoute, routeEvent{Table: "default", Prefix: "10.0.0.0/8"})
+	s.broadcast(EventLink, linkEvent{Interface: "eth-0-0", Up: true})
+
+	var n struct {
+		Method string
+		Params json.RawMessage
+		Id     json.RawMessage
+	}
+	c0.recv(&n)
+	if n.Method != "event.link" || string(n.Params) != `{"interface":"eth-0-0","up":true}` || n.Id != nil {
+		t.Errorf("c0: got %s %s", n.Method, n.Params)
+	}
+	c1.recv(&n)
+	if n.Method != "event.route" {
+		t.Errorf("c1: got %s want event.route", n.Method)
+	}
+	c1.recv(&n)
+	if n.Method != "event.link" {
+		t.Errorf("c1: got %s want event.link", n.Method)
+	}
+
+	r = c1.call(`{"jsonrpc":"2.0","method":"events.unsubscribe","params":{"events":["route","admin"]},"id":2}`)
+	if r.Error != nil || string(r.Result) != `{"events":["link"]}` {
+		t.Errorf("unsubscribe: %+v", r)
+	}
+	if cs := s.clients(); len(cs) != 2 || cs[0].Client != 1 || len(cs[0].Events) != 1 {
+		t.Errorf("clients: %+v", cs)
+	}
+}
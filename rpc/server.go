@@ -0,0 +1,301 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Calls method with given params; returns result or error (preferably *Error).
+type dispatchFunc func(method string, params json.RawMessage) (interface{}, error)
+
+type server struct {
+	// Path of unix socket.
+	path string
+
+	l        net.Listener
+	dispatch dispatchFunc
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	conns   map[*conn]struct{}
+	nClient uint
+}
+
+// Number of notifications queued per client before new ones are dropped.
+const maxPendingEvents = 256
+
+type conn struct {
+	s  *server
+	c  net.Conn
+	id uint
+
+	// Serializes writes of responses and notifications.
+	wmu sync.Mutex
+	enc *json.Encoder
+
+	events chan *Notification
+
+	// Subscribed event types and count of dropped notifications; protected by server mutex.
+	subs     map[string]bool
+	nDropped uint64
+}
+
+func (s *server) listen(f dispatchFunc) (err error) {
+	// Remove stale socket left from previous run.
+	os.Remove(s.path)
+	if s.l, err = net.Listen("unix", s.path); err != nil {
+		err = fmt.Errorf("rpc listen %s: %v", s.path, err)
+		return
+	}
+	s.dispatch = f
+	s.conns = make(map[*conn]struct{})
+	s.wg.Add(1)
+	go s.accept(s.l)
+	return
+}
+
+func (s *server) close() {
+	if s.l == nil {
+		return
+	}
+	s.l.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.l = nil
+	os.Remove(s.path)
+}
+
+func (s *server) accept(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{
+			s:      s,
+			c:      nc,
+			enc:    json.NewEncoder(nc),
+			events: make(chan *Notification, maxPendingEvents),
+			subs:   make(map[string]bool),
+		}
+		s.mu.Lock()
+		s.nClient++
+		c.id = s.nClient
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(2)
+		go c.serve()
+		go c.notify()
+	}
+}
+
+func (c *conn) write(x interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.enc.Encode(x)
+}
+
+func (c *conn) notify() {
+	defer c.s.wg.Done()
+	for n := range c.events {
+		if c.write(n) != nil {
+			c.c.Close()
+		}
+	}
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer func() {
+		c.s.mu.Lock()
+		delete(c.s.conns, c)
+		close(c.events)
+		c.s.mu.Unlock()
+		c.c.Close()
+	}()
+	dec := json.NewDecoder(c.c)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err != io.EOF {
+				// Stream cannot be re-synchronized after bad JSON so report error and close.
+				c.write(&Response{Jsonrpc: jsonrpcVersion, Error: errorf(ErrParse, "%v", err), Id: json.RawMessage("null")})
+			}
+			return
+		}
+		r := c.handle(raw)
+		if r == nil {
+			continue
+		}
+		if c.write(r) != nil {
+			return
+		}
+	}
+}
+
+// Handle request returning response or nil for notifications.
+func (c *conn) handle(raw json.RawMessage) (r *Response) {
+	var req Request
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		return &Response{Jsonrpc: jsonrpcVersion, Error: errorf(ErrInvalidRequest, "batch requests not supported"), Id: json.RawMessage("null")}
+	}
+	if err := json.Unmarshal(raw, &req); err != nil || req.Jsonrpc != jsonrpcVersion || len(req.Method) == 0 {
+		msg := "expected jsonrpc 2.0 request object with method"
+		if err != nil {
+			msg = err.Error()
+		}
+		return &Response{Jsonrpc: jsonrpcVersion, Error: errorf(ErrInvalidRequest, "%s", msg), Id: json.RawMessage("null")}
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch req.Method {
+	case "events.subscribe":
+		result, err = c.subscribe(req.Params, true)
+	case "events.unsubscribe":
+		result, err = c.subscribe(req.Params, false)
+	default:
+		result, err = c.s.dispatch(req.Method, req.Params)
+	}
+	if len(req.Id) == 0 {
+		return
+	}
+	r = &Response{Jsonrpc: jsonrpcVersion, Id: req.Id}
+	if err != nil {
+		r.Error = toError(err)
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		r.Result = result
+	}
+	return
+}
+
+// Event types clients may subscribe to.
+const (
+	// Hardware interface link up/down.
+	EventLink = "link"
+	// Software interface admin up/down.
+	EventAdmin = "admin"
+	// Ip4 route add/delete.
+	EventRoute = "route"
+)
+
+var eventTypes = map[string]bool{EventLink: true, EventAdmin: true, EventRoute: true}
+
+type subscribeParams struct {
+	// Event types; empty means all types.
+	Events []string `json:"events"`
+}
+
+type subscribeResult struct {
+	Events []string `json:"events"`
+}
+
+func (c *conn) subscribe(params json.RawMessage, isSubscribe bool) (result interface{}, err error) {
+	var p subscribeParams
+	if err = decodeParams(params, &p); err != nil {
+		return
+	}
+	if len(p.Events) == 0 {
+		for t := range eventTypes {
+			p.Events = append(p.Events, t)
+		}
+	}
+	for _, t := range p.Events {
+		if !eventTypes[t] {
+			err = errorf(ErrInvalidParams, "unknown event type `%s'", t)
+			return
+		}
+	}
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for _, t := range p.Events {
+		if isSubscribe {
+			c.subs[t] = true
+		} else {
+			delete(c.subs, t)
+		}
+	}
+	r := subscribeResult{Events: []string{}}
+	for t := range c.subs {
+		r.Events = append(r.Events, t)
+	}
+	sort.Strings(r.Events)
+	result = r
+	return
+}
+
+// Send event to all clients subscribed to its type; never blocks.
+func (s *server) broadcast(eventType string, params interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := &Notification{Jsonrpc: jsonrpcVersion, Method: "event." + eventType, Params: params}
+	for c := range s.conns {
+		if !c.subs[eventType] {
+			continue
+		}
+		select {
+		case c.events <- n:
+		default:
+			c.nDropped++
+		}
+	}
+}
+
+type clientStats struct {
+	Client  uint     `format:"%d"`
+	Events  []string `format:"%v"`
+	Pending int      `format:"%d"`
+	Dropped uint64   `format:"%d"`
+}
+
+func (s *server) clients() (cs []clientStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		x := clientStats{
+			Client:  c.id,
+			Dropped: c.nDropped,
+			Pending: len(c.events),
+		}
+		for t := range c.subs {
+			x.Events = append(x.Events, t)
+		}
+		sort.Strings(x.Events)
+		cs = append(cs, x)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Client < cs[j].Client })
+	return
+}
+
+// Decode params into x; missing params leave x unchanged.
+func decodeParams(params json.RawMessage, x interface{}) (err error) {
+	if len(params) == 0 || string(params) == "null" {
+		return
+	}
+	d := json.NewDecoder(bytes.NewReader(params))
+	d.DisallowUnknownFields()
+	if err = d.Decode(x); err != nil {
+		err = errorf(ErrInvalidParams, "%v", err)
+	}
+	return
+}
@@ -0,0 +1,298 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Node dispatch statistics.
+type NodeRuntimeStats struct {
+	// Number of times node was called.
+	Calls uint64
+	// Number of packets processed (input for output and in/out nodes; output for input nodes).
+	Vectors uint64
+	// CPU clocks spent in node.
+	Clocks uint64
+}
+
+func (s *NodeRuntimeStats) add(x *NodeRuntimeStats) {
+	s.Calls += x.Calls
+	s.Vectors += x.Vectors
+	s.Clocks += x.Clocks
+}
+
+func (s *NodeRuntimeStats) sub(x *NodeRuntimeStats) {
+	s.Calls -= x.Calls
+	s.Vectors -= x.Vectors
+	s.Clocks -= x.Clocks
+}
+
+func (s *NodeRuntimeStats) VectorsPerCall() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return float64(s.Vectors) / float64(s.Calls)
+}
+
+func (s *NodeRuntimeStats) ClocksPerVector() float64 {
+	if s.Vectors == 0 {
+		return 0
+	}
+	return float64(s.Clocks) / float64(s.Vectors)
+}
+
+// Loads stats written concurrently by data path.
+func (s *NodeRuntimeStats) load() (x NodeRuntimeStats) {
+	x.Calls = atomic.LoadUint64(&s.Calls)
+	x.Vectors = atomic.LoadUint64(&s.Vectors)
+	x.Clocks = atomic.LoadUint64(&s.Clocks)
+	return
+}
+
+type nodeRuntimeThread struct {
+	stats          NodeRuntimeStats
+	statsLastClear NodeRuntimeStats
+}
+
+// Per-thread stats indexed by thread id; each thread only writes its own entry.
+type nodeRuntime struct {
+	// Slice of *nodeRuntimeThread read without locking; replaced by a larger copy when a
+	// thread calls node for the first time.
+	threads atomic.Value
+}
+
+func (r *nodeRuntime) getThreads() (ts []*nodeRuntimeThread) {
+	ts, _ = r.threads.Load().([]*nodeRuntimeThread)
+	return
+}
+
+func (r *nodeRuntime) getThread(id uint, mu *sync.Mutex) (t *nodeRuntimeThread) {
+	if ts := r.getThreads(); id < uint(len(ts)) && ts[id] != nil {
+		return ts[id]
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	ts := r.getThreads()
+	if id < uint(len(ts)) && ts[id] != nil {
+		return ts[id]
+	}
+	l := uint(len(ts))
+	if id >= l {
+		l = id + 1
+	}
+	x := make([]*nodeRuntimeThread, l)
+	copy(x, ts)
+	t = &nodeRuntimeThread{}
+	x[id] = t
+	r.threads.Store(x)
+	return
+}
+
+func (n *Node) runtimeStart() cpu.Time { return cpu.TimeNow() }
+
+func (n *Node) runtimeUpdate(id uint, nVectors uint, t0 cpu.Time) {
+	if id == ^uint(0) {
+		return
+	}
+	t := n.runtime.getThread(id, &n.Vnet.runtimeMu)
+	atomic.AddUint64(&t.stats.Calls, 1)
+	atomic.AddUint64(&t.stats.Vectors, uint64(nVectors))
+	atomic.AddUint64(&t.stats.Clocks, uint64(cpu.TimeNow()-t0))
+}
+
+// Vnet replaces main loop's "show runtime" and "clear runtime" with per-node stats of all vnet
+// nodes broken down by thread.
+type runtimeMain struct {
+	// Serializes allocation of per-thread stats.
+	runtimeMu            sync.Mutex
+	runtimeNodes         []*Node
+	timeLastRuntimeClear time.Time
+}
+
+func (v *Vnet) addRuntimeNode(n *Node) { v.runtimeNodes = append(v.runtimeNodes, n) }
+
+// ForeachNodeRuntime calls f with stats since last clear for each node and thread which called node.
+func (v *Vnet) ForeachNodeRuntime(f func(n *Node, threadId uint, s *NodeRuntimeStats)) {
+	for _, n := range v.runtimeNodes {
+		for id, t := range n.runtime.getThreads() {
+			if t == nil {
+				continue
+			}
+			s := t.stats.load()
+			s.sub(&t.statsLastClear)
+			if s.Calls == 0 {
+				continue
+			}
+			f(n, uint(id), &s)
+		}
+	}
+}
+
+func (v *Vnet) ClearNodeRuntime() {
+	v.timeLastRuntimeClear = time.Now()
+	for _, n := range v.runtimeNodes {
+		for _, t := range n.runtime.getThreads() {
+			if t != nil {
+				t.statsLastClear = t.stats.load()
+			}
+		}
+	}
+}
+
+type showRuntimeNode struct {
+	Name            string  `format:"%-30s"`
+	Thread          string  `align:"right"`
+	Calls           uint64  `format:"%16d"`
+	Vectors         uint64  `format:"%16d"`
+	VectorsPerCall  float64 `format:"%16.2f"`
+	Clocks          uint64  `format:"%16d"`
+	ClocksPerVector float64 `format:"%16.2f"`
+}
+
+type showRuntimeNodes []showRuntimeNode
+
+var runtimeSortKeys = map[string]func(a, b *showRuntimeNode) bool{
+	"name":    func(a, b *showRuntimeNode) bool { return a.Name < b.Name },
+	"calls":   func(a, b *showRuntimeNode) bool { return a.Calls > b.Calls },
+	"vectors": func(a, b *showRuntimeNode) bool { return a.Vectors > b.Vectors },
+	"clocks":  func(a, b *showRuntimeNode) bool { return a.Clocks > b.Clocks },
+	"clocks-per-vector": func(a, b *showRuntimeNode) bool {
+		return a.ClocksPerVector > b.ClocksPerVector
+	},
+}
+
+func (v *Vnet) showRuntime(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		detail, perThread bool
+		sortKey           string = "name"
+		thread            uint   = ^uint(0)
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("d%*etail"):
+			detail = true
+		case in.Parse("t%*hread %d", &thread):
+			perThread = true
+		case in.Parse("t%*hreads"):
+			perThread = true
+		case in.Parse("s%*ort %s", &sortKey):
+			if _, ok := runtimeSortKeys[sortKey]; !ok {
+				err = fmt.Errorf("unknown sort key `%s'", sortKey)
+				return
+			}
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+
+	type key struct {
+		n      *Node
+		thread uint
+	}
+	stats := make(map[key]*NodeRuntimeStats)
+	var total NodeRuntimeStats
+	v.ForeachNodeRuntime(func(n *Node, id uint, s *NodeRuntimeStats) {
+		if thread != ^uint(0) && id != thread {
+			return
+		}
+		k := key{n: n, thread: ^uint(0)}
+		if perThread {
+			k.thread = id
+		}
+		if stats[k] == nil {
+			stats[k] = &NodeRuntimeStats{}
+		}
+		stats[k].add(s)
+		total.add(s)
+	})
+	if detail {
+		// Show nodes which have not been called.
+		called := make(map[*Node]bool)
+		for k := range stats {
+			called[k.n] = true
+		}
+		for _, n := range v.runtimeNodes {
+			if !called[n] {
+				stats[key{n: n, thread: ^uint(0)}] = &NodeRuntimeStats{}
+			}
+		}
+	}
+
+	ns := showRuntimeNodes{}
+	for k, s := range stats {
+		if s.Calls == 0 && !detail {
+			continue
+		}
+		x := showRuntimeNode{
+			Name:            k.n.Name(),
+			Calls:           s.Calls,
+			Vectors:         s.Vectors,
+			VectorsPerCall:  s.VectorsPerCall(),
+			Clocks:          s.Clocks,
+			ClocksPerVector: s.ClocksPerVector(),
+		}
+		if k.thread != ^uint(0) {
+			x.Thread = fmt.Sprintf("%d", k.thread)
+		}
+		ns = append(ns, x)
+	}
+	less := runtimeSortKeys[sortKey]
+	sort.Slice(ns, func(i, j int) bool {
+		a, b := &ns[i], &ns[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Thread < b.Thread
+	})
+
+	if total.Vectors > 0 {
+		dt := time.Since(v.timeLastRuntimeClear).Seconds()
+		fmt.Fprintf(w, "Vectors: %d, Vectors/sec: %.2e, Clocks/vector: %.2f, Vectors/call %.2f\n",
+			total.Vectors, float64(total.Vectors)/dt, total.ClocksPerVector(), total.VectorsPerCall())
+	}
+	colMap := map[string]bool{
+		"Thread": perThread,
+	}
+	elib.Tabulate(ns).WriteCols(w, colMap)
+	return
+}
+
+func (v *Vnet) clearRuntime(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	v.ClearNodeRuntime()
+	return
+}
+
+func init() {
+	AddInit(func(v *Vnet) {
+		v.timeLastRuntimeClear = time.Now()
+		// Vnet init runs after main loop has added its commands so these replace them.
+		v.CliAdd(&cli.Command{
+			Name:      "show runtime",
+			ShortHelp: "show node runtime statistics [detail] [threads|thread N] [sort name|calls|vectors|clocks|clocks-per-vector]",
+			Action:    v.showRuntime,
+		})
+		v.CliAdd(&cli.Command{
+			Name:      "clear runtime",
+			ShortHelp: "clear node runtime statistics",
+			Action:    v.clearRuntime,
+		})
+	})
+}
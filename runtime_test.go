@@ -0,0 +1,44 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"sync"
+	"testing"
+)
+
+// Each thread gets its own stats however many threads call node.
+func TestNodeRuntimeThreads(t *testing.T) {
+	v := &Vnet{}
+	n := &Node{Vnet: v}
+	v.addRuntimeNode(n)
+	const nThreads = 40
+	var wg sync.WaitGroup
+	for id := uint(0); id < nThreads; id++ {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			for i := uint(0); i <= id; i++ {
+				n.runtimeUpdate(id, 2, n.runtimeStart())
+			}
+		}(id)
+		v.ForeachNodeRuntime(func(n *Node, id uint, s *NodeRuntimeStats) {})
+	}
+	wg.Wait()
+	nSeen := uint(0)
+	v.ForeachNodeRuntime(func(n *Node, id uint, s *NodeRuntimeStats) {
+		if s.Calls != uint64(id+1) || s.Vectors != 2*s.Calls {
+			t.Errorf("thread %d: %d calls %d vectors", id, s.Calls, s.Vectors)
+		}
+		nSeen++
+	})
+	if nSeen != nThreads {
+		t.Errorf("stats for %d threads, want %d", nSeen, nThreads)
+	}
+	v.ClearNodeRuntime()
+	v.ForeachNodeRuntime(func(n *Node, id uint, s *NodeRuntimeStats) {
+		t.Errorf("thread %d: stats after clear", id)
+	})
+}
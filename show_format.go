@@ -0,0 +1,64 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib/parse"
+	"gopkg.in/yaml.v2"
+
+	"encoding/json"
+	"io"
+)
+
+// Output format for show commands: "format json" and "format yaml" select structured
+// output for consumption by scripts; default is human readable text.
+type ShowFormat uint8
+
+const (
+	ShowFormatText ShowFormat = iota
+	ShowFormatJson
+	ShowFormatYaml
+)
+
+var showFormatStrings = [...]string{
+	ShowFormatText: "text",
+	ShowFormatJson: "json",
+	ShowFormatYaml: "yaml",
+}
+
+func (f ShowFormat) String() string { return showFormatStrings[f] }
+
+func (f *ShowFormat) Parse(in *parse.Input) {
+	switch text := in.Token(); text {
+	case "text":
+		*f = ShowFormatText
+	case "json":
+		*f = ShowFormatJson
+	case "yaml":
+		*f = ShowFormatYaml
+	default:
+		in.ParseError()
+	}
+}
+
+func (f ShowFormat) IsText() bool { return f == ShowFormatText }
+
+// Write writes x in JSON or YAML format.
+// Field names are taken from json and yaml struct tags.
+func (f ShowFormat) Write(w io.Writer, x interface{}) (err error) {
+	switch f {
+	case ShowFormatYaml:
+		var b []byte
+		if b, err = yaml.Marshal(x); err != nil {
+			return
+		}
+		_, err = w.Write(b)
+	default:
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		err = e.Encode(x)
+	}
+	return
+}
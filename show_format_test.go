@@ -0,0 +1,63 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vnet
+
+import (
+	"github.com/platinasystems/elib/parse"
+
+	"bytes"
+	"testing"
+)
+
+func TestShowFormat(t *testing.T) {
+	pools := []showPool{{Pool: "default", Size: 2048, Free: 4096, Used: 8192}}
+	for _, x := range []struct{ in, want string }{
+		{"json", "[\n  {\n    \"pool\": \"default\",\n    \"size\": 2048,\n    \"free_bytes\": 4096,\n    \"used_bytes\": 8192\n  }\n]\n"},
+		{"yaml", "- pool: default\n  size: 2048\n  free_bytes: 4096\n  used_bytes: 8192\n"},
+	} {
+		var (
+			f  ShowFormat
+			in parse.Input
+		)
+		in.SetString("format " + x.in)
+		if !in.Parse("f%*ormat %v", &f) || f.String() != x.in {
+			t.Fatalf("parse %s: got %s", x.in, f)
+		}
+		var b bytes.Buffer
+		if err := f.Write(&b, pools); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != x.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", x.in, got, x.want)
+		}
+	}
+
+	var (
+		f  ShowFormat
+		in parse.Input
+	)
+	in.SetString("format xml")
+	if in.Parse("f%*ormat %v", &f) {
+		t.Errorf("parsed unknown format")
+	}
+}
+
+// Text output leaves count and rate blank for rows without counter.
+func TestShowIfText(t *testing.T) {
+	sw := showSwIfs{
+		{Name: "eth-0-0", State: "up"},
+		{Name: "eth-0-1", State: "up", Counter: "rx packets", Count: 10, Rate: 2},
+	}.text()
+	if x := sw[0]; x.Count != "" || x.Rate != "" {
+		t.Errorf("sw summary row: got count %q rate %q want blank", x.Count, x.Rate)
+	}
+	if x := sw[1]; x.Count != "10" || x.Rate != "2.00e+00" {
+		t.Errorf("sw counter row: got count %q rate %q", x.Count, x.Rate)
+	}
+	hw := showHwIfs{{Name: "eth-0-0", Driver: "fe1", Link: "up"}}.text()
+	if x := hw[0]; x.Count != "" || x.Rate != "" {
+		t.Errorf("hw summary row: got count %q rate %q want blank", x.Count, x.Rate)
+	}
+}
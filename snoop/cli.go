@@ -0,0 +1,230 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snoop
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// snoop bridge STAG enable [fast-leave] [mrouter INTERFACE]...
+// snoop bridge STAG disable
+func (m *Main) snoopBridge(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		bd  Bridge
+		cf  BridgeConfig
+		si  vnet.Si
+		dis bool
+	)
+	if !in.Parse("%d", &bd) {
+		err = cli.ParseError
+		return
+	}
+	switch {
+	case in.Parse("enable"):
+	case in.Parse("disable"):
+		dis = true
+	default:
+		err = cli.ParseError
+		return
+	}
+	for !dis && !in.End() {
+		switch {
+		case in.Parse("fast-leave"):
+			cf.FastLeave = true
+		case in.Parse("mrouter %v", &si, m.Vnet):
+			cf.Mrouters = append(cf.Mrouters, si)
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	if dis {
+		return m.Disable(bd)
+	}
+	m.Enable(bd, &cf)
+	return
+}
+
+// snoop member INTERFACE bridge STAG|none
+func (m *Main) snoopMember(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		si vnet.Si
+		bd Bridge
+	)
+	switch {
+	case in.Parse("%v bridge %d", &si, m.Vnet, &bd):
+		m.SetMember(si, bd, false)
+	case in.Parse("%v none", &si, m.Vnet):
+		m.SetMember(si, 0, true)
+	default:
+		err = cli.ParseError
+	}
+	return
+}
+
+type showGroup struct {
+	Bridge    Bridge `format:"%6d"`
+	Group     string `format:"%-24s" align:"left"`
+	Interface string `format:"%-30s" align:"left"`
+	Expires   string `format:"%10s"`
+}
+
+func expires(now, t cpu.Time) string {
+	if t <= now {
+		return "0s"
+	}
+	return fmt.Sprintf("%.0fs", (t - now).Seconds())
+}
+
+// show snoop [bridge STAG] [groups]
+func (m *Main) showSnoop(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		bd      Bridge
+		bdValid bool
+		groups  bool
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("bridge %d", &bd):
+			bdValid = true
+		case in.Parse("group%*s"):
+			groups = true
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	v := m.Vnet
+	now := cpu.TimeNow()
+	siName := func(si vnet.Si) string { return vnet.SiName{V: v, Si: si}.String() }
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bdValid && m.bridges[bd] == nil {
+		err = fmt.Errorf("bridge %d: snooping not enabled", bd)
+		return
+	}
+	var gs []showGroup
+	for _, x := range m.sortedBridges() {
+		if bdValid && x != bd {
+			continue
+		}
+		b := m.bridges[x]
+		if !groups {
+			fmt.Fprintf(w, "bridge %d: %d groups", x, len(b.groups))
+			if b.FastLeave {
+				fmt.Fprintf(w, ", fast-leave")
+			}
+			fmt.Fprintf(w, ", %d queries, %d reports, %d leaves, %d pim hellos\n",
+				b.counters[counterQuery], b.counters[counterReport], b.counters[counterLeave], b.counters[counterMrouter])
+			for i, proto := range [2]string{"igmp", "mld"} {
+				q := &b.queriers[i]
+				if q.expires > now {
+					fmt.Fprintf(w, "  %s querier %s on %s, version %d, expires %s\n",
+						proto, net.IP(q.src[:]), siName(q.si), q.version, expires(now, q.expires))
+				}
+			}
+			var ms []string
+			for _, si := range b.Mrouters {
+				ms = append(ms, siName(si)+" (static)")
+			}
+			for si, e := range b.mrouters {
+				ms = append(ms, fmt.Sprintf("%s (%s)", siName(si), expires(now, e)))
+			}
+			sort.Strings(ms)
+			if len(ms) > 0 {
+				fmt.Fprintf(w, "  mrouter ports: %s\n", strings.Join(ms, ", "))
+			}
+			continue
+		}
+		as := make([]ip.Address, 0, len(b.groups))
+		for a := range b.groups {
+			as = append(as, a)
+		}
+		sort.Slice(as, func(i, j int) bool { return bytes.Compare(as[i][:], as[j][:]) < 0 })
+		for _, a := range as {
+			g := b.groups[a]
+			sis := make([]vnet.Si, 0, len(g.members))
+			for si := range g.members {
+				sis = append(sis, si)
+			}
+			sort.Slice(sis, func(i, j int) bool { return sis[i] < sis[j] })
+			for _, si := range sis {
+				gs = append(gs, showGroup{
+					Bridge:    x,
+					Group:     net.IP(a[:]).String(),
+					Interface: siName(si),
+					Expires:   expires(now, g.members[si]),
+				})
+			}
+		}
+	}
+	if groups {
+		if len(gs) == 0 {
+			fmt.Fprintln(w, "No groups")
+			return
+		}
+		elib.Tabulate(gs).Write(w)
+	} else if len(m.bridges) == 0 {
+		fmt.Fprintln(w, "Snooping not enabled on any bridge")
+	}
+	return
+}
+
+// clear snoop [bridge STAG]
+func (m *Main) clearSnoop(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var bd Bridge
+	all := true
+	for !in.End() {
+		switch {
+		case in.Parse("bridge %d", &bd):
+			all = false
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
+	m.Clear(bd, all)
+	return
+}
+
+func (m *Main) cliInit() {
+	v := m.Vnet
+	cmds := [...]cli.Command{
+		cli.Command{
+			Name:      "snoop bridge",
+			ShortHelp: "enable/disable igmp/mld snooping: snoop bridge STAG enable [fast-leave] [mrouter INTERFACE]... | disable",
+			Action:    m.snoopBridge,
+		},
+		cli.Command{
+			Name:      "snoop member",
+			ShortHelp: "set bridge of member interface: snoop member INTERFACE bridge STAG|none",
+			Action:    m.snoopMember,
+		},
+		cli.Command{
+			Name:      "show snoop",
+			ShortHelp: "show igmp/mld snooping queriers, mrouter ports and groups [bridge STAG] [groups]",
+			Action:    m.showSnoop,
+		},
+		cli.Command{
+			Name:      "clear snoop",
+			ShortHelp: "flush learned igmp/mld snooping state [bridge STAG]",
+			Action:    m.clearSnoop,
+		},
+	}
+	for i := range cmds {
+		v.CliAdd(&cmds[i])
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snoop
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+)
+
+const (
+	next_error uint = iota
+)
+
+// Node snooping frames received on bridge member interfaces.  Node is an ethernet input
+// feature enabled on members of bridges with snooping enabled; frames start with ethernet
+// header and all continue to the next enabled feature.
+type node struct {
+	vnet.InOutNode
+	m *Main
+	// Feature arc and index of node's feature.
+	arc     *vnet.FeatureArc
+	feature uint
+}
+
+func (n *node) init(v *vnet.Vnet, m *Main) {
+	n.m = m
+	n.Next = []string{
+		next_error: "error",
+	}
+	v.RegisterInOutNode(n, "l2-snoop")
+	n.arc = &ethernet.GetMain(v).InputFeatures
+	n.feature = n.arc.Register(n)
+}
+
+func (n *node) NodeInput(in *vnet.RefIn, o *vnet.RefOut) {
+	m := n.m
+	q := n.GetEnqueue(in)
+	now := cpu.TimeNow()
+	i, n_left := in.Range()
+	for ; n_left > 0; n_left-- {
+		r0 := in.Get1(i)
+		m.input(r0.Si, r0.DataSlice(), now)
+		q.Put1(r0, n.arc.Next(r0.Si, n.feature))
+		i++
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package snoop provides IGMP and MLD snooping for bridges.
+//
+// Snooping is enabled per bridge domain, identified by bridge stag.  The
+// l2-snoop node, an ethernet input feature, inspects frames received on bridge
+// member interfaces and passes all of them on.  Members are interfaces set with
+// SetMember and ports with the bridge's stag known when snooping is enabled or
+// the interface is created.  IGMPv1/v2/v3 and MLDv1/v2 reports add the receiving
+// interface to the bridge's group table; leaves and timeouts remove it.  Queries
+// elect the querier of each bridge and, with PIM hellos, mark multicast router
+// ports.  Snooping does not forward frames: hooks registered with
+// RegisterGroupHook are called with the interfaces group traffic is constrained
+// to, members and multicast router ports, when they change so that bridges
+// forwarding in hardware can be programmed.  Membership is per group: IGMPv3 and
+// MLDv2 source lists are not tracked.
+package snoop
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+)
+
+var packageIndex uint
+
+// GroupHook is called when interfaces traffic for group is sent to change.  Nil sis
+// means traffic for group is no longer constrained.
+type GroupHook func(bd Bridge, group net.IP, sis []vnet.Si)
+
+type groupChange struct {
+	bd    Bridge
+	group ip.Address
+	sis   []vnet.Si
+}
+
+type Main struct {
+	vnet.Package
+
+	mu      sync.Mutex
+	bridges map[Bridge]*bridge
+	// Configured bridge of member interfaces; others are looked up by port stag.
+	members map[vnet.Si]Bridge
+	// Interfaces with snoop feature enabled.
+	snooped map[vnet.Si]bool
+	Timers
+
+	// Scratch message for parsing.
+	msg message
+
+	groupHooks []GroupHook
+	changes    []groupChange
+
+	node     node
+	ageEvent ageEvent
+}
+
+func Init(v *vnet.Vnet) {
+	m := &Main{}
+	m.Timers = DefaultTimers
+	packageIndex = v.AddPackage("snoop", m)
+	m.DependsOn("ethernet")
+}
+
+func GetMain(v *vnet.Vnet) *Main { return v.GetPackage(packageIndex).(*Main) }
+
+// Configure parses e.g. snoop { query-interval 60 robustness 3 }
+func (m *Main) Configure(in *parse.Input) {
+	t := &m.Timers
+	for !in.End() {
+		switch {
+		case in.Parse("query-interval %f", &t.QueryInterval) && t.QueryInterval > 0:
+		case in.Parse("query-response-interval %f", &t.QueryResponseInterval) && t.QueryResponseInterval > 0:
+		case in.Parse("last-member-query-interval %f", &t.LastMemberQueryInterval) && t.LastMemberQueryInterval > 0:
+		case in.Parse("robustness %d", &t.Robustness) && t.Robustness > 0:
+		default:
+			in.ParseError()
+		}
+	}
+}
+
+// Interval in seconds between aging scans.
+const ageInterval = 1
+
+type ageEvent struct {
+	vnet.Event
+	m *Main
+}
+
+func (e *ageEvent) String() string { return "snoop group aging" }
+func (e *ageEvent) EventAction() {
+	e.m.age(cpu.TimeNow())
+	e.SignalEventAfter(e, ageInterval)
+}
+
+func (m *Main) Init() (err error) {
+	v := m.Vnet
+	m.node.init(v, m)
+	v.RegisterSwIfAddDelHook(m.swIfAddDel)
+	m.ageEvent.m = m
+	v.SignalEventAfter(&m.ageEvent, ageInterval)
+	m.cliInit()
+	return
+}
+
+// RegisterGroupHook registers function called when interfaces of a group change.
+func (m *Main) RegisterGroupHook(h GroupHook) {
+	m.mu.Lock()
+	m.groupHooks = append(m.groupHooks, h)
+	m.mu.Unlock()
+}
+
+// Enable enables snooping on bridge or, when already enabled, updates configuration.
+func (m *Main) Enable(bd Bridge, c *BridgeConfig) {
+	m.mu.Lock()
+	if b, ok := m.bridges[bd]; ok {
+		b.BridgeConfig = *c
+		m.changedAll(bd, b)
+	} else {
+		if m.bridges == nil {
+			m.bridges = make(map[Bridge]*bridge)
+		}
+		m.bridges[bd] = newBridge(c)
+		m.setFeatures()
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+// Disable disables snooping on bridge and forgets its groups.
+func (m *Main) Disable(bd Bridge) (err error) {
+	m.mu.Lock()
+	b, ok := m.bridges[bd]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("bridge %d: snooping not enabled", bd)
+	}
+	for a := range b.groups {
+		m.changes = append(m.changes, groupChange{bd: bd, group: a})
+	}
+	delete(m.bridges, bd)
+	m.setFeatures()
+	m.mu.Unlock()
+	m.notify()
+	return
+}
+
+// Config returns configuration of bridge with snooping enabled.
+func (m *Main) Config(bd Bridge) (c BridgeConfig, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b *bridge
+	if b, ok = m.bridges[bd]; ok {
+		c = b.BridgeConfig
+		c.Mrouters = append([]vnet.Si(nil), c.Mrouters...)
+	}
+	return
+}
+
+// SetMember sets bridge of member interface overriding bridge of port's stag.
+func (m *Main) SetMember(si vnet.Si, bd Bridge, isDel bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if isDel {
+		delete(m.members, si)
+	} else {
+		if m.members == nil {
+			m.members = make(map[vnet.Si]Bridge)
+		}
+		m.members[si] = bd
+	}
+	m.setFeatures()
+}
+
+// Enable snoop feature on members of bridges with snooping enabled and disable it on all
+// other interfaces.  Called with lock held.
+func (m *Main) setFeatures() {
+	want := make(map[vnet.Si]bool)
+	for si, bd := range m.members {
+		if m.bridges[bd] != nil {
+			want[si] = true
+		}
+	}
+	vnet.Ports.ForeachSiByIndex(func(ifindex int32, si vnet.Si) {
+		if _, ok := m.members[si]; ok {
+			return
+		}
+		if pe, found := vnet.Ports.GetPortByIndex(ifindex); found && pe.Stag != 0 && m.bridges[Bridge(pe.Stag)] != nil {
+			want[si] = true
+		}
+	})
+	n := &m.node
+	for si := range m.snooped {
+		if !want[si] {
+			n.arc.Enable(si, n.feature, false)
+		}
+	}
+	for si := range want {
+		n.arc.Enable(si, n.feature, true)
+	}
+	m.snooped = want
+}
+
+// Bridge of member interface: configured or from bridge stag of port.
+// Called with lock held.
+func (m *Main) bridgeForSi(si vnet.Si) (bd Bridge, ok bool) {
+	if bd, ok = m.members[si]; ok {
+		return
+	}
+	vnet.Ports.ForeachSiByIndex(func(ifindex int32, x vnet.Si) {
+		if x != si || ok {
+			return
+		}
+		if pe, found := vnet.Ports.GetPortByIndex(ifindex); found && pe.Stag != 0 {
+			bd, ok = Bridge(pe.Stag), true
+		}
+	})
+	return
+}
+
+// Queue changes for all groups of bridge.  Called with lock held.
+func (m *Main) changedAll(bd Bridge, b *bridge) {
+	for a := range b.groups {
+		m.changed(bd, b, a)
+	}
+}
+
+func (m *Main) changed(bd Bridge, b *bridge, a ip.Address) {
+	if len(m.groupHooks) == 0 {
+		return
+	}
+	c := groupChange{bd: bd, group: a}
+	if _, ok := b.groups[a]; ok {
+		c.sis = b.groupSis(a)
+	}
+	m.changes = append(m.changes, c)
+}
+
+// Call group hooks for queued changes.  Called without lock so hooks may call back.
+func (m *Main) notify() {
+	m.mu.Lock()
+	cs, hs := m.changes, m.groupHooks
+	m.changes = nil
+	m.mu.Unlock()
+	for i := range cs {
+		c := &cs[i]
+		for _, h := range hs {
+			h(c.bd, net.IP(c.group[:]), c.sis)
+		}
+	}
+}
+
+// Input snoops frame received on given interface.
+func (m *Main) input(si vnet.Si, b []byte, now cpu.Time) {
+	m.mu.Lock()
+	msg := &m.msg
+	if len(m.bridges) == 0 || !msg.parse(b) {
+		m.mu.Unlock()
+		return
+	}
+	bd, ok := m.bridgeForSi(si)
+	br := m.bridges[bd]
+	if !ok || br == nil {
+		m.mu.Unlock()
+		return
+	}
+	t := &m.Timers
+	switch msg.typ {
+	case msgQuery:
+		br.counters[counterQuery]++
+		if br.query(msg, si, now, t) {
+			m.changedAll(bd, br)
+		}
+	case msgMrouter:
+		br.counters[counterMrouter]++
+		if br.mrouter(si, now, t) {
+			m.changedAll(bd, br)
+		}
+	case msgReport:
+		for i := range msg.records {
+			r := &msg.records[i]
+			if isFlooded(net.IP(r.group[:])) {
+				continue
+			}
+			var changed bool
+			if r.join {
+				br.counters[counterReport]++
+				changed = br.join(r.group, si, after(now, t.membership()))
+			} else {
+				br.counters[counterLeave]++
+				changed = br.leave(r.group, si, after(now, t.lastMember()))
+			}
+			if changed {
+				m.changed(bd, br, r.group)
+			}
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+func (m *Main) age(now cpu.Time) {
+	m.mu.Lock()
+	for bd, b := range m.bridges {
+		gs, all := b.age(now)
+		if all {
+			m.changedAll(bd, b)
+		}
+		for _, a := range gs {
+			m.changed(bd, b, a)
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+func (m *Main) swIfAddDel(v *vnet.Vnet, si vnet.Si, isDel bool) (err error) {
+	m.mu.Lock()
+	if !isDel {
+		m.setFeatures()
+		m.mu.Unlock()
+		return
+	}
+	delete(m.members, si)
+	if m.snooped[si] {
+		m.node.arc.Enable(si, m.node.feature, false)
+		delete(m.snooped, si)
+	}
+	for bd, b := range m.bridges {
+		gs, all := b.delSi(si)
+		if all {
+			m.changedAll(bd, b)
+		}
+		for _, a := range gs {
+			m.changed(bd, b, a)
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+	return
+}
+
+// Clear flushes learned groups, queriers and multicast router ports of bridge or, with
+// all set, of all bridges.
+func (m *Main) Clear(bd Bridge, all bool) {
+	m.mu.Lock()
+	for x, b := range m.bridges {
+		if all || x == bd {
+			for a := range b.groups {
+				m.changes = append(m.changes, groupChange{bd: x, group: a})
+			}
+			b.clear()
+		}
+	}
+	m.mu.Unlock()
+	m.notify()
+}
+
+func (m *Main) sortedBridges() (bds []Bridge) {
+	for bd := range m.bridges {
+		bds = append(bds, bd)
+	}
+	sort.Slice(bds, func(i, j int) bool { return bds[i] < bds[j] })
+	return
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snoop
+
+import (
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+
+	"net"
+)
+
+type msgType uint8
+
+const (
+	msgNone msgType = iota
+	// IGMP or MLD membership query.
+	msgQuery
+	// Membership reports and leaves.
+	msgReport
+	// PIM hello identifying a multicast router.
+	msgMrouter
+)
+
+type record struct {
+	group ip.Address
+	join  bool
+}
+
+// Snooped IGMP, MLD or PIM message.
+type message struct {
+	typ msgType
+	is6 bool
+	// IGMP version 1, 2 or 3; MLD version 1 or 2.
+	version uint8
+	src     ip.Address
+	// Query group; zero for general queries.
+	group   ip.Address
+	records []record
+}
+
+const (
+	igmpQuery    = 0x11
+	igmpV1Report = 0x12
+	igmpV2Report = 0x16
+	igmpLeave    = 0x17
+	igmpV3Report = 0x22
+
+	mldQuery    = 130
+	mldV1Report = 131
+	mldDone     = 132
+	mldV2Report = 143
+
+	pimHello = 0
+)
+
+// IGMPv3/MLDv2 group record types.
+const (
+	modeIsInclude = 1 + iota
+	modeIsExclude
+	changeToInclude
+	changeToExclude
+	allowNewSources
+	blockOldSources
+)
+
+var (
+	// Destination of PIM hellos: ALL-PIM-ROUTERS.
+	allPimRouters4 = net.IPv4(224, 0, 0, 13)
+	allPimRouters6 = net.ParseIP("ff02::d")
+)
+
+func be16(b []byte) uint { return uint(b[0])<<8 | uint(b[1]) }
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func toAddress(b []byte) (a ip.Address) {
+	if !isZero(b) {
+		copy(a[:], net.IP(b).To16())
+	}
+	return
+}
+
+// Join or leave for v3/v2 group record.  Block records do not change membership.
+func (m *message) addRecord(t uint, nSources uint, group []byte) {
+	switch t {
+	case modeIsInclude, changeToInclude:
+		// Include of no sources is a leave.
+		m.records = append(m.records, record{group: toAddress(group), join: nSources > 0})
+	case modeIsExclude, changeToExclude, allowNewSources:
+		m.records = append(m.records, record{group: toAddress(group), join: true})
+	}
+}
+
+// Parse ethernet frame; returns false for frames which are not IGMP, MLD or PIM hellos.
+func (m *message) parse(b []byte) (ok bool) {
+	m.typ = msgNone
+	m.records = m.records[:0]
+	if len(b) < ethernet.SizeofHeader {
+		return
+	}
+	t := ethernet.Type(be16(b[12:]))
+	b = b[ethernet.SizeofHeader:]
+	for t == ethernet.TYPE_VLAN || t == ethernet.TYPE_VLAN_802_1AD {
+		if len(b) < ethernet.SizeofVlanHeader {
+			return
+		}
+		t = ethernet.Type(be16(b[2:]))
+		b = b[ethernet.SizeofVlanHeader:]
+	}
+	switch t {
+	case ethernet.TYPE_IP4:
+		ok = m.parseIp4(b)
+	case ethernet.TYPE_IP6:
+		ok = m.parseIp6(b)
+	}
+	return ok && m.typ != msgNone
+}
+
+func (m *message) parseIp4(b []byte) (ok bool) {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return
+	}
+	l := int(b[0]&0xf) * 4
+	if l < 20 || len(b) < l {
+		return
+	}
+	m.is6 = false
+	m.src = toAddress(b[12:16])
+	dst := b[16:20]
+	p := b[l:]
+	switch ip.Protocol(b[9]) {
+	case ip.IGMP:
+		return m.parseIgmp(p)
+	case ip.PIM:
+		if len(p) >= 4 && p[0]&0xf == pimHello && net.IP(dst).Equal(allPimRouters4) {
+			m.typ = msgMrouter
+			ok = true
+		}
+	}
+	return
+}
+
+func (m *message) parseIgmp(p []byte) (ok bool) {
+	if len(p) < 8 {
+		return
+	}
+	switch p[0] {
+	case igmpQuery:
+		m.typ = msgQuery
+		m.group = toAddress(p[4:8])
+		switch {
+		case len(p) >= 12:
+			m.version = 3
+		case p[1] == 0:
+			m.version = 1
+		default:
+			m.version = 2
+		}
+	case igmpV1Report, igmpV2Report:
+		m.typ = msgReport
+		m.version = 2
+		if p[0] == igmpV1Report {
+			m.version = 1
+		}
+		m.records = append(m.records, record{group: toAddress(p[4:8]), join: true})
+	case igmpLeave:
+		m.typ = msgReport
+		m.version = 2
+		m.records = append(m.records, record{group: toAddress(p[4:8])})
+	case igmpV3Report:
+		m.typ = msgReport
+		m.version = 3
+		n := be16(p[6:])
+		p = p[8:]
+		for i := uint(0); i < n; i++ {
+			if len(p) < 8 {
+				return
+			}
+			nSources := be16(p[2:])
+			l := 8 + 4*nSources + 4*uint(p[1])
+			if uint(len(p)) < l {
+				return
+			}
+			m.addRecord(uint(p[0]), nSources, p[4:8])
+			p = p[l:]
+		}
+	default:
+		return
+	}
+	ok = true
+	return
+}
+
+func (m *message) parseIp6(b []byte) (ok bool) {
+	if len(b) < 40 || b[0]>>4 != 6 {
+		return
+	}
+	m.is6 = true
+	m.src = toAddress(b[8:24])
+	dst := b[24:40]
+	nh := ip.Protocol(b[6])
+	p := b[40:]
+	// MLD messages carry router alert in hop by hop options header.
+	if nh == ip.IP6_HOP_BY_HOP_OPTIONS {
+		if len(p) < 8 {
+			return
+		}
+		l := (int(p[1]) + 1) * 8
+		if len(p) < l {
+			return
+		}
+		nh = ip.Protocol(p[0])
+		p = p[l:]
+	}
+	switch nh {
+	case ip.ICMP6:
+		return m.parseMld(p)
+	case ip.PIM:
+		if len(p) >= 4 && p[0]&0xf == pimHello && net.IP(dst).Equal(allPimRouters6) {
+			m.typ = msgMrouter
+			ok = true
+		}
+	}
+	return
+}
+
+func (m *message) parseMld(p []byte) (ok bool) {
+	if len(p) < 8 {
+		return
+	}
+	switch p[0] {
+	case mldQuery:
+		if len(p) < 24 {
+			return
+		}
+		m.typ = msgQuery
+		m.group = toAddress(p[8:24])
+		m.version = 1
+		if len(p) >= 28 {
+			m.version = 2
+		}
+	case mldV1Report, mldDone:
+		if len(p) < 24 {
+			return
+		}
+		m.typ = msgReport
+		m.version = 1
+		m.records = append(m.records, record{group: toAddress(p[8:24]), join: p[0] == mldV1Report})
+	case mldV2Report:
+		m.typ = msgReport
+		m.version = 2
+		n := be16(p[6:])
+		p = p[8:]
+		for i := uint(0); i < n; i++ {
+			if len(p) < 20 {
+				return
+			}
+			nSources := be16(p[2:])
+			l := 20 + 16*nSources + 4*uint(p[1])
+			if uint(len(p)) < l {
+				return
+			}
+			m.addRecord(uint(p[0]), nSources, p[4:20])
+			p = p[l:]
+		}
+	default:
+		return
+	}
+	ok = true
+	return
+}
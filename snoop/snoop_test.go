@@ -0,0 +1,226 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snoop
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/pg"
+
+	"net"
+	"reflect"
+	"testing"
+)
+
+func newMain(t *testing.T) *Main {
+	v := &vnet.Vnet{}
+	pg.Init(v)
+	ethernet.Init(v, ip4.Init(v), ip6.Init(v))
+	Init(v)
+	if err := ethernet.GetMain(v).Init(); err != nil {
+		t.Fatal(err)
+	}
+	m := GetMain(v)
+	m.node.init(v, m)
+	return m
+}
+
+// Interfaces traffic for group is constrained to.
+func groupSis(m *Main, bd Bridge, group string) []vnet.Si {
+	var a ip.Address
+	copy(a[:], net.ParseIP(group))
+	return m.bridges[bd].groupSis(a)
+}
+
+func seconds(s float64) (t cpu.Time) {
+	t.Cycles(s)
+	return
+}
+
+// Ethernet frame with ip4 header and given igmp/pim payload.
+func ip4Frame(src, dst string, proto ip.Protocol, payload []byte) []byte {
+	b := make([]byte, 14+24+len(payload))
+	b[12], b[13] = 0x08, 0x00
+	h := b[14:]
+	// 24 byte header with router alert option.
+	h[0], h[8], h[9] = 0x46, 1, byte(proto)
+	copy(h[12:], net.ParseIP(src).To4())
+	copy(h[16:], net.ParseIP(dst).To4())
+	h[20], h[21] = 0x94, 4
+	copy(h[24:], payload)
+	return b
+}
+
+func igmp(t byte, maxResp byte, group string) []byte {
+	p := []byte{t, maxResp, 0, 0, 0, 0, 0, 0}
+	copy(p[4:], net.ParseIP(group).To4())
+	return p
+}
+
+// Ethernet frame with ip6 header, hop by hop options and mld payload.
+func mldFrame(src, dst string, payload []byte) []byte {
+	b := make([]byte, 14+40+8+len(payload))
+	b[12], b[13] = 0x86, 0xdd
+	h := b[14:]
+	h[0], h[6], h[7] = 0x60, byte(ip.IP6_HOP_BY_HOP_OPTIONS), 1
+	copy(h[8:], net.ParseIP(src))
+	copy(h[24:], net.ParseIP(dst))
+	o := h[40:]
+	o[0] = byte(ip.ICMP6)
+	copy(o[8:], payload)
+	return b
+}
+
+func TestParse(t *testing.T) {
+	var m message
+	if !m.parse(ip4Frame("10.0.0.2", "239.1.1.1", ip.IGMP, igmp(igmpV2Report, 0, "239.1.1.1"))) {
+		t.Fatal("v2 report not parsed")
+	}
+	g := toAddress(net.ParseIP("239.1.1.1").To4())
+	if m.typ != msgReport || m.version != 2 || !reflect.DeepEqual(m.records, []record{{group: g, join: true}}) {
+		t.Errorf("v2 report %+v", m)
+	}
+
+	// v3 report: join 239.1.1.1 (exclude none), leave 239.2.2.2 (include none), block ignored.
+	r := []byte{igmpV3Report, 0, 0, 0, 0, 0, 0, 3,
+		changeToExclude, 0, 0, 0, 239, 1, 1, 1,
+		changeToInclude, 0, 0, 0, 239, 2, 2, 2,
+		blockOldSources, 0, 0, 1, 239, 3, 3, 3, 10, 0, 0, 1,
+	}
+	if !m.parse(ip4Frame("10.0.0.2", "224.0.0.22", ip.IGMP, r)) {
+		t.Fatal("v3 report not parsed")
+	}
+	want := []record{{group: g, join: true}, {group: toAddress([]byte{239, 2, 2, 2})}}
+	if m.version != 3 || !reflect.DeepEqual(m.records, want) {
+		t.Errorf("v3 report %+v", m.records)
+	}
+
+	if !m.parse(ip4Frame("10.0.0.1", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0"))) {
+		t.Fatal("query not parsed")
+	}
+	if m.typ != msgQuery || m.version != 2 || m.group != (ip.Address{}) {
+		t.Errorf("general query %+v", m)
+	}
+
+	if !m.parse(ip4Frame("10.0.0.1", "224.0.0.13", ip.PIM, []byte{0x20, 0, 0, 0})) || m.typ != msgMrouter {
+		t.Errorf("pim hello %+v", m)
+	}
+
+	p := make([]byte, 24)
+	p[0] = mldV1Report
+	copy(p[8:], net.ParseIP("ff0e::1234"))
+	if !m.parse(mldFrame("fe80::2", "ff0e::1234", p)) {
+		t.Fatal("mld report not parsed")
+	}
+	if !m.is6 || m.typ != msgReport || m.records[0].group != toAddress(net.ParseIP("ff0e::1234")) || !m.records[0].join {
+		t.Errorf("mld report %+v", m)
+	}
+
+	if m.parse(ip4Frame("10.0.0.2", "10.0.0.3", ip.UDP, make([]byte, 8))) {
+		t.Errorf("udp parsed as %+v", m)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	m := newMain(t)
+	const bd = Bridge(100)
+	m.Enable(bd, &BridgeConfig{})
+	m.SetMember(1, bd, false)
+	m.SetMember(2, bd, false)
+	m.SetMember(3, bd, false)
+	for si := vnet.Si(1); si <= 3; si++ {
+		if !m.node.arc.IsEnabled(si, m.node.feature) {
+			t.Errorf("l2-snoop not enabled on member %d", si)
+		}
+	}
+
+	var hookSis []vnet.Si
+	m.RegisterGroupHook(func(b Bridge, g net.IP, sis []vnet.Si) { hookSis = sis })
+
+	const group = "239.1.1.1"
+	now := seconds(1000)
+	m.input(1, ip4Frame("10.0.0.1", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0")), now)
+	m.input(2, ip4Frame("10.0.0.2", "239.1.1.1", ip.IGMP, igmp(igmpV2Report, 0, "239.1.1.1")), now)
+
+	// Group traffic goes to member and querier's mrouter port.
+	if sis := groupSis(m, bd, group); !reflect.DeepEqual(sis, []vnet.Si{1, 2}) {
+		t.Errorf("group %v", sis)
+	}
+	if !reflect.DeepEqual(hookSis, []vnet.Si{1, 2}) {
+		t.Errorf("hook %v", hookSis)
+	}
+	// Unknown groups only go to mrouter ports; link local groups are not learned.
+	if sis := groupSis(m, bd, "239.9.9.9"); !reflect.DeepEqual(sis, []vnet.Si{1}) {
+		t.Errorf("unknown group %v", sis)
+	}
+	m.input(3, ip4Frame("10.0.0.3", "224.0.0.5", ip.IGMP, igmp(igmpV2Report, 0, "224.0.0.5")), now)
+	if n := len(m.bridges[bd].groups); n != 1 {
+		t.Errorf("%d groups after link local report", n)
+	}
+
+	// Leave shortens membership to last member query time.
+	m.input(2, ip4Frame("10.0.0.2", "224.0.0.2", ip.IGMP, igmp(igmpLeave, 0, "239.1.1.1")), now)
+	m.age(now + seconds(1))
+	if sis := groupSis(m, bd, group); len(sis) != 2 {
+		t.Errorf("member removed before last member query time: %v", sis)
+	}
+	m.age(now + seconds(3))
+	if sis := groupSis(m, bd, group); !reflect.DeepEqual(sis, []vnet.Si{1}) {
+		t.Errorf("member not removed after leave: %v", sis)
+	}
+	if !reflect.DeepEqual(hookSis, []vnet.Si(nil)) {
+		t.Errorf("hook after leave %v", hookSis)
+	}
+
+	// Membership and mrouter ports time out.
+	m.input(3, ip4Frame("10.0.0.3", "239.1.1.1", ip.IGMP, igmp(igmpV2Report, 0, "239.1.1.1")), now)
+	m.age(now + seconds(m.membership()+1))
+	if sis := groupSis(m, bd, group); len(sis) != 0 {
+		t.Errorf("after timeout %v", sis)
+	}
+
+	// Disabling snooping disables feature on members.
+	if err := m.Disable(bd); err != nil {
+		t.Fatal(err)
+	}
+	if m.node.arc.Active() {
+		t.Error("l2-snoop enabled after disable")
+	}
+}
+
+func TestQuerierElection(t *testing.T) {
+	m := newMain(t)
+	const bd = Bridge(7)
+	m.Enable(bd, &BridgeConfig{FastLeave: true})
+	m.SetMember(1, bd, false)
+	m.SetMember(2, bd, false)
+	b := m.bridges[bd]
+	now := seconds(10)
+
+	m.input(1, ip4Frame("10.0.0.9", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0")), now)
+	m.input(2, ip4Frame("10.0.0.3", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0")), now)
+	m.input(1, ip4Frame("10.0.0.9", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0")), now)
+	if q := &b.queriers[0]; q.si != 2 || !net.IP(q.src[:]).Equal(net.ParseIP("10.0.0.3")) {
+		t.Errorf("querier %s on %d", net.IP(q.src[:]), q.si)
+	}
+
+	// Higher address takes over when elected querier is gone.
+	later := now + seconds(m.otherQuerier()+1)
+	m.input(1, ip4Frame("10.0.0.9", "224.0.0.1", ip.IGMP, igmp(igmpQuery, 100, "0.0.0.0")), later)
+	if q := &b.queriers[0]; q.si != 1 {
+		t.Errorf("querier not replaced: %s on %d", net.IP(q.src[:]), q.si)
+	}
+
+	// Fast leave removes member at once.
+	m.input(2, ip4Frame("10.0.0.2", "239.1.1.1", ip.IGMP, igmp(igmpV2Report, 0, "239.1.1.1")), later)
+	m.input(2, ip4Frame("10.0.0.2", "224.0.0.2", ip.IGMP, igmp(igmpLeave, 0, "239.1.1.1")), later)
+	if len(b.groups) != 0 {
+		t.Errorf("groups after fast leave %v", b.groups)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snoop
+
+import (
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+
+	"bytes"
+	"net"
+	"sort"
+)
+
+// Bridge domain identified by bridge stag.
+type Bridge uint16
+
+type BridgeConfig struct {
+	// Remove interface from group as soon as leave is received instead of
+	// waiting for last member query time.
+	FastLeave bool
+	// Interfaces always treated as multicast router ports.
+	Mrouters []vnet.Si
+}
+
+// Protocol timers in seconds (RFC 3376 section 8).
+type Timers struct {
+	QueryInterval           float64
+	QueryResponseInterval   float64
+	LastMemberQueryInterval float64
+	Robustness              uint
+}
+
+var DefaultTimers = Timers{
+	QueryInterval:           125,
+	QueryResponseInterval:   10,
+	LastMemberQueryInterval: 1,
+	Robustness:              2,
+}
+
+// Time after last report when a member is removed.
+func (t *Timers) membership() float64 {
+	return float64(t.Robustness)*t.QueryInterval + t.QueryResponseInterval
+}
+
+// Time after last query when querier is considered gone.
+func (t *Timers) otherQuerier() float64 {
+	return float64(t.Robustness)*t.QueryInterval + t.QueryResponseInterval/2
+}
+
+// Time after leave when a member is removed.
+func (t *Timers) lastMember() float64 {
+	return float64(t.Robustness) * t.LastMemberQueryInterval
+}
+
+func after(now cpu.Time, secs float64) cpu.Time {
+	var dt cpu.Time
+	dt.Cycles(secs)
+	return now + dt
+}
+
+// Members of group with time when membership expires.
+type group struct {
+	members map[vnet.Si]cpu.Time
+}
+
+type querier struct {
+	src     ip.Address
+	si      vnet.Si
+	version uint8
+	expires cpu.Time
+}
+
+const (
+	counterQuery = iota
+	counterReport
+	counterLeave
+	counterMrouter
+	nCounter
+)
+
+type bridge struct {
+	BridgeConfig
+	groups map[ip.Address]*group
+	// Dynamically learned multicast router ports with expire time.
+	mrouters map[vnet.Si]cpu.Time
+	// Elected querier indexed by ip4 (0) and ip6 (1).
+	queriers [2]querier
+	counters [nCounter]uint64
+}
+
+func newBridge(c *BridgeConfig) *bridge {
+	return &bridge{
+		BridgeConfig: *c,
+		groups:       make(map[ip.Address]*group),
+		mrouters:     make(map[vnet.Si]cpu.Time),
+	}
+}
+
+func family(is6 bool) int {
+	if is6 {
+		return 1
+	}
+	return 0
+}
+
+// Interfaces which get traffic for group: members and multicast router ports.
+func (b *bridge) groupSis(a ip.Address) (sis []vnet.Si) {
+	seen := make(map[vnet.Si]bool)
+	add := func(si vnet.Si) {
+		if !seen[si] {
+			seen[si] = true
+			sis = append(sis, si)
+		}
+	}
+	if g, ok := b.groups[a]; ok {
+		for si := range g.members {
+			add(si)
+		}
+	}
+	for si := range b.mrouters {
+		add(si)
+	}
+	for _, si := range b.Mrouters {
+		add(si)
+	}
+	sort.Slice(sis, func(i, j int) bool { return sis[i] < sis[j] })
+	return
+}
+
+func (b *bridge) join(a ip.Address, si vnet.Si, expires cpu.Time) (changed bool) {
+	g, ok := b.groups[a]
+	if !ok {
+		g = &group{members: make(map[vnet.Si]cpu.Time)}
+		b.groups[a] = g
+	}
+	_, ok = g.members[si]
+	g.members[si] = expires
+	return !ok
+}
+
+// Leave removes member at once or shortens membership to given time.
+func (b *bridge) leave(a ip.Address, si vnet.Si, expires cpu.Time) (changed bool) {
+	g, ok := b.groups[a]
+	if !ok {
+		return
+	}
+	t, ok := g.members[si]
+	if !ok {
+		return
+	}
+	if b.FastLeave {
+		b.delMember(a, g, si)
+		return true
+	}
+	if expires < t {
+		g.members[si] = expires
+	}
+	return
+}
+
+func (b *bridge) delMember(a ip.Address, g *group, si vnet.Si) {
+	delete(g.members, si)
+	if len(g.members) == 0 {
+		delete(b.groups, a)
+	}
+}
+
+// Query elects querier (lowest address wins) and marks receiving interface as multicast router port.
+// Returns true when multicast router ports change.
+func (b *bridge) query(msg *message, si vnet.Si, now cpu.Time, t *Timers) (changed bool) {
+	// Queries with unspecified source come from proxies, not routers.
+	if msg.src == (ip.Address{}) {
+		return
+	}
+	q := &b.queriers[family(msg.is6)]
+	if q.expires <= now || q.src == msg.src || bytes.Compare(msg.src[:], q.src[:]) < 0 {
+		*q = querier{
+			src:     msg.src,
+			si:      si,
+			version: msg.version,
+			expires: after(now, t.otherQuerier()),
+		}
+	}
+	// Group specific query: members must report within last member query time.
+	if msg.group != (ip.Address{}) {
+		if g, ok := b.groups[msg.group]; ok {
+			e := after(now, t.lastMember())
+			for x, old := range g.members {
+				if e < old {
+					g.members[x] = e
+				}
+			}
+		}
+	}
+	return b.mrouter(si, now, t)
+}
+
+func (b *bridge) mrouter(si vnet.Si, now cpu.Time, t *Timers) (changed bool) {
+	_, ok := b.mrouters[si]
+	b.mrouters[si] = after(now, t.membership())
+	return !ok
+}
+
+// Age expired members and multicast router ports.  Returns groups whose interfaces changed;
+// all is set when multicast router ports changed.
+func (b *bridge) age(now cpu.Time) (changed []ip.Address, all bool) {
+	for si, e := range b.mrouters {
+		if e <= now {
+			delete(b.mrouters, si)
+			all = true
+		}
+	}
+	for a, g := range b.groups {
+		n := len(g.members)
+		for si, e := range g.members {
+			if e <= now {
+				b.delMember(a, g, si)
+			}
+		}
+		if len(g.members) != n {
+			changed = append(changed, a)
+		}
+	}
+	return
+}
+
+// Remove interface from groups and multicast router ports.
+func (b *bridge) delSi(si vnet.Si) (changed []ip.Address, all bool) {
+	if _, ok := b.mrouters[si]; ok {
+		delete(b.mrouters, si)
+		all = true
+	}
+	ms := b.Mrouters[:0:0]
+	for _, x := range b.Mrouters {
+		if x != si {
+			ms = append(ms, x)
+		}
+	}
+	all = all || len(ms) != len(b.Mrouters)
+	b.Mrouters = ms
+	for a, g := range b.groups {
+		if _, ok := g.members[si]; ok {
+			b.delMember(a, g, si)
+			changed = append(changed, a)
+		}
+	}
+	for i := range b.queriers {
+		if b.queriers[i].si == si {
+			b.queriers[i] = querier{}
+		}
+	}
+	return
+}
+
+// Flushes dynamic state.
+func (b *bridge) clear() {
+	b.groups = make(map[ip.Address]*group)
+	b.mrouters = make(map[vnet.Si]cpu.Time)
+	b.queriers = [2]querier{}
+	b.counters = [nCounter]uint64{}
+}
+
+// Link and interface local groups are always flooded.
+func isFlooded(a net.IP) bool {
+	return a.IsLinkLocalMulticast() || a.IsInterfaceLocalMulticast()
+}
@@ -14,6 +14,7 @@ package unix
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"sync"
 	"syscall"
@@ -1193,19 +1194,83 @@ type fdbBridgeIndex struct {
 // ctag=0 will be used for untagged member
 var fdbBrmToIndex = map[fdbBridgeMember]fdbBridgeIndex{}
 
+// Port entry for structured show ports output.
+type showPort struct {
+	Name         string   `json:"name" yaml:"name"`
+	Si           vnet.Si  `json:"si" yaml:"si"`
+	Net          uint64   `json:"net" yaml:"net"`
+	Ifindex      int32    `json:"ifindex" yaml:"ifindex"`
+	Iflinkindex  int32    `json:"iflinkindex" yaml:"iflinkindex"`
+	Flags        string   `json:"flags" yaml:"flags"`
+	Iff          string   `json:"iff" yaml:"iff"`
+	Speed        string   `json:"speed" yaml:"speed"`
+	Autoneg      uint8    `json:"autoneg" yaml:"autoneg"`
+	PortVid      uint16   `json:"port_vid" yaml:"port_vid"`
+	Stag         uint16   `json:"stag" yaml:"stag"`
+	Ctag         uint16   `json:"ctag" yaml:"ctag"`
+	Portindex    int16    `json:"portindex" yaml:"portindex"`
+	Subportindex int8     `json:"subportindex" yaml:"subportindex"`
+	PuntIndex    uint8    `json:"punt_index" yaml:"punt_index"`
+	Devtype      uint8    `json:"devtype" yaml:"devtype"`
+	StationAddr  string   `json:"station_addr,omitempty" yaml:"station_addr,omitempty"`
+	IPNets       []string `json:"ipnets,omitempty" yaml:"ipnets,omitempty"`
+}
+
+func newShowPort(si vnet.Si, pe *vnet.PortEntry) (x showPort) {
+	x = showPort{
+		Name:         pe.Ifname,
+		Si:           si,
+		Net:          pe.Net,
+		Ifindex:      pe.Ifindex,
+		Iflinkindex:  pe.Iflinkindex,
+		Flags:        pe.Flags.String(),
+		Iff:          pe.Iff.String(),
+		Speed:        pe.Speed.String(),
+		Autoneg:      pe.Autoneg,
+		PortVid:      pe.PortVid,
+		Stag:         pe.Stag,
+		Ctag:         pe.Ctag,
+		Portindex:    pe.Portindex,
+		Subportindex: pe.Subportindex,
+		PuntIndex:    pe.PuntIndex,
+		Devtype:      pe.Devtype,
+	}
+	if len(pe.StationAddr) > 0 {
+		x.StationAddr = pe.StationAddr.String()
+	}
+	for _, n := range pe.IPNets {
+		x.IPNets = append(x.IPNets, n.String())
+	}
+	return
+}
+
 func (m *FdbMain) fdbPortShow(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var format vnet.ShowFormat
 	show_linux := false
 
 	for !in.End() {
 		switch {
 		case in.Parse("l%*inux"):
 			show_linux = true
+		case in.Parse("f%*ormat %v", &format):
 		default:
 			err = cli.ParseError
 			return
 		}
 	}
 
+	if !format.IsText() {
+		ps := []showPort{}
+		vnet.Ports.Foreach(func(ifname string, pe *vnet.PortEntry) {
+			if !show_linux || pe.Devtype >= xeth.XETH_DEVTYPE_LINUX_UNKNOWN {
+				si, _ := vnet.Ports.GetSiByIndex(pe.Ifindex)
+				ps = append(ps, newShowPort(si, pe))
+			}
+		})
+		sort.Slice(ps, func(i, j int) bool { return ps[i].Name < ps[j].Name })
+		return format.Write(w, ps)
+	}
+
 	vnet.Ports.Foreach(func(ifname string, pe *vnet.PortEntry) {
 		if !show_linux || pe.Devtype >= xeth.XETH_DEVTYPE_LINUX_UNKNOWN {
 			si, _ := vnet.Ports.GetSiByIndex(pe.Ifindex)
@@ -285,6 +285,12 @@ type net_namespace struct {
 
 	interface_by_index map[uint32]*net_namespace_interface
 	interface_by_name  map[string]*net_namespace_interface
+
+	// Linux vrf interfaces indexed by ifindex and by route table.
+	vrf_by_ifindex map[uint32]*vrf_interface
+	vrf_by_table   map[uint32]*vrf_interface
+	// Vrf for interfaces enslaved to a vrf indexed by ifindex of enslaved interface.
+	vrf_by_member_ifindex map[uint32]*vrf_interface
 }
 
 //go:generate gentemplate -d Package=unix -id net_namespace -d PoolType=net_namespace_pool -d Type=*net_namespace -d Data=entries github.com/platinasystems/elib/pool.tmpl
@@ -1206,6 +1212,7 @@ func (ns *net_namespace) del(m *net_namespace_main) {
 		}
 		delete(ns.interface_by_index, index)
 	}
+	ns.delVrfs()
 
 	ns.m.namespace_pool.PutIndex(ns.index)
 	ns.m.namespace_pool.entries[ns.index] = nil
@@ -1225,6 +1232,7 @@ func (ns *net_namespace) delNs(m *net_namespace_main) {
 		}
 		delete(ns.interface_by_index, index)
 	}
+	ns.delVrfs()
 
 	ns.m.namespace_pool.PutIndex(ns.index)
 	ns.m.namespace_pool.entries[ns.index] = nil
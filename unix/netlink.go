@@ -175,6 +175,15 @@ func (ns *net_namespace) route_msg_for_vnet_interface(v *netlink.RouteMessage) (
 	return
 }
 
+// Multicast routes are for vnet when their input interface is known.
+// Outgoing interfaces not in vnet are ignored.
+func (ns *net_namespace) mroute_msg_for_vnet_interface(v *netlink.RouteMessage) (ok bool) {
+	if a := v.Attrs[netlink.RTA_IIF]; a != nil {
+		ok = ns.knownInterface(a.(netlink.Uint32Attr).Uint())
+	}
+	return
+}
+
 func (ns *net_namespace) msg_for_vnet_interface(msg netlink.Message) (ok bool) {
 	ok = true
 	switch v := msg.(type) {
@@ -187,6 +196,10 @@ func (ns *net_namespace) msg_for_vnet_interface(msg netlink.Message) (ok bool) {
 			_, ok = ns.getDummyInterface(v.Index)
 		}
 	case *netlink.RouteMessage:
+		if v.Family == netlink.RTNL_FAMILY_IPMR {
+			ok = ns.mroute_msg_for_vnet_interface(v)
+			break
+		}
 		var intf *net_namespace_interface
 		intf, ok = ns.route_msg_for_vnet_interface(v)
 
@@ -410,10 +423,11 @@ func (ns *net_namespace) fibInit(is_del bool) {
 	}
 }
 func (ns *net_namespace) validateFibIndexForSi(si vnet.Si) {
-	m4 := ip4.GetMain(ns.m.m.v)
 	fi := ns.fibIndexForNamespace()
-
-	m4.SetFibIndexForSi(si, fi)
+	if intf, ok := ns.m.interface_by_si[si]; ok {
+		fi = ns.fibIndexForIfIndex(intf.ifindex)
+	}
+	setFibIndexForSi(ns.m.m.v, si, fi)
 	return
 }
 
@@ -435,6 +449,9 @@ func (e *netlinkEvent) EventAction() {
 					continue
 				}
 			}
+			if err := e.ns.vrfIfInfoMsg(v); err != nil {
+				m.v.Logf("namespace %s, vrf %s: %v\n", e.ns, v.Attrs[netlink.IFLA_IFNAME].String(), err)
+			}
 		}
 
 		if !e.ns.msg_for_vnet_interface(msg) {
@@ -493,6 +510,9 @@ func (e *netlinkEvent) EventAction() {
 				case netlink.AF_INET6:
 					known = true
 					err = e.ip6RouteMsg(v, isLastInEvent)
+				case netlink.RTNL_FAMILY_IPMR:
+					known = true
+					err = e.ip4MrouteMsg(v)
 				}
 			}
 		case *netlink.NeighborMessage:
@@ -577,7 +597,7 @@ func (e *netlinkEvent) ip4IfaddrMsg(v *netlink.IfAddrMessage) (err error) {
 	m4 := ip4.GetMain(e.m.v)
 	isDel := v.Header.Type == netlink.RTM_DELADDR
 	if di, ok := e.ns.getDummyInterface(v.Index); ok {
-		fi := e.ns.fibIndexForNamespace()
+		fi := e.ns.fibIndexForIfIndex(v.Index)
 		if di.isAdminUp || isDel {
 			m4.AddDelRoute(&q, fi, ip.AdjPunt, isDel)
 		}
@@ -702,9 +722,10 @@ func (e *netlinkEvent) ip4RouteMsg(v *netlink.RouteMessage, isLastInEvent bool)
 	if v.RouteType != netlink.RTN_UNICAST {
 		return
 	}
-	// No linux VRF support.  Only main table is meaningful.
-	if v.Table != netlink.RT_TABLE_MAIN {
-		e.m.v.Logf("netlink ignore route with table not main: %s\n", v)
+	// Only main table and route tables of vrf interfaces are meaningful.
+	fi, ok := e.ns.fibIndexForRouteTable(v)
+	if !ok {
+		e.m.v.Logf("netlink ignore route with table not main or vrf: %s\n", v)
 		return
 	}
 
@@ -741,9 +762,9 @@ func (e *netlinkEvent) ip4RouteMsg(v *netlink.RouteMessage, isLastInEvent bool)
 			as := nh.attrs[netlink.RTA_ENCAP].(*netlink.AttrArray)
 			switch encap_type {
 			case netlink.LWTUNNEL_ENCAP_IP:
-				err = e.ip4_in_ip4_route(&p, as, intf, isDel)
+				err = e.ip4_in_ip4_route(&p, fi, as, intf, isDel)
 			case netlink.LWTUNNEL_ENCAP_IP6:
-				err = e.ip4_in_ip6_route(&p, as, intf, isDel)
+				err = e.ip4_in_ip6_route(&p, fi, as, intf, isDel)
 			}
 			if err != nil {
 				return
@@ -755,7 +776,9 @@ func (e *netlinkEvent) ip4RouteMsg(v *netlink.RouteMessage, isLastInEvent bool)
 		gw := nh.attrs[netlink.RTA_GATEWAY]
 		if gw != nil {
 			fmt.Printf("RouteMsg for Prefix %v adding nexthop %v\n", p, gw)
-			if err = m4.AddDelRouteNextHop(&p, &nh.NextHop, isDel, isReplace); err != nil {
+			nhs := ip.NextHopVec{{Address: nh.Address, Si: nh.Si}}
+			nhs[0].Weight = nh.Weight
+			if err = m4.AddDelRouteNextHops(fi, &p, nhs, isDel, isReplace); err != nil {
 				return
 			}
 		}
@@ -765,7 +788,46 @@ func (e *netlinkEvent) ip4RouteMsg(v *netlink.RouteMessage, isLastInEvent bool)
 	return
 }
 
-func (e *netlinkEvent) ip4_in_ip4_route(p *net.IPNet, as *netlink.AttrArray, intf *net_namespace_interface, isDel bool) (err error) {
+// Mirror linux multicast routes (RTNL_FAMILY_IPMR) into ip4 multicast fib.
+func (e *netlinkEvent) ip4MrouteMsg(v *netlink.RouteMessage) (err error) {
+	if v.RouteType != netlink.RTN_MULTICAST {
+		return
+	}
+	isDel := v.Header.Type == netlink.RTM_DELROUTE
+	// Ignore routes of tables not mapped to a fib.
+	fi, ok := e.ns.fibIndexForMrouteTable(v)
+	if !ok {
+		return
+	}
+	src := ip4Address(v.Attrs[netlink.RTA_SRC])
+	grp := ip4Address(v.Attrs[netlink.RTA_DST])
+
+	rpf := vnet.SiNil
+	if a := v.Attrs[netlink.RTA_IIF]; a != nil {
+		if rpf, ok = e.ns.siForIfIndex(a.(netlink.Uint32Attr).Uint()); !ok {
+			return
+		}
+	}
+	var oifs []vnet.Si
+	if a := v.Attrs[netlink.RTA_MULTIPATH]; a != nil {
+		mp := a.(*netlink.RtaMultipath)
+		for i := range mp.NextHops {
+			if si, ok := e.ns.siForIfIndex(mp.NextHops[i].Ifindex); ok {
+				oifs = append(oifs, si)
+			}
+		}
+	}
+
+	m4 := ip4.GetMain(e.m.v)
+	err = m4.AddDelMroute(fi, src, grp, rpf, oifs, isDel)
+	// Kernel may send deletes for routes never added (e.g. with unknown input interface).
+	if err == ip4.ErrMrouteNotFound {
+		err = nil
+	}
+	return
+}
+
+func (e *netlinkEvent) ip4_in_ip4_route(p *net.IPNet, fi ip.FibIndex, as *netlink.AttrArray, intf *net_namespace_interface, isDel bool) (err error) {
 	switch intf.kind {
 	case netlink.InterfaceKindIp4GRE, netlink.InterfaceKindIpip:
 	default:
@@ -817,14 +879,14 @@ func (e *netlinkEvent) ip4_in_ip4_route(p *net.IPNet, as *netlink.AttrArray, int
 
 	m4 := ip4.GetMain(e.m.v)
 
-	// By default lookup neighbor in FIB for namespace.
-	nbr.FibIndex = e.ns.fibIndexForNamespace()
+	// By default lookup neighbor in FIB of route.
+	nbr.FibIndex = fi
 	nbr.Weight = 1
-	err = m4.AddDelRouteNeighbor(p, &nbr, e.ns.fibIndexForNamespace(), isDel)
+	err = m4.AddDelRouteNeighbor(p, &nbr, fi, isDel)
 	return
 }
 
-func (e *netlinkEvent) ip4_in_ip6_route(p *net.IPNet, as *netlink.AttrArray, intf *net_namespace_interface, isDel bool) (err error) {
+func (e *netlinkEvent) ip4_in_ip6_route(p *net.IPNet, fi ip.FibIndex, as *netlink.AttrArray, intf *net_namespace_interface, isDel bool) (err error) {
 	panic("not yet")
 	return
 }
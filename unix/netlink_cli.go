@@ -11,6 +11,7 @@ import (
 
 	"github.com/platinasystems/elib"
 	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/vnet"
 	"github.com/platinasystems/vnet/ip"
 	"github.com/platinasystems/vnet/ip4"
 	"github.com/platinasystems/vnet/netlink"
@@ -145,9 +146,9 @@ func (m *netlink_main) enable_disable_log(c cli.Commander, w cli.Writer, in *cli
 }
 
 type showMsg struct {
-	Type    string `format:"%-30s"`
-	Ignored uint64 `format:"%16d"`
-	Handled uint64 `format:"%16d"`
+	Type    string `format:"%-30s" json:"type" yaml:"type"`
+	Ignored uint64 `format:"%16d" json:"ignored" yaml:"ignored"`
+	Handled uint64 `format:"%16d" json:"handled" yaml:"handled"`
 }
 type showMsgs []showMsg
 
@@ -156,6 +157,15 @@ func (ns showMsgs) Swap(i, j int)      { ns[i], ns[j] = ns[j], ns[i] }
 func (ns showMsgs) Len() int           { return len(ns) }
 
 func (m *netlink_main) show_summary(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var format vnet.ShowFormat
+	for !in.End() {
+		switch {
+		case in.Parse("f%*ormat %v", &format):
+		default:
+			err = cli.ParseError
+			return
+		}
+	}
 	sm := make(map[netlink.MsgType]showMsg)
 	var (
 		x  showMsg
@@ -193,6 +203,9 @@ func (m *netlink_main) show_summary(c cli.Commander, w cli.Writer, in *cli.Input
 		Handled: m.msg_stats.handled.total,
 	})
 
+	if !format.IsText() {
+		return format.Write(w, msgs)
+	}
 	elib.TabulateWrite(w, msgs)
 	return
 }
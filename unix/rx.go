@@ -132,6 +132,10 @@ func (n *rx_node) init(m *Main) {
 		rx_error_tun_not_ip4_or_ip6: "expected 4 or 6 for ip version",
 	}
 	v.RegisterInputNode(n, "unix-rx")
+	// Packets sent by linux out vnet interfaces pass output features before injection.
+	a := v.OutputFeatures()
+	a.AddStart(n)
+	a.SetEnd(m.RxInjectNodeName)
 	n.buffer_pool = vnet.DefaultBufferPool
 	v.AddBufferPool(n.buffer_pool)
 	n.pv_pool = make(chan *rx_packet_vector, 8*vnet.MaxVectorLen)
@@ -170,6 +174,7 @@ func SetRxInject(v *vnet.Vnet, inject_node_name string) {
 	m := GetMain(v)
 	n := &m.rx_node
 	n.next_for_inject = rx_node_next(v.AddNamedNext(n, inject_node_name))
+	v.OutputFeatures().SetEnd(inject_node_name)
 }
 
 type rx_node_next uint32
@@ -225,6 +230,11 @@ func (rv *rx_ref_vector) rx_packet(rx *rx_node, ns *net_namespace, pv *rx_packet
 		if n != rx_node_next_error && rx.next_for_inject != rx_node_next_error {
 			n = rx.next_for_inject
 		}
+		if n != rx_node_next_error {
+			if x, ok := rx.Vnet.OutputFeatures().First(si); ok {
+				n = rx_node_next(x)
+			}
+		}
 		rv.nexts[rvi] = n
 	} else {
 		ref.Si = vnet.SiNil
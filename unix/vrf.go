@@ -0,0 +1,222 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/netlink"
+
+	"fmt"
+	"net"
+)
+
+// Linux vrf (l3mdev) interface: a route table with its own fib.
+// Interfaces enslaved to the vrf interface use the vrf's fib instead of the fib of their namespace.
+type vrf_interface struct {
+	name     string
+	ifindex  uint32
+	table    uint32
+	fibIndex ip.FibIndex
+}
+
+// Fib name for vrf; vrfs outside of default namespace are qualified by namespace name.
+func (ns *net_namespace) vrfFibName(name string) string {
+	if ns.is_default {
+		return name
+	}
+	return ns.name + "/" + name
+}
+
+// Track vrf interfaces and their enslaved interfaces from netlink NEWLINK/DELLINK messages.
+func (ns *net_namespace) vrfIfInfoMsg(msg *netlink.IfInfoMessage) (err error) {
+	isDel := false
+	switch msg.Header.Type {
+	case netlink.RTM_NEWLINK:
+	case netlink.RTM_DELLINK:
+		isDel = true
+	default:
+		return
+	}
+	if _, ok := ns.vrf_by_ifindex[msg.Index]; ok && isDel {
+		ns.delVrf(msg.Index)
+		return
+	}
+	if msg.InterfaceKind() == netlink.InterfaceKindVrf {
+		if !isDel {
+			err = ns.addVrf(msg)
+		}
+		return
+	}
+	var x *vrf_interface
+	if a, ok := msg.Attrs[netlink.IFLA_MASTER].(netlink.Uint32Attr); ok && !isDel {
+		x = ns.vrf_by_ifindex[a.Uint()]
+	}
+	ns.setVrfForIfIndex(msg.Index, x)
+	return
+}
+
+func (ns *net_namespace) addVrf(msg *netlink.IfInfoMessage) (err error) {
+	name := msg.Attrs[netlink.IFLA_IFNAME].String()
+	table, ok := msg.VrfTable()
+	if !ok {
+		err = fmt.Errorf("vrf %s: no route table", name)
+		return
+	}
+	m4 := ip4.GetMain(ns.m.m.v)
+	m6 := ip6.GetMain(ns.m.m.v)
+	if x, exists := ns.vrf_by_ifindex[msg.Index]; exists {
+		// Route table of vrf never changes; only rename needs handling.
+		if x.name != name {
+			x.name = name
+			m4.SetFibNameForIndex(ns.vrfFibName(name), x.fibIndex)
+			m6.SetFibNameForIndex(ns.vrfFibName(name), x.fibIndex)
+		}
+		return
+	}
+	if x, exists := ns.vrf_by_table[table]; exists {
+		err = fmt.Errorf("vrf %s: table %d already used by vrf %s", name, table, x.name)
+		return
+	}
+	x := &vrf_interface{
+		name:    name,
+		ifindex: msg.Index,
+		table:   table,
+	}
+	// Vrf fib indices are allocated from namespace pool so that they never collide with namespace fib indices.
+	x.fibIndex = ip.FibIndex(ns.m.namespace_pool.GetIndex())
+	m4.SetFibNameForIndex(ns.vrfFibName(name), x.fibIndex)
+	m6.SetFibNameForIndex(ns.vrfFibName(name), x.fibIndex)
+	m4.SetFibIndexForId(ip.FibId(table), x.fibIndex)
+	m6.SetFibIndexForId(ip.FibId(table), x.fibIndex)
+	if ns.vrf_by_ifindex == nil {
+		ns.vrf_by_ifindex = make(map[uint32]*vrf_interface)
+		ns.vrf_by_table = make(map[uint32]*vrf_interface)
+	}
+	ns.vrf_by_ifindex[x.ifindex] = x
+	ns.vrf_by_table[x.table] = x
+	return
+}
+
+func (ns *net_namespace) delVrf(ifindex uint32) {
+	x := ns.vrf_by_ifindex[ifindex]
+	// Return enslaved interfaces to namespace fib.
+	for i, y := range ns.vrf_by_member_ifindex {
+		if y == x {
+			ns.setVrfForIfIndex(i, nil)
+		}
+	}
+	m4 := ip4.GetMain(ns.m.m.v)
+	m6 := ip6.GetMain(ns.m.m.v)
+	m4.FibReset(x.fibIndex)
+	m6.FibReset(x.fibIndex)
+	m4.SetFibNameForIndex("", x.fibIndex)
+	m6.SetFibNameForIndex("", x.fibIndex)
+	if fi, ok := m4.FibIndexForId(ip.FibId(x.table)); ok && fi == x.fibIndex {
+		m4.DelFibIndexForId(ip.FibId(x.table))
+	}
+	if fi, ok := m6.FibIndexForId(ip.FibId(x.table)); ok && fi == x.fibIndex {
+		m6.DelFibIndexForId(ip.FibId(x.table))
+	}
+	ns.m.namespace_pool.PutIndex(uint(x.fibIndex))
+	delete(ns.vrf_by_ifindex, x.ifindex)
+	delete(ns.vrf_by_table, x.table)
+}
+
+// Delete all vrfs when namespace is deleted.
+func (ns *net_namespace) delVrfs() {
+	// Interfaces of namespace are deleted along with namespace.
+	ns.vrf_by_member_ifindex = nil
+	for i := range ns.vrf_by_ifindex {
+		ns.delVrf(i)
+	}
+}
+
+// Set vrf of interface with given ifindex; nil vrf for interface not enslaved to a vrf.
+func (ns *net_namespace) setVrfForIfIndex(ifindex uint32, x *vrf_interface) {
+	if ns.vrf_by_member_ifindex[ifindex] == x {
+		return
+	}
+	if x == nil {
+		delete(ns.vrf_by_member_ifindex, ifindex)
+	} else {
+		if ns.vrf_by_member_ifindex == nil {
+			ns.vrf_by_member_ifindex = make(map[uint32]*vrf_interface)
+		}
+		ns.vrf_by_member_ifindex[ifindex] = x
+	}
+	if si, ok := ns.siForIfIndex(ifindex); ok {
+		ns.validateFibIndexForSi(si)
+	}
+}
+
+// Fib for interface: fib of vrf interface is enslaved to or otherwise namespace fib.
+func (ns *net_namespace) fibIndexForIfIndex(ifindex uint32) ip.FibIndex {
+	if x, ok := ns.vrf_by_member_ifindex[ifindex]; ok {
+		return x.fibIndex
+	}
+	return ns.fibIndexForNamespace()
+}
+
+// Fib for netlink route: namespace fib for main table or fib of vrf with route's table.
+func (ns *net_namespace) fibIndexForRouteTable(v *netlink.RouteMessage) (fi ip.FibIndex, ok bool) {
+	return ns.fibIndexForTable(v, netlink.RT_TABLE_MAIN)
+}
+
+// Fib for netlink multicast route: kernel keeps multicast routes of namespace in default table.
+func (ns *net_namespace) fibIndexForMrouteTable(v *netlink.RouteMessage) (fi ip.FibIndex, ok bool) {
+	return ns.fibIndexForTable(v, netlink.RT_TABLE_DEFAULT)
+}
+
+func (ns *net_namespace) fibIndexForTable(v *netlink.RouteMessage, nsTable netlink.RouteTableKind) (fi ip.FibIndex, ok bool) {
+	table := uint32(v.Table)
+	// Table ids above 255 are only given by RTA_TABLE.
+	if a, isTable := v.Attrs[netlink.RTA_TABLE].(netlink.Uint32Attr); isTable {
+		table = a.Uint()
+	}
+	if table == uint32(nsTable) {
+		return ns.fibIndexForNamespace(), true
+	}
+	if x, found := ns.vrf_by_table[table]; found {
+		return x.fibIndex, true
+	}
+	return
+}
+
+// Move interface to given fib.  Interface addresses are keyed by fib so addresses are
+// deleted from old fib and added to new fib; kernel keeps addresses when interface is enslaved.
+func setFibIndexForSi(v *vnet.Vnet, si vnet.Si, fi ip.FibIndex) {
+	m4 := ip4.GetMain(v)
+	m6 := ip6.GetMain(v)
+	var p4, p6 []net.IPNet
+	if m4.ValidateFibIndexForSi(si) != fi {
+		m4.ForeachIfAddress(si, func(ia ip.IfAddr, ifa *ip.IfAddress) (err error) {
+			p4 = append(p4, ifa.Prefix)
+			return
+		})
+		for i := range p4 {
+			m4.AddDelInterfaceAddress(si, &p4[i], true)
+		}
+	}
+	if m6.ValidateFibIndexForSi(si) != fi {
+		m6.ForeachIfAddress(si, func(ia ip.IfAddr, ifa *ip.IfAddress) (err error) {
+			p6 = append(p6, ifa.Prefix)
+			return
+		})
+		for i := range p6 {
+			m6.AddDelInterfaceAddress(si, &p6[i], true)
+		}
+	}
+	m4.SetFibIndexForSi(si, fi)
+	m6.SetFibIndexForSi(si, fi)
+	for i := range p4 {
+		m4.AddDelInterfaceAddress(si, &p4[i], false)
+	}
+	for i := range p6 {
+		m6.AddDelInterfaceAddress(si, &p6[i], false)
+	}
+}
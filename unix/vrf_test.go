@@ -0,0 +1,147 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package unix
+
+import (
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ip"
+	"github.com/platinasystems/vnet/ip4"
+	"github.com/platinasystems/vnet/ip6"
+	"github.com/platinasystems/vnet/netlink"
+
+	"net"
+	"testing"
+)
+
+func newTestNamespace() *net_namespace {
+	v := &vnet.Vnet{}
+	ip4.Init(v)
+	ip6.Init(v)
+	m := &Main{v: v}
+	nm := &m.net_namespace_main
+	nm.m = m
+	ns := &nm.default_namespace
+	ns.m = nm
+	ns.is_default = true
+	ns.index = nm.namespace_pool.GetIndex()
+	nm.namespace_pool.entries[ns.index] = ns
+	return ns
+}
+
+func vrfLinkMsg(t netlink.MsgType, index uint32, name string, table uint32) *netlink.IfInfoMessage {
+	msg := netlink.NewIfInfoMessage()
+	msg.Header.Type = t
+	msg.Index = index
+	msg.Attrs[netlink.IFLA_IFNAME] = netlink.StringAttr(name)
+	data := &netlink.AttrArray{}
+	data.X.Validate(uint(netlink.IFLA_VRF_MAX - 1))
+	data.X[netlink.IFLA_VRF_TABLE] = netlink.Uint32Attr(table)
+	li := &netlink.AttrArray{}
+	li.X.Validate(uint(netlink.IFLA_INFO_MAX - 1))
+	li.X[netlink.IFLA_INFO_KIND] = netlink.StringAttr("vrf")
+	li.X[netlink.IFLA_INFO_DATA] = data
+	msg.Attrs[netlink.IFLA_LINKINFO] = li
+	return msg
+}
+
+func memberLinkMsg(index, master uint32) *netlink.IfInfoMessage {
+	msg := netlink.NewIfInfoMessage()
+	msg.Header.Type = netlink.RTM_NEWLINK
+	msg.Index = index
+	msg.Attrs[netlink.IFLA_IFNAME] = netlink.StringAttr("eth0")
+	if master != 0 {
+		msg.Attrs[netlink.IFLA_MASTER] = netlink.Uint32Attr(master)
+	}
+	return msg
+}
+
+func TestVrfFib(t *testing.T) {
+	ns := newTestNamespace()
+	v := ns.m.m.v
+	m4, m6 := ip4.GetMain(v), ip6.GetMain(v)
+	nsFib := ns.fibIndexForNamespace()
+
+	if err := ns.vrfIfInfoMsg(vrfLinkMsg(netlink.RTM_NEWLINK, 10, "red", 1001)); err != nil {
+		t.Fatal(err)
+	}
+	x := ns.vrf_by_ifindex[10]
+	if x == nil || x.fibIndex == nsFib {
+		t.Fatalf("vrf %+v: no fib of its own", x)
+	}
+	fi := x.fibIndex
+	if got := m4.FibNameForIndex(fi); got != "red" {
+		t.Errorf("ip4 fib name %q, want red", got)
+	}
+	if got := m6.FibNameForIndex(fi); got != "red" {
+		t.Errorf("ip6 fib name %q, want red", got)
+	}
+	if got, ok := m4.FibIndexForId(1001); !ok || got != fi {
+		t.Errorf("ip4 fib for table 1001: %d %v, want %d", got, ok, fi)
+	}
+	if got, ok := m6.FibIndexForId(1001); !ok || got != fi {
+		t.Errorf("ip6 fib for table 1001: %d %v, want %d", got, ok, fi)
+	}
+
+	// Table of a vrf may not be used by another vrf.
+	if err := ns.vrfIfInfoMsg(vrfLinkMsg(netlink.RTM_NEWLINK, 11, "blue", 1001)); err == nil {
+		t.Error("second vrf with same table added")
+	}
+
+	// Enslaved interfaces use vrf fib; others use namespace fib.
+	ns.vrfIfInfoMsg(memberLinkMsg(20, 10))
+	ns.vrfIfInfoMsg(memberLinkMsg(21, 0))
+	if got := ns.fibIndexForIfIndex(20); got != fi {
+		t.Errorf("enslaved interface fib %d, want %d", got, fi)
+	}
+	if got := ns.fibIndexForIfIndex(21); got != nsFib {
+		t.Errorf("interface fib %d, want namespace fib %d", got, nsFib)
+	}
+
+	// Routes are mapped to fibs by table.
+	r := &netlink.RouteMessage{}
+	r.Table = netlink.RT_TABLE_MAIN
+	if got, ok := ns.fibIndexForRouteTable(r); !ok || got != nsFib {
+		t.Errorf("main table fib %d %v, want %d", got, ok, nsFib)
+	}
+	r.Attrs[netlink.RTA_TABLE] = netlink.Uint32Attr(1001)
+	if got, ok := ns.fibIndexForRouteTable(r); !ok || got != fi {
+		t.Errorf("table 1001 fib %d %v, want %d", got, ok, fi)
+	}
+	r.Attrs[netlink.RTA_TABLE] = netlink.Uint32Attr(1002)
+	if _, ok := ns.fibIndexForRouteTable(r); ok {
+		t.Error("fib for unknown table")
+	}
+
+	// Deleting vrf resets its fibs and returns members to namespace fib.
+	_, p, _ := net.ParseCIDR("2001:db8::/64")
+	m6.AddDelRoute(p, fi, ip.AdjPunt, false)
+	if _, _, ok := m6.Lookup(fi, net.ParseIP("2001:db8::1")); !ok {
+		t.Fatal("ip6 route not added to vrf fib")
+	}
+	ns.vrfIfInfoMsg(vrfLinkMsg(netlink.RTM_DELLINK, 10, "red", 1001))
+	if len(ns.vrf_by_ifindex) != 0 || len(ns.vrf_by_table) != 0 {
+		t.Error("vrf not deleted")
+	}
+	if _, ok := m4.FibIndexForId(1001); ok {
+		t.Error("ip4 fib for deleted vrf table")
+	}
+	if _, ok := m6.FibIndexForId(1001); ok {
+		t.Error("ip6 fib for deleted vrf table")
+	}
+	if _, _, ok := m6.Lookup(fi, net.ParseIP("2001:db8::1")); ok {
+		t.Error("ip6 route in fib of deleted vrf")
+	}
+	if got := ns.fibIndexForIfIndex(20); got != nsFib {
+		t.Errorf("former member fib %d, want namespace fib %d", got, nsFib)
+	}
+
+	// Fib index of deleted vrf is reused.
+	if err := ns.vrfIfInfoMsg(vrfLinkMsg(netlink.RTM_NEWLINK, 12, "green", 1003)); err != nil {
+		t.Fatal(err)
+	}
+	if got := ns.vrf_by_ifindex[12].fibIndex; got != fi {
+		t.Errorf("new vrf fib %d, want reused %d", got, fi)
+	}
+}